@@ -22,6 +22,9 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize database
 	pool, err := db.NewPool(cfg.Database.DSN())
@@ -30,11 +33,29 @@ func main() {
 	}
 	defer pool.Close()
 
+	// Envelope encryption of node credentials at rest
+	secrets, err := repository.NewSecretBox(cfg.Encryption.Keys(), cfg.Encryption.KeyVersion)
+	if err != nil {
+		log.Fatalf("Failed to initialize encryption keys: %v", err)
+	}
+
 	// Initialize repositories
-	hostingRepo := repository.NewHostingProvisionRepository(pool)
+	hostingRepo := repository.NewHostingProvisionRepository(pool, secrets)
 	vpnRepo := repository.NewVPNProvisionRepository(pool)
 	regionRepo := repository.NewRegionRepository(pool)
+	snapshotRepo := repository.NewNodeSnapshotRepository(pool, secrets)
+	ipChangeRepo := repository.NewNodeIPChangeRepository(pool)
+	probeRepo := repository.NewNodeProbeRepository(pool)
+	replacementRepo := repository.NewNodeReplacementRepository(pool)
+	webhookEventRepo := repository.NewWebhookEventRepository(pool)
+	nodeEventRepo := repository.NewNodeEventRepository(pool)
+	warmNodeRepo := repository.NewWarmNodeRepository(pool)
 	logRepo := repository.NewLogRepository(pool)
+	trialAttemptRepo := repository.NewTrialAttemptRepository(pool)
+	voucherRepo := repository.NewVoucherRepository(pool)
+	grantRepo := repository.NewEntitlementGrantRepository(pool)
+	topupRepo := repository.NewTrafficTopUpRepository(pool)
+	cycleRepo := repository.NewTrafficCycleRepository(pool)
 
 	// Initialize clients
 	hostingClient := client.NewHostingClient(
@@ -50,43 +71,162 @@ func main() {
 	otunClient := client.NewOTunClient(cfg.Services.OTunManagerURL, cfg.InternalSecret)
 
 	// Initialize services
+	// 节点创建并发控制：所有 CreateNode 调用按优先级排队
+	createQueue := service.NewNodeCreateQueue(cfg.CreateQueue)
+
+	// 节点就绪由 hosting-service 推送驱动；未配置 webhook 时退回 5 秒轮询
+	readyPoll := 5 * time.Second
+	if cfg.Hosting.WebhookSecret != "" {
+		readyPoll = time.Duration(cfg.Hosting.ReadyPollSeconds) * time.Second
+	}
+	nodeEvents := service.NewNodeEventHub(hostingClient, nodeEventRepo, readyPoll)
+
+	warmPoolService := service.NewWarmPoolService(cfg, warmNodeRepo, hostingClient, createQueue, nodeEvents)
+
 	provisionService := service.NewProvisionService(
 		cfg,
 		hostingRepo,
 		regionRepo,
+		snapshotRepo,
+		ipChangeRepo,
+		replacementRepo,
+		webhookEventRepo,
 		logRepo,
 		hostingClient,
 		subscriptionClient,
+		warmPoolService,
+		createQueue,
+		nodeEvents,
 	)
 
+	// 权益账本：所有 VPN 限额变更都经由账本汇总后再推送到 otun-manager
+	entitlementLedger := service.NewEntitlementLedger(grantRepo, vpnRepo, otunClient)
+
 	vpnService := service.NewVPNService(
 		cfg,
 		vpnRepo,
+		topupRepo,
+		cycleRepo,
 		logRepo,
+		entitlementLedger,
 		otunClient,
 		subscriptionClient,
 	)
 
+	trialEligibility := service.NewTrialEligibilityEngine(cfg, trialAttemptRepo)
+
 	entitlementService := service.NewEntitlementService(
 		cfg,
 		vpnRepo,
+		logRepo,
+		voucherRepo,
+		entitlementLedger,
 		otunClient,
+		subscriptionClient,
+		trialEligibility,
+	)
+
+	// 节点可达性探测：VLESS/SS 端口 TCP 握手 + 节点 agent /health
+	probeTimeout := time.Duration(cfg.Probe.TimeoutSeconds) * time.Second
+	nodeHealthService := service.NewNodeHealthService(
+		cfg,
+		hostingRepo,
+		probeRepo,
+		logRepo,
+		service.NewVlessTCPProber(probeTimeout),
+		service.NewSSTCPProber(probeTimeout),
+		service.NewAgentHealthProber(probeTimeout),
 	)
 
 	// Initialize CleanupScheduler (后台兜底清理失败的 VPS 实例)
 	cleanupScheduler := service.NewCleanupScheduler(
 		hostingRepo,
 		hostingClient,
+		provisionService,
+		warmPoolService,
 		1*time.Hour,  // 每小时运行一次
 		24*time.Hour, // 清理创建超过 24 小时的失败节点
 	)
 
+	// Start NodeEventHub listener (接收其他副本转发的节点事件)
+	nodeEventsCtx, nodeEventsCancel := context.WithCancel(context.Background())
+	go nodeEvents.Start(nodeEventsCtx)
+
 	// Start CleanupScheduler in background
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
 	go cleanupScheduler.Start(cleanupCtx)
 
+	// Start SuspensionScheduler (宽限期过后删除暂停的节点)
+	suspensionCtx, suspensionCancel := context.WithCancel(context.Background())
+	suspensionScheduler := service.NewSuspensionScheduler(provisionService, 10*time.Minute)
+	go suspensionScheduler.Start(suspensionCtx)
+
+	// Start TrafficCycleScheduler (长周期套餐按月重置流量)
+	cycleCtx, cycleCancel := context.WithCancel(context.Background())
+	if cfg.TrafficCycle.Enabled {
+		trafficCycleScheduler := service.NewTrafficCycleScheduler(
+			vpnRepo,
+			vpnService,
+			time.Duration(cfg.TrafficCycle.CheckInterval)*time.Minute,
+		)
+		go trafficCycleScheduler.Start(cycleCtx)
+	}
+
+	// Start VPNPauseScheduler (暂停达到最长天数后自动恢复)
+	pauseCtx, pauseCancel := context.WithCancel(context.Background())
+	if cfg.Pause.Enabled {
+		pauseScheduler := service.NewVPNPauseScheduler(
+			vpnRepo,
+			vpnService,
+			time.Duration(cfg.Pause.CheckInterval)*time.Minute,
+		)
+		go pauseScheduler.Start(pauseCtx)
+	}
+
+	// Start ProbeScheduler (节点可达性探测)
+	probeCtx, probeCancel := context.WithCancel(context.Background())
+	if cfg.Probe.Enabled {
+		probeScheduler := service.NewProbeScheduler(
+			nodeHealthService,
+			time.Duration(cfg.Probe.Interval)*time.Minute,
+		)
+		go probeScheduler.Start(probeCtx)
+	}
+
+	// Start AutoHealScheduler (替换持续不健康的节点)
+	healCtx, healCancel := context.WithCancel(context.Background())
+	if cfg.AutoHeal.Enabled {
+		autoHealScheduler := service.NewAutoHealScheduler(
+			cfg.AutoHeal,
+			hostingRepo,
+			replacementRepo,
+			hostingClient,
+			provisionService,
+		)
+		go autoHealScheduler.Start(healCtx)
+	}
+
+	// Start WarmPoolScheduler (补充预热节点池)
+	warmCtx, warmCancel := context.WithCancel(context.Background())
+	if cfg.WarmPool.Enabled {
+		warmPoolScheduler := service.NewWarmPoolScheduler(
+			warmPoolService,
+			time.Duration(cfg.WarmPool.CheckInterval)*time.Minute,
+		)
+		go warmPoolScheduler.Start(warmCtx)
+	}
+
+	// Start SecretReencryptScheduler (明文及旧密钥加密的节点凭据重新加密)
+	reencryptCtx, reencryptCancel := context.WithCancel(context.Background())
+	reencryptScheduler := service.NewSecretReencryptScheduler(
+		hostingRepo,
+		snapshotRepo,
+		time.Duration(cfg.Encryption.ReencryptMinutes)*time.Minute,
+	)
+	go reencryptScheduler.Start(reencryptCtx)
+
 	// Initialize HTTP server
-	server := http.NewServer(cfg, pool, provisionService, vpnService, entitlementService)
+	server := http.NewServer(cfg, pool, provisionService, vpnService, entitlementService, nodeHealthService)
 
 	// Start server in goroutine
 	go func() {
@@ -103,7 +243,15 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
-	cleanupCancel() // 停止 CleanupScheduler
+	nodeEventsCancel() // 停止 NodeEventHub 监听
+	cleanupCancel()    // 停止 CleanupScheduler
+	suspensionCancel() // 停止 SuspensionScheduler
+	cycleCancel()      // 停止 TrafficCycleScheduler
+	pauseCancel()      // 停止 VPNPauseScheduler
+	probeCancel()      // 停止 ProbeScheduler
+	healCancel()       // 停止 AutoHealScheduler
+	warmCancel()       // 停止 WarmPoolScheduler
+	reencryptCancel()  // 停止 SecretReencryptScheduler
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
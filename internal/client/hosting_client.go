@@ -36,6 +36,9 @@ type CreateNodeRequest struct {
 	BundleID       string `json:"bundle_id,omitempty"`       // nano_3_0, small_3_0, etc.
 	SubscriptionID string `json:"subscription_id,omitempty"` // 对账单 ID（hosting-service 要求 fulfillment 必填）
 	UserID         string `json:"user_id,omitempty"`         // 用户 ID（hosting-service 要求 fulfillment 必填）
+	SnapshotID     string `json:"snapshot_id,omitempty"`     // 从快照启动（恢复之前删除的节点）
+	ReuseKeysFrom  string `json:"reuse_keys_from,omitempty"` // 沿用该节点的 Reality 密钥和 API Key（替换故障节点）
+	CallbackToken  string `json:"callback_token,omitempty"`  // 节点 agent 回调签名密钥（按 provision 生成）
 }
 
 // CreateNodeResponse is the response from creating a node
@@ -62,6 +65,14 @@ type NodeInfo struct {
 	CreatedAt     string `json:"created_at"`
 }
 
+// NodeEvent is a node status change pushed by hosting-service to the fulfillment webhook
+type NodeEvent struct {
+	EventID    string   `json:"event_id"`
+	Event      string   `json:"event"` // node.status_changed
+	OccurredAt string   `json:"occurred_at"`
+	Node       NodeInfo `json:"node"`
+}
+
 // DeleteNodeResponse is the response from deleting a node
 type DeleteNodeResponse struct {
 	NodeID  string `json:"node_id"`
@@ -300,3 +311,212 @@ func (c *HostingClient) WaitForNodeReady(ctx context.Context, nodeID string, max
 
 	return nil, fmt.Errorf("timeout waiting for node to be ready")
 }
+
+// RotateCredentialsRequest is the request to regenerate node secrets
+type RotateCredentialsRequest struct {
+	// 旧 APIKey 在节点上继续有效的秒数（重叠窗口）
+	OldKeyTTLSeconds int `json:"old_key_ttl_seconds"`
+}
+
+// RotateNodeCredentials asks hosting-service (via node agent) to regenerate
+// the node API key and Reality key pair / short id. Returns the updated node.
+func (c *HostingClient) RotateNodeCredentials(ctx context.Context, nodeID string, req *RotateCredentialsRequest) (*NodeInfo, error) {
+	log.Printf("[HostingClient] Rotating credentials for node: %s", nodeID)
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/admin/nodes/"+nodeID+"/rotate-credentials", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Admin-Key", c.adminKey)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hosting-service returned status %d", resp.StatusCode)
+	}
+
+	var result NodeInfo
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	log.Printf("[HostingClient] Credentials rotated for node: %s", nodeID)
+	return &result, nil
+}
+
+// AssignNodeRequest transfers a node to a subscription/user
+type AssignNodeRequest struct {
+	SubscriptionID string `json:"subscription_id"`
+	UserID         string `json:"user_id"`
+	CallbackToken  string `json:"callback_token,omitempty"` // 新归属 provision 的回调签名密钥
+}
+
+// AssignNode re-assigns an unassigned (warm pool) node to its new owner
+func (c *HostingClient) AssignNode(ctx context.Context, nodeID string, req *AssignNodeRequest) error {
+	log.Printf("[HostingClient] Assigning node %s to user %s", nodeID, req.UserID)
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/admin/nodes/"+nodeID+"/assign", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Admin-Key", c.adminKey)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("hosting-service returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// StopNode stops (powers off) a node without deleting it; the instance and
+// its static IP are kept so the node can be started again
+func (c *HostingClient) StopNode(ctx context.Context, nodeID string) (*NodeInfo, error) {
+	return c.nodeAction(ctx, nodeID, "stop")
+}
+
+// StartNode starts a stopped node
+func (c *HostingClient) StartNode(ctx context.Context, nodeID string) (*NodeInfo, error) {
+	return c.nodeAction(ctx, nodeID, "start")
+}
+
+// RebootNode reboots a running node in place
+func (c *HostingClient) RebootNode(ctx context.Context, nodeID string) (*NodeInfo, error) {
+	return c.nodeAction(ctx, nodeID, "reboot")
+}
+
+// ChangeNodeIP allocates a new public IP for a node (e.g. attaches a new
+// Lightsail static IP and releases the old one); keys and config are kept
+func (c *HostingClient) ChangeNodeIP(ctx context.Context, nodeID string) (*NodeInfo, error) {
+	return c.nodeAction(ctx, nodeID, "change-ip")
+}
+
+// nodeAction calls POST /api/admin/nodes/:id/<action> and returns the updated node
+func (c *HostingClient) nodeAction(ctx context.Context, nodeID, action string) (*NodeInfo, error) {
+	log.Printf("[HostingClient] Node action %s: %s", action, nodeID)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/admin/nodes/"+nodeID+"/"+action, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-Admin-Key", c.adminKey)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hosting-service returned status %d", resp.StatusCode)
+	}
+
+	var result NodeInfo
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// SnapshotInfo describes a node snapshot in hosting-service
+type SnapshotInfo struct {
+	SnapshotID string `json:"snapshot_id"`
+	NodeID     string `json:"node_id"`
+	Status     string `json:"status"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// CreateSnapshot snapshots a node (disk and node-agent config) before deletion
+func (c *HostingClient) CreateSnapshot(ctx context.Context, nodeID string) (*SnapshotInfo, error) {
+	log.Printf("[HostingClient] Creating snapshot for node: %s", nodeID)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/admin/nodes/"+nodeID+"/snapshots", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-Admin-Key", c.adminKey)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("hosting-service returned status %d", resp.StatusCode)
+	}
+
+	var result SnapshotInfo
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	log.Printf("[HostingClient] Snapshot created: %s (node: %s)", result.SnapshotID, nodeID)
+	return &result, nil
+}
+
+// DeleteSnapshot deletes a snapshot by ID
+func (c *HostingClient) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	log.Printf("[HostingClient] Deleting snapshot: %s", snapshotID)
+
+	httpReq, err := http.NewRequestWithContext(ctx, "DELETE", c.baseURL+"/api/admin/snapshots/"+snapshotID, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	httpReq.Header.Set("X-Admin-Key", c.adminKey)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 已经不存在的快照视为删除成功
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("hosting-service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
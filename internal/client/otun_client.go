@@ -57,7 +57,7 @@ type CreateVPNUserResponse struct {
 // UpdateVPNUserRequest is the request to update a VPN user
 type UpdateVPNUserRequest struct {
 	TrafficLimit int64   `json:"traffic_limit,omitempty"`
-	TrafficUsed  int64   `json:"traffic_used,omitempty"`
+	TrafficUsed  *int64  `json:"traffic_used,omitempty"` // 指针：需要能显式重置为 0
 	ExpireAt     string  `json:"expire_at,omitempty"`
 	Enabled      *bool   `json:"enabled,omitempty"`
 	Email        *string `json:"email,omitempty"`
@@ -240,6 +240,13 @@ func (c *OTunClient) EnableUser(ctx context.Context, uuid string) error {
 	return c.UpdateUser(ctx, uuid, &UpdateVPNUserRequest{Enabled: &enabled})
 }
 
+// ResetTrafficUsed resets a VPN user's traffic counter (start of a new traffic cycle)
+func (c *OTunClient) ResetTrafficUsed(ctx context.Context, uuid string) error {
+	log.Printf("[OTunClient] Resetting traffic for VPN user: %s", uuid)
+	zero := int64(0)
+	return c.UpdateUser(ctx, uuid, &UpdateVPNUserRequest{TrafficUsed: &zero})
+}
+
 // DeleteUser deletes a VPN user
 func (c *OTunClient) DeleteUser(ctx context.Context, uuid string) error {
 	log.Printf("[OTunClient] Deleting VPN user: %s", uuid)
@@ -106,6 +106,41 @@ func (c *SubscriptionClient) NotifyDeleted(ctx context.Context, subscriptionID,
 	})
 }
 
+// NotifySuspended notifies that the node has been stopped after the subscription lapsed
+// 宽限期内订阅恢复则节点恢复，否则 until 之后删除
+func (c *SubscriptionClient) NotifySuspended(ctx context.Context, subscriptionID, resourceID string, until time.Time) error {
+	return c.NotifyResourceStatus(ctx, &models.SubscriptionCallback{
+		SubscriptionID: subscriptionID,
+		App:            "obox",
+		Status:         models.StatusStopped,
+		Reason:         "suspended",
+		Message:        fmt.Sprintf("Resource %s suspended, will be deleted after %s", resourceID, until.Format(time.RFC3339)),
+	})
+}
+
+// NotifyResumed notifies that a suspended node is running again
+func (c *SubscriptionClient) NotifyResumed(ctx context.Context, subscriptionID, resourceID string) error {
+	return c.NotifyResourceStatus(ctx, &models.SubscriptionCallback{
+		SubscriptionID: subscriptionID,
+		App:            "obox",
+		Status:         models.StatusActive,
+		Reason:         "resumed",
+		Message:        fmt.Sprintf("Resource %s resumed", resourceID),
+	})
+}
+
+// NotifyCredentialsRotated notifies that node credentials have been regenerated
+// subscription-service 据此刷新缓存的节点配置并通知客户端重新拉取
+func (c *SubscriptionClient) NotifyCredentialsRotated(ctx context.Context, subscriptionID, resourceID string) error {
+	return c.NotifyResourceStatus(ctx, &models.SubscriptionCallback{
+		SubscriptionID: subscriptionID,
+		App:            "obox",
+		Status:         models.StatusActive,
+		Reason:         "credentials_rotated",
+		Message:        fmt.Sprintf("Resource %s credentials rotated", resourceID),
+	})
+}
+
 // NotifyVPNActive notifies that VPN user is active
 func (c *SubscriptionClient) NotifyVPNActive(ctx context.Context, subscriptionID, resourceID string) error {
 	return c.NotifyResourceStatus(ctx, &models.SubscriptionCallback{
@@ -136,6 +171,32 @@ func (c *SubscriptionClient) NotifyVPNDeleted(ctx context.Context, subscriptionI
 	})
 }
 
+// NotifyVPNRevoked notifies that a VPN entitlement has been revoked by an admin
+// refundType 和 reason 放在 metadata 中透传给 subscription-service，用于决定是否发起退款
+// userActive 表示撤销后用户仍由其他权益覆盖（VPN 继续可用），此时上报 active 而不是 deleted
+func (c *SubscriptionClient) NotifyVPNRevoked(ctx context.Context, subscriptionID, resourceID, reason, refundType, fallbackID string, userActive bool) error {
+	status := models.StatusDeleted
+	if userActive {
+		status = models.StatusActive
+	}
+	metadata := map[string]string{
+		"resource_id":   resourceID,
+		"refund_type":   refundType,
+		"revoke_reason": reason,
+	}
+	if fallbackID != "" {
+		metadata["fallback_entitlement_id"] = fallbackID
+	}
+	return c.NotifyResourceStatus(ctx, &models.SubscriptionCallback{
+		SubscriptionID: subscriptionID,
+		App:            "otun",
+		Status:         status,
+		Reason:         "entitlement_revoked",
+		Message:        fmt.Sprintf("VPN resource %s revoked", resourceID),
+		Metadata:       metadata,
+	})
+}
+
 // SubscriptionStatusResponse is the response from subscription-service
 type SubscriptionStatusResponse struct {
 	HasActive      bool   `json:"has_active"`
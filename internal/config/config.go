@@ -1,10 +1,15 @@
 package config
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // 不安全的默认值列表 (生产环境不应使用)
@@ -24,18 +29,186 @@ type Config struct {
 	Encryption     EncryptionConfig
 	Services       ServicesConfig
 	InternalSecret string
+	InternalAuth   InternalAuthConfig
 	Trial          TrialConfig
+	TopUp          TopUpConfig
+	Store          StoreConfig
+	TrafficCycle   TrafficCycleConfig
+	Pause          PauseConfig
+	Probe          ProbeConfig
+	AutoHeal       AutoHealConfig
+	WarmPool       WarmPoolConfig
+	CreateQueue    CreateQueueConfig
+	RateLimit      RateLimitConfig
+}
+
+// InternalAuthConfig 内部 API 调用方凭据
+type InternalAuthConfig struct {
+	Credentials  []InternalCredential // 来自 INTERNAL_CREDENTIALS_FILE
+	LegacySecret bool                 // 已废弃：仍接受共享 INTERNAL_SECRET（视为拥有全部 scope），默认关闭
+
+	credentialsErr error // 凭据文件读取或解析失败，由 Validate 报告
+}
+
+// InternalCredential is one key of an internal API caller
+// 轮换时为同一 caller 添加新 key，并给旧 key 设置 expires_at，过渡期内两个 key 同时有效
+type InternalCredential struct {
+	CallerID  string     `json:"caller_id"`
+	KeySHA256 string     `json:"key_sha256"` // hex(SHA-256(key))，不保存明文
+	Scopes    []string   `json:"scopes"`     // "*" 表示全部
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type TrialConfig struct {
 	Enabled       bool
 	DurationHours int
 	TrafficGB     int
+
+	// 试用资格评估
+	DisposableDomainsFile string
+	ReviewScore           int // 评分达到此值需人工复核
+	DenyScore             int // 评分达到此值直接拒绝
+	OverrideDays          int // 管理员复核结果的默认有效天数
+}
+
+// TopUpConfig 流量加油包规则
+type TopUpConfig struct {
+	CarryOver    bool // true: 未用完的加油包跨周期保留；false: 随当前周期到期
+	ValidityDays int  // CarryOver 时加油包的最长有效天数
+}
+
+// StoreConfig Apple/Google 订阅到期规则
+type StoreConfig struct {
+	ExpiryGraceHours int // 商店到期后保留的宽限时间，覆盖续订 webhook 延迟
+}
+
+// TrafficCycleConfig 长周期套餐的流量重置规则
+type TrafficCycleConfig struct {
+	Enabled       bool
+	Months        int // 每个流量周期的月数
+	MinPlanDays   int // 套餐时长超过此天数才按周期重置
+	CheckInterval int // 调度器检查间隔（分钟）
+}
+
+// PauseConfig VPN 套餐暂停规则
+type PauseConfig struct {
+	Enabled       bool
+	Limits        map[string]PauseLimit // 按 plan_tier，"default" 为兜底
+	CheckInterval int                   // 自动恢复检查间隔（分钟）
+}
+
+// PauseLimit 单个 provision 的暂停上限
+type PauseLimit struct {
+	MaxCount int // 最多暂停次数
+	MaxDays  int // 累计最多暂停天数
+}
+
+// LimitFor returns the pause limit of a plan tier, falling back to "default"
+func (c PauseConfig) LimitFor(planTier string) PauseLimit {
+	if l, ok := c.Limits[planTier]; ok {
+		return l
+	}
+	return c.Limits["default"]
+}
+
+// ProbeConfig 节点可达性探测
+type ProbeConfig struct {
+	Enabled          bool
+	Interval         int // 探测间隔（分钟）
+	TimeoutSeconds   int // 单项检查超时
+	FailureThreshold int // 连续失败多少轮标记 degraded / blocked
+	Concurrency      int // 同时探测的节点数
+	RetentionDays    int // 探测结果保留天数
+}
+
+// AutoHealConfig 不健康节点自动替换规则
+type AutoHealConfig struct {
+	Enabled             bool
+	UnhealthyMinutes    int // degraded 持续多久后替换
+	CheckInterval       int // 调度器检查间隔（分钟）
+	MaxPerHour          int // 熔断：每小时最多替换的节点数
+	MaxUnhealthyPercent int // 熔断：degraded 节点占比达到此值视为云厂商故障，暂停替换
+	MinNodesForPercent  int // 节点数少于此值时不按占比熔断
+}
+
+// WarmPoolConfig 预创建节点池规则
+type WarmPoolConfig struct {
+	Enabled       bool
+	Pools         []WarmPoolTarget
+	PeakStartHour int // 高峰时段（UTC 小时，含），使用 Peak 目标
+	PeakEndHour   int // 高峰时段结束（UTC 小时，不含）
+	CheckInterval int // 补充检查间隔（分钟）
+	CreateTimeout int // 节点停留在 creating 超过该分钟数视为失败（进程重启等导致创建中断）
+
+	// 成本上限
+	MaxNodes         int                // 池中节点总数上限（creating + ready）
+	MonthlyBudgetUSD int                // 当月空闲成本上限，0 表示不限
+	BundleHourlyCost map[string]float64 // 各规格每小时成本（USD）
+}
+
+// WarmPoolTarget is the desired number of ready nodes of one region and bundle
+type WarmPoolTarget struct {
+	Region   string
+	BundleID string
+	OffPeak  int
+	Peak     int
+}
+
+// TargetAt returns the pool size target at the given time
+func (c WarmPoolConfig) TargetAt(t WarmPoolTarget, now time.Time) int {
+	hour := now.UTC().Hour()
+	peak := hour >= c.PeakStartHour && hour < c.PeakEndHour
+	if c.PeakStartHour > c.PeakEndHour {
+		// 跨零点，如 20-4
+		peak = hour >= c.PeakStartHour || hour < c.PeakEndHour
+	}
+	if peak {
+		return t.Peak
+	}
+	return t.OffPeak
+}
+
+// CreateQueueConfig 节点创建并发控制（调用 hosting-service CreateNode 到节点就绪）
+// 队列在进程内，各上限为所有副本合计，按 Replicas 平分到每个进程
+type CreateQueueConfig struct {
+	MaxConcurrent      int            // 全局同时创建的节点数
+	ProviderLimits     map[string]int // 按云厂商的并发上限，未配置的云厂商只受全局限制
+	RegionLimits       map[string]int // 按区域的并发上限
+	DefaultRegionLimit int            // 未单独配置的区域的并发上限，0 表示不限
+	EstimateSeconds    int            // 尚无完成记录时估算排队时间使用的单个节点创建耗时
+	Replicas           int            // 运行的 fulfillment-service 副本数
+	SlotHoldSeconds    int            // 单个创建最长占用名额的时间，之后即使节点尚未就绪也归还
+}
+
+// RegionLimit returns the concurrency limit of a region, 0 meaning unlimited
+func (c CreateQueueConfig) RegionLimit(region string) int {
+	if l, ok := c.RegionLimits[region]; ok {
+		return l
+	}
+	return c.DefaultRegionLimit
+}
+
+// RateLimitConfig 速率限制
+type RateLimitConfig struct {
+	Backend  string                     // memory（单副本）/ postgres（多副本共享计数）
+	Policies map[string]RateLimitPolicy // 按路由策略名
+}
+
+// RateLimitPolicy allows Limit requests per Window for each key
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+	KeyBy  string // user（无用户时按 IP）/ ip / caller
 }
 
+// defaultRateLimitPolicies 未在 RATE_LIMIT_POLICIES 中覆盖的策略使用的默认值
+const defaultRateLimitPolicies = "user:30:1m:user,create:5:1h:user,rotate:3:1h:user," +
+	"node_reboot:6:1h:user,node_stop:3:1h:user,node_start:3:1h:user"
+
 type ServerConfig struct {
-	Port string
-	Mode string
+	Port           string
+	Mode           string
+	TrustedProxies []string // 可信反向代理的 IP/CIDR，只信任这些地址传来的 X-Forwarded-For；为空时按连接地址取客户端 IP
 }
 
 type DatabaseConfig struct {
@@ -49,7 +222,24 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	SecretKey string
+	SecretKey         string   // HS* 共享密钥（与 auth-service 相同）
+	Algorithms        []string // 允许的签名算法，其余一律拒绝
+	JWKSURL           string   // RS*/ES* 公钥来源：JWKS 端点
+	PublicKeyFile     string   // RS*/ES* 公钥来源：本地 PEM 或 JWKS 文件
+	Issuer            string   // 非空时校验 iss
+	Audience          string   // 非空时校验 aud
+	ClockSkewSeconds  int      // exp/nbf/iat 容忍的时钟偏差
+	KeyRefreshMinutes int      // 公钥缓存刷新间隔
+}
+
+// UsesHMAC reports whether a shared-secret algorithm is allowed
+func (c JWTConfig) UsesHMAC() bool {
+	return slices.ContainsFunc(c.Algorithms, func(alg string) bool { return strings.HasPrefix(alg, "HS") })
+}
+
+// UsesPublicKeys reports whether an RSA or ECDSA algorithm is allowed
+func (c JWTConfig) UsesPublicKeys() bool {
+	return slices.ContainsFunc(c.Algorithms, func(alg string) bool { return !strings.HasPrefix(alg, "HS") })
 }
 
 type HostingConfig struct {
@@ -57,16 +247,69 @@ type HostingConfig struct {
 	AdminKey      string
 	CloudProvider string
 	DefaultRegion string
+
+	// 订阅失效后节点停机保留的小时数，0 表示立即删除
+	SuspendGraceHours int
+
+	// 删除前快照（可选），保留期内重新创建节点时从快照恢复
+	SnapshotOnDelete      bool
+	SnapshotRetentionDays int
+
+	// 每月可更换公网 IP 的次数，按 plan_tier，"default" 为兜底
+	IPChangeLimits map[string]int
+
+	// 创建失败（容量/配额/超时等）时依次尝试的备选区域，按首选区域配置
+	RegionFallbacks     map[string][]RegionFallback
+	FailoverMaxAttempts int // 包含首选区域在内的最多尝试次数，1 表示不切换
+
+	// hosting-service 推送节点状态变更的 webhook 签名密钥，为空时不启用推送，仅轮询
+	WebhookSecret    string
+	ReadyPollSeconds int // 启用推送后兜底轮询 GetNode 的间隔（秒）
+}
+
+// RegionFallback is an alternate placement; empty Provider means the default cloud provider
+type RegionFallback struct {
+	Provider string
+	Region   string
+}
+
+// IPChangeLimitFor returns the monthly IP change quota of a plan tier, falling back to "default"
+func (c HostingConfig) IPChangeLimitFor(planTier string) int {
+	if l, ok := c.IPChangeLimits[planTier]; ok {
+		return l
+	}
+	return c.IPChangeLimits["default"]
 }
 
 type NodeConfig struct {
 	APIPort   int
 	VlessPort int
 	SSPort    int
+
+	// 凭据轮换后旧 APIKey 的保留时长（分钟）
+	CredentialOverlapMinutes int
+
+	// 已废弃：允许节点回调使用共享 INTERNAL_SECRET（旧版 agent），全部升级为签名回调后关闭
+	LegacyCallbackAuth bool
 }
 
 type EncryptionConfig struct {
-	Key string
+	Key              string         // 当前主密钥（32 字节），加密新写入的节点凭据
+	KeyVersion       int            // 当前主密钥版本，写入密文前缀
+	OldKeys          map[int]string // 轮换前的主密钥，仅用于解密，重新加密完成后移除
+	ReencryptMinutes int            // 后台重新加密（明文或旧版本密钥）的检查间隔
+}
+
+// Keys returns all configured master keys by version
+func (c EncryptionConfig) Keys() map[int][]byte {
+	keys := make(map[int][]byte, len(c.OldKeys)+1)
+	for version, key := range c.OldKeys {
+		keys[version] = []byte(key)
+	}
+	if c.Key != "" {
+		keys[c.KeyVersion] = []byte(c.Key)
+	}
+	return keys
 }
 
 type ServicesConfig struct {
@@ -78,8 +321,9 @@ type ServicesConfig struct {
 func Load() *Config {
 	cfg := &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8014"),
-			Mode: getEnv("GIN_MODE", "release"), // 默认为 release 模式
+			Port:           getEnv("SERVER_PORT", "8014"),
+			Mode:           getEnv("GIN_MODE", "release"), // 默认为 release 模式
+			TrustedProxies: parseList(getEnv("TRUSTED_PROXIES", "")),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -91,21 +335,48 @@ func Load() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			SecretKey: getEnv("JWT_SECRET_KEY", ""),
+			SecretKey:         getEnv("JWT_SECRET_KEY", ""),
+			Algorithms:        parseJWTAlgorithms(getEnv("JWT_ALGORITHMS", "HS256")),
+			JWKSURL:           getEnv("JWT_JWKS_URL", ""),
+			PublicKeyFile:     getEnv("JWT_PUBLIC_KEY_FILE", ""),
+			Issuer:            getEnv("JWT_ISSUER", ""),
+			Audience:          getEnv("JWT_AUDIENCE", ""),
+			ClockSkewSeconds:  getEnvInt("JWT_CLOCK_SKEW_SECONDS", 30),
+			KeyRefreshMinutes: getEnvInt("JWT_KEY_REFRESH_MINUTES", 60),
 		},
 		Hosting: HostingConfig{
 			ServiceURL:    getEnv("HOSTING_SERVICE_URL", "http://localhost:8023"),
 			AdminKey:      getEnv("HOSTING_ADMIN_KEY", ""),
 			CloudProvider: getEnv("HOSTING_CLOUD_PROVIDER", "lightsail"),
 			DefaultRegion: getEnv("HOSTING_DEFAULT_REGION", "us-east-1"),
+
+			SuspendGraceHours: getEnvInt("HOSTING_SUSPEND_GRACE_HOURS", 72),
+
+			SnapshotOnDelete:      getEnv("HOSTING_SNAPSHOT_ON_DELETE", "false") == "true",
+			SnapshotRetentionDays: getEnvInt("HOSTING_SNAPSHOT_RETENTION_DAYS", 7),
+
+			IPChangeLimits: parseIntMap("HOSTING_IP_CHANGE_LIMITS", getEnv("HOSTING_IP_CHANGE_LIMITS", "default:1,premium:3,unlimited:5")),
+
+			RegionFallbacks:     parseRegionFallbacks(getEnv("HOSTING_REGION_FALLBACKS", "")),
+			FailoverMaxAttempts: getEnvInt("HOSTING_FAILOVER_MAX_ATTEMPTS", 3),
+
+			WebhookSecret:    getEnv("HOSTING_WEBHOOK_SECRET", ""),
+			ReadyPollSeconds: getEnvInt("HOSTING_READY_POLL_SECONDS", 60),
 		},
 		Node: NodeConfig{
 			APIPort:   getEnvInt("NODE_API_PORT", 8080),
 			VlessPort: getEnvInt("NODE_VLESS_PORT", 443),
 			SSPort:    getEnvInt("NODE_SS_PORT", 8388),
+
+			CredentialOverlapMinutes: getEnvInt("NODE_CREDENTIAL_OVERLAP_MINUTES", 10),
+
+			LegacyCallbackAuth: getEnv("NODE_CALLBACK_LEGACY_AUTH", "false") == "true",
 		},
 		Encryption: EncryptionConfig{
-			Key: getEnv("ENCRYPTION_KEY", ""),
+			Key:              getEnv("ENCRYPTION_KEY", ""),
+			KeyVersion:       getEnvInt("ENCRYPTION_KEY_VERSION", 1),
+			OldKeys:          parseEncryptionKeys(getEnv("ENCRYPTION_OLD_KEYS", "")),
+			ReencryptMinutes: getEnvInt("ENCRYPTION_REENCRYPT_MINUTES", 60),
 		},
 		Services: ServicesConfig{
 			SubscriptionServiceURL: getEnv("SUBSCRIPTION_SERVICE_URL", "http://localhost:8012"),
@@ -113,12 +384,80 @@ func Load() *Config {
 			OTunManagerURL:         getEnv("OTUN_MANAGER_URL", "http://localhost:8022"),
 		},
 		InternalSecret: getEnv("INTERNAL_SECRET", ""),
+		InternalAuth: InternalAuthConfig{
+			LegacySecret: getEnv("INTERNAL_AUTH_LEGACY_SECRET", "false") == "true",
+		},
 		Trial: TrialConfig{
 			Enabled:       getEnv("TRIAL_ENABLED", "true") == "true",
 			DurationHours: getEnvInt("TRIAL_DURATION_HOURS", 1),
 			TrafficGB:     getEnvInt("TRIAL_TRAFFIC_GB", 1),
+
+			DisposableDomainsFile: getEnv("TRIAL_DISPOSABLE_DOMAINS_FILE", "data/disposable_domains.txt"),
+			ReviewScore:           getEnvInt("TRIAL_REVIEW_SCORE", 40),
+			DenyScore:             getEnvInt("TRIAL_DENY_SCORE", 100),
+			OverrideDays:          getEnvInt("TRIAL_OVERRIDE_DAYS", 30),
+		},
+		TopUp: TopUpConfig{
+			CarryOver:    getEnv("TOPUP_CARRY_OVER", "true") == "true",
+			ValidityDays: getEnvInt("TOPUP_VALIDITY_DAYS", 365),
+		},
+		Store: StoreConfig{
+			ExpiryGraceHours: getEnvInt("STORE_EXPIRY_GRACE_HOURS", 24),
+		},
+		TrafficCycle: TrafficCycleConfig{
+			Enabled:       getEnv("TRAFFIC_CYCLE_ENABLED", "true") == "true",
+			Months:        getEnvInt("TRAFFIC_CYCLE_MONTHS", 1),
+			MinPlanDays:   getEnvInt("TRAFFIC_CYCLE_MIN_PLAN_DAYS", 35),
+			CheckInterval: getEnvInt("TRAFFIC_CYCLE_CHECK_MINUTES", 15),
+		},
+		Pause: PauseConfig{
+			Enabled:       getEnv("VPN_PAUSE_ENABLED", "true") == "true",
+			Limits:        parsePauseLimits(getEnv("VPN_PAUSE_LIMITS", "default:1:14,premium:2:30,unlimited:3:60")),
+			CheckInterval: getEnvInt("VPN_PAUSE_CHECK_MINUTES", 15),
+		},
+		Probe: ProbeConfig{
+			Enabled:          getEnv("NODE_PROBE_ENABLED", "true") == "true",
+			Interval:         getEnvInt("NODE_PROBE_INTERVAL_MINUTES", 5),
+			TimeoutSeconds:   getEnvInt("NODE_PROBE_TIMEOUT_SECONDS", 5),
+			FailureThreshold: getEnvInt("NODE_PROBE_FAILURE_THRESHOLD", 3),
+			Concurrency:      getEnvInt("NODE_PROBE_CONCURRENCY", 10),
+			RetentionDays:    getEnvInt("NODE_PROBE_RETENTION_DAYS", 14),
+		},
+		WarmPool: WarmPoolConfig{
+			Enabled:       getEnv("WARM_POOL_ENABLED", "false") == "true",
+			Pools:         parseWarmPoolTargets(getEnv("WARM_POOL_TARGETS", "us-east-1:nano_3_0:1:3")),
+			PeakStartHour: getEnvInt("WARM_POOL_PEAK_START_HOUR", 12),
+			PeakEndHour:   getEnvInt("WARM_POOL_PEAK_END_HOUR", 22),
+			CheckInterval: getEnvInt("WARM_POOL_CHECK_MINUTES", 5),
+			CreateTimeout: getEnvInt("WARM_POOL_CREATE_TIMEOUT_MINUTES", 60),
+
+			MaxNodes:         getEnvInt("WARM_POOL_MAX_NODES", 10),
+			MonthlyBudgetUSD: getEnvInt("WARM_POOL_MONTHLY_BUDGET_USD", 0),
+			BundleHourlyCost: parseBundleCosts(getEnv("WARM_POOL_BUNDLE_HOURLY_COST", "nano_3_0:0.005,micro_3_0:0.0094,small_3_0:0.0134")),
+		},
+		CreateQueue: CreateQueueConfig{
+			MaxConcurrent:      getEnvInt("HOSTING_CREATE_MAX_CONCURRENT", 10),
+			ProviderLimits:     parseIntMap("HOSTING_CREATE_PROVIDER_LIMITS", getEnv("HOSTING_CREATE_PROVIDER_LIMITS", "")),
+			RegionLimits:       parseIntMap("HOSTING_CREATE_REGION_LIMITS", getEnv("HOSTING_CREATE_REGION_LIMITS", "")),
+			DefaultRegionLimit: getEnvInt("HOSTING_CREATE_REGION_DEFAULT_LIMIT", 4),
+			EstimateSeconds:    getEnvInt("HOSTING_CREATE_ESTIMATE_SECONDS", 180),
+			Replicas:           getEnvInt("HOSTING_CREATE_REPLICAS", 1),
+			SlotHoldSeconds:    getEnvInt("HOSTING_CREATE_SLOT_HOLD_SECONDS", 180),
+		},
+		RateLimit: RateLimitConfig{
+			Backend:  getEnv("RATE_LIMIT_BACKEND", "memory"),
+			Policies: parseRateLimitPolicies(getEnv("RATE_LIMIT_POLICIES", "")),
+		},
+		AutoHeal: AutoHealConfig{
+			Enabled:             getEnv("AUTO_HEAL_ENABLED", "false") == "true",
+			UnhealthyMinutes:    getEnvInt("AUTO_HEAL_UNHEALTHY_MINUTES", 30),
+			CheckInterval:       getEnvInt("AUTO_HEAL_CHECK_MINUTES", 5),
+			MaxPerHour:          getEnvInt("AUTO_HEAL_MAX_PER_HOUR", 5),
+			MaxUnhealthyPercent: getEnvInt("AUTO_HEAL_MAX_UNHEALTHY_PERCENT", 20),
+			MinNodesForPercent:  getEnvInt("AUTO_HEAL_MIN_NODES_FOR_PERCENT", 10),
 		},
 	}
+	cfg.InternalAuth.Credentials, cfg.InternalAuth.credentialsErr = loadInternalCredentials(getEnv("INTERNAL_CREDENTIALS_FILE", ""))
 
 	// 日志脱敏: 不记录敏感配置
 	log.Printf("[config] Fulfillment Service loaded: port=%s db=%s/%s.%s hosting=%s trial_enabled=%v",
@@ -129,12 +468,20 @@ func Load() *Config {
 
 // Validate 验证配置有效性，生产环境必须设置安全的密钥
 func (c *Config) Validate() error {
-	// 检查 JWT 密钥
-	if insecureDefaults[c.JWT.SecretKey] {
-		return fmt.Errorf("JWT_SECRET_KEY must be set to a secure value (current value is insecure or empty)")
+	// 检查 JWT 配置
+	if len(c.JWT.Algorithms) == 0 {
+		return fmt.Errorf("JWT_ALGORITHMS must list at least one supported algorithm")
 	}
-	if len(c.JWT.SecretKey) < 32 {
-		return fmt.Errorf("JWT_SECRET_KEY must be at least 32 characters long")
+	if c.JWT.UsesHMAC() {
+		if insecureDefaults[c.JWT.SecretKey] {
+			return fmt.Errorf("JWT_SECRET_KEY must be set to a secure value (current value is insecure or empty)")
+		}
+		if len(c.JWT.SecretKey) < 32 {
+			return fmt.Errorf("JWT_SECRET_KEY must be at least 32 characters long")
+		}
+	}
+	if c.JWT.UsesPublicKeys() && c.JWT.JWKSURL == "" && c.JWT.PublicKeyFile == "" {
+		return fmt.Errorf("JWT_JWKS_URL or JWT_PUBLIC_KEY_FILE is required for RS*/ES* algorithms")
 	}
 
 	// 检查内部服务密钥
@@ -145,6 +492,28 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("INTERNAL_SECRET must be at least 32 characters long")
 	}
 
+	// 配置了凭据文件却无法读取时拒绝启动，避免所有调用方静默失去访问权限
+	if c.InternalAuth.credentialsErr != nil {
+		return c.InternalAuth.credentialsErr
+	}
+
+	// 关闭共享密钥后必须配置调用方凭据，否则所有内部 API 都无法访问
+	if !c.InternalAuth.LegacySecret && len(c.InternalAuth.Credentials) == 0 {
+		return fmt.Errorf("INTERNAL_CREDENTIALS_FILE must define at least one credential when INTERNAL_AUTH_LEGACY_SECRET=false")
+	}
+
+	// 节点凭据加密密钥
+	if len(c.Encryption.Key) != 32 || c.Encryption.Key == "your-32-character-encryption-key" {
+		return fmt.Errorf("ENCRYPTION_KEY must be set to a secure 32-character value")
+	}
+	if c.Encryption.KeyVersion <= 0 {
+		return fmt.Errorf("ENCRYPTION_KEY_VERSION must be positive")
+	}
+
+	if c.RateLimit.Backend != "memory" && c.RateLimit.Backend != "postgres" {
+		return fmt.Errorf("RATE_LIMIT_BACKEND must be memory or postgres")
+	}
+
 	return nil
 }
 
@@ -152,6 +521,213 @@ func (c *DatabaseConfig) DSN() string {
 	return "postgres://" + c.User + ":" + c.Password + "@" + c.Host + ":" + c.Port + "/" + c.DBName + "?sslmode=" + c.SSLMode
 }
 
+// parsePauseLimits parses "plan:max_count:max_days,..." (e.g. "default:1:14,premium:2:30").
+// Malformed entries are skipped.
+func parsePauseLimits(value string) map[string]PauseLimit {
+	limits := make(map[string]PauseLimit)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			continue
+		}
+		count, err1 := strconv.Atoi(parts[1])
+		days, err2 := strconv.Atoi(parts[2])
+		if err1 != nil || err2 != nil {
+			log.Printf("[config] Ignoring malformed VPN_PAUSE_LIMITS entry: %q", entry)
+			continue
+		}
+		limits[parts[0]] = PauseLimit{MaxCount: count, MaxDays: days}
+	}
+	return limits
+}
+
+// parseIntMap parses "key:count,..." (e.g. HOSTING_IP_CHANGE_LIMITS "default:1,premium:3").
+// Malformed entries are skipped; name is the env var used in log messages.
+func parseIntMap(name, value string) map[string]int {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 2 {
+			continue
+		}
+		count, err := strconv.Atoi(parts[1])
+		if err != nil {
+			log.Printf("[config] Ignoring malformed %s entry: %q", name, entry)
+			continue
+		}
+		limits[parts[0]] = count
+	}
+	return limits
+}
+
+// parseList parses a comma-separated list, skipping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			items = append(items, entry)
+		}
+	}
+	return items
+}
+
+// jwtAlgorithms 支持的签名算法（不含 none）
+var jwtAlgorithms = []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+// parseJWTAlgorithms parses "RS256,ES256"; unsupported algorithms are skipped.
+func parseJWTAlgorithms(value string) []string {
+	var algs []string
+	for _, entry := range strings.Split(value, ",") {
+		alg := strings.ToUpper(strings.TrimSpace(entry))
+		if alg == "" {
+			continue
+		}
+		if !slices.Contains(jwtAlgorithms, alg) {
+			log.Printf("[config] Ignoring unsupported JWT_ALGORITHMS entry: %s", entry)
+			continue
+		}
+		algs = append(algs, alg)
+	}
+	return algs
+}
+
+// loadInternalCredentials reads the internal API caller registry (a JSON array of InternalCredential).
+// An empty path means no per-caller credentials; malformed entries are skipped.
+func loadInternalCredentials(path string) ([]InternalCredential, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read INTERNAL_CREDENTIALS_FILE %s: %w", path, err)
+	}
+
+	var entries []InternalCredential
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse INTERNAL_CREDENTIALS_FILE %s: %w", path, err)
+	}
+
+	credentials := make([]InternalCredential, 0, len(entries))
+	for _, e := range entries {
+		if hash, err := hex.DecodeString(e.KeySHA256); err != nil || len(hash) != 32 || e.CallerID == "" || len(e.Scopes) == 0 {
+			log.Printf("[config] Ignoring malformed internal credential for caller %q", e.CallerID)
+			continue
+		}
+		credentials = append(credentials, e)
+	}
+	return credentials, nil
+}
+
+// parseEncryptionKeys parses retired master keys "version:key,..." (e.g. "1:<32 characters>").
+// Malformed entries are skipped.
+func parseEncryptionKeys(value string) map[int]string {
+	keys := make(map[int]string)
+	for _, entry := range strings.Split(value, ",") {
+		v, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+		version, err := strconv.Atoi(v)
+		if err != nil || version <= 0 || key == "" {
+			log.Printf("[config] Ignoring malformed ENCRYPTION_OLD_KEYS entry for version %q", v)
+			continue
+		}
+		keys[version] = key
+	}
+	return keys
+}
+
+// parseRateLimitPolicies parses "name:limit:window:key,..." (e.g. "create:5:1h:user") on top of
+// defaultRateLimitPolicies. key is user, ip or caller; a limit of 0 disables the policy.
+// Malformed entries are skipped.
+func parseRateLimitPolicies(value string) map[string]RateLimitPolicy {
+	policies := make(map[string]RateLimitPolicy)
+	for _, entry := range strings.Split(defaultRateLimitPolicies+","+value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 4 {
+			if strings.TrimSpace(entry) != "" {
+				log.Printf("[config] Ignoring malformed RATE_LIMIT_POLICIES entry: %q", entry)
+			}
+			continue
+		}
+		limit, err1 := strconv.Atoi(parts[1])
+		window, err2 := time.ParseDuration(parts[2])
+		keyBy := parts[3]
+		if err1 != nil || err2 != nil || limit < 0 || window <= 0 || (keyBy != "user" && keyBy != "ip" && keyBy != "caller") {
+			log.Printf("[config] Ignoring malformed RATE_LIMIT_POLICIES entry: %q", entry)
+			continue
+		}
+		policies[parts[0]] = RateLimitPolicy{Limit: limit, Window: window, KeyBy: keyBy}
+	}
+	return policies
+}
+
+// parseRegionFallbacks parses "region:fallback|fallback,..." where a fallback is
+// "region" or "provider/region" (e.g. "us-east-1:us-east-2|digitalocean/nyc1").
+// Malformed entries are skipped.
+func parseRegionFallbacks(value string) map[string][]RegionFallback {
+	fallbacks := make(map[string][]RegionFallback)
+	if value == "" {
+		return fallbacks
+	}
+	for _, entry := range strings.Split(value, ",") {
+		region, list, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || region == "" || list == "" {
+			log.Printf("[config] Ignoring malformed HOSTING_REGION_FALLBACKS entry: %q", entry)
+			continue
+		}
+		for _, item := range strings.Split(list, "|") {
+			fb := RegionFallback{Region: strings.TrimSpace(item)}
+			if provider, r, found := strings.Cut(fb.Region, "/"); found {
+				fb.Provider, fb.Region = provider, r
+			}
+			if fb.Region != "" {
+				fallbacks[region] = append(fallbacks[region], fb)
+			}
+		}
+	}
+	return fallbacks
+}
+
+// parseWarmPoolTargets parses "region:bundle:off_peak:peak,..." (e.g. "us-east-1:nano_3_0:1:3").
+// Malformed entries are skipped.
+func parseWarmPoolTargets(value string) []WarmPoolTarget {
+	var targets []WarmPoolTarget
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 4 {
+			continue
+		}
+		offPeak, err1 := strconv.Atoi(parts[2])
+		peak, err2 := strconv.Atoi(parts[3])
+		if err1 != nil || err2 != nil {
+			log.Printf("[config] Ignoring malformed WARM_POOL_TARGETS entry: %q", entry)
+			continue
+		}
+		targets = append(targets, WarmPoolTarget{Region: parts[0], BundleID: parts[1], OffPeak: offPeak, Peak: peak})
+	}
+	return targets
+}
+
+// parseBundleCosts parses "bundle:hourly_usd,..." (e.g. "nano_3_0:0.005").
+// Malformed entries are skipped.
+func parseBundleCosts(value string) map[string]float64 {
+	costs := make(map[string]float64)
+	for _, entry := range strings.Split(value, ",") {
+		bundle, cost, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+		c, err := strconv.ParseFloat(cost, 64)
+		if err != nil {
+			log.Printf("[config] Ignoring malformed WARM_POOL_BUNDLE_HOURLY_COST entry: %q", entry)
+			continue
+		}
+		costs[bundle] = c
+	}
+	return costs
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+)
+
+// Internal API scopes
+const (
+	ScopeAll               = "*"
+	ScopeProvisionWrite    = "provision:write"    // 开通/回收/更新资源（subscription-service）
+	ScopeResourcesRead     = "resources:read"     // 查询资源和 VPN 配置（subscription-service、user-portal）
+	ScopeVPNWrite          = "vpn:write"          // 暂停/恢复 VPN（客服、user-portal）
+	ScopeUsersWrite        = "users:write"        // 同步用户邮箱（subscription-service）
+	ScopeNodesAdmin        = "nodes:admin"        // 节点运维：轮换凭据、换 IP、恢复、健康报告
+	ScopeProbesWrite       = "probes:write"       // 外部探测点上报探测结果
+	ScopeEntitlementsAdmin = "entitlements:admin" // 赠送/撤销权益、兑换码、试用复核
+	ScopeAdminDB           = "admin:db"           // 数据库浏览
+)
+
+// legacyCallerID 使用共享 INTERNAL_SECRET 的调用方
+const legacyCallerID = "legacy-shared-secret"
+
+// gin context keys
+const (
+	callerIDKey     = "callerID"
+	callerScopesKey = "callerScopes"
+)
+
+// CallerRegistry authenticates internal API callers by their key
+type CallerRegistry struct {
+	credentials  []config.InternalCredential
+	legacySecret string // 为空表示不再接受共享密钥
+}
+
+// NewCallerRegistry creates a registry from the configured credentials
+func NewCallerRegistry(auth config.InternalAuthConfig, internalSecret string) *CallerRegistry {
+	r := &CallerRegistry{credentials: auth.Credentials}
+	if auth.LegacySecret {
+		r.legacySecret = internalSecret
+	}
+	return r
+}
+
+// Authenticate returns the scopes of the caller holding key
+// 同一 caller 可以同时有多个未过期的 key（轮换过渡期）
+func (r *CallerRegistry) Authenticate(callerID, key string) ([]string, bool) {
+	if callerID == "" || key == "" {
+		return nil, false
+	}
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+
+	now := time.Now()
+	for _, cred := range r.credentials {
+		if cred.CallerID != callerID || (cred.ExpiresAt != nil && now.After(*cred.ExpiresAt)) {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(cred.KeySHA256)) == 1 {
+			return cred.Scopes, true
+		}
+	}
+	return nil, false
+}
+
+// AuthenticateLegacy checks the deprecated shared secret
+func (r *CallerRegistry) AuthenticateLegacy(secret string) bool {
+	return r.legacySecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(r.legacySecret)) == 1
+}
+
+// RequireScope rejects internal callers without the given scope
+// 必须在 InternalAuthMiddleware 之后使用
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, _ := c.Get(callerScopesKey)
+		granted, _ := scopes.([]string)
+		if !slices.Contains(granted, scope) && !slices.Contains(granted, ScopeAll) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("caller %s lacks scope %s", c.GetString(callerIDKey), scope)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestLogFormatter gin 请求日志，附带内部调用方
+func requestLogFormatter(p gin.LogFormatterParams) string {
+	caller := "-"
+	if id, ok := p.Keys[callerIDKey].(string); ok {
+		caller = id
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | caller=%s\n%s",
+		p.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		p.StatusCode,
+		p.Latency,
+		p.ClientIP,
+		p.Method,
+		p.Path,
+		caller,
+		p.ErrorMessage,
+	)
+}
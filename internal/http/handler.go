@@ -1,10 +1,18 @@
 package http
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/client"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/service"
 )
 
@@ -12,13 +20,19 @@ type Handler struct {
 	provisionService   *service.ProvisionService
 	vpnService         *service.VPNService
 	entitlementService *service.EntitlementService
+	nodeHealthService  *service.NodeHealthService
+	limiter            Limiter
+	rateLimits         map[string]config.RateLimitPolicy
 }
 
-func NewHandler(provisionService *service.ProvisionService, vpnService *service.VPNService, entitlementService *service.EntitlementService) *Handler {
+func NewHandler(provisionService *service.ProvisionService, vpnService *service.VPNService, entitlementService *service.EntitlementService, nodeHealthService *service.NodeHealthService, limiter Limiter, rateLimits map[string]config.RateLimitPolicy) *Handler {
 	return &Handler{
 		provisionService:   provisionService,
 		vpnService:         vpnService,
 		entitlementService: entitlementService,
+		nodeHealthService:  nodeHealthService,
+		limiter:            limiter,
+		rateLimits:         rateLimits,
 	}
 }
 
@@ -37,6 +51,13 @@ func (h *Handler) Provision(c *gin.Context) {
 
 	// Route based on app_source (new) or resource_type (legacy)
 	switch {
+	case req.BusinessType == models.BusinessTypeTopUp:
+		// 流量加油包：只加流量，不改到期时间
+		resp, err = h.vpnService.ApplyTrafficTopUp(c.Request.Context(), &req)
+		if errors.Is(err, service.ErrNoActivePlanForTopUp) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 	case req.AppSource == "otun" || req.ResourceType == models.ResourceTypeVPNUser:
 		resp, err = h.vpnService.ProvisionVPNUser(c.Request.Context(), &req)
 	default:
@@ -120,6 +141,137 @@ func (h *Handler) GetUserResources(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": resp})
 }
 
+// RotateResourceCredentials regenerates node credentials for a resource (admin/internal)
+func (h *Handler) RotateResourceCredentials(c *gin.Context) {
+	resourceID := c.Param("id")
+	if resourceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "resource id required"})
+		return
+	}
+
+	resp, err := h.provisionService.RotateResourceCredentials(c.Request.Context(), resourceID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !resp.Success {
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ChangeResourceIP swaps the public IP of a hosting node (admin/internal)
+// POST /api/internal/resources/:id/change-ip
+func (h *Handler) ChangeResourceIP(c *gin.Context) {
+	var req models.ChangeIPRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.provisionService.ChangeResourceIP(c.Request.Context(), c.Param("id"), req.Reason)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !resp.Success {
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ReportNodeProbes records reachability checks from an external vantage point
+// POST /api/internal/resources/:id/probes
+func (h *Handler) ReportNodeProbes(c *gin.Context) {
+	var req models.NodeProbeReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.nodeHealthService.ReportExternal(c.Request.Context(), c.Param("id"), &req); err != nil {
+		if errors.Is(err, service.ErrInvalidProbeReport) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetNodeProbes returns recent probe results of a hosting node (admin/internal)
+// GET /api/internal/resources/:id/probes?limit=100
+func (h *Handler) GetNodeProbes(c *gin.Context) {
+	limit, ok := queryLimit(c, 100, 1000)
+	if !ok {
+		return
+	}
+
+	resp, err := h.nodeHealthService.GetProbeResults(c.Request.Context(), c.Param("id"), limit)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetNodeHealthReport summarizes reachability of all active nodes (admin/internal)
+// GET /api/internal/nodes/health
+func (h *Handler) GetNodeHealthReport(c *gin.Context) {
+	report, err := h.nodeHealthService.HealthReport(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ResumeResource restarts a suspended hosting node (admin/internal)
+// POST /api/internal/resources/:id/resume
+func (h *Handler) ResumeResource(c *gin.Context) {
+	resp, err := h.provisionService.ResumeResource(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		if errors.Is(err, service.ErrNodeNotSuspended) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // ==================== Node Callback Handlers ====================
 
 // NodeReady handles callback when node software is ready
@@ -138,6 +290,22 @@ func (h *Handler) NodeReady(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// HostingNodeEvent handles node status changes pushed by hosting-service
+func (h *Handler) HostingNodeEvent(c *gin.Context) {
+	var req client.NodeEvent
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.provisionService.HandleHostingNodeEvent(c.Request.Context(), &req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
 // NodeFailed handles callback when node installation fails
 func (h *Handler) NodeFailed(c *gin.Context) {
 	var req models.NodeFailedCallback
@@ -223,6 +391,122 @@ func (h *Handler) DeleteMyNode(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// RotateMyNodeCredentials regenerates the current user's node credentials
+func (h *Handler) RotateMyNodeCredentials(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	resp, err := h.provisionService.RotateUserNodeCredentials(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !resp.Success {
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ChangeMyNodeIP swaps the public IP of the current user's node (monthly quota per plan)
+func (h *Handler) ChangeMyNodeIP(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var req models.ChangeIPRequest
+	if err := bindOptionalJSON(c, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.provisionService.ChangeUserNodeIP(c.Request.Context(), userID.(string), req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !resp.Success {
+		status := http.StatusBadRequest
+		if resp.ResourceID == "" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// NodeActionMyNode reboots, stops or starts the current user's node
+func (h *Handler) NodeActionMyNode(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var req models.NodeActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 按操作分别计数（node_reboot / node_stop / node_start 策略）
+	if !allowRequest(c, h.limiter, "node_"+req.Action, rateLimitPolicy(h.rateLimits, "node_"+req.Action)) {
+		return
+	}
+
+	resp, err := h.provisionService.NodeAction(c.Request.Context(), userID.(string), req.Action)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !resp.Success {
+		status := http.StatusConflict
+		if resp.ResourceID == "" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, resp)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// GetMyNodeTimeline returns recent events of the current user's node
+func (h *Handler) GetMyNodeTimeline(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	limit, ok := queryLimit(c, 50, 200)
+	if !ok {
+		return
+	}
+	resp, err := h.provisionService.GetUserNodeTimeline(c.Request.Context(), userID.(string), limit)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no node found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // GetRegions returns available regions
 func (h *Handler) GetRegions(c *gin.Context) {
 	resp, err := h.provisionService.GetAvailableRegions(c.Request.Context())
@@ -326,6 +610,95 @@ func (h *Handler) UpdateVPNResource(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "VPN user updated successfully"})
 }
 
+// PauseMyVPN pauses the current user's VPN plan
+func (h *Handler) PauseMyVPN(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var req models.VPNPauseRequest
+	_ = c.ShouldBindJSON(&req) // body 可选
+
+	resp, err := h.vpnService.PauseVPN(c.Request.Context(), userID.(string), pauseReason(req.Reason, "user"))
+	if err != nil {
+		writePauseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ResumeMyVPN resumes the current user's paused VPN plan
+func (h *Handler) ResumeMyVPN(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	resp, err := h.vpnService.ResumeVPN(c.Request.Context(), userID.(string), "resumed by user")
+	if err != nil {
+		writePauseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PauseUserVPN pauses a user's VPN plan (internal/support)
+// POST /api/internal/vpn/user/:user_id/pause
+func (h *Handler) PauseUserVPN(c *gin.Context) {
+	var req models.VPNPauseRequest
+	_ = c.ShouldBindJSON(&req)
+
+	resp, err := h.vpnService.PauseVPN(c.Request.Context(), c.Param("user_id"), pauseReason(req.Reason, "internal"))
+	if err != nil {
+		writePauseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ResumeUserVPN resumes a user's paused VPN plan (internal/support)
+// POST /api/internal/vpn/user/:user_id/resume
+func (h *Handler) ResumeUserVPN(c *gin.Context) {
+	var req models.VPNPauseRequest
+	_ = c.ShouldBindJSON(&req)
+
+	resp, err := h.vpnService.ResumeVPN(c.Request.Context(), c.Param("user_id"), pauseReason(req.Reason, "internal"))
+	if err != nil {
+		writePauseError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// pauseReason falls back to "requested by <actor>" when no reason was given
+func pauseReason(reason, actor string) string {
+	if reason != "" {
+		return reason
+	}
+	return "requested by " + actor
+}
+
+// writePauseError maps pause/resume errors to HTTP responses
+func writePauseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrVPNNotPausable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "pause_not_allowed"})
+	case errors.Is(err, service.ErrVPNPauseLimitReached):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "pause_limit_reached"})
+	case errors.Is(err, service.ErrVPNNotPaused):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "not_paused"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // UpdateUserEmail 更新用户邮箱（subscription-service 邮箱绑定事件触发）
 // PUT /api/internal/users/:user_id/email
 func (h *Handler) UpdateUserEmail(c *gin.Context) {
@@ -355,6 +728,49 @@ func (h *Handler) GetTrialConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
+// ActivateMyTrial starts a VPN trial for the current user
+func (h *Handler) ActivateMyTrial(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var req models.TrialActivationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.entitlementService.ActivateTrial(c.Request.Context(), userID.(string), c.GetString("email"), c.ClientIP(), &req)
+	if err != nil {
+		var eligibilityErr *service.TrialEligibilityError
+		switch {
+		case errors.As(err, &eligibilityErr):
+			status := http.StatusForbidden
+			code := "trial_denied"
+			if eligibilityErr.Decision == models.TrialDecisionReview {
+				status = http.StatusAccepted
+				code = "trial_under_review"
+			}
+			c.JSON(status, gin.H{"error": err.Error(), "code": code, "attempt_id": eligibilityErr.AttemptID})
+		case errors.Is(err, repository.ErrTrialUserUsed),
+			errors.Is(err, repository.ErrTrialDeviceUsed),
+			errors.Is(err, repository.ErrTrialEmailUsed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "trial_already_used"})
+		case errors.Is(err, service.ErrTrialNotEligible):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "trial_not_eligible"})
+		case errors.Is(err, service.ErrTrialDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "trial_disabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
 // GiftEntitlement creates a gift entitlement (admin/internal)
 func (h *Handler) GiftEntitlement(c *gin.Context) {
 	var req models.GiftEntitlementRequest
@@ -372,6 +788,176 @@ func (h *Handler) GiftEntitlement(c *gin.Context) {
 	c.JSON(http.StatusCreated, resp)
 }
 
+// GetEntitlementLedger returns a user's entitlement grants and resolved result (admin/internal)
+func (h *Handler) GetEntitlementLedger(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		return
+	}
+
+	resp, err := h.entitlementService.GetLedger(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeEntitlement revokes a VPN entitlement (admin/internal)
+func (h *Handler) RevokeEntitlement(c *gin.Context) {
+	var req models.RevokeEntitlementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.entitlementService.RevokeEntitlement(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "entitlement not found"})
+		case errors.Is(err, service.ErrEntitlementAlreadyRevoked):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateVoucherBatch generates a batch of voucher codes (admin/internal)
+// 传 ?format=csv 时直接返回 CSV 文件
+func (h *Handler) CreateVoucherBatch(c *gin.Context) {
+	var req models.CreateVoucherBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.entitlementService.CreateVoucherBatch(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVoucherBatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		writeVoucherCSV(c, resp.BatchID, resp.Vouchers)
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ExportVoucherBatch exports a voucher batch as CSV (admin/internal)
+func (h *Handler) ExportVoucherBatch(c *gin.Context) {
+	batchID := c.Param("batch_id")
+
+	vouchers, err := h.entitlementService.ListVoucherBatch(c.Request.Context(), batchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(vouchers) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "voucher batch not found"})
+		return
+	}
+
+	writeVoucherCSV(c, batchID, vouchers)
+}
+
+func writeVoucherCSV(c *gin.Context, batchID string, vouchers []*models.VoucherInfo) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=vouchers-%s.csv", batchID))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"code", "campaign", "traffic_gb", "duration_days", "service_tier", "max_redemptions", "redeemed_count", "valid_from", "valid_until"})
+	for _, v := range vouchers {
+		w.Write([]string{
+			v.Code, v.Campaign,
+			strconv.Itoa(v.TrafficGB), strconv.Itoa(v.DurationDays), v.ServiceTier,
+			strconv.Itoa(v.MaxRedemptions), strconv.Itoa(v.RedeemedCount),
+			v.ValidFrom, v.ValidUntil,
+		})
+	}
+	w.Flush()
+}
+
+// RedeemMyVoucher redeems a voucher code for the current user
+func (h *Handler) RedeemMyVoucher(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not authenticated"})
+		return
+	}
+
+	var req models.RedeemVoucherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.entitlementService.RedeemVoucher(c.Request.Context(), userID.(string), c.GetString("email"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrVoucherInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "voucher_invalid"})
+		case errors.Is(err, repository.ErrVoucherAlreadyRedeemed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "voucher_already_redeemed"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListTrialAttempts queries trial eligibility evaluations (admin/internal)
+func (h *Handler) ListTrialAttempts(c *gin.Context) {
+	limit, ok := queryLimit(c, 100, 500)
+	if !ok {
+		return
+	}
+
+	resp, err := h.entitlementService.ListTrialAttempts(c.Request.Context(), c.Query("user_id"), c.Query("decision"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attempts": resp})
+}
+
+// OverrideTrialAttempt sets an admin decision on a trial attempt (admin/internal)
+func (h *Handler) OverrideTrialAttempt(c *gin.Context) {
+	var req models.TrialOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.entitlementService.OverrideTrialAttempt(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "trial attempt not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
 // ListEntitlements queries entitlements (admin/internal)
 func (h *Handler) ListEntitlements(c *gin.Context) {
 	userID := c.Query("user_id")
@@ -390,3 +976,26 @@ func (h *Handler) ListEntitlements(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"entitlements": resp})
 }
+
+// bindOptionalJSON binds an optional JSON body; an empty body is not an error
+func bindOptionalJSON(c *gin.Context, obj any) error {
+	if err := c.ShouldBindJSON(obj); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// queryLimit parses the optional ?limit= query parameter, clamped to 1..upper.
+// A non-integer value is answered with 400 and ok=false.
+func queryLimit(c *gin.Context, def, upper int) (limit int, ok bool) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return def, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer"})
+		return 0, false
+	}
+	return min(max(limit, 1), upper), true
+}
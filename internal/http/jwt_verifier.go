@@ -0,0 +1,354 @@
+package http
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+)
+
+// jwksMinRefetch 遇到未知 kid 时重新拉取公钥的最小间隔，防止伪造 kid 刷爆 JWKS 端点
+const jwksMinRefetch = time.Minute
+
+var errNoSubject = errors.New("token has no uid or sub claim")
+
+// JWTVerifier verifies user tokens against the configured algorithms, keys and claims
+type JWTVerifier struct {
+	parser *jwt.Parser
+	secret []byte
+	keys   *publicKeySet // nil 表示只允许 HS*
+}
+
+// NewJWTVerifier creates a verifier from the JWT config
+// 本地公钥文件读取失败直接返回错误；JWKS 端点暂时不可用时只记录日志，首个请求时重试
+func NewJWTVerifier(cfg config.JWTConfig) (*JWTVerifier, error) {
+	// 空列表会让 WithValidMethods 不做算法限制
+	if len(cfg.Algorithms) == 0 {
+		return nil, errors.New("no JWT algorithms allowed, check JWT_ALGORITHMS")
+	}
+	// golang-jwt 不拒绝空的 HMAC 密钥，短密钥等同于任何人都能签发 token
+	if cfg.UsesHMAC() && len(cfg.SecretKey) < 32 {
+		return nil, errors.New("JWT_SECRET_KEY must be at least 32 characters when HS* algorithms are allowed")
+	}
+	if cfg.UsesPublicKeys() && cfg.JWKSURL == "" && cfg.PublicKeyFile == "" {
+		return nil, errors.New("JWT_JWKS_URL or JWT_PUBLIC_KEY_FILE is required for RS*/ES* algorithms")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Duration(cfg.ClockSkewSeconds) * time.Second),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	v := &JWTVerifier{
+		parser: jwt.NewParser(opts...),
+		secret: []byte(cfg.SecretKey),
+	}
+
+	if cfg.UsesPublicKeys() {
+		v.keys = &publicKeySet{refresh: time.Duration(max(cfg.KeyRefreshMinutes, 1)) * time.Minute}
+		if cfg.JWKSURL != "" {
+			v.keys.source = cfg.JWKSURL
+			v.keys.fetch = fetchJWKS(cfg.JWKSURL)
+		} else {
+			v.keys.source = cfg.PublicKeyFile
+			v.keys.fetch = readKeyFile(cfg.PublicKeyFile)
+		}
+		if err := v.keys.reload(context.Background()); err != nil {
+			if cfg.JWKSURL == "" {
+				return nil, err
+			}
+			log.Printf("[JWT] WARN: %v (will retry on first request)", err)
+		}
+	}
+	return v, nil
+}
+
+// Verify parses and validates a token and returns its claims
+// 缺少 uid/sub 的 token 一律拒绝
+func (v *JWTVerifier) Verify(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if strings.HasPrefix(token.Method.Alg(), "HS") {
+			return v.secret, nil
+		}
+		if v.keys == nil {
+			return nil, fmt.Errorf("no public keys configured for %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		keys := v.keys.lookup(ctx, kid)
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("no public key for kid %q", kid)
+		}
+		set := jwt.VerificationKeySet{}
+		for _, k := range keys {
+			set.Keys = append(set.Keys, k)
+		}
+		return set, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if subjectOf(claims) == "" {
+		return nil, errNoSubject
+	}
+	return claims, nil
+}
+
+// subjectOf 兼容 auth-service 的 JWT 格式：优先使用 uid，其次使用标准的 sub
+func subjectOf(claims jwt.MapClaims) string {
+	if uid, ok := claims["uid"].(string); ok && uid != "" {
+		return uid
+	}
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// publicKey is one verification key, kid is empty for PEM keys
+type publicKey struct {
+	kid string
+	key crypto.PublicKey
+}
+
+// publicKeySet caches public keys from a JWKS endpoint or key file
+// 超过 refresh 间隔或遇到未知 kid（签发方轮换了密钥）时重新加载；加载失败时沿用旧的公钥
+type publicKeySet struct {
+	source  string
+	fetch   func(ctx context.Context) ([]publicKey, error)
+	refresh time.Duration
+
+	mu          sync.Mutex
+	keys        []publicKey
+	loadedAt    time.Time
+	lastAttempt time.Time
+	fetching    bool // 同一时间只有一个请求拉取公钥
+}
+
+// lookup returns the keys matching kid, reloading stale or missing keys
+// 拉取在锁外进行，其他请求继续使用缓存的公钥，不会被慢的 JWKS 端点阻塞
+func (s *publicKeySet) lookup(ctx context.Context, kid string) []crypto.PublicKey {
+	s.mu.Lock()
+	keys := s.matchLocked(kid)
+	stale := time.Since(s.loadedAt) > s.refresh
+	refetch := (stale || len(keys) == 0) && !s.fetching && time.Since(s.lastAttempt) > jwksMinRefetch
+	s.mu.Unlock()
+
+	if !refetch {
+		return keys
+	}
+	s.reload(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.matchLocked(kid)
+}
+
+// matchLocked 没有 kid 的 token 尝试全部公钥；没有 kid 的公钥（PEM）匹配任意 token
+func (s *publicKeySet) matchLocked(kid string) []crypto.PublicKey {
+	var keys []crypto.PublicKey
+	for _, k := range s.keys {
+		if kid == "" || k.kid == "" || k.kid == kid {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
+
+func (s *publicKeySet) reload(ctx context.Context) error {
+	s.mu.Lock()
+	if s.fetching {
+		s.mu.Unlock()
+		return nil
+	}
+	s.fetching = true
+	s.lastAttempt = time.Now()
+	s.mu.Unlock()
+
+	keys, err := s.fetch(ctx)
+	if err == nil && len(keys) == 0 {
+		err = errors.New("no usable keys")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetching = false
+	if err != nil {
+		err = fmt.Errorf("load JWT keys from %s: %w", s.source, err)
+		log.Printf("[JWT] Failed to reload public keys, keeping %d cached: %v", len(s.keys), err)
+		return err
+	}
+	if len(s.keys) > 0 && len(keys) != len(s.keys) {
+		log.Printf("[JWT] Public keys from %s changed: %d -> %d", s.source, len(s.keys), len(keys))
+	}
+	s.keys = keys
+	s.loadedAt = time.Now()
+	return nil
+}
+
+// fetchJWKS loads keys from a JWKS endpoint
+func fetchJWKS(url string) func(ctx context.Context) ([]publicKey, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	return func(ctx context.Context) ([]publicKey, error) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+		return parseJWKS(body)
+	}
+}
+
+// readKeyFile loads keys from a local file: PEM public keys / certificates, or a JWKS document
+// 轮换时可以在同一文件中同时放新旧两个公钥
+func readKeyFile(path string) func(ctx context.Context) ([]publicKey, error) {
+	return func(ctx context.Context) ([]publicKey, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+			return parseJWKS(data)
+		}
+
+		var keys []publicKey
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			var key crypto.PublicKey
+			switch block.Type {
+			case "PUBLIC KEY":
+				key, err = x509.ParsePKIXPublicKey(block.Bytes)
+			case "RSA PUBLIC KEY":
+				key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+			case "CERTIFICATE":
+				var cert *x509.Certificate
+				if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+					key = cert.PublicKey
+				}
+			default:
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", block.Type, err)
+			}
+			keys = append(keys, publicKey{key: key})
+		}
+		return keys, nil
+	}
+}
+
+// jwk is a JSON Web Key (RSA or EC public key)
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS parses a JWKS document; keys that are not signing keys or cannot be parsed are skipped
+func parseJWKS(data []byte) ([]publicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	var keys []publicKey
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("[JWT] Ignoring JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys = append(keys, publicKey{kid: k.Kid, key: key})
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid e")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		var point ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, point = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, point = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, point = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, errors.New("invalid x/y")
+		}
+		// 校验点在曲线上
+		if _, err := point.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,312 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, pub *ecdsa.PublicKey) map[string]string {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"kid": kid,
+		"kty": "EC",
+		"crv": pub.Curve.Params().Name,
+		"x":   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+		"y":   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// jwksServer serves a JWKS document that the test can replace, counting fetches
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    []map[string]string
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...map[string]string) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) setKeys(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func newTestVerifier(t *testing.T, cfg config.JWTConfig) *JWTVerifier {
+	t.Helper()
+	v, err := NewJWTVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	return v
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, claims jwt.MapClaims, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"uid": "user-1",
+		"iss": "auth-service",
+		"aud": "fulfillment",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func withClaims(edit func(jwt.MapClaims)) jwt.MapClaims {
+	c := validClaims()
+	edit(c)
+	return c
+}
+
+func TestJWTVerifierVerify(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherRSA := newRSAKey(t)
+	srv := newJWKSServer(t, rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+
+	// 只允许 RS256 / ES256，并校验 iss / aud
+	v := newTestVerifier(t, config.JWTConfig{
+		Algorithms:        []string{"RS256", "ES256"},
+		JWKSURL:           srv.URL,
+		Issuer:            "auth-service",
+		Audience:          "fulfillment",
+		KeyRefreshMinutes: 60,
+	})
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+		wantSub string
+	}{
+		{"rs256", signToken(t, jwt.SigningMethodRS256, "rsa-1", validClaims(), rsaKey), false, "user-1"},
+		{"es256", signToken(t, jwt.SigningMethodES256, "ec-1", validClaims(), ecKey), false, "user-1"},
+		{"sub without uid", signToken(t, jwt.SigningMethodRS256, "rsa-1", withClaims(func(c jwt.MapClaims) {
+			delete(c, "uid")
+			c["sub"] = "user-2"
+		}), rsaKey), false, "user-2"},
+		{"alg outside allow-list", signToken(t, jwt.SigningMethodHS256, "", validClaims(), []byte(testHMACSecret)), true, ""},
+		{"rs512 not allowed", signToken(t, jwt.SigningMethodRS512, "rsa-1", validClaims(), rsaKey), true, ""},
+		{"alg none", signToken(t, jwt.SigningMethodNone, "", validClaims(), jwt.UnsafeAllowNoneSignatureType), true, ""},
+		{"missing exp", signToken(t, jwt.SigningMethodRS256, "rsa-1", withClaims(func(c jwt.MapClaims) { delete(c, "exp") }), rsaKey), true, ""},
+		{"expired", signToken(t, jwt.SigningMethodRS256, "rsa-1", withClaims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), rsaKey), true, ""},
+		{"wrong issuer", signToken(t, jwt.SigningMethodRS256, "rsa-1", withClaims(func(c jwt.MapClaims) { c["iss"] = "someone-else" }), rsaKey), true, ""},
+		{"missing issuer", signToken(t, jwt.SigningMethodRS256, "rsa-1", withClaims(func(c jwt.MapClaims) { delete(c, "iss") }), rsaKey), true, ""},
+		{"wrong audience", signToken(t, jwt.SigningMethodRS256, "rsa-1", withClaims(func(c jwt.MapClaims) { c["aud"] = "billing" }), rsaKey), true, ""},
+		{"no uid or sub", signToken(t, jwt.SigningMethodRS256, "rsa-1", withClaims(func(c jwt.MapClaims) { delete(c, "uid") }), rsaKey), true, ""},
+		{"signed by unknown key", signToken(t, jwt.SigningMethodRS256, "rsa-1", validClaims(), otherRSA), true, ""},
+		{"malformed", "not.a.token", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && subjectOf(claims) != tt.wantSub {
+				t.Fatalf("subject = %q, want %q", subjectOf(claims), tt.wantSub)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRejectsMissingSubject(t *testing.T) {
+	v := newTestVerifier(t, config.JWTConfig{Algorithms: []string{"HS256"}, SecretKey: testHMACSecret})
+	token := signToken(t, jwt.SigningMethodHS256, "", jwt.MapClaims{
+		"uid": "",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}, []byte(testHMACSecret))
+
+	if _, err := v.Verify(context.Background(), token); !errors.Is(err, errNoSubject) {
+		t.Fatalf("Verify err = %v, want errNoSubject", err)
+	}
+}
+
+func TestJWTVerifierUnknownKidRefetchIsRateLimited(t *testing.T) {
+	oldKey := newRSAKey(t)
+	newKey := newRSAKey(t)
+	srv := newJWKSServer(t, rsaJWK("old", &oldKey.PublicKey))
+	v := newTestVerifier(t, config.JWTConfig{
+		Algorithms:        []string{"RS256"},
+		JWKSURL:           srv.URL,
+		KeyRefreshMinutes: 60,
+	})
+	if got := srv.fetches.Load(); got != 1 {
+		t.Fatalf("fetches after NewJWTVerifier = %d, want 1", got)
+	}
+
+	// 签发方轮换了密钥，但距上次拉取不足 jwksMinRefetch：不重新拉取
+	srv.setKeys(rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey))
+	rotated := signToken(t, jwt.SigningMethodRS256, "new", validClaims(), newKey)
+	if _, err := v.Verify(context.Background(), rotated); err == nil {
+		t.Fatal("token with unknown kid accepted before refetch")
+	}
+	if got := srv.fetches.Load(); got != 1 {
+		t.Fatalf("fetches within jwksMinRefetch = %d, want 1", got)
+	}
+
+	// 超过最小间隔后，未知 kid 触发一次拉取
+	v.keys.mu.Lock()
+	v.keys.lastAttempt = time.Now().Add(-2 * jwksMinRefetch)
+	v.keys.mu.Unlock()
+	if _, err := v.Verify(context.Background(), rotated); err != nil {
+		t.Fatalf("Verify after refetch: %v", err)
+	}
+	if got := srv.fetches.Load(); got != 2 {
+		t.Fatalf("fetches after unknown kid = %d, want 2", got)
+	}
+
+	// 伪造的 kid 不会在间隔内反复拉取
+	forged := signToken(t, jwt.SigningMethodRS256, "forged", validClaims(), newRSAKey(t))
+	for i := 0; i < 3; i++ {
+		if _, err := v.Verify(context.Background(), forged); err == nil {
+			t.Fatal("token with forged kid accepted")
+		}
+	}
+	if got := srv.fetches.Load(); got != 2 {
+		t.Fatalf("fetches after forged kids = %d, want 2", got)
+	}
+
+	// 已缓存的公钥不受影响
+	if _, err := v.Verify(context.Background(), signToken(t, jwt.SigningMethodRS256, "old", validClaims(), oldKey)); err != nil {
+		t.Fatalf("Verify with cached key: %v", err)
+	}
+}
+
+func TestPublicKeySetKeepsKeysWhenReloadFails(t *testing.T) {
+	key := newRSAKey(t)
+	fail := false
+	s := &publicKeySet{
+		source:  "test",
+		refresh: time.Hour,
+		fetch: func(ctx context.Context) ([]publicKey, error) {
+			if fail {
+				return nil, errors.New("endpoint down")
+			}
+			return []publicKey{{kid: "k1", key: &key.PublicKey}}, nil
+		},
+	}
+	if err := s.reload(context.Background()); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	fail = true
+	s.lastAttempt = time.Now().Add(-2 * jwksMinRefetch)
+	if got := s.lookup(context.Background(), "k2"); len(got) != 0 {
+		t.Fatalf("lookup unknown kid = %d keys, want 0", len(got))
+	}
+	if got := s.lookup(context.Background(), "k1"); len(got) != 1 {
+		t.Fatalf("lookup cached kid after failed reload = %d keys, want 1", len(got))
+	}
+	if got := s.lookup(context.Background(), ""); len(got) != 1 {
+		t.Fatalf("lookup without kid = %d keys, want all cached keys", len(got))
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey := newRSAKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	encKey := rsaJWK("enc-1", &rsaKey.PublicKey)
+	encKey["use"] = "enc"
+	offCurve := ecJWK("bad-ec", &ecKey.PublicKey)
+	offCurve["y"] = offCurve["x"]
+
+	tests := []struct {
+		name     string
+		keys     []map[string]string
+		wantKids []string
+	}{
+		{"rsa and ec", []map[string]string{rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey)}, []string{"rsa-1", "ec-1"}},
+		{"encryption key skipped", []map[string]string{encKey, rsaJWK("rsa-1", &rsaKey.PublicKey)}, []string{"rsa-1"}},
+		{"unsupported kty skipped", []map[string]string{{"kid": "oct-1", "kty": "oct", "k": "c2VjcmV0"}}, nil},
+		{"unsupported curve skipped", []map[string]string{{"kid": "ed-1", "kty": "EC", "crv": "Ed25519", "x": "AA", "y": "AA"}}, nil},
+		{"point off curve skipped", []map[string]string{offCurve}, nil},
+		{"invalid exponent skipped", []map[string]string{{"kid": "rsa-bad", "kty": "RSA", "n": "AQAB", "e": ""}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := json.Marshal(map[string]interface{}{"keys": tt.keys})
+			keys, err := parseJWKS(data)
+			if err != nil {
+				t.Fatalf("parseJWKS: %v", err)
+			}
+			if len(keys) != len(tt.wantKids) {
+				t.Fatalf("parseJWKS returned %d keys, want %d", len(keys), len(tt.wantKids))
+			}
+			for i, k := range keys {
+				if k.kid != tt.wantKids[i] {
+					t.Errorf("key %d kid = %q, want %q", i, k.kid, tt.wantKids[i])
+				}
+			}
+		})
+	}
+
+	if _, err := parseJWKS([]byte("not json")); err == nil {
+		t.Error("parseJWKS accepted invalid JSON")
+	}
+}
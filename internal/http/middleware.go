@@ -1,17 +1,29 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
 )
 
 // JWTAuthMiddleware validates JWT tokens for user endpoints
-// 兼容 auth-service 签发的 JWT 格式，使用 MapClaims 解析
-func JWTAuthMiddleware(secretKey string) gin.HandlerFunc {
+// 算法、签名公钥、iss/aud、exp 由 JWTVerifier 按配置校验
+func JWTAuthMiddleware(verifier *JWTVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -27,30 +39,15 @@ func JWTAuthMiddleware(secretKey string) gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := verifier.Verify(c.Request.Context(), tokenString)
+		if err != nil {
+			log.Printf("[JWT] Rejected token from %s: %v", c.ClientIP(), err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
-			c.Abort()
-			return
-		}
-
-		// 提取用户信息，兼容 auth-service 的 JWT 格式
-		// 优先使用 uid 字段，其次使用 sub 字段（标准 JWT claim）
-		if uid, ok := claims["uid"].(string); ok {
-			c.Set("userID", uid)
-		} else if sub, ok := claims["sub"].(string); ok {
-			c.Set("userID", sub)
-		}
+		c.Set("userID", subjectOf(claims))
 
 		// 提取 email（如果存在）
 		if email, ok := claims["email"].(string); ok {
@@ -62,19 +59,197 @@ func JWTAuthMiddleware(secretKey string) gin.HandlerFunc {
 }
 
 // InternalAuthMiddleware validates internal service calls
-// 使用常量时间比较防止时序攻击
-func InternalAuthMiddleware(internalSecret string) gin.HandlerFunc {
+// 调用方通过 X-Caller-ID + X-Internal-Key 认证，scope 由 RequireScope 检查；
+// 已废弃的 X-Internal-Secret 视为拥有全部 scope。使用常量时间比较防止时序攻击
+func InternalAuthMiddleware(callers *CallerRegistry) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		secret := c.GetHeader("X-Internal-Secret")
-		if subtle.ConstantTimeCompare([]byte(secret), []byte(internalSecret)) != 1 {
+		callerID := c.GetHeader("X-Caller-ID")
+		scopes, ok := callers.Authenticate(callerID, c.GetHeader("X-Internal-Key"))
+		if !ok && callers.AuthenticateLegacy(c.GetHeader("X-Internal-Secret")) {
+			callerID, scopes, ok = legacyCallerID, []string{ScopeAll}, true
+		}
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized internal access"})
 			c.Abort()
 			return
 		}
+
+		c.Set(callerIDKey, callerID)
+		c.Set(callerScopesKey, scopes)
+		c.Request = c.Request.WithContext(models.WithCaller(c.Request.Context(), callerID))
+		c.Next()
+	}
+}
+
+// signatureTolerance 签名时间戳允许的最大偏差，超出视为重放
+const signatureTolerance = 5 * time.Minute
+
+// HostingWebhookAuthMiddleware verifies the HMAC signature of hosting-service webhooks
+// X-Hosting-Signature = hex(HMAC-SHA256(secret, X-Hosting-Timestamp + "." + body))
+func HostingWebhookAuthMiddleware(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := readSignedBody(c)
+		if !ok {
+			return
+		}
+
+		if err := verifySignature([]byte(secret), c.GetHeader("X-Hosting-Timestamp"), c.GetHeader("X-Hosting-Signature"), body); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid webhook signature: " + err.Error()})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CallbackTokenFunc returns the callback signing key of a resource
+type CallbackTokenFunc func(ctx context.Context, resourceID string) (string, error)
+
+// NodeCallbackAuthMiddleware verifies node agent callbacks signed with the per-provision token
+// X-Node-Signature = hex(HMAC-SHA256(callback_token, X-Node-Timestamp + "." + body))。
+// 密钥按请求体中的 resource_id 查找，节点只能为自己的 resource 回调；同一签名只接受一次。
+// allowLegacy 时未签名的请求仍可使用 X-Internal-Secret（已废弃）。
+func NodeCallbackAuthMiddleware(internalSecret string, allowLegacy bool, tokenFor CallbackTokenFunc) gin.HandlerFunc {
+	replay := newReplayGuard(2 * signatureTolerance)
+	return func(c *gin.Context) {
+		signature := c.GetHeader("X-Node-Signature")
+		if signature == "" {
+			secret := c.GetHeader("X-Internal-Secret")
+			if allowLegacy && subtle.ConstantTimeCompare([]byte(secret), []byte(internalSecret)) == 1 {
+				log.Printf("[Callback] DEPRECATED: unsigned node callback %s from %s using shared secret", c.FullPath(), c.ClientIP())
+				c.Next()
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing callback signature"})
+			c.Abort()
+			return
+		}
+
+		body, ok := readSignedBody(c)
+		if !ok {
+			return
+		}
+
+		var scope struct {
+			ResourceID string `json:"resource_id"`
+		}
+		if err := json.Unmarshal(body, &scope); err != nil || scope.ResourceID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resource_id is required"})
+			c.Abort()
+			return
+		}
+
+		// 查不到密钥和签名错误返回同样的结果，不暴露 resource 是否存在
+		token, err := tokenFor(c.Request.Context(), scope.ResourceID)
+		if err == nil {
+			err = verifySignature([]byte(token), c.GetHeader("X-Node-Timestamp"), signature, body)
+		}
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid callback signature"})
+			c.Abort()
+			return
+		}
+		if !replay.firstSeen(signature) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "callback already processed"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
+// replayGuardEvictInterval 清理过期签名的间隔
+const replayGuardEvictInterval = time.Minute
+
+// replayGuard remembers signatures seen within the signature tolerance window
+// 仅限单实例内存，多副本部署时由时间戳窗口兜底；过期签名由后台定时清理，请求路径上只做一次查找
+type replayGuard struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[string]time.Time
+}
+
+func newReplayGuard(ttl time.Duration) *replayGuard {
+	g := &replayGuard{ttl: ttl, seen: make(map[string]time.Time)}
+	go g.evictLoop(replayGuardEvictInterval)
+	return g
+}
+
+// firstSeen records the signature and reports whether it was new
+func (g *replayGuard) firstSeen(signature string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if at, ok := g.seen[signature]; ok && now.Sub(at) <= g.ttl {
+		return false
+	}
+	g.seen[signature] = now
+	return true
+}
+
+// evictLoop 定时删除超过 ttl 的签名（中间件随进程存在，无需停止）
+func (g *replayGuard) evictLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		g.evict(now)
+	}
+}
+
+func (g *replayGuard) evict(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for sig, at := range g.seen {
+		if now.Sub(at) > g.ttl {
+			delete(g.seen, sig)
+		}
+	}
+}
+
+// maxSignedBodyBytes 签名请求（webhook、节点回调）的请求体上限，签名校验前需要完整读入内存
+const maxSignedBodyBytes = 1 << 20
+
+// readSignedBody reads the request body for signature verification and restores it for the handler
+// 超过 maxSignedBodyBytes 返回 413；失败时已写入响应并中止
+func readSignedBody(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+		}
+		c.Abort()
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// verifySignature checks an HMAC-SHA256 signature over "timestamp.body"
+// timestamp 为 Unix 秒；signature 可带 "sha256=" 前缀
+func verifySignature(secret []byte, timestamp, signature string, body []byte) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > signatureTolerance || skew < -signatureTolerance {
+		return errors.New("timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(strings.TrimPrefix(signature, "sha256="))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
 // AdminAuthMiddleware validates admin API key
 // 使用常量时间比较防止时序攻击
 func AdminAuthMiddleware(adminAPIKey string) gin.HandlerFunc {
@@ -0,0 +1,162 @@
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testCallbackToken = "callback-token-res-1"
+
+func sign(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newCallbackRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	tokens := map[string]string{"res-1": testCallbackToken, "res-2": "callback-token-res-2"}
+	tokenFor := func(_ context.Context, resourceID string) (string, error) {
+		token, ok := tokens[resourceID]
+		if !ok {
+			return "", errors.New("not found")
+		}
+		return token, nil
+	}
+	r := gin.New()
+	r.POST("/callback", NodeCallbackAuthMiddleware("shared-secret", false, tokenFor), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func postCallback(r *gin.Engine, timestamp, signature, body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+	req.Header.Set("X-Node-Timestamp", timestamp)
+	if signature != "" {
+		req.Header.Set("X-Node-Signature", signature)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("webhook-secret")
+	body := []byte(`{"resource_id":"res-1"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	valid := sign(string(secret), now, string(body))
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		wantErr   bool
+	}{
+		{"valid", now, valid, false},
+		{"sha256 prefix", now, "sha256=" + valid, false},
+		{"missing timestamp", "", valid, true},
+		{"non-numeric timestamp", "yesterday", valid, true},
+		{"expired timestamp", strconv.FormatInt(time.Now().Add(-signatureTolerance-time.Minute).Unix(), 10), "", true},
+		{"future timestamp", strconv.FormatInt(time.Now().Add(signatureTolerance+time.Minute).Unix(), 10), "", true},
+		{"wrong signature", now, sign("other-secret", now, string(body)), true},
+		{"signature for another timestamp", now, sign(string(secret), "1", string(body)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature := tt.signature
+			if signature == "" {
+				signature = sign(string(secret), tt.timestamp, string(body))
+			}
+			err := verifySignature(secret, tt.timestamp, signature, body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySignature err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodeCallbackAuthMiddleware(t *testing.T) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	expired := strconv.FormatInt(time.Now().Add(-signatureTolerance-time.Minute).Unix(), 10)
+	body := `{"resource_id":"res-1","status":"ok"}`
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      string
+		want      int
+	}{
+		{"valid", now, sign(testCallbackToken, now, body), body, http.StatusNoContent},
+		{"missing signature", now, "", body, http.StatusUnauthorized},
+		{"bad timestamp", "not-a-time", sign(testCallbackToken, "not-a-time", body), body, http.StatusUnauthorized},
+		{"expired timestamp", expired, sign(testCallbackToken, expired, body), body, http.StatusUnauthorized},
+		{"missing resource_id", now, sign(testCallbackToken, now, `{}`), `{}`, http.StatusBadRequest},
+		// 节点用自己的密钥冒充其他 resource 回调
+		{"resource_id not matching token", now, sign(testCallbackToken, now, `{"resource_id":"res-2"}`), `{"resource_id":"res-2"}`, http.StatusUnauthorized},
+		{"unknown resource_id", now, sign(testCallbackToken, now, `{"resource_id":"res-9"}`), `{"resource_id":"res-9"}`, http.StatusUnauthorized},
+		{"tampered body", now, sign(testCallbackToken, now, body), `{"resource_id":"res-1","status":"failed"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newCallbackRouter(t)
+			if got := postCallback(r, tt.timestamp, tt.signature, tt.body); got != tt.want {
+				t.Fatalf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeCallbackAuthMiddlewareRejectsReplay(t *testing.T) {
+	r := newCallbackRouter(t)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	body := `{"resource_id":"res-1"}`
+	signature := sign(testCallbackToken, now, body)
+
+	if got := postCallback(r, now, signature, body); got != http.StatusNoContent {
+		t.Fatalf("first callback status = %d, want %d", got, http.StatusNoContent)
+	}
+	if got := postCallback(r, now, signature, body); got != http.StatusUnauthorized {
+		t.Fatalf("replayed callback status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+func TestReplayGuard(t *testing.T) {
+	g := &replayGuard{ttl: time.Minute, seen: make(map[string]time.Time)}
+
+	if !g.firstSeen("sig-1") {
+		t.Fatal("new signature reported as seen")
+	}
+	if g.firstSeen("sig-1") {
+		t.Fatal("repeated signature reported as new")
+	}
+	if !g.firstSeen("sig-2") {
+		t.Fatal("other signature reported as seen")
+	}
+
+	// 超过 ttl 的签名被清理，之后按新签名处理（时间戳窗口已经拒绝这类请求）
+	g.seen["sig-1"] = time.Now().Add(-2 * time.Minute)
+	g.evict(time.Now())
+	if _, ok := g.seen["sig-1"]; ok {
+		t.Error("expired signature not evicted")
+	}
+	if _, ok := g.seen["sig-2"]; !ok {
+		t.Error("live signature evicted")
+	}
+	if !g.firstSeen("sig-1") {
+		t.Error("evicted signature still reported as seen")
+	}
+}
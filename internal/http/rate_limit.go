@@ -0,0 +1,237 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// RateLimitResult is the outcome of one rate limit check
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int           // 本窗口剩余次数
+	Reset     time.Duration // 距离窗口内最早一次请求过期（恢复一次额度）的时间
+}
+
+// Limiter is a sliding-window rate limiter
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy config.RateLimitPolicy) (RateLimitResult, error)
+}
+
+// NewLimiter creates the limiter of the configured backend (memory or postgres)
+func NewLimiter(cfg config.RateLimitConfig, rateLimitRepo *repository.RateLimitRepository) (Limiter, error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewMemoryLimiter(), nil
+	case "postgres":
+		var maxWindow time.Duration
+		for _, p := range cfg.Policies {
+			maxWindow = max(maxWindow, p.Window)
+		}
+		return NewPostgresLimiter(rateLimitRepo, maxWindow), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+	}
+}
+
+// memorySweepInterval 内存限流器清理空闲 key 的间隔
+const memorySweepInterval = time.Minute
+
+type memoryBucket struct {
+	hits   []time.Time
+	window time.Duration
+}
+
+// MemoryLimiter 进程内速率限制器，仅适用于单副本部署
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+// NewMemoryLimiter creates an in-process limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*memoryBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow 检查是否允许请求
+func (rl *MemoryLimiter) Allow(ctx context.Context, key string, policy config.RateLimitPolicy) (RateLimitResult, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastSweep) > memorySweepInterval {
+		rl.sweepLocked(now)
+	}
+
+	b := rl.buckets[key]
+	if b == nil {
+		b = &memoryBucket{window: policy.Window}
+		rl.buckets[key] = b
+	}
+
+	// 清理过期请求
+	windowStart := now.Add(-policy.Window)
+	valid := b.hits[:0]
+	for _, t := range b.hits {
+		if t.After(windowStart) {
+			valid = append(valid, t)
+		}
+	}
+	b.hits = valid
+
+	// 检查是否超过限制
+	if len(b.hits) >= policy.Limit {
+		return RateLimitResult{Reset: b.hits[0].Add(policy.Window).Sub(now)}, nil
+	}
+
+	// 记录新请求
+	b.hits = append(b.hits, now)
+	return RateLimitResult{
+		Allowed:   true,
+		Remaining: policy.Limit - len(b.hits),
+		Reset:     b.hits[0].Add(policy.Window).Sub(now),
+	}, nil
+}
+
+// sweepLocked 删除窗口内已没有请求的 key，避免空闲 key 无限增长
+func (rl *MemoryLimiter) sweepLocked(now time.Time) {
+	for key, b := range rl.buckets {
+		if len(b.hits) == 0 || !b.hits[len(b.hits)-1].Add(b.window).After(now) {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// postgresPurgeInterval 清理所有 key 过期记录的间隔
+const postgresPurgeInterval = 10 * time.Minute
+
+// PostgresLimiter 基于 Postgres 的滑动窗口限流器，多副本共享计数
+type PostgresLimiter struct {
+	repo      *repository.RateLimitRepository
+	maxWindow time.Duration // 早于最长窗口的记录可以安全删除
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewPostgresLimiter creates a limiter backed by fulfillment.rate_limit_hits
+func NewPostgresLimiter(repo *repository.RateLimitRepository, maxWindow time.Duration) *PostgresLimiter {
+	return &PostgresLimiter{
+		repo:      repo,
+		maxWindow: maxWindow,
+		lastPurge: time.Now(),
+	}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, policy config.RateLimitPolicy) (RateLimitResult, error) {
+	l.purgeIfDue()
+
+	count, oldest, allowed, err := l.repo.Hit(ctx, key, policy.Limit, policy.Window)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:   allowed,
+		Remaining: max(policy.Limit-count, 0),
+		Reset:     max(time.Until(oldest.Add(policy.Window)), 0),
+	}, nil
+}
+
+// purgeIfDue 在后台删除空闲 key 的过期记录，每个副本每个间隔至多一次
+func (l *PostgresLimiter) purgeIfDue() {
+	l.mu.Lock()
+	if time.Since(l.lastPurge) < postgresPurgeInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.lastPurge = time.Now()
+	l.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if n, err := l.repo.DeleteBefore(ctx, time.Now().Add(-l.maxWindow)); err != nil {
+			log.Printf("[RateLimit] Failed to purge expired hits: %v", err)
+		} else if n > 0 {
+			log.Printf("[RateLimit] Purged %d expired hits", n)
+		}
+	}()
+}
+
+// RateLimitMiddleware 速率限制中间件，策略为 nil 或 Limit 为 0 时不限制
+func RateLimitMiddleware(limiter Limiter, name string, policy *config.RateLimitPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allowRequest(c, limiter, name, policy) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// allowRequest checks the policy and writes the RateLimit-* headers, or a 429 response when exceeded
+// 限流器出错时放行，避免数据库故障导致用户 API 全部不可用
+func allowRequest(c *gin.Context, limiter Limiter, name string, policy *config.RateLimitPolicy) bool {
+	if policy == nil || policy.Limit <= 0 {
+		return true
+	}
+
+	key := name + ":" + rateLimitKey(c, policy.KeyBy)
+	result, err := limiter.Allow(c.Request.Context(), key, *policy)
+	if err != nil {
+		log.Printf("[RateLimit] Check failed for %s, allowing request: %v", key, err)
+		return true
+	}
+
+	reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+	c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", reset)
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+
+	if !result.Allowed {
+		c.Header("Retry-After", reset)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "rate limit exceeded, please try again later",
+		})
+		return false
+	}
+	return true
+}
+
+// rateLimitPolicy returns the named policy, nil if not configured
+func rateLimitPolicy(policies map[string]config.RateLimitPolicy, name string) *config.RateLimitPolicy {
+	if p, ok := policies[name]; ok {
+		return &p
+	}
+	return nil
+}
+
+// rateLimitKey 按策略取限制 key：用户 ID、内部调用方或客户端 IP（取不到前两者时退回 IP）
+func rateLimitKey(c *gin.Context, keyBy string) string {
+	switch keyBy {
+	case "user":
+		if userID := c.GetString("userID"); userID != "" {
+			return "user:" + userID
+		}
+	case "caller":
+		if callerID := c.GetString(callerIDKey); callerID != "" {
+			return "caller:" + callerID
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
@@ -1,110 +1,55 @@
 package http
 
 import (
-	"net/http"
-	"sync"
-	"time"
+	"log"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/service"
 )
 
-// RateLimiter 简单的内存速率限制器
-type RateLimiter struct {
-	mu       sync.Mutex
-	requests map[string][]time.Time
-	limit    int           // 最大请求数
-	window   time.Duration // 时间窗口
-}
-
-// NewRateLimiter 创建速率限制器
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
-	}
-}
-
-// Allow 检查是否允许请求
-func (rl *RateLimiter) Allow(key string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
-
-	// 清理过期请求
-	var valid []time.Time
-	for _, t := range rl.requests[key] {
-		if t.After(windowStart) {
-			valid = append(valid, t)
-		}
-	}
-
-	// 检查是否超过限制
-	if len(valid) >= rl.limit {
-		rl.requests[key] = valid
-		return false
-	}
-
-	// 记录新请求
-	rl.requests[key] = append(valid, now)
-	return true
-}
-
-// RateLimitMiddleware 速率限制中间件
-func RateLimitMiddleware(rl *RateLimiter) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 使用用户 ID 或 IP 作为限制 key
-		key := c.GetString("userID")
-		if key == "" {
-			key = c.ClientIP()
-		}
-
-		if !rl.Allow(key) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "rate limit exceeded, please try again later",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
-
 type Server struct {
-	router  *gin.Engine
-	handler *Handler
-	cfg     *config.Config
-	db      *pgxpool.Pool
+	router      *gin.Engine
+	handler     *Handler
+	cfg         *config.Config
+	db          *pgxpool.Pool
+	jwtVerifier *JWTVerifier
+	limiter     Limiter
 }
 
-// 全局速率限制器: 每用户每分钟最多 30 次请求
-var userRateLimiter = NewRateLimiter(30, time.Minute)
-
-// 资源创建速率限制器: 每用户每小时最多 5 次创建请求
-// 说明: 业务规则限制每用户只能有一个托管节点，5 次足够处理重试和重建场景
-var createRateLimiter = NewRateLimiter(5, time.Hour)
-
-func NewServer(cfg *config.Config, db *pgxpool.Pool, provisionService *service.ProvisionService, vpnService *service.VPNService, entitlementService *service.EntitlementService) *Server {
+func NewServer(cfg *config.Config, db *pgxpool.Pool, provisionService *service.ProvisionService, vpnService *service.VPNService, entitlementService *service.EntitlementService, nodeHealthService *service.NodeHealthService) *Server {
 	gin.SetMode(cfg.Server.Mode)
 	router := gin.New()
 
+	// 只信任配置的反向代理传来的 X-Forwarded-For，否则客户端可伪造 IP 绕过按 IP 限流
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Global middleware
 	router.Use(gin.Recovery())
-	router.Use(gin.Logger())
+	router.Use(gin.LoggerWithFormatter(requestLogFormatter)) // 日志附带内部调用方
 
-	handler := NewHandler(provisionService, vpnService, entitlementService)
+	limiter, err := NewLimiter(cfg.RateLimit, repository.NewRateLimitRepository(db))
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	handler := NewHandler(provisionService, vpnService, entitlementService, nodeHealthService, limiter, cfg.RateLimit.Policies)
+
+	jwtVerifier, err := NewJWTVerifier(cfg.JWT)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT verifier: %v", err)
+	}
 
 	s := &Server{
-		router:  router,
-		handler: handler,
-		cfg:     cfg,
-		db:      db,
+		router:      router,
+		handler:     handler,
+		cfg:         cfg,
+		db:          db,
+		jwtVerifier: jwtVerifier,
+		limiter:     limiter,
 	}
 
 	s.setupRoutes()
@@ -120,60 +65,108 @@ func (s *Server) setupRoutes() {
 		})
 	})
 
+	// 内部调用方注册表（per-caller key + scope）
+	callers := NewCallerRegistry(s.cfg.InternalAuth, s.cfg.InternalSecret)
+
 	// Internal API - called by subscription-service
 	internal := s.router.Group("/api/internal")
-	internal.Use(InternalAuthMiddleware(s.cfg.InternalSecret))
+	internal.Use(InternalAuthMiddleware(callers), s.rateLimit("internal")) // 按调用方限流（默认不限）
 	{
 		// Provisioning
-		internal.POST("/provision", s.handler.Provision)
-		internal.POST("/deprovision", s.handler.Deprovision)
+		internal.POST("/provision", RequireScope(ScopeProvisionWrite), s.handler.Provision)
+		internal.POST("/deprovision", RequireScope(ScopeProvisionWrite), s.handler.Deprovision)
 
 		// Resource status queries
-		internal.GET("/resources/:id", s.handler.GetResourceStatus)
-		internal.GET("/subscriptions/:subscription_id/resources", s.handler.GetResourcesBySubscription)
+		internal.GET("/resources/:id", RequireScope(ScopeResourcesRead), s.handler.GetResourceStatus)
+		internal.GET("/subscriptions/:subscription_id/resources", RequireScope(ScopeResourcesRead), s.handler.GetResourcesBySubscription)
 
 		// User resource queries (called by user-portal)
-		internal.GET("/users/:user_id/resources", s.handler.GetUserResources)
+		internal.GET("/users/:user_id/resources", RequireScope(ScopeResourcesRead), s.handler.GetUserResources)
 
 		// VPN subscribe config (called by user-portal)
-		internal.GET("/vpn/user/:user_id/subscribe", s.handler.GetUserVPNSubscribe)
+		internal.GET("/vpn/user/:user_id/subscribe", RequireScope(ScopeResourcesRead), s.handler.GetUserVPNSubscribe)
 
 		// VPN status (lightweight, no protocols - called by user-portal)
-		internal.GET("/vpn/user/:user_id/status", s.handler.GetUserVPNQuickStatus)
+		internal.GET("/vpn/user/:user_id/status", RequireScope(ScopeResourcesRead), s.handler.GetUserVPNQuickStatus)
+
+		// VPN pause / resume (support / user-portal)
+		internal.POST("/vpn/user/:user_id/pause", RequireScope(ScopeVPNWrite), s.handler.PauseUserVPN)
+		internal.POST("/vpn/user/:user_id/resume", RequireScope(ScopeVPNWrite), s.handler.ResumeUserVPN)
+
+		// Node credential rotation (admin)
+		internal.POST("/resources/:id/rotate-credentials", RequireScope(ScopeNodesAdmin), s.handler.RotateResourceCredentials)
+
+		// Swap a node's public IP (admin, not counted against the user's quota)
+		internal.POST("/resources/:id/change-ip", RequireScope(ScopeNodesAdmin), s.handler.ChangeResourceIP)
+
+		// Node reachability: external vantage-point reports and admin views
+		internal.POST("/resources/:id/probes", RequireScope(ScopeProbesWrite), s.handler.ReportNodeProbes)
+		internal.GET("/resources/:id/probes", RequireScope(ScopeNodesAdmin), s.handler.GetNodeProbes)
+		internal.GET("/nodes/health", RequireScope(ScopeNodesAdmin), s.handler.GetNodeHealthReport)
+
+		// Resume a suspended hosting node (admin)
+		internal.POST("/resources/:id/resume", RequireScope(ScopeNodesAdmin), s.handler.ResumeResource)
 
 		// VPN resource update (extend/upgrade)
-		internal.PUT("/resources/:id/vpn", s.handler.UpdateVPNResource)
+		internal.PUT("/resources/:id/vpn", RequireScope(ScopeProvisionWrite), s.handler.UpdateVPNResource)
 
 		// User email update (auth-service → subscription-service → fulfillment-service)
-		internal.PUT("/users/:user_id/email", s.handler.UpdateUserEmail)
+		internal.PUT("/users/:user_id/email", RequireScope(ScopeUsersWrite), s.handler.UpdateUserEmail)
 
 		// Entitlement management (admin)
-		internal.POST("/entitlements/gift", s.handler.GiftEntitlement)
-		internal.GET("/entitlements", s.handler.ListEntitlements)
+		internal.POST("/entitlements/gift", RequireScope(ScopeEntitlementsAdmin), s.handler.GiftEntitlement)
+		internal.GET("/entitlements", RequireScope(ScopeEntitlementsAdmin), s.handler.ListEntitlements)
+		internal.POST("/entitlements/:id/revoke", RequireScope(ScopeEntitlementsAdmin), s.handler.RevokeEntitlement)
+		internal.GET("/entitlements/ledger", RequireScope(ScopeEntitlementsAdmin), s.handler.GetEntitlementLedger)
+
+		// Voucher batches (admin)
+		internal.POST("/vouchers/batches", RequireScope(ScopeEntitlementsAdmin), s.handler.CreateVoucherBatch)
+		internal.GET("/vouchers/batches/:batch_id/export", RequireScope(ScopeEntitlementsAdmin), s.handler.ExportVoucherBatch)
+
+		// Trial eligibility review (admin)
+		internal.GET("/trial/attempts", RequireScope(ScopeEntitlementsAdmin), s.handler.ListTrialAttempts)
+		internal.POST("/trial/attempts/:id/override", RequireScope(ScopeEntitlementsAdmin), s.handler.OverrideTrialAttempt)
 	}
 
-	// Node callback API - called by node-agent
+	// Node callback API - called by node-agent (HMAC signed with the per-provision callback token)
 	callback := s.router.Group("/api/callback")
-	callback.Use(InternalAuthMiddleware(s.cfg.InternalSecret))
+	callback.Use(NodeCallbackAuthMiddleware(s.cfg.InternalSecret, s.cfg.Node.LegacyCallbackAuth, s.handler.provisionService.CallbackToken))
 	{
 		callback.POST("/node/ready", s.handler.NodeReady)
 		callback.POST("/node/failed", s.handler.NodeFailed)
 	}
 
+	// Webhook API - node status changes pushed by hosting-service (HMAC signed)
+	if s.cfg.Hosting.WebhookSecret != "" {
+		webhooks := s.router.Group("/api/webhooks")
+		webhooks.Use(HostingWebhookAuthMiddleware(s.cfg.Hosting.WebhookSecret))
+		{
+			webhooks.POST("/hosting/nodes", s.handler.HostingNodeEvent)
+		}
+	}
+
 	// User API - requires JWT authentication
 	user := s.router.Group("/api/v1")
-	user.Use(JWTAuthMiddleware(s.cfg.JWT.SecretKey))
-	user.Use(RateLimitMiddleware(userRateLimiter)) // 用户 API 速率限制
+	user.Use(JWTAuthMiddleware(s.jwtVerifier))
+	user.Use(s.rateLimit("user")) // 用户 API 速率限制
 	{
 		// Hosting Node management
 		user.GET("/my/node", s.handler.GetMyNode) // 获取节点状态（含订阅信息）
 		// 创建节点使用更严格的速率限制
-		user.POST("/my/node", RateLimitMiddleware(createRateLimiter), s.handler.CreateMyNode)
+		user.POST("/my/node", s.rateLimit("create"), s.handler.CreateMyNode)
 		user.DELETE("/my/node", s.handler.DeleteMyNode) // 删除节点
+		user.POST("/my/node/rotate-credentials", s.rateLimit("rotate"), s.handler.RotateMyNodeCredentials)
+		user.POST("/my/node/change-ip", s.rateLimit("rotate"), s.handler.ChangeMyNodeIP)
+		user.POST("/my/node/actions", s.handler.NodeActionMyNode)  // 重启/关机/开机（按操作限流）
+		user.GET("/my/node/timeline", s.handler.GetMyNodeTimeline) // 节点操作记录
 
 		// VPN management
 		user.GET("/my/vpn", s.handler.GetMyVPN)                    // 获取 VPN 状态
 		user.GET("/my/vpn/subscribe", s.handler.GetMyVPNSubscribe) // 获取 VPN 订阅配置
+		user.POST("/my/vpn/trial", s.rateLimit("create"), s.handler.ActivateMyTrial) // 开通试用
+		user.POST("/my/vpn/redeem", s.rateLimit("create"), s.handler.RedeemMyVoucher) // 兑换码兑换
+		user.POST("/my/vpn/pause", s.handler.PauseMyVPN)   // 暂停套餐
+		user.POST("/my/vpn/resume", s.handler.ResumeMyVPN) // 恢复套餐
 
 		// Regions
 		user.GET("/regions", s.handler.GetRegions)
@@ -188,7 +181,7 @@ func (s *Server) setupRoutes() {
 
 	// Internal Admin API (供 user-portal 调用，需要 Internal Secret)
 	internalAdmin := s.router.Group("/api/internal/admin")
-	internalAdmin.Use(InternalAuthMiddleware(s.cfg.InternalSecret))
+	internalAdmin.Use(InternalAuthMiddleware(callers), RequireScope(ScopeAdminDB))
 	{
 		// DB Browser API (通用数据库浏览)
 		dbAdminHandler := NewDBAdminHandler(s.db, "fulfillment")
@@ -201,6 +194,11 @@ func (s *Server) setupRoutes() {
 	}
 }
 
+// rateLimit 按 RATE_LIMIT_POLICIES 中的策略名限流
+func (s *Server) rateLimit(name string) gin.HandlerFunc {
+	return RateLimitMiddleware(s.limiter, name, rateLimitPolicy(s.cfg.RateLimit.Policies, name))
+}
+
 func (s *Server) Run(addr string) error {
 	return s.router.Run(addr)
 }
@@ -0,0 +1,17 @@
+package models
+
+import "context"
+
+type callerKey struct{}
+
+// WithCaller attaches the authenticated internal API caller to a request context
+// 请求内写入的操作记录（provision_logs）会带上 caller
+func WithCaller(ctx context.Context, callerID string) context.Context {
+	return context.WithValue(ctx, callerKey{}, callerID)
+}
+
+// CallerFromContext returns the internal API caller of the request, "" if none
+func CallerFromContext(ctx context.Context) string {
+	callerID, _ := ctx.Value(callerKey{}).(string)
+	return callerID
+}
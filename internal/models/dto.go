@@ -1,12 +1,14 @@
 package models
 
+import "time"
+
 // ==================== Internal API DTOs ====================
 
 // ProvisionRequest is sent by subscription-service to create a resource
 type ProvisionRequest struct {
 	// Three-level classification (new fields, preferred)
 	AppSource    string `json:"app_source"`    // otun / obox
-	BusinessType string `json:"business_type"` // purchase / subscription / trial / gift
+	BusinessType string `json:"business_type"` // purchase / subscription / trial / gift / topup
 	Channel      string `json:"channel"`       // apple, google, stripe, credit
 
 	// Association
@@ -25,6 +27,12 @@ type ProvisionRequest struct {
 	ProductID    string `json:"product_id,omitempty"`
 	PurchaseType string `json:"purchase_type,omitempty"` // subscription, one_time
 
+	// 商店上报的到期时间与订阅周期（apple/google）。
+	// 提供 expires_at 时 VPN 到期 = expires_at + 宽限期；仅提供 period 时按周期计算；
+	// 两者都没有时保留旧的 30 天逻辑（兼容老调用方）
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Period    string     `json:"period,omitempty" binding:"omitempty,oneof=weekly monthly yearly"`
+
 	// Trial-specific
 	DeviceID string `json:"device_id,omitempty"`
 }
@@ -43,6 +51,9 @@ type DeprovisionRequest struct {
 	SubscriptionID string `json:"subscription_id" binding:"required"`
 	ResourceID     string `json:"resource_id"`
 	Reason         string `json:"reason"`
+
+	// true: 立即删除（用户主动删除）；false: 按 HOSTING_SUSPEND_GRACE_HOURS 先停机保留
+	Immediate bool `json:"immediate"`
 }
 
 // DeprovisionResponse is returned after starting deprovisioning
@@ -89,6 +100,9 @@ const (
 	HostingStatusNodeActive          HostingStatus = "node_active"          // 节点正常运行
 	HostingStatusNodeFailed          HostingStatus = "node_failed"          // 节点创建失败
 	HostingStatusSubscriptionExpired HostingStatus = "subscription_expired" // 订阅已过期
+	HostingStatusNodeSuspended       HostingStatus = "node_suspended"       // 订阅失效，节点停机保留中
+	HostingStatusNodeStopped         HostingStatus = "node_stopped"         // 用户主动关机
+	HostingStatusNodeRestarting      HostingStatus = "node_restarting"      // 重启/开机/关机进行中
 )
 
 // UserNodeStatusResponse is returned to users querying their node
@@ -126,6 +140,10 @@ type NodeCreationProgress struct {
 	TotalSteps  int    `json:"total_steps"`  // 4
 	StepName    string `json:"step_name"`    // 当前步骤名称
 	Steps       []NodeCreationStep `json:"steps"`
+
+	// 等待创建名额时的排队信息
+	QueuePosition        int `json:"queue_position,omitempty"`         // 队列中的位置，从 1 开始
+	EstimatedWaitSeconds int `json:"estimated_wait_seconds,omitempty"` // 预计排队等待秒数
 }
 
 // NodeCreationStep represents a single creation step
@@ -154,6 +172,19 @@ type UserNodeInfo struct {
 	TrafficUsedGB  float64 `json:"traffic_used_gb"`
 	TrafficPercent float64 `json:"traffic_percent"`
 	CreatedAt      string  `json:"created_at"`
+
+	// 停机保留截止时间，之后节点被删除（仅 node_suspended）
+	SuspendedUntil string `json:"suspended_until,omitempty"`
+
+	// 可达性探测结果（仅 active 节点）
+	Health *NodeHealthInfo `json:"health,omitempty"`
+}
+
+// NodeHealthInfo is the reachability status of a node
+type NodeHealthInfo struct {
+	Status              string `json:"status"` // unknown, healthy, degraded, blocked
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastProbedAt        string `json:"last_probed_at,omitempty"`
 }
 
 // RegionListResponse is the list of available regions
@@ -194,6 +225,123 @@ type CreateNodeResponse struct {
 	Message          string                `json:"message"`
 }
 
+// RotateCredentialsResponse is returned after regenerating node credentials
+type RotateCredentialsResponse struct {
+	Success          bool    `json:"success"`
+	ResourceID       string  `json:"resource_id,omitempty"`
+	APIKey           *string `json:"api_key,omitempty"`
+	PublicKey        *string `json:"public_key,omitempty"`
+	ShortID          *string `json:"short_id,omitempty"`
+	OldKeyValidUntil string  `json:"old_key_valid_until,omitempty"`
+	Message          string  `json:"message"`
+}
+
+// ChangeIPRequest is for swapping a node's public IP
+type ChangeIPRequest struct {
+	Reason string `json:"reason" binding:"max=256"` // 可选，如 "blocked"；最长 256 字符
+}
+
+// ChangeIPResponse is returned after swapping a node's public IP
+type ChangeIPResponse struct {
+	Success      bool   `json:"success"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	PublicIP     string `json:"public_ip,omitempty"`
+	PreviousIP   string `json:"previous_ip,omitempty"`
+	ChangesUsed  int    `json:"changes_used,omitempty"`  // 本月已用次数
+	ChangesLimit int    `json:"changes_limit,omitempty"` // 本月配额
+	Message      string `json:"message"`
+}
+
+// Node power actions (user-initiated)
+const (
+	NodeActionReboot = "reboot"
+	NodeActionStop   = "stop"
+	NodeActionStart  = "start"
+)
+
+// NodeActionRequest is for user-initiated node power actions
+type NodeActionRequest struct {
+	Action string `json:"action" binding:"required,oneof=reboot stop start"`
+}
+
+// NodeActionResponse is returned after a node power action is accepted
+type NodeActionResponse struct {
+	Success    bool   `json:"success"`
+	ResourceID string `json:"resource_id,omitempty"`
+	Action     string `json:"action"`
+	Status     string `json:"status,omitempty"` // rebooting, stopping, starting
+	Message    string `json:"message"`
+}
+
+// NodeTimelineEntry is one event in the provision timeline
+type NodeTimelineEntry struct {
+	Action    string                 `json:"action"`
+	Status    string                 `json:"status"`
+	Message   string                 `json:"message,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt string                 `json:"created_at"`
+}
+
+// NodeTimelineResponse lists recent events of the user's node, newest first
+type NodeTimelineResponse struct {
+	ResourceID string              `json:"resource_id"`
+	Events     []NodeTimelineEntry `json:"events"`
+}
+
+// ==================== Node Probe DTOs ====================
+
+// NodeProbeCheckReport is one check reported by an external vantage point
+type NodeProbeCheckReport struct {
+	Check     string `json:"check" binding:"required,max=32"` // vless_tcp, ss_tcp, agent_health, ...
+	Success   bool   `json:"success"`
+	LatencyMS int    `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// NodeProbeReportRequest is sent by external vantage-point probes
+type NodeProbeReportRequest struct {
+	Source string                 `json:"source" binding:"required,max=64"` // 探测点标识，如 cn-shanghai-1
+	Checks []NodeProbeCheckReport `json:"checks" binding:"required,min=1,dive"`
+}
+
+// NodeProbeResultInfo is one stored probe result
+type NodeProbeResultInfo struct {
+	Source    string `json:"source"`
+	Check     string `json:"check"`
+	Success   bool   `json:"success"`
+	LatencyMS int    `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	ProbedAt  string `json:"probed_at"`
+}
+
+// NodeProbeResultsResponse lists recent probe results of a node
+type NodeProbeResultsResponse struct {
+	ResourceID   string                `json:"resource_id"`
+	HealthStatus string                `json:"health_status"`
+	Results      []NodeProbeResultInfo `json:"results"`
+}
+
+// NodeHealthReportItem is one node in the admin health report
+type NodeHealthReportItem struct {
+	ResourceID            string `json:"resource_id"`
+	UserID                string `json:"user_id"`
+	Region                string `json:"region"`
+	PublicIP              string `json:"public_ip"`
+	HealthStatus          string `json:"health_status"`
+	ProbeFailures         int    `json:"probe_failures"`
+	ExternalProbeFailures int    `json:"external_probe_failures"`
+	LastProbedAt          string `json:"last_probed_at,omitempty"`
+	HealthChangedAt       string `json:"health_changed_at,omitempty"`
+}
+
+// NodeHealthReport summarizes reachability of all active nodes (admin)
+type NodeHealthReport struct {
+	GeneratedAt string                 `json:"generated_at"`
+	Total       int                    `json:"total"`
+	Counts      map[string]int         `json:"counts"` // 按 health_status 计数
+	Nodes       []NodeHealthReportItem `json:"nodes"`  // 非 healthy 的节点
+}
+
 // ==================== Callback DTOs ====================
 
 // NodeReadyCallback is sent by node agent when ready
@@ -218,12 +366,13 @@ type NodeFailedCallback struct {
 
 // SubscriptionCallback is sent to subscription-service on status changes (v3.1 简化版)
 type SubscriptionCallback struct {
-	SubscriptionID string `json:"subscription_id" binding:"required"`
-	App            string `json:"app" binding:"required"`    // otun, obox
-	Status         string `json:"status" binding:"required"` // active, failed, deleted
-	Reason         string `json:"reason,omitempty"`          // 删除原因：user_initiated（用户主动删除VPS）, subscription_cancelled（订阅取消）
-	Error          string `json:"error,omitempty"`
-	Message        string `json:"message,omitempty"`
+	SubscriptionID string            `json:"subscription_id" binding:"required"`
+	App            string            `json:"app" binding:"required"`    // otun, obox
+	Status         string            `json:"status" binding:"required"` // active, failed, deleted
+	Reason         string            `json:"reason,omitempty"`          // 删除原因：user_initiated（用户主动删除VPS）, subscription_cancelled（订阅取消）
+	Error          string            `json:"error,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"` // 结构化附加信息，如撤销时的 refund_type、revoke_reason
 }
 
 // ==================== VPN User DTOs ====================
@@ -236,6 +385,7 @@ const (
 	VPNStatusActive              VPNStatus = "active"               // VPN 正常可用
 	VPNStatusExpired             VPNStatus = "expired"              // 已过期
 	VPNStatusDisabled            VPNStatus = "disabled"             // 已禁用
+	VPNStatusPaused              VPNStatus = "paused"               // 用户主动暂停
 )
 
 // VPNStatusResponse is returned to users querying their VPN status
@@ -266,6 +416,45 @@ type VPNUserInfo struct {
 	TrafficPercent float64 `json:"traffic_percent"`
 	ExpireAt       string  `json:"expire_at,omitempty"`
 	CreatedAt      string  `json:"created_at"`
+
+	// 加油包剩余流量（基础额度用完后才开始消耗）
+	TopUpRemainingGB float64 `json:"topup_remaining_gb,omitempty"`
+
+	// 长周期套餐的当前流量周期（未启用周期时为空）
+	TrafficCycle *TrafficCycleInfo `json:"traffic_cycle,omitempty"`
+
+	// 暂停状态（仅 paused 时返回）
+	Pause *VPNPauseInfo `json:"pause,omitempty"`
+}
+
+// VPNPauseInfo describes a paused VPN plan
+type VPNPauseInfo struct {
+	PausedAt           string  `json:"paused_at"`
+	AutoResumeAt       string  `json:"auto_resume_at,omitempty"`
+	RemainingDays      float64 `json:"remaining_days"`       // 暂停时剩余的套餐天数
+	RemainingTrafficGB float64 `json:"remaining_traffic_gb"` // 暂停时剩余的流量
+	PausesUsed         int     `json:"pauses_used"`
+	PausesAllowed      int     `json:"pauses_allowed"`
+}
+
+// VPNPauseRequest is the body of the pause/resume endpoints
+type VPNPauseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// VPNPauseResponse is returned by the pause/resume endpoints
+type VPNPauseResponse struct {
+	ResourceID string        `json:"resource_id"`
+	Status     string        `json:"status"`
+	ExpireAt   string        `json:"expire_at,omitempty"`
+	Pause      *VPNPauseInfo `json:"pause,omitempty"`
+}
+
+// TrafficCycleInfo describes the current traffic reset cycle of a long-term plan
+type TrafficCycleInfo struct {
+	AllowanceGB float64 `json:"allowance_gb"`
+	StartedAt   string  `json:"started_at"`
+	ResetsAt    string  `json:"resets_at"`
 }
 
 // VPNSubscribeResponse is returned when getting VPN subscription config
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // ==================== Trial Config DTO ====================
 
 // TrialConfigResponse is returned by GET /api/v1/public/trial/config
@@ -9,6 +11,49 @@ type TrialConfigResponse struct {
 	TrafficGB     int  `json:"traffic_gb"`
 }
 
+// ==================== Trial Activation DTOs ====================
+
+// TrialActivationRequest is the request for POST /api/v1/my/vpn/trial
+type TrialActivationRequest struct {
+	DeviceID string `json:"device_id" binding:"required"`
+}
+
+// TrialActivationResponse is returned by POST /api/v1/my/vpn/trial
+type TrialActivationResponse struct {
+	EntitlementID string        `json:"entitlement_id"`
+	OtunUUID      string        `json:"otun_uuid"`
+	TrafficLimit  int64         `json:"traffic_limit"`
+	ExpireAt      string        `json:"expire_at"`
+	Protocols     []VPNProtocol `json:"protocols"`
+}
+
+// TrialAttemptInfo is the admin view of a trial eligibility evaluation
+type TrialAttemptInfo struct {
+	ID               string   `json:"id"`
+	UserID           string   `json:"user_id"`
+	Email            string   `json:"email"`
+	NormalizedEmail  string   `json:"normalized_email"`
+	DeviceID         string   `json:"device_id"`
+	IPAddress        string   `json:"ip_address"`
+	Decision         string   `json:"decision"`
+	Score            int      `json:"score"`
+	Reasons          []string `json:"reasons"`
+	OverrideDecision *string  `json:"override_decision,omitempty"`
+	OverriddenBy     *string  `json:"overridden_by,omitempty"`
+	OverrideNote     *string  `json:"override_note,omitempty"`
+	OverrideExpires  string   `json:"override_expires_at,omitempty"`
+	EffectiveResult  string   `json:"effective_decision"`
+	CreatedAt        string   `json:"created_at"`
+}
+
+// TrialOverrideRequest is the request for POST /api/internal/trial/attempts/:id/override
+type TrialOverrideRequest struct {
+	Decision     string `json:"decision" binding:"required,oneof=allow deny"`
+	OverriddenBy string `json:"overridden_by" binding:"required"`
+	Note         string `json:"note"`
+	ValidDays    int    `json:"valid_days" binding:"omitempty,min=1,max=365"` // 默认 TRIAL_OVERRIDE_DAYS
+}
+
 // ==================== Admin Gift DTOs ====================
 
 // GiftEntitlementRequest is the request for POST /api/internal/entitlements/gift
@@ -30,6 +75,114 @@ type GiftEntitlementResponse struct {
 	Protocols     []VPNProtocol `json:"protocols"`
 }
 
+// RevokeEntitlementRequest is the request for POST /api/internal/entitlements/:id/revoke
+type RevokeEntitlementRequest struct {
+	Reason     string `json:"reason" binding:"required"`
+	RefundType string `json:"refund_type" binding:"omitempty,oneof=none full partial chargeback"`
+	RevokedBy  string `json:"revoked_by"`
+}
+
+// RevokeEntitlementResponse is returned by POST /api/internal/entitlements/:id/revoke
+// OtunAction: disabled（账本中无其他有效授予）, restored（按剩余授予重新计算）, unchanged（无 otun 用户）
+type RevokeEntitlementResponse struct {
+	EntitlementID         string `json:"entitlement_id"`
+	Status                string `json:"status"`
+	OtunAction            string `json:"otun_action"`
+	FallbackEntitlementID string `json:"fallback_entitlement_id,omitempty"`
+	TrafficLimit          int64  `json:"traffic_limit,omitempty"`
+	ExpireAt              string `json:"expire_at,omitempty"`
+}
+
+// ==================== Entitlement Ledger DTOs ====================
+
+// EntitlementGrantInfo is the admin view of one ledger grant
+type EntitlementGrantInfo struct {
+	ID             string  `json:"id"`
+	VPNProvisionID string  `json:"vpn_provision_id"`
+	Source         string  `json:"source"`
+	SourceRef      string  `json:"source_ref"`
+	TrafficBytes   int64   `json:"traffic_bytes"`
+	StartsAt       string  `json:"starts_at"`
+	EndsAt         string  `json:"ends_at"`
+	Priority       int     `json:"priority"`
+	ServiceTier    string  `json:"service_tier"`
+	Additive       bool    `json:"additive"`
+	Status         string  `json:"status"`
+	CreatedAt      string  `json:"created_at"`
+	ClosedAt       *string `json:"closed_at,omitempty"`
+}
+
+// ResolvedEntitlementInfo is the effective entitlement computed from active grants
+type ResolvedEntitlementInfo struct {
+	Active             bool   `json:"active"`
+	TrafficLimit       int64  `json:"traffic_limit"`
+	BaseTrafficLimit   int64  `json:"base_traffic_limit"`
+	TopUpTraffic       int64  `json:"topup_traffic"`
+	ExpireAt           string `json:"expire_at,omitempty"`
+	ServiceTier        string `json:"service_tier"`
+	PrimaryGrantID     string `json:"primary_grant_id,omitempty"`
+	PrimaryProvisionID string `json:"primary_provision_id,omitempty"`
+}
+
+// EntitlementLedgerResponse is returned by GET /api/internal/entitlements/ledger
+type EntitlementLedgerResponse struct {
+	UserID   string                  `json:"user_id"`
+	Resolved ResolvedEntitlementInfo `json:"resolved"`
+	Grants   []*EntitlementGrantInfo `json:"grants"`
+}
+
+// ==================== Voucher DTOs ====================
+
+// CreateVoucherBatchRequest is the request for POST /api/internal/vouchers/batches
+type CreateVoucherBatchRequest struct {
+	Campaign       string     `json:"campaign" binding:"required"`
+	Count          int        `json:"count" binding:"required,min=1,max=10000"`
+	TrafficGB      int        `json:"traffic_gb" binding:"required,min=1"`
+	DurationDays   int        `json:"duration_days" binding:"required,min=1"`
+	ServiceTier    string     `json:"service_tier"`
+	MaxRedemptions int        `json:"max_redemptions"`
+	ValidFrom      *time.Time `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until"`
+	CreatedBy      string     `json:"created_by"`
+}
+
+// VoucherInfo is the admin view of a voucher code
+type VoucherInfo struct {
+	ID             string `json:"id"`
+	Code           string `json:"code"`
+	BatchID        string `json:"batch_id"`
+	Campaign       string `json:"campaign"`
+	TrafficGB      int    `json:"traffic_gb"`
+	DurationDays   int    `json:"duration_days"`
+	ServiceTier    string `json:"service_tier"`
+	MaxRedemptions int    `json:"max_redemptions"`
+	RedeemedCount  int    `json:"redeemed_count"`
+	ValidFrom      string `json:"valid_from"`
+	ValidUntil     string `json:"valid_until"`
+}
+
+// VoucherBatchResponse is returned after generating a batch
+type VoucherBatchResponse struct {
+	BatchID  string         `json:"batch_id"`
+	Campaign string         `json:"campaign"`
+	Count    int            `json:"count"`
+	Vouchers []*VoucherInfo `json:"vouchers"`
+}
+
+// RedeemVoucherRequest is the request for POST /api/v1/my/vpn/redeem
+type RedeemVoucherRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RedeemVoucherResponse is returned after a successful redemption
+type RedeemVoucherResponse struct {
+	EntitlementID string        `json:"entitlement_id"`
+	OtunUUID      string        `json:"otun_uuid"`
+	TrafficLimit  int64         `json:"traffic_limit"`
+	ExpireAt      string        `json:"expire_at"`
+	Protocols     []VPNProtocol `json:"protocols"`
+}
+
 // ==================== Admin Query DTOs ====================
 
 // EntitlementInfo is the admin view of a vpn provision
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Entitlement grant sources
+const (
+	GrantSourceSubscription = "subscription"
+	GrantSourcePurchase     = "purchase"
+	GrantSourceTrial        = "trial"
+	GrantSourceGift         = "gift"
+	GrantSourceVoucher      = "voucher"
+	GrantSourceAdjustment   = "adjustment"
+	GrantSourceTopUp        = "topup"
+)
+
+// Entitlement grant status constants
+const (
+	GrantStatusActive     = "active"
+	GrantStatusSuperseded = "superseded"
+	GrantStatusRevoked    = "revoked"
+)
+
+// EntitlementGrant is one append-only line in a user's entitlement ledger
+type EntitlementGrant struct {
+	ID             string
+	UserID         string
+	VPNProvisionID string
+
+	Source    string
+	SourceRef string
+
+	TrafficBytes int64
+	StartsAt     time.Time
+	EndsAt       time.Time
+	Priority     int
+	ServiceTier  string
+
+	// Additive grants (top-ups) add bytes on top of the base allowance
+	// and never extend the expiry
+	Additive bool
+
+	Status string
+
+	CreatedAt time.Time
+	ClosedAt  *time.Time
+}
+
+// GrantPriorityForSource returns the default priority of a grant source
+// Paid grants decide the service tier over free ones.
+func GrantPriorityForSource(source string) int {
+	switch source {
+	case GrantSourceSubscription, GrantSourcePurchase, GrantSourceAdjustment:
+		return 100
+	case GrantSourceGift, GrantSourceVoucher:
+		return 50
+	default:
+		return 10
+	}
+}
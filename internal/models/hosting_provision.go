@@ -23,6 +23,18 @@ type HostingProvision struct {
 	PublicKey *string
 	ShortID   *string
 
+	// Credential rotation (旧 APIKey 在重叠窗口内仍有效)
+	PreviousAPIKey          *string
+	PreviousAPIKeyExpiresAt *time.Time
+	CredentialsRotatedAt    *time.Time
+
+	// Node callback signing key (每个 provision 独立，下发给节点 agent)
+	CallbackToken *string
+
+	// 凭据列的密文。查询时只读出密文，APIKey/PreviousAPIKey/CallbackToken 为空，
+	// 需要下发凭据时调用 HostingProvisionRepository.OpenCredentials 解密
+	Sealed SealedHostingCredentials
+
 	// Status and plan
 	Status       string
 	ErrorMessage *string
@@ -33,8 +45,28 @@ type HostingProvision struct {
 	// Cleanup tracking
 	NeedsCleanup bool // 标记是否需要后台清理（VPS 创建失败但删除也失败时设置）
 
+	// Suspension (订阅失效后停机保留，SuspendUntil 之后删除)
+	SuspendedAt   *time.Time
+	SuspendUntil  *time.Time
+	SuspendReason *string
+
+	// Reachability (由 ProbeScheduler 和外部探测点更新)
+	HealthStatus          string
+	ProbeFailures         int
+	ExternalProbeFailures int
+	LastProbedAt          *time.Time
+	HealthChangedAt       *time.Time
+	HostingFailedAt       *time.Time // hosting-service 报告节点 failed，期间保持 degraded
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	ReadyAt   *time.Time
 	DeletedAt *time.Time
 }
+
+// SealedHostingCredentials holds the encrypted credential columns of a provision as stored
+type SealedHostingCredentials struct {
+	APIKey         *string
+	PreviousAPIKey *string
+	CallbackToken  *string
+}
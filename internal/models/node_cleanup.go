@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// NodeCleanup is a cloud instance whose deletion failed and is retried by CleanupScheduler
+type NodeCleanup struct {
+	HostingNodeID      string
+	HostingProvisionID *string
+	CreatedAt          time.Time
+}
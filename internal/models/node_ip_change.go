@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// IP change status
+const (
+	IPChangeStatusPending   = "pending" // 已预留配额，等待 hosting-service 更换
+	IPChangeStatusCompleted = "completed"
+)
+
+// NodeIPChange records one public IP swap of a hosting node
+type NodeIPChange struct {
+	ID                 string
+	HostingProvisionID string
+	UserID             string
+	HostingNodeID      string
+
+	OldIP       *string
+	NewIP       *string // pending 时为空
+	Reason      string
+	InitiatedBy string // user, admin
+	Status      string
+
+	CreatedAt time.Time
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Node health status constants (hosting_provisions.health_status)
+const (
+	NodeHealthUnknown  = "unknown"
+	NodeHealthHealthy  = "healthy"
+	NodeHealthDegraded = "degraded" // 本服务探测连续失败
+	NodeHealthBlocked  = "blocked"  // 本服务探测正常，外部探测点连续失败（IP 疑似被封锁）
+)
+
+// ProbeSourceInternal marks results produced by this service's own probers
+const ProbeSourceInternal = "internal"
+
+// Probe check names
+const (
+	ProbeCheckVlessTCP    = "vless_tcp"
+	ProbeCheckSSTCP       = "ss_tcp"
+	ProbeCheckAgentHealth = "agent_health"
+)
+
+// NodeProbeResult is one reachability check of a hosting node
+type NodeProbeResult struct {
+	ID                 int64
+	HostingProvisionID string
+	Source             string
+	Check              string
+	Success            bool
+	LatencyMS          int
+	Error              *string
+	ProbedAt           time.Time
+}
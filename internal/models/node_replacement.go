@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Node replacement status constants
+const (
+	ReplacementStatusInProgress = "in_progress"
+	ReplacementStatusCompleted  = "completed"
+	ReplacementStatusFailed     = "failed"
+)
+
+// NodeReplacement records an auto-heal replacement of a hosting node
+type NodeReplacement struct {
+	ID                 string
+	HostingProvisionID string
+	UserID             string
+	Region             string
+
+	OldNodeID string
+	NewNodeID *string
+	Reason    string
+
+	Status string
+	Error  *string
+
+	StartedAt   time.Time
+	CompletedAt *time.Time
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Node snapshot status constants
+const (
+	SnapshotStatusAvailable = "available"
+	SnapshotStatusRestored  = "restored"
+	SnapshotStatusDeleted   = "deleted"
+)
+
+// NodeSnapshot is a hosting node snapshot taken before deletion
+type NodeSnapshot struct {
+	ID                 string
+	UserID             string
+	HostingProvisionID string
+	HostingNodeID      string
+
+	// hosting-service reference
+	SnapshotRef string
+	Provider    string
+	Region      string
+	PlanTier    string
+
+	// Node credentials at snapshot time
+	// 查询时 APIKey 为空，密文在 SealedAPIKey，由 NodeSnapshotRepository.OpenCredentials 解密
+	APIKey       *string
+	SealedAPIKey *string
+	PublicKey    *string
+	ShortID      *string
+
+	Status              string
+	ExpiresAt           time.Time
+	RestoredProvisionID *string
+
+	CreatedAt  time.Time
+	RestoredAt *time.Time
+	DeletedAt  *time.Time
+}
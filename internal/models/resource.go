@@ -12,6 +12,9 @@ const (
 	StatusInstalling = "installing"
 	StatusActive     = "active"
 	StatusStopping   = "stopping"
+	StatusStarting   = "starting"
+	StatusRebooting  = "rebooting"
+	StatusReplacing  = "replacing"
 	StatusStopped    = "stopped"
 	StatusDeleted    = "deleted"
 	StatusFailed     = "failed"
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Traffic top-up status constants
+const (
+	TopUpStatusActive   = "active"
+	TopUpStatusConsumed = "consumed"
+	TopUpStatusExpired  = "expired"
+	TopUpStatusRevoked  = "revoked" // 所属套餐被撤销或注销
+)
+
+// TrafficTopUp is a one-time traffic add-on line item
+// Bytes are added on top of the plan allowance; usage draws from the base first.
+type TrafficTopUp struct {
+	ID             string
+	UserID         string
+	VPNProvisionID string
+	GrantID        string
+
+	SourceRef string
+	ProductID string
+
+	Bytes         int64
+	ConsumedBytes int64
+	CarryOver     bool
+	ExpiresAt     time.Time
+
+	Status string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RemainingBytes returns the unconsumed part of the top-up
+func (t *TrafficTopUp) RemainingBytes() int64 {
+	if t.ConsumedBytes >= t.Bytes {
+		return 0
+	}
+	return t.Bytes - t.ConsumedBytes
+}
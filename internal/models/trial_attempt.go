@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Trial eligibility decisions
+const (
+	TrialDecisionAllow  = "allow"
+	TrialDecisionDeny   = "deny"
+	TrialDecisionReview = "review"
+)
+
+// TrialAttempt records a trial request and its eligibility evaluation
+type TrialAttempt struct {
+	ID              string
+	UserID          string
+	Email           string
+	NormalizedEmail string
+	DeviceID        string
+	IPAddress       string
+
+	Decision string
+	Score    int
+	Reasons  []string
+
+	// Admin override (nil until reviewed)
+	OverrideDecision *string
+	OverriddenBy     *string
+	OverrideNote     *string
+	OverriddenAt     *time.Time
+	OverrideExpires  *time.Time // 之后重新按评分评估
+
+	CreatedAt time.Time
+}
+
+// EffectiveDecision returns the admin override if set, otherwise the engine decision
+func (a *TrialAttempt) EffectiveDecision() string {
+	if a.OverrideDecision != nil && *a.OverrideDecision != "" {
+		return *a.OverrideDecision
+	}
+	return a.Decision
+}
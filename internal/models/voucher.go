@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Voucher is a redeemable gift code (generated in batches for a campaign)
+type Voucher struct {
+	ID       string
+	Code     string
+	BatchID  string
+	Campaign string
+
+	// Grant contents
+	TrafficGB    int
+	DurationDays int
+	ServiceTier  string
+
+	// Redemption limits
+	MaxRedemptions int
+	RedeemedCount  int
+	ValidFrom      time.Time
+	ValidUntil     time.Time
+	Disabled       bool
+
+	CreatedBy string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -8,6 +8,7 @@ const (
 	BusinessTypeSubscription = "subscription"
 	BusinessTypeTrial        = "trial"
 	BusinessTypeGift         = "gift"
+	BusinessTypeTopUp        = "topup" // 一次性流量加油包，不单独生成 vpn_provisions 记录
 )
 
 // VPN provision status constants
@@ -17,6 +18,7 @@ const (
 	VPNProvisionStatusDisabled  = "disabled"
 	VPNProvisionStatusRevoked   = "revoked"
 	VPNProvisionStatusConverted = "converted"
+	VPNProvisionStatusPaused    = "paused"
 )
 
 // VPN service tier constants
@@ -59,10 +61,53 @@ type VPNProvision struct {
 	// Current record marker
 	IsCurrent bool
 
+	// Traffic reset cycles (CycleMonths = 0: one allowance for the whole window)
+	CycleAnchor    *time.Time
+	CycleMonths    int
+	CycleAllowance int64
+	CycleStartedAt *time.Time
+	CycleEndsAt    *time.Time
+	// 周期已推进但 otun-manager 的 traffic_used 尚未清零（由 AdvanceCycle 设置）
+	CycleResetPending bool
+
+	// Pause state (set via MarkPaused / MarkResumed, not by Update)
+	PausedAt               *time.Time
+	PauseEndsAt            *time.Time // auto-resume once the plan's max paused days are used up
+	PauseCount             int
+	PausedSeconds          int64 // total paused time of this provision, excluding the current pause
+	PausedRemainingSeconds int64
+	PausedRemainingTraffic int64
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// CycleWindow returns the billing cycle containing at, counted from anchor.
+// Each boundary is computed from the anchor (not the previous boundary) so
+// month-end anchors don't drift, and is clamped to the last day of its month
+// (an anchor on Jan 31 resets on Feb 28/29, then Mar 31).
+func CycleWindow(anchor time.Time, months int, at time.Time) (time.Time, time.Time) {
+	if months <= 0 || at.Before(anchor) {
+		return anchor, addMonthsClamped(anchor, months)
+	}
+	k := 0
+	for !addMonthsClamped(anchor, (k+1)*months).After(at) {
+		k++
+	}
+	return addMonthsClamped(anchor, k*months), addMonthsClamped(anchor, (k+1)*months)
+}
+
+// addMonthsClamped adds n months to t, keeping the day of month but never
+// spilling into the following month (AddDate normalizes Jan 31 + 1 month to Mar 3)
+func addMonthsClamped(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
 // MapPlanToServiceTier maps plan_tier to service_tier
 func MapPlanToServiceTier(planTier string) string {
 	switch planTier {
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 8, 30, 0, 0, time.UTC)
+}
+
+func TestCycleWindowMonthEndAnchors(t *testing.T) {
+	tests := []struct {
+		name      string
+		anchor    time.Time
+		months    int
+		at        time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"31st into february", date(2025, time.January, 31), 1, date(2025, time.February, 10), date(2025, time.January, 31), date(2025, time.February, 28)},
+		{"31st after short february", date(2025, time.January, 31), 1, date(2025, time.March, 1), date(2025, time.February, 28), date(2025, time.March, 31)},
+		{"31st leap year february", date(2024, time.January, 31), 1, date(2024, time.February, 29), date(2024, time.February, 29), date(2024, time.March, 31)},
+		{"31st into 30-day month", date(2025, time.March, 31), 1, date(2025, time.April, 30), date(2025, time.April, 30), date(2025, time.May, 31)},
+		{"31st back to day 31", date(2025, time.January, 31), 1, date(2025, time.May, 31), date(2025, time.May, 31), date(2025, time.June, 30)},
+		{"30th into february", date(2025, time.January, 30), 1, date(2025, time.February, 28), date(2025, time.February, 28), date(2025, time.March, 30)},
+		{"30th leap year february", date(2024, time.January, 30), 1, date(2024, time.February, 15), date(2024, time.January, 30), date(2024, time.February, 29)},
+		{"29th non-leap february", date(2025, time.January, 29), 1, date(2025, time.March, 1), date(2025, time.February, 28), date(2025, time.March, 29)},
+		{"29th leap year february", date(2024, time.January, 29), 1, date(2024, time.February, 29), date(2024, time.February, 29), date(2024, time.March, 29)},
+		{"leap day yearly", date(2024, time.February, 29), 12, date(2025, time.March, 1), date(2025, time.February, 28), date(2026, time.February, 28)},
+		{"31st quarterly", date(2025, time.August, 31), 3, date(2025, time.December, 1), date(2025, time.November, 30), date(2026, time.February, 28)},
+		{"before anchor", date(2025, time.January, 31), 1, date(2025, time.January, 1), date(2025, time.January, 31), date(2025, time.February, 28)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := CycleWindow(tt.anchor, tt.months, tt.at)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Fatalf("CycleWindow = [%s, %s), want [%s, %s)",
+					start.Format(time.DateOnly), end.Format(time.DateOnly),
+					tt.wantStart.Format(time.DateOnly), tt.wantEnd.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+func TestCycleWindowBoundaryBelongsToNextCycle(t *testing.T) {
+	anchor := date(2025, time.January, 31)
+	start, end := CycleWindow(anchor, 1, date(2025, time.February, 28))
+	if !start.Equal(date(2025, time.February, 28)) || !end.Equal(date(2025, time.March, 31)) {
+		t.Fatalf("CycleWindow at boundary = [%s, %s)", start.Format(time.DateOnly), end.Format(time.DateOnly))
+	}
+}
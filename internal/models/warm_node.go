@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Warm node status constants
+const (
+	WarmNodeStatusCreating = "creating"
+	WarmNodeStatusReady    = "ready"
+	WarmNodeStatusClaimed  = "claimed"
+	WarmNodeStatusFailed   = "failed"
+	WarmNodeStatusDeleted  = "deleted"
+)
+
+// WarmNode is a pre-provisioned, unassigned hosting node
+type WarmNode struct {
+	ID            string
+	HostingNodeID *string
+	Provider      string
+	Region        string
+	BundleID      string
+
+	Status       string
+	ErrorMessage *string
+
+	ClaimedByProvisionID *string
+
+	CreatedAt time.Time
+	ReadyAt   *time.Time
+	ClaimedAt *time.Time
+	DeletedAt *time.Time
+}
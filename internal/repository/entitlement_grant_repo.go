@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type EntitlementGrantRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewEntitlementGrantRepository(pool *pgxpool.Pool) *EntitlementGrantRepository {
+	return &EntitlementGrantRepository{pool: pool}
+}
+
+const grantColumns = `id, user_id, COALESCE(vpn_provision_id::text, ''),
+	source, source_ref, traffic_bytes, starts_at, ends_at, priority, service_tier,
+	additive, status, created_at, closed_at`
+
+func (r *EntitlementGrantRepository) Create(ctx context.Context, g *models.EntitlementGrant) error {
+	query := `
+		INSERT INTO fulfillment.entitlement_grants (
+			id, user_id, vpn_provision_id, source, source_ref,
+			traffic_bytes, starts_at, ends_at, priority, service_tier, additive, status
+		) VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := r.pool.Exec(ctx, query,
+		g.ID, g.UserID, g.VPNProvisionID, g.Source, g.SourceRef,
+		g.TrafficBytes, g.StartsAt, g.EndsAt, g.Priority, g.ServiceTier, g.Additive, g.Status,
+	)
+	if err != nil {
+		return fmt.Errorf("insert entitlement_grant: %w", err)
+	}
+	return nil
+}
+
+// ListActiveByUser returns grants that are still active and not yet ended
+func (r *EntitlementGrantRepository) ListActiveByUser(ctx context.Context, userID string) ([]*models.EntitlementGrant, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.entitlement_grants
+		WHERE user_id = $1 AND status = 'active' AND ends_at > NOW()
+		ORDER BY starts_at
+	`, grantColumns)
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list active entitlement_grants: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// ListByUser returns the full ledger of a user (admin view)
+func (r *EntitlementGrantRepository) ListByUser(ctx context.Context, userID string) ([]*models.EntitlementGrant, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.entitlement_grants
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT 200
+	`, grantColumns)
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list entitlement_grants: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// GetActiveBaseByProvision returns the latest-ending active base (non-additive) grant of a provision
+func (r *EntitlementGrantRepository) GetActiveBaseByProvision(ctx context.Context, provisionID string) (*models.EntitlementGrant, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.entitlement_grants
+		WHERE vpn_provision_id = $1 AND status = 'active' AND additive = FALSE
+		ORDER BY ends_at DESC
+		LIMIT 1
+	`, grantColumns)
+	rows, err := r.pool.Query(ctx, query, provisionID)
+	if err != nil {
+		return nil, fmt.Errorf("get entitlement_grant: %w", err)
+	}
+	defer rows.Close()
+	grants, err := r.scanMany(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return nil, ErrNotFound
+	}
+	return grants[0], nil
+}
+
+// CloseByProvision closes all active base grants of a vpn provision with the given status
+// (superseded / revoked). Closed grants stay in the ledger. Top-ups attached to the
+// provision are tracked separately and left untouched.
+func (r *EntitlementGrantRepository) CloseByProvision(ctx context.Context, provisionID, status string) error {
+	query := `
+		UPDATE fulfillment.entitlement_grants SET status = $2, closed_at = NOW()
+		WHERE vpn_provision_id = $1 AND status = 'active' AND additive = FALSE
+	`
+	_, err := r.pool.Exec(ctx, query, provisionID, status)
+	if err != nil {
+		return fmt.Errorf("close entitlement_grants: %w", err)
+	}
+	return nil
+}
+
+// ReplaceByProvision supersedes the active base grants of a provision and inserts g,
+// in one transaction (renewal / trial conversion), so the user is never left without
+// the purchase grant in between.
+func (r *EntitlementGrantRepository) ReplaceByProvision(ctx context.Context, provisionID string, g *models.EntitlementGrant) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE fulfillment.entitlement_grants SET status = 'superseded', closed_at = NOW()
+		WHERE vpn_provision_id = $1 AND status = 'active' AND additive = FALSE
+	`, provisionID); err != nil {
+		return fmt.Errorf("close entitlement_grants: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO fulfillment.entitlement_grants (
+			id, user_id, vpn_provision_id, source, source_ref,
+			traffic_bytes, starts_at, ends_at, priority, service_tier, additive, status
+		) VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`,
+		g.ID, g.UserID, g.VPNProvisionID, g.Source, g.SourceRef,
+		g.TrafficBytes, g.StartsAt, g.EndsAt, g.Priority, g.ServiceTier, g.Additive, g.Status,
+	); err != nil {
+		return fmt.Errorf("insert entitlement_grant: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// CloseTopUpsByProvision supersedes the additive top-up grants of a provision and
+// marks its active top-ups revoked, in one transaction (provision revoked / deprovisioned)
+func (r *EntitlementGrantRepository) CloseTopUpsByProvision(ctx context.Context, provisionID string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE fulfillment.entitlement_grants SET status = 'superseded', closed_at = NOW()
+		WHERE vpn_provision_id = $1 AND status = 'active' AND additive = TRUE
+	`, provisionID); err != nil {
+		return fmt.Errorf("close top-up entitlement_grants: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE fulfillment.traffic_topups SET status = 'revoked', updated_at = NOW()
+		WHERE vpn_provision_id = $1 AND status = 'active'
+	`, provisionID); err != nil {
+		return fmt.Errorf("revoke traffic_topups: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// MoveTopUps reattaches the active top-ups of a provision and their grants to the
+// provision that replaced it (channel change / trial conversion)
+func (r *EntitlementGrantRepository) MoveTopUps(ctx context.Context, fromProvisionID, toProvisionID string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE fulfillment.entitlement_grants SET vpn_provision_id = $2
+		WHERE vpn_provision_id = $1 AND status = 'active' AND additive = TRUE
+	`, fromProvisionID, toProvisionID); err != nil {
+		return fmt.Errorf("move top-up entitlement_grants: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE fulfillment.traffic_topups SET vpn_provision_id = $2, updated_at = NOW()
+		WHERE vpn_provision_id = $1 AND status = 'active'
+	`, fromProvisionID, toProvisionID); err != nil {
+		return fmt.Errorf("move traffic_topups: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// CloseByID closes a single active grant
+func (r *EntitlementGrantRepository) CloseByID(ctx context.Context, id, status string) error {
+	query := `
+		UPDATE fulfillment.entitlement_grants SET status = $2, closed_at = NOW()
+		WHERE id = $1 AND status = 'active'
+	`
+	_, err := r.pool.Exec(ctx, query, id, status)
+	if err != nil {
+		return fmt.Errorf("close entitlement_grant: %w", err)
+	}
+	return nil
+}
+
+// ShiftActiveByUser pushes the user's active grants that were still running at
+// `from` forward by d (VPN pause). Grants that had not started yet move as a whole.
+func (r *EntitlementGrantRepository) ShiftActiveByUser(ctx context.Context, userID string, from time.Time, d time.Duration) error {
+	query := `
+		UPDATE fulfillment.entitlement_grants SET
+			ends_at = ends_at + make_interval(secs => $3),
+			starts_at = CASE WHEN starts_at > $2 THEN starts_at + make_interval(secs => $3) ELSE starts_at END
+		WHERE user_id = $1 AND status = 'active' AND ends_at > $2
+	`
+	_, err := r.pool.Exec(ctx, query, userID, from, d.Seconds())
+	if err != nil {
+		return fmt.Errorf("shift entitlement_grants: %w", err)
+	}
+	return nil
+}
+
+func (r *EntitlementGrantRepository) scanMany(rows pgx.Rows) ([]*models.EntitlementGrant, error) {
+	var results []*models.EntitlementGrant
+	for rows.Next() {
+		var g models.EntitlementGrant
+		if err := rows.Scan(
+			&g.ID, &g.UserID, &g.VPNProvisionID,
+			&g.Source, &g.SourceRef, &g.TrafficBytes, &g.StartsAt, &g.EndsAt, &g.Priority, &g.ServiceTier,
+			&g.Additive, &g.Status, &g.CreatedAt, &g.ClosedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan entitlement_grant: %w", err)
+		}
+		results = append(results, &g)
+	}
+	return results, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -13,32 +14,62 @@ import (
 var ErrNotFound = errors.New("not found")
 
 type HostingProvisionRepository struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	secrets *SecretBox
 }
 
-func NewHostingProvisionRepository(pool *pgxpool.Pool) *HostingProvisionRepository {
-	return &HostingProvisionRepository{pool: pool}
+func NewHostingProvisionRepository(pool *pgxpool.Pool, secrets *SecretBox) *HostingProvisionRepository {
+	return &HostingProvisionRepository{pool: pool, secrets: secrets}
 }
 
+// 加密保存的字段（AES-GCM，见 SecretBox）
+const (
+	fieldHostingAPIKey         = "hosting_provisions.api_key"
+	fieldHostingPreviousAPIKey = "hosting_provisions.previous_api_key"
+	fieldHostingCallbackToken  = "hosting_provisions.callback_token"
+)
+
+const hostingColumns = `id, subscription_id, user_id, channel,
+	hosting_node_id, provider, region,
+	public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
+	previous_api_key, previous_api_key_expires_at, credentials_rotated_at,
+	callback_token,
+	status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
+	suspended_at, suspend_until, suspend_reason,
+	health_status, probe_failures, external_probe_failures, last_probed_at, health_changed_at, hosting_failed_at,
+	created_at, updated_at, ready_at, deleted_at`
+
 func (r *HostingProvisionRepository) Create(ctx context.Context, hp *models.HostingProvision) error {
+	apiKey, err := r.secrets.sealPtr(fieldHostingAPIKey, hp.ID, hp.APIKey)
+	if err != nil {
+		return fmt.Errorf("encrypt hosting_provision api_key: %w", err)
+	}
+	callbackToken, err := r.secrets.sealPtr(fieldHostingCallbackToken, hp.ID, hp.CallbackToken)
+	if err != nil {
+		return fmt.Errorf("encrypt hosting_provision callback_token: %w", err)
+	}
+
 	query := `
 		INSERT INTO fulfillment.hosting_provisions (
 			id, subscription_id, user_id, channel,
 			hosting_node_id, provider, region,
 			public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
-			status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup
+			status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
+			callback_token
 		) VALUES (
 			$1, $2, $3, $4,
 			$5, $6, $7,
 			$8, $9, $10, $11, $12, $13, $14,
-			$15, $16, $17, $18, $19, $20
+			$15, $16, $17, $18, $19, $20,
+			$21
 		)
 	`
-	_, err := r.pool.Exec(ctx, query,
+	_, err = r.pool.Exec(ctx, query,
 		hp.ID, hp.SubscriptionID, hp.UserID, hp.Channel,
 		hp.HostingNodeID, hp.Provider, hp.Region,
-		hp.PublicIP, hp.APIPort, hp.APIKey, hp.VlessPort, hp.SSPort, hp.PublicKey, hp.ShortID,
+		hp.PublicIP, hp.APIPort, apiKey, hp.VlessPort, hp.SSPort, hp.PublicKey, hp.ShortID,
 		hp.Status, hp.ErrorMessage, hp.PlanTier, hp.TrafficLimit, hp.TrafficUsed, hp.NeedsCleanup,
+		callbackToken,
 	)
 	if err != nil {
 		return fmt.Errorf("insert hosting_provision: %w", err)
@@ -47,29 +78,21 @@ func (r *HostingProvisionRepository) Create(ctx context.Context, hp *models.Host
 }
 
 func (r *HostingProvisionRepository) GetByID(ctx context.Context, id string) (*models.HostingProvision, error) {
-	query := `
-		SELECT id, subscription_id, user_id, channel,
-			   hosting_node_id, provider, region,
-			   public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
-			   status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
-			   created_at, updated_at, ready_at, deleted_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM fulfillment.hosting_provisions
 		WHERE id = $1
-	`
+	`, hostingColumns)
 	return r.scanOne(r.pool.QueryRow(ctx, query, id))
 }
 
 func (r *HostingProvisionRepository) GetBySubscriptionID(ctx context.Context, subscriptionID string) ([]*models.HostingProvision, error) {
-	query := `
-		SELECT id, subscription_id, user_id, channel,
-			   hosting_node_id, provider, region,
-			   public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
-			   status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
-			   created_at, updated_at, ready_at, deleted_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM fulfillment.hosting_provisions
 		WHERE subscription_id = $1 AND deleted_at IS NULL
 		ORDER BY created_at DESC
-	`
+	`, hostingColumns)
 	rows, err := r.pool.Query(ctx, query, subscriptionID)
 	if err != nil {
 		return nil, fmt.Errorf("query hosting_provisions: %w", err)
@@ -79,46 +102,43 @@ func (r *HostingProvisionRepository) GetBySubscriptionID(ctx context.Context, su
 }
 
 func (r *HostingProvisionRepository) GetActiveByUser(ctx context.Context, userID string) (*models.HostingProvision, error) {
-	query := `
-		SELECT id, subscription_id, user_id, channel,
-			   hosting_node_id, provider, region,
-			   public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
-			   status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
-			   created_at, updated_at, ready_at, deleted_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM fulfillment.hosting_provisions
 		WHERE user_id = $1
 		  AND status NOT IN ('deleted', 'failed')
 		  AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT 1
-	`
+	`, hostingColumns)
 	return r.scanOne(r.pool.QueryRow(ctx, query, userID))
 }
 
 func (r *HostingProvisionRepository) GetLatestByUser(ctx context.Context, userID string) (*models.HostingProvision, error) {
-	query := `
-		SELECT id, subscription_id, user_id, channel,
-			   hosting_node_id, provider, region,
-			   public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
-			   status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
-			   created_at, updated_at, ready_at, deleted_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM fulfillment.hosting_provisions
 		WHERE user_id = $1
 		  AND status != 'deleted'
 		  AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT 1
-	`
+	`, hostingColumns)
 	return r.scanOne(r.pool.QueryRow(ctx, query, userID))
 }
 
 func (r *HostingProvisionRepository) Update(ctx context.Context, hp *models.HostingProvision) error {
+	apiKey, err := r.secrets.sealPtr(fieldHostingAPIKey, hp.ID, hp.APIKey)
+	if err != nil {
+		return fmt.Errorf("encrypt hosting_provision api_key: %w", err)
+	}
+
 	query := `
 		UPDATE fulfillment.hosting_provisions SET
 			hosting_node_id = $1,
 			public_ip = $2,
 			api_port = $3,
-			api_key = $4,
+			api_key = COALESCE($4, api_key),
 			vless_port = $5,
 			ss_port = $6,
 			public_key = $7,
@@ -131,9 +151,9 @@ func (r *HostingProvisionRepository) Update(ctx context.Context, hp *models.Host
 			updated_at = NOW()
 		WHERE id = $14
 	`
-	_, err := r.pool.Exec(ctx, query,
+	_, err = r.pool.Exec(ctx, query,
 		hp.HostingNodeID,
-		hp.PublicIP, hp.APIPort, hp.APIKey,
+		hp.PublicIP, hp.APIPort, apiKey,
 		hp.VlessPort, hp.SSPort, hp.PublicKey, hp.ShortID,
 		hp.Status, hp.ErrorMessage, hp.TrafficUsed,
 		hp.ReadyAt, hp.DeletedAt, hp.ID,
@@ -153,11 +173,78 @@ func (r *HostingProvisionRepository) UpdateStatus(ctx context.Context, id, statu
 	return nil
 }
 
-// MarkNeedsCleanup 标记 provision 需要后台清理（VPS 删除失败时使用）
-func (r *HostingProvisionRepository) MarkNeedsCleanup(ctx context.Context, id string) error {
-	query := `UPDATE fulfillment.hosting_provisions SET needs_cleanup = TRUE, updated_at = NOW() WHERE id = $1`
-	_, err := r.pool.Exec(ctx, query, id)
-	return err
+// TransitionStatus 仅当当前状态为 from 时切换到 to，避免并发操作互相覆盖
+func (r *HostingProvisionRepository) TransitionStatus(ctx context.Context, id, from, to string) error {
+	query := `
+		UPDATE fulfillment.hosting_provisions SET status = $3, error_message = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = $2 AND deleted_at IS NULL
+	`
+	tag, err := r.pool.Exec(ctx, query, id, from, to)
+	if err != nil {
+		return fmt.Errorf("transition hosting_provision status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdatePlacement 区域故障切换后记录实际使用的云厂商和区域
+func (r *HostingProvisionRepository) UpdatePlacement(ctx context.Context, id, provider, region string) error {
+	query := `UPDATE fulfillment.hosting_provisions SET provider = $2, region = $3, updated_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id, provider, region)
+	if err != nil {
+		return fmt.Errorf("update hosting_provision placement: %w", err)
+	}
+	return nil
+}
+
+// UpdatePublicIP 更换 IP 后保存新的公网 IP（旧 IP 记录在 node_ip_changes）
+// 外部探测失败计数（含各探测点计数）随旧 IP 一起清零，健康状态等待重新探测
+func (r *HostingProvisionRepository) UpdatePublicIP(ctx context.Context, id, publicIP string) error {
+	query := `
+		WITH cleared AS (
+			DELETE FROM fulfillment.node_probe_sources WHERE hosting_provision_id = $1
+		)
+		UPDATE fulfillment.hosting_provisions SET
+			public_ip = $2, health_status = 'unknown', external_probe_failures = 0,
+			health_changed_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(ctx, query, id, publicIP)
+	if err != nil {
+		return fmt.Errorf("update hosting_provision public_ip: %w", err)
+	}
+	return nil
+}
+
+// UpdateCredentials 保存轮换后的节点凭据，旧 APIKey 保留到 previousExpiresAt
+func (r *HostingProvisionRepository) UpdateCredentials(ctx context.Context, id, apiKey, publicKey, shortID string, previousAPIKey *string, previousExpiresAt time.Time) error {
+	sealedKey, err := r.secrets.Seal(fieldHostingAPIKey, id, apiKey)
+	if err != nil {
+		return fmt.Errorf("encrypt hosting_provision api_key: %w", err)
+	}
+	sealedPrevious, err := r.secrets.sealPtr(fieldHostingPreviousAPIKey, id, previousAPIKey)
+	if err != nil {
+		return fmt.Errorf("encrypt hosting_provision previous_api_key: %w", err)
+	}
+
+	query := `
+		UPDATE fulfillment.hosting_provisions SET
+			api_key = $1,
+			public_key = $2,
+			short_id = $3,
+			previous_api_key = $4,
+			previous_api_key_expires_at = $5,
+			credentials_rotated_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $6
+	`
+	_, err = r.pool.Exec(ctx, query, sealedKey, publicKey, shortID, sealedPrevious, previousExpiresAt, id)
+	if err != nil {
+		return fmt.Errorf("update hosting_provision credentials: %w", err)
+	}
+	return nil
 }
 
 // ClearCleanupFlag 清除清理标记（清理成功后调用）
@@ -167,19 +254,15 @@ func (r *HostingProvisionRepository) ClearCleanupFlag(ctx context.Context, id st
 	return err
 }
 
-// ListNeedsCleanup 获取需要后台清理的 provision 列表
+// ListNeedsCleanup 获取升级前标记了 needs_cleanup 的 provision 列表（新的删除失败记录在 node_cleanups）
 func (r *HostingProvisionRepository) ListNeedsCleanup(ctx context.Context, limit int) ([]*models.HostingProvision, error) {
-	query := `
-		SELECT id, subscription_id, user_id, channel,
-			   hosting_node_id, provider, region,
-			   public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
-			   status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
-			   created_at, updated_at, ready_at, deleted_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM fulfillment.hosting_provisions
 		WHERE needs_cleanup = TRUE
 		ORDER BY created_at ASC
 		LIMIT $1
-	`
+	`, hostingColumns)
 	rows, err := r.pool.Query(ctx, query, limit)
 	if err != nil {
 		return nil, fmt.Errorf("query needs_cleanup provisions: %w", err)
@@ -188,19 +271,343 @@ func (r *HostingProvisionRepository) ListNeedsCleanup(ctx context.Context, limit
 	return r.scanMany(rows)
 }
 
+// QueueNodeCleanup 记录删除失败的云实例，由 CleanupScheduler 按节点 id 重试删除
+func (r *HostingProvisionRepository) QueueNodeCleanup(ctx context.Context, provisionID, hostingNodeID string) error {
+	query := `
+		INSERT INTO fulfillment.node_cleanups (hosting_node_id, hosting_provision_id)
+		VALUES ($1, $2)
+		ON CONFLICT (hosting_node_id) DO NOTHING
+	`
+	if _, err := r.pool.Exec(ctx, query, hostingNodeID, provisionID); err != nil {
+		return fmt.Errorf("insert node_cleanup: %w", err)
+	}
+	return nil
+}
+
+// ListNodeCleanups 获取待删除的云实例
+func (r *HostingProvisionRepository) ListNodeCleanups(ctx context.Context, limit int) ([]*models.NodeCleanup, error) {
+	query := `
+		SELECT hosting_node_id, hosting_provision_id::text, created_at
+		FROM fulfillment.node_cleanups
+		ORDER BY created_at ASC
+		LIMIT $1
+	`
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query node_cleanups: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.NodeCleanup
+	for rows.Next() {
+		nc := &models.NodeCleanup{}
+		if err := rows.Scan(&nc.HostingNodeID, &nc.HostingProvisionID, &nc.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan node_cleanup row: %w", err)
+		}
+		results = append(results, nc)
+	}
+	return results, rows.Err()
+}
+
+// DeleteNodeCleanup 云实例删除成功后移除记录
+func (r *HostingProvisionRepository) DeleteNodeCleanup(ctx context.Context, hostingNodeID string) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM fulfillment.node_cleanups WHERE hosting_node_id = $1`, hostingNodeID)
+	if err != nil {
+		return fmt.Errorf("delete node_cleanup: %w", err)
+	}
+	return nil
+}
+
+// MarkSuspended 订阅失效后记录暂停并切到 stopping，停机完成后由调用方更新状态，until 之后由调度器删除
+// 已暂停、已删除或不在可暂停状态时返回 ErrNotFound
+func (r *HostingProvisionRepository) MarkSuspended(ctx context.Context, id string, until time.Time, reason string) error {
+	query := `
+		UPDATE fulfillment.hosting_provisions SET
+			status = 'stopping', suspended_at = NOW(), suspend_until = $2, suspend_reason = $3, updated_at = NOW()
+		WHERE id = $1 AND suspended_at IS NULL AND deleted_at IS NULL
+		  AND status IN ('active', 'stopped', 'rebooting', 'starting')
+	`
+	tag, err := r.pool.Exec(ctx, query, id, until, reason)
+	if err != nil {
+		return fmt.Errorf("mark hosting_provision suspended: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimResume 恢复暂停节点前切到 starting，防止并发恢复或与到期删除冲突
+// 未暂停或正在恢复时返回 ErrNotFound
+func (r *HostingProvisionRepository) ClaimResume(ctx context.Context, id string) error {
+	query := `
+		UPDATE fulfillment.hosting_provisions SET status = 'starting', updated_at = NOW()
+		WHERE id = $1 AND suspended_at IS NOT NULL AND deleted_at IS NULL
+		  AND status IN ('active', 'stopped', 'stopping')
+	`
+	tag, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("claim hosting_provision resume: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClearSuspension 恢复后清除暂停信息（status 由调用方另行更新）
+// subscriptionID 非空时改挂到恢复后的订阅上
+func (r *HostingProvisionRepository) ClearSuspension(ctx context.Context, id, subscriptionID string) error {
+	query := `
+		UPDATE fulfillment.hosting_provisions SET
+			subscription_id = COALESCE(NULLIF($2, ''), subscription_id),
+			suspended_at = NULL, suspend_until = NULL, suspend_reason = NULL, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(ctx, query, id, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("clear hosting_provision suspension: %w", err)
+	}
+	return nil
+}
+
+// ListSuspensionDue 获取宽限期已过的暂停节点
+func (r *HostingProvisionRepository) ListSuspensionDue(ctx context.Context, limit int) ([]*models.HostingProvision, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM fulfillment.hosting_provisions
+		WHERE status IN ('active', 'stopped', 'stopping') AND suspended_at IS NOT NULL
+		  AND suspend_until <= NOW() AND deleted_at IS NULL
+		ORDER BY suspend_until ASC
+		LIMIT $1
+	`, hostingColumns)
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query suspension-due provisions: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// ListStuckSuspending 获取 before 之前进入 stopping 后一直未完成停机的暂停节点（如停机过程中进程重启）
+func (r *HostingProvisionRepository) ListStuckSuspending(ctx context.Context, before time.Time, limit int) ([]*models.HostingProvision, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM fulfillment.hosting_provisions
+		WHERE status = 'stopping' AND suspended_at IS NOT NULL AND updated_at < $1 AND deleted_at IS NULL
+		ORDER BY updated_at ASC
+		LIMIT $2
+	`, hostingColumns)
+	rows, err := r.pool.Query(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query stuck suspending provisions: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// ListProbeTargets 获取需要探测的活跃节点
+func (r *HostingProvisionRepository) ListProbeTargets(ctx context.Context) ([]*models.HostingProvision, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM fulfillment.hosting_provisions
+		WHERE status = 'active' AND public_ip IS NOT NULL AND deleted_at IS NULL
+		ORDER BY created_at ASC
+	`, hostingColumns)
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query probe targets: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// RecordProbeRound 更新一轮内部探测后的连续失败计数，返回更新后的计数和当前健康状态
+func (r *HostingProvisionRepository) RecordProbeRound(ctx context.Context, id string, ok bool) (failures, externalFailures int, healthStatus string, err error) {
+	query := `
+		UPDATE fulfillment.hosting_provisions SET
+			probe_failures = CASE WHEN $2 THEN 0 ELSE probe_failures + 1 END,
+			last_probed_at = NOW()
+		WHERE id = $1
+		RETURNING probe_failures, external_probe_failures, health_status
+	`
+	err = r.pool.QueryRow(ctx, query, id, ok).Scan(&failures, &externalFailures, &healthStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, "", ErrNotFound
+		}
+		return 0, 0, "", fmt.Errorf("record probe round: %w", err)
+	}
+	return failures, externalFailures, healthStatus, nil
+}
+
+// RecordExternalProbeRound 更新一个外部探测点的连续失败计数
+// external_probe_failures 取 activeSince 之后有上报的探测点中的最大值，
+// 一个探测点成功不会清零其他探测点的失败，停止上报的探测点也不会一直保持 blocked
+func (r *HostingProvisionRepository) RecordExternalProbeRound(ctx context.Context, id, source string, ok bool, activeSince time.Time) (failures, externalFailures int, healthStatus string, err error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	upsert := `
+		INSERT INTO fulfillment.node_probe_sources (hosting_provision_id, source, failures, reported_at)
+		VALUES ($1, $2, CASE WHEN $3 THEN 0 ELSE 1 END, NOW())
+		ON CONFLICT (hosting_provision_id, source) DO UPDATE SET
+			failures = CASE WHEN $3 THEN 0 ELSE node_probe_sources.failures + 1 END,
+			reported_at = NOW()
+	`
+	if _, err := tx.Exec(ctx, upsert, id, source, ok); err != nil {
+		return 0, 0, "", fmt.Errorf("upsert node_probe_source: %w", err)
+	}
+
+	query := `
+		UPDATE fulfillment.hosting_provisions SET
+			external_probe_failures = COALESCE((
+				SELECT MAX(failures) FROM fulfillment.node_probe_sources
+				WHERE hosting_provision_id = $1 AND reported_at >= $2
+			), 0),
+			last_probed_at = NOW()
+		WHERE id = $1
+		RETURNING probe_failures, external_probe_failures, health_status
+	`
+	err = tx.QueryRow(ctx, query, id, activeSince).Scan(&failures, &externalFailures, &healthStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, "", ErrNotFound
+		}
+		return 0, 0, "", fmt.Errorf("record external probe round: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, "", fmt.Errorf("commit tx: %w", err)
+	}
+	return failures, externalFailures, healthStatus, nil
+}
+
+// UpdateHealthStatus 健康状态变化时更新
+func (r *HostingProvisionRepository) UpdateHealthStatus(ctx context.Context, id, healthStatus string) error {
+	query := `
+		UPDATE fulfillment.hosting_provisions SET health_status = $2, health_changed_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(ctx, query, id, healthStatus)
+	if err != nil {
+		return fmt.Errorf("update hosting_provision health_status: %w", err)
+	}
+	return nil
+}
+
+// MarkDegraded 标记节点 degraded，返回标记前的健康状态
+// 已是 degraded 时不更新 health_changed_at，auto-heal 的持续时间从第一次变为 degraded 算起。
+// hostingFailed 为 true 时记录 hosting_failed_at（hosting-service 报告节点 failed）。
+func (r *HostingProvisionRepository) MarkDegraded(ctx context.Context, id string, hostingFailed bool) (string, error) {
+	query := `
+		WITH prev AS (
+			SELECT id, health_status FROM fulfillment.hosting_provisions WHERE id = $1 FOR UPDATE
+		)
+		UPDATE fulfillment.hosting_provisions hp SET
+			health_status = 'degraded',
+			health_changed_at = CASE WHEN prev.health_status = 'degraded' THEN hp.health_changed_at ELSE NOW() END,
+			hosting_failed_at = CASE WHEN $2 THEN COALESCE(hp.hosting_failed_at, NOW()) ELSE hp.hosting_failed_at END
+		FROM prev
+		WHERE hp.id = prev.id
+		RETURNING prev.health_status
+	`
+	var previous string
+	if err := r.pool.QueryRow(ctx, query, id, hostingFailed).Scan(&previous); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("mark hosting_provision degraded: %w", err)
+	}
+	return previous, nil
+}
+
+// ClearHostingFailed 清除 hosting-service 已不再报告 failed 的节点的 hosting_failed_at
+// failedNodeIDs 为 hosting-service 当前报告 failed 的节点
+func (r *HostingProvisionRepository) ClearHostingFailed(ctx context.Context, failedNodeIDs []string) (int64, error) {
+	query := `
+		UPDATE fulfillment.hosting_provisions SET hosting_failed_at = NULL
+		WHERE hosting_failed_at IS NOT NULL AND NOT (hosting_node_id = ANY($1))
+	`
+	tag, err := r.pool.Exec(ctx, query, failedNodeIDs)
+	if err != nil {
+		return 0, fmt.Errorf("clear hosting_provision hosting_failed_at: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// SwapNode 替换完成后切换到新节点：仅当状态仍为 replacing 时更新节点信息并恢复 active，
+// 同时清零探测状态。期间被删除或暂停时返回 ErrNotFound。
+func (r *HostingProvisionRepository) SwapNode(ctx context.Context, hp *models.HostingProvision) error {
+	apiKey, err := r.secrets.sealPtr(fieldHostingAPIKey, hp.ID, hp.APIKey)
+	if err != nil {
+		return fmt.Errorf("encrypt hosting_provision api_key: %w", err)
+	}
+
+	query := `
+		WITH cleared AS (
+			DELETE FROM fulfillment.node_probe_sources WHERE hosting_provision_id = $1
+		)
+		UPDATE fulfillment.hosting_provisions SET
+			hosting_node_id = $2,
+			public_ip = $3,
+			api_key = COALESCE($4, api_key),
+			vless_port = $5,
+			ss_port = $6,
+			public_key = $7,
+			short_id = $8,
+			status = 'active',
+			health_status = 'unknown', probe_failures = 0, external_probe_failures = 0,
+			hosting_failed_at = NULL, health_changed_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'replacing' AND deleted_at IS NULL
+	`
+	tag, err := r.pool.Exec(ctx, query,
+		hp.ID, hp.HostingNodeID, hp.PublicIP, apiKey,
+		hp.VlessPort, hp.SSPort, hp.PublicKey, hp.ShortID,
+	)
+	if err != nil {
+		return fmt.Errorf("swap hosting_provision node: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListHealCandidates 获取 degraded 持续到 unhealthySince 之前、且此后没有发起过替换的 active 节点
+func (r *HostingProvisionRepository) ListHealCandidates(ctx context.Context, unhealthySince time.Time, limit int) ([]*models.HostingProvision, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM fulfillment.hosting_provisions hp
+		WHERE status = 'active' AND health_status = 'degraded'
+		  AND health_changed_at <= $1 AND deleted_at IS NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM fulfillment.node_replacements nr
+			WHERE nr.hosting_provision_id = hp.id AND nr.started_at > $1
+		  )
+		ORDER BY health_changed_at ASC
+		LIMIT $2
+	`, hostingColumns)
+	rows, err := r.pool.Query(ctx, query, unhealthySince, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query heal candidates: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
 // GetByHostingNodeID 根据 hosting_node_id 查找 provision
 func (r *HostingProvisionRepository) GetByHostingNodeID(ctx context.Context, hostingNodeID string) (*models.HostingProvision, error) {
-	query := `
-		SELECT id, subscription_id, user_id, channel,
-			   hosting_node_id, provider, region,
-			   public_ip, api_port, api_key, vless_port, ss_port, public_key, short_id,
-			   status, error_message, plan_tier, traffic_limit, traffic_used, needs_cleanup,
-			   created_at, updated_at, ready_at, deleted_at
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM fulfillment.hosting_provisions
 		WHERE hosting_node_id = $1
 		ORDER BY created_at DESC
 		LIMIT 1
-	`
+	`, hostingColumns)
 	return r.scanOne(r.pool.QueryRow(ctx, query, hostingNodeID))
 }
 
@@ -209,8 +616,12 @@ func (r *HostingProvisionRepository) scanOne(row pgx.Row) (*models.HostingProvis
 	err := row.Scan(
 		&hp.ID, &hp.SubscriptionID, &hp.UserID, &hp.Channel,
 		&hp.HostingNodeID, &hp.Provider, &hp.Region,
-		&hp.PublicIP, &hp.APIPort, &hp.APIKey, &hp.VlessPort, &hp.SSPort, &hp.PublicKey, &hp.ShortID,
+		&hp.PublicIP, &hp.APIPort, &hp.Sealed.APIKey, &hp.VlessPort, &hp.SSPort, &hp.PublicKey, &hp.ShortID,
+		&hp.Sealed.PreviousAPIKey, &hp.PreviousAPIKeyExpiresAt, &hp.CredentialsRotatedAt,
+		&hp.Sealed.CallbackToken,
 		&hp.Status, &hp.ErrorMessage, &hp.PlanTier, &hp.TrafficLimit, &hp.TrafficUsed, &hp.NeedsCleanup,
+		&hp.SuspendedAt, &hp.SuspendUntil, &hp.SuspendReason,
+		&hp.HealthStatus, &hp.ProbeFailures, &hp.ExternalProbeFailures, &hp.LastProbedAt, &hp.HealthChangedAt, &hp.HostingFailedAt,
 		&hp.CreatedAt, &hp.UpdatedAt, &hp.ReadyAt, &hp.DeletedAt,
 	)
 	if err != nil {
@@ -229,8 +640,12 @@ func (r *HostingProvisionRepository) scanMany(rows pgx.Rows) ([]*models.HostingP
 		err := rows.Scan(
 			&hp.ID, &hp.SubscriptionID, &hp.UserID, &hp.Channel,
 			&hp.HostingNodeID, &hp.Provider, &hp.Region,
-			&hp.PublicIP, &hp.APIPort, &hp.APIKey, &hp.VlessPort, &hp.SSPort, &hp.PublicKey, &hp.ShortID,
+			&hp.PublicIP, &hp.APIPort, &hp.Sealed.APIKey, &hp.VlessPort, &hp.SSPort, &hp.PublicKey, &hp.ShortID,
+			&hp.Sealed.PreviousAPIKey, &hp.PreviousAPIKeyExpiresAt, &hp.CredentialsRotatedAt,
+			&hp.Sealed.CallbackToken,
 			&hp.Status, &hp.ErrorMessage, &hp.PlanTier, &hp.TrafficLimit, &hp.TrafficUsed, &hp.NeedsCleanup,
+			&hp.SuspendedAt, &hp.SuspendUntil, &hp.SuspendReason,
+			&hp.HealthStatus, &hp.ProbeFailures, &hp.ExternalProbeFailures, &hp.LastProbedAt, &hp.HealthChangedAt, &hp.HostingFailedAt,
 			&hp.CreatedAt, &hp.UpdatedAt, &hp.ReadyAt, &hp.DeletedAt,
 		)
 		if err != nil {
@@ -240,3 +655,27 @@ func (r *HostingProvisionRepository) scanMany(rows pgx.Rows) ([]*models.HostingP
 	}
 	return results, rows.Err()
 }
+
+// OpenCredentials decrypts the credential columns of a provision read from the database
+// 查询不解密凭据，只在下发凭据的地方调用，个别行的密钥版本缺失不影响列表查询
+func (r *HostingProvisionRepository) OpenCredentials(hp *models.HostingProvision) error {
+	apiKey, err := r.secrets.openPtr(fieldHostingAPIKey, hp.ID, hp.Sealed.APIKey)
+	if err != nil {
+		return err
+	}
+	previousAPIKey, err := r.secrets.openPtr(fieldHostingPreviousAPIKey, hp.ID, hp.Sealed.PreviousAPIKey)
+	if err != nil {
+		return err
+	}
+	callbackToken, err := r.secrets.openPtr(fieldHostingCallbackToken, hp.ID, hp.Sealed.CallbackToken)
+	if err != nil {
+		return err
+	}
+	hp.APIKey, hp.PreviousAPIKey, hp.CallbackToken = apiKey, previousAPIKey, callbackToken
+	return nil
+}
+
+// ResealSecrets re-encrypts node credentials stored in plaintext or under an old key version
+func (r *HostingProvisionRepository) ResealSecrets(ctx context.Context) (resealed, failed int, err error) {
+	return resealSecrets(ctx, r.pool, r.secrets, "hosting_provisions", []string{"api_key", "previous_api_key", "callback_token"})
+}
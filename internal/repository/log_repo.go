@@ -23,6 +23,16 @@ func (r *LogRepository) Create(ctx context.Context, logEntry *models.ProvisionLo
 		logEntry.ID = uuid.New().String()
 	}
 
+	// 内部 API 请求中写入的记录附带调用方，便于审计
+	if caller := models.CallerFromContext(ctx); caller != "" {
+		metadata := make(map[string]interface{}, len(logEntry.Metadata)+1)
+		for k, v := range logEntry.Metadata {
+			metadata[k] = v
+		}
+		metadata["caller"] = caller
+		logEntry.Metadata = metadata
+	}
+
 	query := `
 		INSERT INTO fulfillment.provision_logs (id, provision_id, provision_type, action, status, message, metadata)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// nodeEventChannel 节点状态变更在副本之间转发所用的 LISTEN/NOTIFY 频道
+const nodeEventChannel = "fulfillment_node_events"
+
+// NodeEventRepository relays node status changes between replicas over Postgres LISTEN/NOTIFY
+// 只转发节点 ID；接收方自行 GetNode 获取最新状态，负载里不带节点凭据
+type NodeEventRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewNodeEventRepository(pool *pgxpool.Pool) *NodeEventRepository {
+	return &NodeEventRepository{pool: pool}
+}
+
+// Notify tells every listening replica that a node's status changed
+func (r *NodeEventRepository) Notify(ctx context.Context, payload string) error {
+	if _, err := r.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, nodeEventChannel, payload); err != nil {
+		return fmt.Errorf("notify node event: %w", err)
+	}
+	return nil
+}
+
+// Listen holds a dedicated connection and calls handle for every notification
+// until ctx is cancelled or the connection fails
+func (r *NodeEventRepository) Listen(ctx context.Context, handle func(payload string)) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire conn: %w", err)
+	}
+	// LISTEN 绑定在会话上：连接不放回连接池，直接关闭
+	defer func() {
+		conn.Conn().Close(context.Background())
+		conn.Release()
+	}()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+nodeEventChannel); err != nil {
+		return fmt.Errorf("listen node events: %w", err)
+	}
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait node event: %w", err)
+		}
+		handle(n.Payload)
+	}
+}
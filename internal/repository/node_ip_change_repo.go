@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type NodeIPChangeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewNodeIPChangeRepository(pool *pgxpool.Pool) *NodeIPChangeRepository {
+	return &NodeIPChangeRepository{pool: pool}
+}
+
+const ipChangeColumns = `id, hosting_provision_id, user_id, hosting_node_id,
+	old_ip, new_ip, reason, initiated_by, status, created_at`
+
+// ErrIPChangeQuotaExceeded 本月更换次数已用完
+var ErrIPChangeQuotaExceeded = errors.New("ip change quota exceeded")
+
+// Reserve counts the user's changes since since and inserts c as pending in the same transaction.
+// 同一用户的预留通过 advisory lock 串行化；limit < 0 表示不限制（admin 操作）。
+// 返回预留前已用次数，达到 limit 时返回 ErrIPChangeQuotaExceeded。
+func (r *NodeIPChangeRepository) Reserve(ctx context.Context, c *models.NodeIPChange, since time.Time, limit int) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('node_ip_changes:' || $1, 0))`, c.UserID); err != nil {
+		return 0, fmt.Errorf("lock node_ip_changes: %w", err)
+	}
+
+	var used int
+	query := `
+		SELECT COUNT(*) FROM fulfillment.node_ip_changes
+		WHERE user_id = $1 AND initiated_by = 'user' AND created_at >= $2
+	`
+	if err := tx.QueryRow(ctx, query, c.UserID, since).Scan(&used); err != nil {
+		return 0, fmt.Errorf("count node_ip_changes: %w", err)
+	}
+	if limit >= 0 && used >= limit {
+		return used, ErrIPChangeQuotaExceeded
+	}
+
+	insert := `
+		INSERT INTO fulfillment.node_ip_changes (
+			id, hosting_provision_id, user_id, hosting_node_id,
+			old_ip, reason, initiated_by, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending')
+	`
+	_, err = tx.Exec(ctx, insert,
+		c.ID, c.HostingProvisionID, c.UserID, c.HostingNodeID,
+		c.OldIP, c.Reason, c.InitiatedBy,
+	)
+	if err != nil {
+		return used, fmt.Errorf("insert node_ip_change: %w", err)
+	}
+	return used, tx.Commit(ctx)
+}
+
+// Complete records the new IP of a reserved change
+func (r *NodeIPChangeRepository) Complete(ctx context.Context, id, newIP string) error {
+	query := `UPDATE fulfillment.node_ip_changes SET new_ip = $2, status = 'completed' WHERE id = $1`
+	if _, err := r.pool.Exec(ctx, query, id, newIP); err != nil {
+		return fmt.Errorf("complete node_ip_change: %w", err)
+	}
+	return nil
+}
+
+// Release deletes a reserved change whose IP swap failed, returning the quota
+func (r *NodeIPChangeRepository) Release(ctx context.Context, id string) error {
+	query := `DELETE FROM fulfillment.node_ip_changes WHERE id = $1 AND status = 'pending'`
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("release node_ip_change: %w", err)
+	}
+	return nil
+}
+
+// ListByProvision 获取节点的 IP 更换历史，按时间倒序
+func (r *NodeIPChangeRepository) ListByProvision(ctx context.Context, provisionID string, limit int) ([]*models.NodeIPChange, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.node_ip_changes
+		WHERE hosting_provision_id = $1 AND status = 'completed'
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, ipChangeColumns)
+	rows, err := r.pool.Query(ctx, query, provisionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query node_ip_changes: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.NodeIPChange
+	for rows.Next() {
+		c := &models.NodeIPChange{}
+		err := rows.Scan(
+			&c.ID, &c.HostingProvisionID, &c.UserID, &c.HostingNodeID,
+			&c.OldIP, &c.NewIP, &c.Reason, &c.InitiatedBy, &c.Status, &c.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan node_ip_change row: %w", err)
+		}
+		results = append(results, c)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type NodeProbeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewNodeProbeRepository(pool *pgxpool.Pool) *NodeProbeRepository {
+	return &NodeProbeRepository{pool: pool}
+}
+
+const probeColumns = `id, hosting_provision_id, source, check_name, success, latency_ms, error, probed_at`
+
+// CreateBatch 写入一轮探测的所有检查结果
+func (r *NodeProbeRepository) CreateBatch(ctx context.Context, results []*models.NodeProbeResult) error {
+	batch := &pgx.Batch{}
+	for _, pr := range results {
+		batch.Queue(`
+			INSERT INTO fulfillment.node_probe_results (
+				hosting_provision_id, source, check_name, success, latency_ms, error
+			) VALUES ($1, $2, $3, $4, $5, $6)
+		`, pr.HostingProvisionID, pr.Source, pr.Check, pr.Success, pr.LatencyMS, pr.Error)
+	}
+	if err := r.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("insert node_probe_results: %w", err)
+	}
+	return nil
+}
+
+// ListRecentByProvision 获取节点最近的探测结果，按时间倒序
+func (r *NodeProbeRepository) ListRecentByProvision(ctx context.Context, provisionID string, limit int) ([]*models.NodeProbeResult, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.node_probe_results
+		WHERE hosting_provision_id = $1
+		ORDER BY probed_at DESC
+		LIMIT $2
+	`, probeColumns)
+	rows, err := r.pool.Query(ctx, query, provisionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query node_probe_results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.NodeProbeResult
+	for rows.Next() {
+		pr := &models.NodeProbeResult{}
+		err := rows.Scan(
+			&pr.ID, &pr.HostingProvisionID, &pr.Source, &pr.Check,
+			&pr.Success, &pr.LatencyMS, &pr.Error, &pr.ProbedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan node_probe_result row: %w", err)
+		}
+		results = append(results, pr)
+	}
+	return results, rows.Err()
+}
+
+// DeleteOlderThan 删除超过保留期的探测结果
+func (r *NodeProbeRepository) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM fulfillment.node_probe_results WHERE probed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete node_probe_results: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type NodeReplacementRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewNodeReplacementRepository(pool *pgxpool.Pool) *NodeReplacementRepository {
+	return &NodeReplacementRepository{pool: pool}
+}
+
+func (r *NodeReplacementRepository) Create(ctx context.Context, nr *models.NodeReplacement) error {
+	query := `
+		INSERT INTO fulfillment.node_replacements (
+			id, hosting_provision_id, user_id, region, old_node_id, reason, status
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.pool.Exec(ctx, query,
+		nr.ID, nr.HostingProvisionID, nr.UserID, nr.Region, nr.OldNodeID, nr.Reason, nr.Status,
+	)
+	if err != nil {
+		return fmt.Errorf("insert node_replacement: %w", err)
+	}
+	return nil
+}
+
+// SetNewNode 记录替换节点 ID（创建后、就绪前）
+func (r *NodeReplacementRepository) SetNewNode(ctx context.Context, id, newNodeID string) error {
+	query := `UPDATE fulfillment.node_replacements SET new_node_id = $2 WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id, newNodeID)
+	if err != nil {
+		return fmt.Errorf("set node_replacement new node: %w", err)
+	}
+	return nil
+}
+
+// MarkCompleted 替换完成
+func (r *NodeReplacementRepository) MarkCompleted(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.node_replacements SET status = 'completed', completed_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("mark node_replacement completed: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed 替换失败，原节点保留
+func (r *NodeReplacementRepository) MarkFailed(ctx context.Context, id, errMsg string) error {
+	query := `UPDATE fulfillment.node_replacements SET status = 'failed', error = $2, completed_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id, errMsg)
+	if err != nil {
+		return fmt.Errorf("mark node_replacement failed: %w", err)
+	}
+	return nil
+}
+
+// CountStartedSince 统计 since 之后发起的替换次数（熔断用）
+func (r *NodeReplacementRepository) CountStartedSince(ctx context.Context, since time.Time) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM fulfillment.node_replacements WHERE started_at >= $1`
+	if err := r.pool.QueryRow(ctx, query, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count node_replacements: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type NodeSnapshotRepository struct {
+	pool    *pgxpool.Pool
+	secrets *SecretBox
+}
+
+func NewNodeSnapshotRepository(pool *pgxpool.Pool, secrets *SecretBox) *NodeSnapshotRepository {
+	return &NodeSnapshotRepository{pool: pool, secrets: secrets}
+}
+
+const fieldSnapshotAPIKey = "node_snapshots.api_key"
+
+const snapshotColumns = `id, user_id, hosting_provision_id, hosting_node_id,
+	snapshot_ref, provider, region, plan_tier,
+	api_key, public_key, short_id,
+	status, expires_at, restored_provision_id::text,
+	created_at, restored_at, deleted_at`
+
+func (r *NodeSnapshotRepository) Create(ctx context.Context, ns *models.NodeSnapshot) error {
+	apiKey, err := r.secrets.sealPtr(fieldSnapshotAPIKey, ns.ID, ns.APIKey)
+	if err != nil {
+		return fmt.Errorf("encrypt node_snapshot api_key: %w", err)
+	}
+
+	query := `
+		INSERT INTO fulfillment.node_snapshots (
+			id, user_id, hosting_provision_id, hosting_node_id,
+			snapshot_ref, provider, region, plan_tier,
+			api_key, public_key, short_id,
+			status, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`
+	_, err = r.pool.Exec(ctx, query,
+		ns.ID, ns.UserID, ns.HostingProvisionID, ns.HostingNodeID,
+		ns.SnapshotRef, ns.Provider, ns.Region, ns.PlanTier,
+		apiKey, ns.PublicKey, ns.ShortID,
+		ns.Status, ns.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert node_snapshot: %w", err)
+	}
+	return nil
+}
+
+func (r *NodeSnapshotRepository) GetByID(ctx context.Context, id string) (*models.NodeSnapshot, error) {
+	query := fmt.Sprintf(`SELECT %s FROM fulfillment.node_snapshots WHERE id = $1`, snapshotColumns)
+	return r.scanOne(r.pool.QueryRow(ctx, query, id))
+}
+
+// GetLatestAvailableByUser 获取用户最近一个仍在保留期内的快照
+func (r *NodeSnapshotRepository) GetLatestAvailableByUser(ctx context.Context, userID string) (*models.NodeSnapshot, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.node_snapshots
+		WHERE user_id = $1 AND status = 'available' AND expires_at > NOW()
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, snapshotColumns)
+	return r.scanOne(r.pool.QueryRow(ctx, query, userID))
+}
+
+// MarkRestored 在创建节点前领取快照用于恢复，防止并发创建恢复同一个快照。快照本身保留到 expires_at 再删除
+// Returns ErrNotFound if the snapshot is no longer available (concurrent restore).
+func (r *NodeSnapshotRepository) MarkRestored(ctx context.Context, id, provisionID string) error {
+	query := `
+		UPDATE fulfillment.node_snapshots SET
+			status = 'restored', restored_provision_id = $2, restored_at = NOW()
+		WHERE id = $1 AND status = 'available'
+	`
+	tag, err := r.pool.Exec(ctx, query, id, provisionID)
+	if err != nil {
+		return fmt.Errorf("mark node_snapshot restored: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ReleaseRestore 恢复未成功（切换到其他区域或创建失败）时归还快照，仅限仍由该 provision 领取的快照
+func (r *NodeSnapshotRepository) ReleaseRestore(ctx context.Context, id, provisionID string) error {
+	query := `
+		UPDATE fulfillment.node_snapshots SET
+			status = 'available', restored_provision_id = NULL, restored_at = NULL
+		WHERE id = $1 AND status = 'restored' AND restored_provision_id = $2
+	`
+	tag, err := r.pool.Exec(ctx, query, id, provisionID)
+	if err != nil {
+		return fmt.Errorf("release node_snapshot restore: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListExpired 获取已过保留期、尚未删除的快照
+func (r *NodeSnapshotRepository) ListExpired(ctx context.Context, limit int) ([]*models.NodeSnapshot, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.node_snapshots
+		WHERE status IN ('available', 'restored') AND expires_at <= NOW()
+		ORDER BY expires_at ASC
+		LIMIT $1
+	`, snapshotColumns)
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query expired node_snapshots: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// MarkDeleted 快照已在 hosting-service 删除
+func (r *NodeSnapshotRepository) MarkDeleted(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.node_snapshots SET status = 'deleted', deleted_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("mark node_snapshot deleted: %w", err)
+	}
+	return nil
+}
+
+func (r *NodeSnapshotRepository) scanOne(row pgx.Row) (*models.NodeSnapshot, error) {
+	ns := &models.NodeSnapshot{}
+	err := row.Scan(
+		&ns.ID, &ns.UserID, &ns.HostingProvisionID, &ns.HostingNodeID,
+		&ns.SnapshotRef, &ns.Provider, &ns.Region, &ns.PlanTier,
+		&ns.SealedAPIKey, &ns.PublicKey, &ns.ShortID,
+		&ns.Status, &ns.ExpiresAt, &ns.RestoredProvisionID,
+		&ns.CreatedAt, &ns.RestoredAt, &ns.DeletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("scan node_snapshot: %w", err)
+	}
+	return ns, nil
+}
+
+func (r *NodeSnapshotRepository) scanMany(rows pgx.Rows) ([]*models.NodeSnapshot, error) {
+	var results []*models.NodeSnapshot
+	for rows.Next() {
+		ns := &models.NodeSnapshot{}
+		err := rows.Scan(
+			&ns.ID, &ns.UserID, &ns.HostingProvisionID, &ns.HostingNodeID,
+			&ns.SnapshotRef, &ns.Provider, &ns.Region, &ns.PlanTier,
+			&ns.SealedAPIKey, &ns.PublicKey, &ns.ShortID,
+			&ns.Status, &ns.ExpiresAt, &ns.RestoredProvisionID,
+			&ns.CreatedAt, &ns.RestoredAt, &ns.DeletedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan node_snapshot row: %w", err)
+		}
+		results = append(results, ns)
+	}
+	return results, rows.Err()
+}
+
+// OpenCredentials decrypts the API key of a snapshot read from the database
+func (r *NodeSnapshotRepository) OpenCredentials(ns *models.NodeSnapshot) error {
+	apiKey, err := r.secrets.openPtr(fieldSnapshotAPIKey, ns.ID, ns.SealedAPIKey)
+	if err != nil {
+		return err
+	}
+	ns.APIKey = apiKey
+	return nil
+}
+
+// ResealSecrets re-encrypts snapshot credentials stored in plaintext or under an old key version
+func (r *NodeSnapshotRepository) ResealSecrets(ctx context.Context) (resealed, failed int, err error) {
+	return resealSecrets(ctx, r.pool, r.secrets, "node_snapshots", []string{"api_key"})
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RateLimitRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRateLimitRepository(pool *pgxpool.Pool) *RateLimitRepository {
+	return &RateLimitRepository{pool: pool}
+}
+
+// Hit records a request for key if fewer than limit requests were recorded within window
+// 返回窗口内（含本次）的请求数、窗口内最早一次请求的时间和是否放行
+func (r *RateLimitRepository) Hit(ctx context.Context, key string, limit int, window time.Duration) (int, time.Time, bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, time.Time{}, false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// 同一 key 的并发请求串行化，事务结束自动释放
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, key); err != nil {
+		return 0, time.Time{}, false, fmt.Errorf("lock rate_limit_hits: %w", err)
+	}
+
+	// 以数据库时间为准，避免各副本时钟不一致
+	query := `DELETE FROM fulfillment.rate_limit_hits WHERE key = $1 AND hit_at <= NOW() - $2 * INTERVAL '1 second'`
+	if _, err := tx.Exec(ctx, query, key, window.Seconds()); err != nil {
+		return 0, time.Time{}, false, fmt.Errorf("delete rate_limit_hits: %w", err)
+	}
+
+	var count int
+	var oldest *time.Time
+	err = tx.QueryRow(ctx, `SELECT COUNT(*), MIN(hit_at) FROM fulfillment.rate_limit_hits WHERE key = $1`, key).Scan(&count, &oldest)
+	if err != nil {
+		return 0, time.Time{}, false, fmt.Errorf("count rate_limit_hits: %w", err)
+	}
+	if count >= limit {
+		return count, *oldest, false, tx.Commit(ctx)
+	}
+
+	var hitAt time.Time
+	err = tx.QueryRow(ctx, `INSERT INTO fulfillment.rate_limit_hits (key) VALUES ($1) RETURNING hit_at`, key).Scan(&hitAt)
+	if err != nil {
+		return 0, time.Time{}, false, fmt.Errorf("insert rate_limit_hits: %w", err)
+	}
+	if oldest == nil {
+		oldest = &hitAt
+	}
+	return count + 1, *oldest, true, tx.Commit(ctx)
+}
+
+// DeleteBefore removes hits older than cutoff, returns the number of rows deleted
+func (r *RateLimitRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM fulfillment.rate_limit_hits WHERE hit_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete rate_limit_hits: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
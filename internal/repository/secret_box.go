@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// secretPrefix 加密后的字段格式: enc:v<密钥版本>:<base64(密钥 nonce | 加密的数据密钥 | 数据 nonce | 密文)>
+const secretPrefix = "enc:v"
+
+// ErrSecretKeyMissing 密文使用的密钥版本未配置（密钥已下线但仍有数据未重新加密）
+var ErrSecretKeyMissing = errors.New("encryption key version not configured")
+
+// placeholderKeys .env.example 中的示例密钥，长度合法但不能用于加密
+var placeholderKeys = map[string]bool{
+	"your-32-character-encryption-key": true,
+}
+
+// SecretBox envelope-encrypts secret columns with AES-256-GCM
+// 每个值使用随机数据密钥（DEK）加密，DEK 再由版本化的主密钥（KEK）加密后与密文一起保存。
+// 轮换主密钥时新增版本并设为当前版本，旧版本保留到 SecretReencryptScheduler 重新加密完所有数据。
+// 没有 enc: 前缀的值视为升级前的明文，照常读取，由重新加密任务补加密。
+// 附加数据为 "字段/行 id"，密文不能挪到其他字段或其他行解密。
+type SecretBox struct {
+	keys    map[int]cipher.AEAD
+	current int
+}
+
+// NewSecretBox creates a box from 32-byte keys by version, encrypting with the current version
+// 当前版本必须配置密钥；缺少密钥、使用示例密钥或版本号不为正时返回错误，不会退回明文存储
+func NewSecretBox(keys map[int][]byte, current int) (*SecretBox, error) {
+	if current <= 0 {
+		return nil, fmt.Errorf("encryption key version must be positive, got %d", current)
+	}
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current encryption key v%d not configured (ENCRYPTION_KEY)", current)
+	}
+
+	b := &SecretBox{keys: make(map[int]cipher.AEAD, len(keys)), current: current}
+	for version, key := range keys {
+		if version <= 0 {
+			return nil, fmt.Errorf("encryption key version must be positive, got %d", version)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key v%d must be 32 bytes, got %d", version, len(key))
+		}
+		if placeholderKeys[string(key)] {
+			return nil, fmt.Errorf("encryption key v%d is the example placeholder", version)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key v%d: %w", version, err)
+		}
+		b.keys[version] = aead
+	}
+	return b, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// CurrentVersion returns the key version used for new values
+func (b *SecretBox) CurrentVersion() int {
+	return b.current
+}
+
+// secretAAD 附加数据：字段名（如 "hosting_provisions.api_key"）和行 id
+func secretAAD(field, rowID string) []byte {
+	return []byte(field + "/" + rowID)
+}
+
+// Seal encrypts a secret of the given field and row
+func (b *SecretBox) Seal(field, rowID, plaintext string) (string, error) {
+	kek := b.keys[b.current]
+	aad := secretAAD(field, rowID)
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("generate data key: %w", err)
+	}
+	data, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+
+	kekNonce := make([]byte, kek.NonceSize())
+	dataNonce := make([]byte, data.NonceSize())
+	if _, err := rand.Read(kekNonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	if _, err := rand.Read(dataNonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+
+	out := append([]byte{}, kekNonce...)
+	out = kek.Seal(out, kekNonce, dek, aad)
+	out = append(out, dataNonce...)
+	out = data.Seal(out, dataNonce, []byte(plaintext), aad)
+
+	return secretPrefix + strconv.Itoa(b.current) + ":" + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Open decrypts a value written by Seal; plaintext values (未加密的旧数据) are returned as is
+func (b *SecretBox) Open(field, rowID, value string) (string, error) {
+	version, payload, ok := sealedVersion(value)
+	if !ok {
+		return value, nil
+	}
+	kek, ok := b.keys[version]
+	if !ok {
+		return "", fmt.Errorf("%s: %w (v%d)", field, ErrSecretKeyMissing, version)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("%s: decode: %w", field, err)
+	}
+
+	// 密钥 nonce | 加密的 DEK（32 + tag）| 数据 nonce | 密文
+	wrappedLen := 32 + kek.Overhead()
+	if len(raw) < kek.NonceSize()+wrappedLen {
+		return "", fmt.Errorf("%s: ciphertext too short", field)
+	}
+	kekNonce, rest := raw[:kek.NonceSize()], raw[kek.NonceSize():]
+	aad := secretAAD(field, rowID)
+	dek, err := kek.Open(nil, kekNonce, rest[:wrappedLen], aad)
+	if err != nil {
+		return "", fmt.Errorf("%s: unwrap data key: %w", field, err)
+	}
+	rest = rest[wrappedLen:]
+
+	data, err := newGCM(dek)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) < data.NonceSize() {
+		return "", fmt.Errorf("%s: ciphertext too short", field)
+	}
+	plaintext, err := data.Open(nil, rest[:data.NonceSize()], rest[data.NonceSize():], aad)
+	if err != nil {
+		return "", fmt.Errorf("%s: decrypt: %w", field, err)
+	}
+	return string(plaintext), nil
+}
+
+// NeedsReseal reports whether a stored value is plaintext or sealed with a non-current key
+func (b *SecretBox) NeedsReseal(value string) bool {
+	version, _, ok := sealedVersion(value)
+	return !ok || version != b.current
+}
+
+// sealPtr / openPtr 处理可空字段
+func (b *SecretBox) sealPtr(field, rowID string, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	sealed, err := b.Seal(field, rowID, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &sealed, nil
+}
+
+func (b *SecretBox) openPtr(field, rowID string, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	plaintext, err := b.Open(field, rowID, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &plaintext, nil
+}
+
+// sealedVersion splits a sealed value into its key version and base64 payload
+func sealedVersion(value string) (int, string, bool) {
+	rest, ok := strings.CutPrefix(value, secretPrefix)
+	if !ok {
+		return 0, "", false
+	}
+	v, payload, ok := strings.Cut(rest, ":")
+	if !ok {
+		return 0, "", false
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, "", false
+	}
+	return version, payload, true
+}
+
+// resealBatchSize 重新加密每批处理的行数
+const resealBatchSize = 100
+
+// resealSecrets re-encrypts the secret columns of a table that are plaintext or sealed with an old key.
+// 按 id 顺序扫描全表一遍；无法解密的行（密钥版本缺失）记入 failed 并跳过。
+// 更新时校验原值未变，避免覆盖并发写入的新凭据。
+func resealSecrets(ctx context.Context, pool *pgxpool.Pool, secrets *SecretBox, table string, columns []string) (resealed, failed int, err error) {
+	current := fmt.Sprintf("%s%d:%%", secretPrefix, secrets.CurrentVersion())
+	stale := make([]string, len(columns))
+	sets := make([]string, len(columns))
+	guards := make([]string, len(columns))
+	for i, col := range columns {
+		stale[i] = fmt.Sprintf("%s NOT LIKE $1", col)
+		sets[i] = fmt.Sprintf("%s = $%d", col, i+2)
+		guards[i] = fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", col, len(columns)+i+2)
+	}
+	selectQuery := fmt.Sprintf(`
+		SELECT id::text, %s FROM fulfillment.%s
+		WHERE id > $2::uuid AND (%s)
+		ORDER BY id
+		LIMIT $3
+	`, strings.Join(columns, ", "), table, strings.Join(stale, " OR "))
+	updateQuery := fmt.Sprintf(`UPDATE fulfillment.%s SET %s WHERE id = $1 AND %s`,
+		table, strings.Join(sets, ", "), strings.Join(guards, " AND "))
+
+	cursor := uuid.Nil.String()
+	for {
+		type row struct {
+			id     string
+			values []*string
+		}
+		var batch []row
+
+		rows, err := pool.Query(ctx, selectQuery, current, cursor, resealBatchSize)
+		if err != nil {
+			return resealed, failed, fmt.Errorf("select %s secrets: %w", table, err)
+		}
+		for rows.Next() {
+			r := row{values: make([]*string, len(columns))}
+			dest := []any{&r.id}
+			for i := range r.values {
+				dest = append(dest, &r.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return resealed, failed, fmt.Errorf("scan %s secrets: %w", table, err)
+			}
+			batch = append(batch, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return resealed, failed, fmt.Errorf("select %s secrets: %w", table, err)
+		}
+
+	rowLoop:
+		for _, r := range batch {
+			cursor = r.id
+			args := []any{r.id}
+			for i, v := range r.values {
+				field := table + "." + columns[i]
+				if v == nil || !secrets.NeedsReseal(*v) {
+					args = append(args, v)
+					continue
+				}
+				plaintext, err := secrets.Open(field, r.id, *v)
+				if err != nil {
+					log.Printf("[Secrets] Cannot re-encrypt %s of %s: %v", field, r.id, err)
+					failed++
+					continue rowLoop
+				}
+				sealed, err := secrets.Seal(field, r.id, plaintext)
+				if err != nil {
+					return resealed, failed, err
+				}
+				args = append(args, sealed)
+			}
+			for _, v := range r.values {
+				args = append(args, v)
+			}
+			tag, err := pool.Exec(ctx, updateQuery, args...)
+			if err != nil {
+				return resealed, failed, fmt.Errorf("update %s secrets: %w", table, err)
+			}
+			// 行数为 0 表示期间凭据被更新，新值已按当前密钥加密
+			resealed += int(tag.RowsAffected())
+		}
+
+		if len(batch) < resealBatchSize {
+			return resealed, failed, nil
+		}
+	}
+}
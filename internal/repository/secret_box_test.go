@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	testKeyV1 = []byte("0123456789abcdef0123456789abcdef")
+	testKeyV2 = []byte("fedcba9876543210fedcba9876543210")
+)
+
+func newTestBox(t *testing.T, keys map[int][]byte, current int) *SecretBox {
+	t.Helper()
+	b, err := NewSecretBox(keys, current)
+	if err != nil {
+		t.Fatalf("NewSecretBox: %v", err)
+	}
+	return b
+}
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	b := newTestBox(t, map[int][]byte{1: testKeyV1}, 1)
+
+	sealed, err := b.Seal(fieldHostingAPIKey, "row-1", "node-api-key")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:") {
+		t.Fatalf("sealed value %q has no version prefix", sealed)
+	}
+	if strings.Contains(sealed, "node-api-key") {
+		t.Fatal("sealed value contains the plaintext")
+	}
+
+	got, err := b.Open(fieldHostingAPIKey, "row-1", sealed)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got != "node-api-key" {
+		t.Fatalf("Open = %q, want %q", got, "node-api-key")
+	}
+
+	// 每次加密使用新的数据密钥和 nonce
+	again, _ := b.Seal(fieldHostingAPIKey, "row-1", "node-api-key")
+	if again == sealed {
+		t.Fatal("sealing the same value twice produced identical ciphertext")
+	}
+}
+
+func TestSecretBoxBindsFieldAndRow(t *testing.T) {
+	b := newTestBox(t, map[int][]byte{1: testKeyV1}, 1)
+	sealed, err := b.Seal(fieldHostingAPIKey, "row-1", "node-api-key")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	if _, err := b.Open(fieldHostingCallbackToken, "row-1", sealed); err == nil {
+		t.Error("ciphertext opened under another field")
+	}
+	if _, err := b.Open(fieldHostingAPIKey, "row-2", sealed); err == nil {
+		t.Error("ciphertext opened under another row")
+	}
+}
+
+func TestSecretBoxPlaintextPassthrough(t *testing.T) {
+	b := newTestBox(t, map[int][]byte{1: testKeyV1}, 1)
+
+	got, err := b.Open(fieldHostingAPIKey, "row-1", "legacy-plaintext")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got != "legacy-plaintext" {
+		t.Fatalf("Open = %q, want plaintext unchanged", got)
+	}
+	if !b.NeedsReseal("legacy-plaintext") {
+		t.Error("plaintext value should need resealing")
+	}
+}
+
+func TestSecretBoxRotation(t *testing.T) {
+	old := newTestBox(t, map[int][]byte{1: testKeyV1}, 1)
+	sealedV1, err := old.Seal(fieldSnapshotAPIKey, "row-1", "snapshot-key")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	// 轮换：v2 为当前密钥，v1 保留用于解密旧数据
+	rotated := newTestBox(t, map[int][]byte{1: testKeyV1, 2: testKeyV2}, 2)
+	got, err := rotated.Open(fieldSnapshotAPIKey, "row-1", sealedV1)
+	if err != nil {
+		t.Fatalf("Open v1 after rotation: %v", err)
+	}
+	if got != "snapshot-key" {
+		t.Fatalf("Open = %q, want %q", got, "snapshot-key")
+	}
+	if !rotated.NeedsReseal(sealedV1) {
+		t.Error("v1 ciphertext should need resealing after rotation")
+	}
+
+	// 重新加密后只需要 v2
+	sealedV2, err := rotated.Seal(fieldSnapshotAPIKey, "row-1", got)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if rotated.NeedsReseal(sealedV2) {
+		t.Error("v2 ciphertext should not need resealing")
+	}
+	retired := newTestBox(t, map[int][]byte{2: testKeyV2}, 2)
+	if got, err := retired.Open(fieldSnapshotAPIKey, "row-1", sealedV2); err != nil || got != "snapshot-key" {
+		t.Fatalf("Open resealed value = %q, %v", got, err)
+	}
+
+	// 旧密钥下线后未重新加密的数据报 ErrSecretKeyMissing
+	if _, err := retired.Open(fieldSnapshotAPIKey, "row-1", sealedV1); !errors.Is(err, ErrSecretKeyMissing) {
+		t.Fatalf("Open v1 without key: err = %v, want ErrSecretKeyMissing", err)
+	}
+}
+
+func TestNewSecretBoxRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[int][]byte
+		current int
+	}{
+		{"missing current key", map[int][]byte{}, 1},
+		{"current version not configured", map[int][]byte{1: testKeyV1}, 2},
+		{"zero version", map[int][]byte{0: testKeyV1}, 0},
+		{"negative old version", map[int][]byte{1: testKeyV1, -1: testKeyV2}, 1},
+		{"short key", map[int][]byte{1: []byte("too-short")}, 1},
+		{"placeholder key", map[int][]byte{1: []byte("your-32-character-encryption-key")}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSecretBox(tt.keys, tt.current); err == nil {
+				t.Fatal("NewSecretBox accepted invalid keys")
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TrafficCycleRepository archives per-cycle usage (vpn_traffic_cycles)
+type TrafficCycleRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTrafficCycleRepository(pool *pgxpool.Pool) *TrafficCycleRepository {
+	return &TrafficCycleRepository{pool: pool}
+}
+
+// Archive records the usage of a finished cycle; a cycle already archived is left unchanged
+func (r *TrafficCycleRepository) Archive(ctx context.Context, provisionID, userID string, start, end time.Time, allowance, used int64) error {
+	query := `
+		INSERT INTO fulfillment.vpn_traffic_cycles (
+			vpn_provision_id, user_id, cycle_start, cycle_end, allowance, traffic_used
+		) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (vpn_provision_id, cycle_start) DO NOTHING
+	`
+	_, err := r.pool.Exec(ctx, query, provisionID, userID, start, end, allowance, used)
+	if err != nil {
+		return fmt.Errorf("insert vpn_traffic_cycle: %w", err)
+	}
+	return nil
+}
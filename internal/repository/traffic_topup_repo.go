@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type TrafficTopUpRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTrafficTopUpRepository(pool *pgxpool.Pool) *TrafficTopUpRepository {
+	return &TrafficTopUpRepository{pool: pool}
+}
+
+const topupColumns = `id, user_id, vpn_provision_id, COALESCE(grant_id::text, ''),
+	source_ref, product_id, bytes, consumed_bytes, carry_over, expires_at,
+	status, created_at, updated_at`
+
+// Create inserts a top-up. source_ref is the idempotency key: if a top-up with the
+// same order reference already exists nothing is inserted and false is returned.
+func (r *TrafficTopUpRepository) Create(ctx context.Context, t *models.TrafficTopUp) (bool, error) {
+	query := `
+		INSERT INTO fulfillment.traffic_topups (
+			id, user_id, vpn_provision_id, grant_id, source_ref, product_id,
+			bytes, consumed_bytes, carry_over, expires_at, status
+		) VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (source_ref) WHERE source_ref != '' DO NOTHING
+	`
+	tag, err := r.pool.Exec(ctx, query,
+		t.ID, t.UserID, t.VPNProvisionID, t.GrantID, t.SourceRef, t.ProductID,
+		t.Bytes, t.ConsumedBytes, t.CarryOver, t.ExpiresAt, t.Status,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert traffic_topup: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// AttachGrant links the ledger grant backing a top-up that has none yet.
+// Returns false if another request already attached one.
+func (r *TrafficTopUpRepository) AttachGrant(ctx context.Context, id, grantID string) (bool, error) {
+	query := `
+		UPDATE fulfillment.traffic_topups SET grant_id = $2, updated_at = NOW()
+		WHERE id = $1 AND grant_id IS NULL
+	`
+	tag, err := r.pool.Exec(ctx, query, id, grantID)
+	if err != nil {
+		return false, fmt.Errorf("attach traffic_topup grant: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetBySourceRef finds a top-up by its order reference (idempotency)
+func (r *TrafficTopUpRepository) GetBySourceRef(ctx context.Context, sourceRef string) (*models.TrafficTopUp, error) {
+	query := fmt.Sprintf(`SELECT %s FROM fulfillment.traffic_topups WHERE source_ref = $1`, topupColumns)
+	rows, err := r.pool.Query(ctx, query, sourceRef)
+	if err != nil {
+		return nil, fmt.Errorf("get traffic_topup: %w", err)
+	}
+	defer rows.Close()
+	results, err := r.scanMany(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNotFound
+	}
+	return results[0], nil
+}
+
+// ListActiveByUser returns a user's unexpired top-ups, earliest expiry first
+// (the order in which overflow usage consumes them)
+func (r *TrafficTopUpRepository) ListActiveByUser(ctx context.Context, userID string) ([]*models.TrafficTopUp, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.traffic_topups
+		WHERE user_id = $1 AND status = 'active' AND expires_at > NOW()
+		ORDER BY expires_at, created_at
+	`, topupColumns)
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list traffic_topups: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// UpdateSettlement stores consumption, status and the grant currently backing the top-up
+func (r *TrafficTopUpRepository) UpdateSettlement(ctx context.Context, t *models.TrafficTopUp) error {
+	query := `
+		UPDATE fulfillment.traffic_topups SET
+			consumed_bytes = $2, status = $3, grant_id = NULLIF($4, '')::uuid, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(ctx, query, t.ID, t.ConsumedBytes, t.Status, t.GrantID)
+	if err != nil {
+		return fmt.Errorf("update traffic_topup: %w", err)
+	}
+	return nil
+}
+
+func (r *TrafficTopUpRepository) scanMany(rows pgx.Rows) ([]*models.TrafficTopUp, error) {
+	var results []*models.TrafficTopUp
+	for rows.Next() {
+		var t models.TrafficTopUp
+		if err := rows.Scan(
+			&t.ID, &t.UserID, &t.VPNProvisionID, &t.GrantID,
+			&t.SourceRef, &t.ProductID, &t.Bytes, &t.ConsumedBytes, &t.CarryOver, &t.ExpiresAt,
+			&t.Status, &t.CreatedAt, &t.UpdatedAt,
+		); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("scan traffic_topup: %w", err)
+		}
+		results = append(results, &t)
+	}
+	return results, rows.Err()
+}
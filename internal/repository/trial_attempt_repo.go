@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type TrialAttemptRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTrialAttemptRepository(pool *pgxpool.Pool) *TrialAttemptRepository {
+	return &TrialAttemptRepository{pool: pool}
+}
+
+const trialAttemptColumns = `id, user_id, email, normalized_email, device_id, ip_address,
+	decision, score, reasons,
+	override_decision, overridden_by, override_note, overridden_at, override_expires_at,
+	created_at`
+
+func (r *TrialAttemptRepository) Create(ctx context.Context, a *models.TrialAttempt) error {
+	query := `
+		INSERT INTO fulfillment.trial_attempts (
+			id, user_id, email, normalized_email, device_id, ip_address,
+			decision, score, reasons
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	reasons := a.Reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+	_, err := r.pool.Exec(ctx, query,
+		a.ID, a.UserID, a.Email, a.NormalizedEmail, a.DeviceID, a.IPAddress,
+		a.Decision, a.Score, reasons,
+	)
+	if err != nil {
+		return fmt.Errorf("insert trial_attempt: %w", err)
+	}
+	return nil
+}
+
+func (r *TrialAttemptRepository) GetByID(ctx context.Context, id string) (*models.TrialAttempt, error) {
+	query := fmt.Sprintf(`SELECT %s FROM fulfillment.trial_attempts WHERE id = $1`, trialAttemptColumns)
+	return r.scanOne(r.pool.QueryRow(ctx, query, id))
+}
+
+// GetLatestOverrideByUser returns the user's most recently reviewed attempt whose override has not expired
+func (r *TrialAttemptRepository) GetLatestOverrideByUser(ctx context.Context, userID string) (*models.TrialAttempt, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.trial_attempts
+		WHERE user_id = $1 AND override_decision IS NOT NULL AND override_expires_at > NOW()
+		ORDER BY overridden_at DESC
+		LIMIT 1
+	`, trialAttemptColumns)
+	return r.scanOne(r.pool.QueryRow(ctx, query, userID))
+}
+
+// CountByIPSince counts attempts from an IP address since the given time
+func (r *TrialAttemptRepository) CountByIPSince(ctx context.Context, ip string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM fulfillment.trial_attempts WHERE ip_address = $1 AND created_at >= $2`
+	var count int
+	if err := r.pool.QueryRow(ctx, query, ip, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count trial_attempts by ip: %w", err)
+	}
+	return count, nil
+}
+
+// CountDistinctUsersByDeviceSince counts other accounts that requested a trial from a device
+func (r *TrialAttemptRepository) CountDistinctUsersByDeviceSince(ctx context.Context, deviceID, excludeUserID string, since time.Time) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT user_id) FROM fulfillment.trial_attempts
+		WHERE device_id = $1 AND user_id != $2 AND created_at >= $3
+	`
+	var count int
+	if err := r.pool.QueryRow(ctx, query, deviceID, excludeUserID, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count trial_attempts by device: %w", err)
+	}
+	return count, nil
+}
+
+// CountByUserSince counts attempts by an account since the given time
+func (r *TrialAttemptRepository) CountByUserSince(ctx context.Context, userID string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM fulfillment.trial_attempts WHERE user_id = $1 AND created_at >= $2`
+	var count int
+	if err := r.pool.QueryRow(ctx, query, userID, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count trial_attempts by user: %w", err)
+	}
+	return count, nil
+}
+
+// ExistsAllowedByNormalizedEmail reports whether another account already got a trial with this normalized email
+func (r *TrialAttemptRepository) ExistsAllowedByNormalizedEmail(ctx context.Context, normalizedEmail, excludeUserID string) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM fulfillment.trial_attempts
+			WHERE normalized_email = $1 AND user_id != $2
+			  AND COALESCE(override_decision, decision) = 'allow'
+		)
+	`
+	var exists bool
+	if err := r.pool.QueryRow(ctx, query, normalizedEmail, excludeUserID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check trial_attempts by email: %w", err)
+	}
+	return exists, nil
+}
+
+// SetOverride records an admin override decision, followed until expiresAt
+func (r *TrialAttemptRepository) SetOverride(ctx context.Context, id, decision, overriddenBy, note string, expiresAt time.Time) error {
+	query := `
+		UPDATE fulfillment.trial_attempts SET
+			override_decision = $1,
+			overridden_by = $2,
+			override_note = $3,
+			overridden_at = NOW(),
+			override_expires_at = $5
+		WHERE id = $4
+	`
+	tag, err := r.pool.Exec(ctx, query, decision, overriddenBy, note, id, expiresAt)
+	if err != nil {
+		return fmt.Errorf("override trial_attempt: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListByFilters queries trial attempts with optional filters (admin)
+// decision 按最终结果（含人工复核）过滤
+func (r *TrialAttemptRepository) ListByFilters(ctx context.Context, userID, decision string, limit int) ([]*models.TrialAttempt, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.trial_attempts
+		WHERE ($1 = '' OR user_id = $1)
+		  AND ($2 = '' OR COALESCE(override_decision, decision) = $2)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, trialAttemptColumns)
+	rows, err := r.pool.Query(ctx, query, userID, decision, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list trial_attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.TrialAttempt
+	for rows.Next() {
+		a, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan trial_attempt row: %w", err)
+		}
+		results = append(results, a)
+	}
+	return results, rows.Err()
+}
+
+func (r *TrialAttemptRepository) scanOne(row pgx.Row) (*models.TrialAttempt, error) {
+	a, err := r.scan(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("scan trial_attempt: %w", err)
+	}
+	return a, nil
+}
+
+func (r *TrialAttemptRepository) scan(row pgx.Row) (*models.TrialAttempt, error) {
+	a := &models.TrialAttempt{}
+	err := row.Scan(
+		&a.ID, &a.UserID, &a.Email, &a.NormalizedEmail, &a.DeviceID, &a.IPAddress,
+		&a.Decision, &a.Score, &a.Reasons,
+		&a.OverrideDecision, &a.OverriddenBy, &a.OverrideNote, &a.OverriddenAt, &a.OverrideExpires,
+		&a.CreatedAt,
+	)
+	return a, err
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+// Voucher redemption errors
+var (
+	ErrVoucherInvalid         = errors.New("voucher code is invalid, expired or fully redeemed")
+	ErrVoucherAlreadyRedeemed = errors.New("voucher code already redeemed by this account")
+)
+
+type VoucherRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewVoucherRepository(pool *pgxpool.Pool) *VoucherRepository {
+	return &VoucherRepository{pool: pool}
+}
+
+const voucherColumns = `id, code, batch_id, campaign,
+	traffic_gb, duration_days, service_tier,
+	max_redemptions, redeemed_count, valid_from, valid_until, disabled,
+	created_by, created_at, updated_at`
+
+// CreateBatch inserts a batch of vouchers in a single transaction
+func (r *VoucherRepository) CreateBatch(ctx context.Context, vouchers []*models.Voucher) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO fulfillment.vouchers (
+			id, code, batch_id, campaign,
+			traffic_gb, duration_days, service_tier,
+			max_redemptions, valid_from, valid_until, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	for _, v := range vouchers {
+		_, err := tx.Exec(ctx, query,
+			v.ID, v.Code, v.BatchID, v.Campaign,
+			v.TrafficGB, v.DurationDays, v.ServiceTier,
+			v.MaxRedemptions, v.ValidFrom, v.ValidUntil, v.CreatedBy,
+		)
+		if err != nil {
+			return fmt.Errorf("insert voucher: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit voucher batch: %w", err)
+	}
+	return nil
+}
+
+// ListByBatch returns all vouchers in a batch (for CSV export)
+func (r *VoucherRepository) ListByBatch(ctx context.Context, batchID string) ([]*models.Voucher, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.vouchers
+		WHERE batch_id = $1
+		ORDER BY code
+	`, voucherColumns)
+	rows, err := r.pool.Query(ctx, query, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("list vouchers: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*models.Voucher
+	for rows.Next() {
+		v, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan voucher row: %w", err)
+		}
+		results = append(results, v)
+	}
+	return results, rows.Err()
+}
+
+// Consume atomically validates a code and takes one redemption slot for the user.
+// Returns ErrVoucherInvalid if the code is unknown, disabled, outside its validity
+// window or exhausted, and ErrVoucherAlreadyRedeemed on a repeat by the same user.
+func (r *VoucherRepository) Consume(ctx context.Context, code, userID string) (*models.Voucher, string, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := fmt.Sprintf(`
+		UPDATE fulfillment.vouchers SET
+			redeemed_count = redeemed_count + 1,
+			updated_at = NOW()
+		WHERE code = $1
+		  AND NOT disabled
+		  AND redeemed_count < max_redemptions
+		  AND NOW() >= valid_from AND NOW() < valid_until
+		RETURNING %s
+	`, voucherColumns)
+	v, err := r.scan(tx.QueryRow(ctx, query, code))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", ErrVoucherInvalid
+		}
+		return nil, "", fmt.Errorf("consume voucher: %w", err)
+	}
+
+	var redemptionID string
+	err = tx.QueryRow(ctx, `
+		INSERT INTO fulfillment.voucher_redemptions (voucher_id, user_id)
+		VALUES ($1, $2)
+		RETURNING id
+	`, v.ID, userID).Scan(&redemptionID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, "", ErrVoucherAlreadyRedeemed
+		}
+		return nil, "", fmt.Errorf("insert voucher_redemption: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, "", fmt.Errorf("commit voucher redemption: %w", err)
+	}
+	return v, redemptionID, nil
+}
+
+// Release gives back a redemption slot (used when fulfillment fails after Consume)
+func (r *VoucherRepository) Release(ctx context.Context, voucherID, redemptionID string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM fulfillment.voucher_redemptions WHERE id = $1`, redemptionID); err != nil {
+		return fmt.Errorf("delete voucher_redemption: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE fulfillment.vouchers SET redeemed_count = redeemed_count - 1, updated_at = NOW()
+		WHERE id = $1 AND redeemed_count > 0
+	`, voucherID); err != nil {
+		return fmt.Errorf("release voucher: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *VoucherRepository) scan(row pgx.Row) (*models.Voucher, error) {
+	v := &models.Voucher{}
+	err := row.Scan(
+		&v.ID, &v.Code, &v.BatchID, &v.Campaign,
+		&v.TrafficGB, &v.DurationDays, &v.ServiceTier,
+		&v.MaxRedemptions, &v.RedeemedCount, &v.ValidFrom, &v.ValidUntil, &v.Disabled,
+		&v.CreatedBy, &v.CreatedAt, &v.UpdatedAt,
+	)
+	return v, err
+}
@@ -7,10 +7,25 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
 )
 
+// Trial uniqueness violations (mapped from the partial unique indexes in 006)
+var (
+	ErrTrialUserUsed   = errors.New("trial already used by this account")
+	ErrTrialDeviceUsed = errors.New("trial already used on this device")
+	ErrTrialEmailUsed  = errors.New("trial already used with this email")
+)
+
+// trialConstraintErrors maps unique index names to their sentinel errors
+var trialConstraintErrors = map[string]error{
+	"idx_vpn_prov_user_trial":   ErrTrialUserUsed,
+	"idx_vpn_prov_device_trial": ErrTrialDeviceUsed,
+	"idx_vpn_prov_email_trial":  ErrTrialEmailUsed,
+}
+
 type VPNProvisionRepository struct {
 	pool *pgxpool.Pool
 }
@@ -23,31 +38,98 @@ const vpnColumns = `id, user_id, subscription_id, channel,
 	business_type, service_tier, otun_uuid, plan_tier, status,
 	traffic_limit, traffic_used, expire_at,
 	email, device_id, granted_by, note, is_current,
+	cycle_anchor, cycle_months, cycle_allowance, cycle_started_at, cycle_ends_at, cycle_reset_pending,
+	paused_at, pause_ends_at, pause_count, paused_seconds,
+	paused_remaining_seconds, paused_remaining_traffic,
 	created_at, updated_at`
 
-func (r *VPNProvisionRepository) Create(ctx context.Context, vp *models.VPNProvision) error {
-	query := `
-		INSERT INTO fulfillment.vpn_provisions (
-			id, user_id, subscription_id, channel,
-			business_type, service_tier, otun_uuid, plan_tier, status,
-			traffic_limit, traffic_used, expire_at,
-			email, device_id, granted_by, note, is_current
-		) VALUES (
-			$1, $2, $3, $4,
-			$5, $6, $7, $8, $9,
-			$10, $11, $12,
-			$13, $14, $15, $16, $17
-		)
-	`
-	_, err := r.pool.Exec(ctx, query,
+const vpnInsertQuery = `
+	INSERT INTO fulfillment.vpn_provisions (
+		id, user_id, subscription_id, channel,
+		business_type, service_tier, otun_uuid, plan_tier, status,
+		traffic_limit, traffic_used, expire_at,
+		email, device_id, granted_by, note, is_current,
+		cycle_anchor, cycle_months, cycle_allowance, cycle_started_at, cycle_ends_at
+	) VALUES (
+		$1, $2, $3, $4,
+		$5, $6, $7, $8, $9,
+		$10, $11, $12,
+		$13, $14, $15, $16, $17,
+		$18, $19, $20, $21, $22
+	)
+`
+
+func vpnInsertArgs(vp *models.VPNProvision) []any {
+	return []any{
 		vp.ID, vp.UserID, vp.SubscriptionID, vp.Channel,
 		vp.BusinessType, vp.ServiceTier, vp.OtunUUID, vp.PlanTier, vp.Status,
 		vp.TrafficLimit, vp.TrafficUsed, vp.ExpireAt,
 		vp.Email, vp.DeviceID, vp.GrantedBy, vp.Note, vp.IsCurrent,
-	)
+		vp.CycleAnchor, vp.CycleMonths, vp.CycleAllowance, vp.CycleStartedAt, vp.CycleEndsAt,
+	}
+}
+
+func (r *VPNProvisionRepository) Create(ctx context.Context, vp *models.VPNProvision) error {
+	_, err := r.pool.Exec(ctx, vpnInsertQuery, vpnInsertArgs(vp)...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			if trialErr, ok := trialConstraintErrors[pgErr.ConstraintName]; ok {
+				return trialErr
+			}
+		}
+		return fmt.Errorf("insert vpn_provision: %w", err)
+	}
+	return nil
+}
+
+// CreateRedeemed inserts the record produced by a voucher redemption and links the
+// redemption to it in one transaction. The record only becomes the user's current
+// one when the user has no current record yet (vp.IsCurrent is set accordingly).
+func (r *VPNProvisionRepository) CreateRedeemed(ctx context.Context, vp *models.VPNProvision, redemptionID string) error {
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// 同一用户并发兑换时串行判断 is_current
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, vp.UserID); err != nil {
+		return fmt.Errorf("lock vpn_provisions of user: %w", err)
+	}
+	var hasCurrent bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM fulfillment.vpn_provisions WHERE user_id = $1 AND is_current = TRUE)
+	`, vp.UserID).Scan(&hasCurrent)
+	if err != nil {
+		return fmt.Errorf("query current vpn_provision: %w", err)
+	}
+	vp.IsCurrent = !hasCurrent
+
+	if _, err := tx.Exec(ctx, vpnInsertQuery, vpnInsertArgs(vp)...); err != nil {
 		return fmt.Errorf("insert vpn_provision: %w", err)
 	}
+	tag, err := tx.Exec(ctx, `UPDATE fulfillment.voucher_redemptions SET vpn_provision_id = $1 WHERE id = $2`, vp.ID, redemptionID)
+	if err != nil {
+		return fmt.Errorf("update voucher_redemption: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit redeemed vpn_provision: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a vpn provision record (used to release a reserved trial when otun-manager fails)
+func (r *VPNProvisionRepository) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM fulfillment.vpn_provisions WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("delete vpn_provision: %w", err)
+	}
 	return nil
 }
 
@@ -124,8 +206,11 @@ func (r *VPNProvisionRepository) Update(ctx context.Context, vp *models.VPNProvi
 			otun_uuid = $5, plan_tier = $6, status = $7,
 			traffic_limit = $8, traffic_used = $9, expire_at = $10,
 			email = $11, device_id = $12, granted_by = $13, note = $14,
-			is_current = $15, updated_at = NOW()
-		WHERE id = $16
+			is_current = $15,
+			cycle_anchor = $16, cycle_months = $17, cycle_allowance = $18,
+			cycle_started_at = $19, cycle_ends_at = $20,
+			updated_at = NOW()
+		WHERE id = $21
 	`
 	_, err := r.pool.Exec(ctx, query,
 		vp.SubscriptionID, vp.Channel,
@@ -133,7 +218,10 @@ func (r *VPNProvisionRepository) Update(ctx context.Context, vp *models.VPNProvi
 		vp.OtunUUID, vp.PlanTier, vp.Status,
 		vp.TrafficLimit, vp.TrafficUsed, vp.ExpireAt,
 		vp.Email, vp.DeviceID, vp.GrantedBy, vp.Note,
-		vp.IsCurrent, vp.ID,
+		vp.IsCurrent,
+		vp.CycleAnchor, vp.CycleMonths, vp.CycleAllowance,
+		vp.CycleStartedAt, vp.CycleEndsAt,
+		vp.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("update vpn_provision: %w", err)
@@ -159,6 +247,49 @@ func (r *VPNProvisionRepository) MarkNotCurrent(ctx context.Context, id string)
 	return nil
 }
 
+// UnsetCurrent clears the is_current marker without touching status (history record)
+func (r *VPNProvisionRepository) UnsetCurrent(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.vpn_provisions SET is_current = FALSE, updated_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("unset vpn_provision current: %w", err)
+	}
+	return nil
+}
+
+// UpdateProjectionByUser writes the ledger-resolved limit/expiry onto the user's current active records
+func (r *VPNProvisionRepository) UpdateProjectionByUser(ctx context.Context, userID string, trafficLimit int64, expireAt time.Time) error {
+	query := `
+		UPDATE fulfillment.vpn_provisions SET traffic_limit = $2, expire_at = $3, updated_at = NOW()
+		WHERE user_id = $1 AND is_current = TRUE AND status = 'active'
+	`
+	_, err := r.pool.Exec(ctx, query, userID, trafficLimit, expireAt)
+	if err != nil {
+		return fmt.Errorf("update vpn_provision projection: %w", err)
+	}
+	return nil
+}
+
+// SetCurrent marks a record as the user's current provision
+func (r *VPNProvisionRepository) SetCurrent(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.vpn_provisions SET is_current = TRUE, updated_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("set vpn_provision current: %w", err)
+	}
+	return nil
+}
+
+// MarkRevoked sets status=revoked and clears is_current
+func (r *VPNProvisionRepository) MarkRevoked(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.vpn_provisions SET status = 'revoked', is_current = FALSE, updated_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("mark vpn_provision revoked: %w", err)
+	}
+	return nil
+}
+
 func (r *VPNProvisionRepository) UpdateTrafficUsed(ctx context.Context, id string, trafficUsed int64) error {
 	query := `UPDATE fulfillment.vpn_provisions SET traffic_used = $1, updated_at = NOW() WHERE id = $2`
 	_, err := r.pool.Exec(ctx, query, trafficUsed, id)
@@ -186,6 +317,159 @@ func (r *VPNProvisionRepository) ListByFilters(ctx context.Context, userID, busi
 	return r.scanMany(rows)
 }
 
+// ListCycleDue returns current provisions whose traffic cycle has ended
+// while the plan itself is still running, and those whose traffic reset is still pending
+func (r *VPNProvisionRepository) ListCycleDue(ctx context.Context, limit int) ([]*models.VPNProvision, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.vpn_provisions
+		WHERE cycle_months > 0 AND status = 'active' AND is_current = TRUE
+		  AND (cycle_ends_at <= NOW() OR cycle_reset_pending)
+		  AND (expire_at IS NULL OR expire_at > NOW())
+		ORDER BY cycle_ends_at
+		LIMIT $1
+	`, vpnColumns)
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list cycle-due vpn_provisions: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// AdvanceCycle moves a provision from the cycle ending at prevEndsAt into the next one,
+// clears traffic_used and marks the otun-manager reset as pending.
+// Returns ErrNotFound if the cycle was already advanced (concurrent or repeated run).
+func (r *VPNProvisionRepository) AdvanceCycle(ctx context.Context, id string, prevEndsAt, startedAt, endsAt time.Time) error {
+	query := `
+		UPDATE fulfillment.vpn_provisions SET
+			traffic_used = 0, cycle_started_at = $3, cycle_ends_at = $4,
+			cycle_reset_pending = TRUE, updated_at = NOW()
+		WHERE id = $1 AND cycle_ends_at = $2
+	`
+	tag, err := r.pool.Exec(ctx, query, id, prevEndsAt, startedAt, endsAt)
+	if err != nil {
+		return fmt.Errorf("advance vpn_provision cycle: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClearCycleResetPending records that otun-manager's traffic_used was reset for the current cycle
+func (r *VPNProvisionRepository) ClearCycleResetPending(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.vpn_provisions SET cycle_reset_pending = FALSE, updated_at = NOW() WHERE id = $1`
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("clear vpn_provision cycle reset: %w", err)
+	}
+	return nil
+}
+
+// MarkPaused moves an active provision to paused and records what was left of it.
+// Returns ErrNotFound if the record is no longer active (concurrent pause).
+func (r *VPNProvisionRepository) MarkPaused(ctx context.Context, id string, pausedAt, pauseEndsAt time.Time, remainingSeconds, remainingTraffic int64) error {
+	query := `
+		UPDATE fulfillment.vpn_provisions SET
+			status = 'paused', paused_at = $2, pause_ends_at = $3, pause_count = pause_count + 1,
+			paused_remaining_seconds = $4, paused_remaining_traffic = $5, updated_at = NOW()
+		WHERE id = $1 AND status = 'active'
+	`
+	tag, err := r.pool.Exec(ctx, query, id, pausedAt, pauseEndsAt, remainingSeconds, remainingTraffic)
+	if err != nil {
+		return fmt.Errorf("mark vpn_provision paused: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkResumed reactivates a paused provision, pushing expire_at and the traffic
+// cycle forward by the paused duration.
+// Returns ErrNotFound if the record is no longer paused (concurrent resume).
+func (r *VPNProvisionRepository) MarkResumed(ctx context.Context, id string, paused time.Duration) error {
+	query := `
+		UPDATE fulfillment.vpn_provisions SET
+			status = 'active',
+			expire_at = expire_at + make_interval(secs => $2::bigint),
+			cycle_anchor = cycle_anchor + make_interval(secs => $2::bigint),
+			cycle_started_at = cycle_started_at + make_interval(secs => $2::bigint),
+			cycle_ends_at = cycle_ends_at + make_interval(secs => $2::bigint),
+			paused_seconds = paused_seconds + $2::bigint,
+			paused_at = NULL, pause_ends_at = NULL,
+			paused_remaining_seconds = 0, paused_remaining_traffic = 0,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'paused'
+	`
+	tag, err := r.pool.Exec(ctx, query, id, int64(paused.Seconds()))
+	if err != nil {
+		return fmt.Errorf("mark vpn_provision resumed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RestorePaused undoes MarkResumed when re-enabling the user failed, so the
+// provision is paused again and the resume can be retried (by the user or VPNPauseScheduler).
+// Returns ErrNotFound if the record is no longer active.
+func (r *VPNProvisionRepository) RestorePaused(ctx context.Context, vp *models.VPNProvision, paused time.Duration) error {
+	query := `
+		UPDATE fulfillment.vpn_provisions SET
+			status = 'paused',
+			expire_at = expire_at - make_interval(secs => $2::bigint),
+			cycle_anchor = cycle_anchor - make_interval(secs => $2::bigint),
+			cycle_started_at = cycle_started_at - make_interval(secs => $2::bigint),
+			cycle_ends_at = cycle_ends_at - make_interval(secs => $2::bigint),
+			paused_seconds = paused_seconds - $2::bigint,
+			paused_at = $3, pause_ends_at = $4,
+			paused_remaining_seconds = $5, paused_remaining_traffic = $6,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'active'
+	`
+	tag, err := r.pool.Exec(ctx, query, vp.ID, int64(paused.Seconds()),
+		vp.PausedAt, vp.PauseEndsAt, vp.PausedRemainingSeconds, vp.PausedRemainingTraffic)
+	if err != nil {
+		return fmt.Errorf("restore vpn_provision paused: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListPauseDue returns paused provisions that have reached their max paused days
+func (r *VPNProvisionRepository) ListPauseDue(ctx context.Context, limit int) ([]*models.VPNProvision, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.vpn_provisions
+		WHERE status = 'paused' AND pause_ends_at <= NOW()
+		ORDER BY pause_ends_at
+		LIMIT $1
+	`, vpnColumns)
+	rows, err := r.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list pause-due vpn_provisions: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// ListActiveByUser returns a user's active provisions, latest expiry first
+func (r *VPNProvisionRepository) ListActiveByUser(ctx context.Context, userID string) ([]*models.VPNProvision, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.vpn_provisions
+		WHERE user_id = $1 AND status = 'active'
+		ORDER BY expire_at DESC NULLS LAST, created_at DESC
+	`, vpnColumns)
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list active vpn_provisions: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
 // UpdateEmailByUserID 更新用户邮箱（邮箱绑定事件触发）
 func (r *VPNProvisionRepository) UpdateEmailByUserID(ctx context.Context, userID, email string) error {
 	query := `UPDATE fulfillment.vpn_provisions SET email = $2, updated_at = NOW() WHERE user_id = $1`
@@ -214,6 +498,9 @@ func (r *VPNProvisionRepository) scanOne(row pgx.Row) (*models.VPNProvision, err
 		&vp.BusinessType, &vp.ServiceTier, &vp.OtunUUID, &vp.PlanTier, &vp.Status,
 		&vp.TrafficLimit, &vp.TrafficUsed, &vp.ExpireAt,
 		&vp.Email, &vp.DeviceID, &vp.GrantedBy, &vp.Note, &vp.IsCurrent,
+		&vp.CycleAnchor, &vp.CycleMonths, &vp.CycleAllowance, &vp.CycleStartedAt, &vp.CycleEndsAt, &vp.CycleResetPending,
+		&vp.PausedAt, &vp.PauseEndsAt, &vp.PauseCount, &vp.PausedSeconds,
+		&vp.PausedRemainingSeconds, &vp.PausedRemainingTraffic,
 		&vp.CreatedAt, &vp.UpdatedAt,
 	)
 	if err != nil {
@@ -234,6 +521,9 @@ func (r *VPNProvisionRepository) scanMany(rows pgx.Rows) ([]*models.VPNProvision
 			&vp.BusinessType, &vp.ServiceTier, &vp.OtunUUID, &vp.PlanTier, &vp.Status,
 			&vp.TrafficLimit, &vp.TrafficUsed, &vp.ExpireAt,
 			&vp.Email, &vp.DeviceID, &vp.GrantedBy, &vp.Note, &vp.IsCurrent,
+			&vp.CycleAnchor, &vp.CycleMonths, &vp.CycleAllowance, &vp.CycleStartedAt, &vp.CycleEndsAt, &vp.CycleResetPending,
+			&vp.PausedAt, &vp.PauseEndsAt, &vp.PauseCount, &vp.PausedSeconds,
+			&vp.PausedRemainingSeconds, &vp.PausedRemainingTraffic,
 			&vp.CreatedAt, &vp.UpdatedAt,
 		)
 		if err != nil {
@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+type WarmNodeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWarmNodeRepository(pool *pgxpool.Pool) *WarmNodeRepository {
+	return &WarmNodeRepository{pool: pool}
+}
+
+const warmNodeColumns = `id, hosting_node_id, provider, region, bundle_id,
+	status, error_message, claimed_by_provision_id::text,
+	created_at, ready_at, claimed_at, deleted_at`
+
+// WarmPoolCount is the number of pending (creating + ready) nodes of one pool
+type WarmPoolCount struct {
+	Region   string
+	BundleID string
+	Creating int
+	Ready    int
+}
+
+// TryLockReplenish takes the session advisory lock that serializes replenish rounds
+// across replicas. ok=false means another replica holds it; unlock must be called when ok.
+func (r *WarmNodeRepository) TryLockReplenish(ctx context.Context) (unlock func(), ok bool, err error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("acquire conn: %w", err)
+	}
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtextextended('warm_pool_replenish', 0))`).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("lock warm_pool_replenish: %w", err)
+	}
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+	return func() {
+		// 会话级锁必须在同一连接上释放；释放失败时关闭连接，锁随会话结束
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtextextended('warm_pool_replenish', 0))`); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}, true, nil
+}
+
+func (r *WarmNodeRepository) Create(ctx context.Context, wn *models.WarmNode) error {
+	query := `
+		INSERT INTO fulfillment.warm_nodes (id, provider, region, bundle_id, status)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.pool.Exec(ctx, query, wn.ID, wn.Provider, wn.Region, wn.BundleID, wn.Status)
+	if err != nil {
+		return fmt.Errorf("insert warm_node: %w", err)
+	}
+	return nil
+}
+
+// SetNode 记录 hosting-service 返回的节点 ID
+func (r *WarmNodeRepository) SetNode(ctx context.Context, id, hostingNodeID string) error {
+	query := `UPDATE fulfillment.warm_nodes SET hosting_node_id = $2 WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id, hostingNodeID)
+	if err != nil {
+		return fmt.Errorf("set warm_node node id: %w", err)
+	}
+	return nil
+}
+
+// MarkReady 节点就绪，可被领取
+func (r *WarmNodeRepository) MarkReady(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.warm_nodes SET status = 'ready', ready_at = NOW() WHERE id = $1 AND status = 'creating'`
+	tag, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("mark warm_node ready: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkFailed 创建失败；节点已不在 creating（如已被超时回收）时返回 ErrNotFound
+func (r *WarmNodeRepository) MarkFailed(ctx context.Context, id, errMsg string) error {
+	query := `
+		UPDATE fulfillment.warm_nodes SET status = 'failed', error_message = $2, deleted_at = NOW()
+		WHERE id = $1 AND status = 'creating'
+	`
+	tag, err := r.pool.Exec(ctx, query, id, errMsg)
+	if err != nil {
+		return fmt.Errorf("mark warm_node failed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListStuckCreating 获取 before 之前创建、仍停留在 creating 的节点
+func (r *WarmNodeRepository) ListStuckCreating(ctx context.Context, before time.Time) ([]*models.WarmNode, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.warm_nodes
+		WHERE status = 'creating' AND created_at < $1
+		ORDER BY created_at ASC
+	`, warmNodeColumns)
+	rows, err := r.pool.Query(ctx, query, before)
+	if err != nil {
+		return nil, fmt.Errorf("query stuck warm_nodes: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// MarkDeleted 节点已从 hosting-service 删除（缩容或领取后交付失败）
+func (r *WarmNodeRepository) MarkDeleted(ctx context.Context, id string) error {
+	query := `UPDATE fulfillment.warm_nodes SET status = 'deleted', deleted_at = NOW() WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("mark warm_node deleted: %w", err)
+	}
+	return nil
+}
+
+// Claim 原子领取指定区域和规格中最早就绪的节点
+// SKIP LOCKED 保证并发领取不会拿到同一个节点；池为空时返回 ErrNotFound
+func (r *WarmNodeRepository) Claim(ctx context.Context, region, bundleID, provisionID string) (*models.WarmNode, error) {
+	query := fmt.Sprintf(`
+		UPDATE fulfillment.warm_nodes SET
+			status = 'claimed', claimed_by_provision_id = $3, claimed_at = NOW()
+		WHERE id = (
+			SELECT id FROM fulfillment.warm_nodes
+			WHERE status = 'ready' AND region = $1 AND bundle_id = $2
+			ORDER BY ready_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING %s
+	`, warmNodeColumns)
+	return r.scanOne(r.pool.QueryRow(ctx, query, region, bundleID, provisionID))
+}
+
+// CountPending 按 (region, bundle) 统计 creating 和 ready 的节点数
+func (r *WarmNodeRepository) CountPending(ctx context.Context) ([]WarmPoolCount, error) {
+	query := `
+		SELECT region, bundle_id,
+			COUNT(*) FILTER (WHERE status = 'creating'),
+			COUNT(*) FILTER (WHERE status = 'ready')
+		FROM fulfillment.warm_nodes
+		WHERE status IN ('creating', 'ready')
+		GROUP BY region, bundle_id
+	`
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("count warm_nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []WarmPoolCount
+	for rows.Next() {
+		var c WarmPoolCount
+		if err := rows.Scan(&c.Region, &c.BundleID, &c.Creating, &c.Ready); err != nil {
+			return nil, fmt.Errorf("scan warm_node count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// ListReady 获取某个池中就绪的节点，最早就绪的在前
+func (r *WarmNodeRepository) ListReady(ctx context.Context, region, bundleID string) ([]*models.WarmNode, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM fulfillment.warm_nodes
+		WHERE status = 'ready' AND region = $1 AND bundle_id = $2
+		ORDER BY ready_at ASC
+	`, warmNodeColumns)
+	rows, err := r.pool.Query(ctx, query, region, bundleID)
+	if err != nil {
+		return nil, fmt.Errorf("query ready warm_nodes: %w", err)
+	}
+	defer rows.Close()
+	return r.scanMany(rows)
+}
+
+// IsPoolNode 判断 hosting 节点是否是尚未领取的池节点（CleanupScheduler 据此跳过）
+// 刚领取（claimedGrace 内）的节点同样算作池节点：领取到 provision 记录 hosting_node_id 之间
+// 节点没有 provision 引用，不能被当作孤立节点删除
+func (r *WarmNodeRepository) IsPoolNode(ctx context.Context, hostingNodeID string, claimedGrace time.Duration) (bool, error) {
+	var exists bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM fulfillment.warm_nodes
+			WHERE hosting_node_id = $1
+			  AND (status IN ('creating', 'ready')
+			       OR (status = 'claimed' AND claimed_at > NOW() - make_interval(secs => $2)))
+		)
+	`
+	if err := r.pool.QueryRow(ctx, query, hostingNodeID, claimedGrace.Seconds()).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check warm_node: %w", err)
+	}
+	return exists, nil
+}
+
+// IdleHoursSince 按规格统计 since 之后池节点的空闲时长（小时），用于成本上限
+// 空闲时长从创建开始，到被领取或删除为止
+func (r *WarmNodeRepository) IdleHoursSince(ctx context.Context, since time.Time) (map[string]float64, error) {
+	query := `
+		SELECT bundle_id,
+			SUM(EXTRACT(EPOCH FROM (
+				COALESCE(claimed_at, deleted_at, NOW()) - GREATEST(created_at, $1)
+			)) / 3600)
+		FROM fulfillment.warm_nodes
+		WHERE COALESCE(claimed_at, deleted_at, NOW()) > $1
+		GROUP BY bundle_id
+	`
+	rows, err := r.pool.Query(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("sum warm_node idle hours: %w", err)
+	}
+	defer rows.Close()
+
+	hours := make(map[string]float64)
+	for rows.Next() {
+		var bundleID string
+		var h float64
+		if err := rows.Scan(&bundleID, &h); err != nil {
+			return nil, fmt.Errorf("scan warm_node idle hours: %w", err)
+		}
+		hours[bundleID] = h
+	}
+	return hours, rows.Err()
+}
+
+func (r *WarmNodeRepository) scanOne(row pgx.Row) (*models.WarmNode, error) {
+	wn := &models.WarmNode{}
+	err := row.Scan(
+		&wn.ID, &wn.HostingNodeID, &wn.Provider, &wn.Region, &wn.BundleID,
+		&wn.Status, &wn.ErrorMessage, &wn.ClaimedByProvisionID,
+		&wn.CreatedAt, &wn.ReadyAt, &wn.ClaimedAt, &wn.DeletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("scan warm_node: %w", err)
+	}
+	return wn, nil
+}
+
+func (r *WarmNodeRepository) scanMany(rows pgx.Rows) ([]*models.WarmNode, error) {
+	var results []*models.WarmNode
+	for rows.Next() {
+		wn := &models.WarmNode{}
+		err := rows.Scan(
+			&wn.ID, &wn.HostingNodeID, &wn.Provider, &wn.Region, &wn.BundleID,
+			&wn.Status, &wn.ErrorMessage, &wn.ClaimedByProvisionID,
+			&wn.CreatedAt, &wn.ReadyAt, &wn.ClaimedAt, &wn.DeletedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan warm_node row: %w", err)
+		}
+		results = append(results, wn)
+	}
+	return results, rows.Err()
+}
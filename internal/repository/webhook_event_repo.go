@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type WebhookEventRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookEventRepository(pool *pgxpool.Pool) *WebhookEventRepository {
+	return &WebhookEventRepository{pool: pool}
+}
+
+// Record stores a webhook event id, returns false if the event was already recorded
+func (r *WebhookEventRepository) Record(ctx context.Context, eventID string) (bool, error) {
+	query := `INSERT INTO fulfillment.hosting_webhook_events (event_id) VALUES ($1) ON CONFLICT (event_id) DO NOTHING`
+	tag, err := r.pool.Exec(ctx, query, eventID)
+	if err != nil {
+		return false, fmt.Errorf("insert hosting_webhook_event: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Forget removes a recorded event id so that a retry of the event is processed again
+func (r *WebhookEventRepository) Forget(ctx context.Context, eventID string) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM fulfillment.hosting_webhook_events WHERE event_id = $1`, eventID)
+	if err != nil {
+		return fmt.Errorf("delete hosting_webhook_event: %w", err)
+	}
+	return nil
+}
+
+// DeleteBefore removes event ids received before cutoff, returns the number of rows deleted
+func (r *WebhookEventRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM fulfillment.hosting_webhook_events WHERE received_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete hosting_webhook_events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/client"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// AutoHealScheduler 不健康节点自动替换任务
+// degraded 持续超过 AUTO_HEAL_UNHEALTHY_MINUTES 的节点在同区域替换。
+// 熔断：每小时替换数达到上限，或 degraded 节点占比过高（疑似云厂商整体故障）时暂停替换。
+type AutoHealScheduler struct {
+	cfg              config.AutoHealConfig
+	hostingRepo      *repository.HostingProvisionRepository
+	replacementRepo  *repository.NodeReplacementRepository
+	hostingClient    *client.HostingClient
+	provisionService *ProvisionService
+	interval         time.Duration
+
+	breakerOpen bool // 仅用于状态变化时打印日志
+}
+
+// NewAutoHealScheduler 创建自动替换调度器
+func NewAutoHealScheduler(
+	cfg config.AutoHealConfig,
+	hostingRepo *repository.HostingProvisionRepository,
+	replacementRepo *repository.NodeReplacementRepository,
+	hostingClient *client.HostingClient,
+	provisionService *ProvisionService,
+) *AutoHealScheduler {
+	return &AutoHealScheduler{
+		cfg:              cfg,
+		hostingRepo:      hostingRepo,
+		replacementRepo:  replacementRepo,
+		hostingClient:    hostingClient,
+		provisionService: provisionService,
+		interval:         time.Duration(cfg.CheckInterval) * time.Minute,
+	}
+}
+
+// Start 启动调度器（阻塞运行，应在 goroutine 中调用）
+func (s *AutoHealScheduler) Start(ctx context.Context) {
+	log.Printf("[AutoHealScheduler] Started (interval=%v, unhealthy_after=%dm, max_per_hour=%d)",
+		s.interval, s.cfg.UnhealthyMinutes, s.cfg.MaxPerHour)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[AutoHealScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.markHostingFailedNodes(ctx)
+			s.healUnhealthyNodes(ctx)
+		}
+	}
+}
+
+// markHostingFailedNodes 已交付节点在 hosting-service 变为 failed 时标记 degraded，
+// 不再出现在 failed 列表中的节点清除标记，之后按探测结果恢复
+func (s *AutoHealScheduler) markHostingFailedNodes(ctx context.Context) {
+	nodes, err := s.hostingClient.ListFailedNodes(ctx, 0)
+	if err != nil {
+		log.Printf("[AutoHealScheduler] Failed to list failed nodes from hosting-service: %v", err)
+		return
+	}
+
+	failedIDs := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		failedIDs = append(failedIDs, node.NodeID)
+		hp, err := s.hostingRepo.GetByHostingNodeID(ctx, node.NodeID)
+		if err != nil || hp.Status != models.StatusActive {
+			continue // 未交付的失败节点由 provision 流程和 CleanupScheduler 处理
+		}
+		s.provisionService.MarkHostingFailed(ctx, hp, "hosting-service reported node failed: "+node.ErrorMessage)
+	}
+
+	if n, err := s.hostingRepo.ClearHostingFailed(ctx, failedIDs); err != nil {
+		log.Printf("[AutoHealScheduler] Failed to clear recovered hosting failures: %v", err)
+	} else if n > 0 {
+		log.Printf("[AutoHealScheduler] %d nodes no longer reported failed by hosting-service", n)
+	}
+}
+
+func (s *AutoHealScheduler) healUnhealthyNodes(ctx context.Context) {
+	since := time.Now().Add(-time.Duration(s.cfg.UnhealthyMinutes) * time.Minute)
+	candidates, err := s.hostingRepo.ListHealCandidates(ctx, since, max(s.cfg.MaxPerHour, 1))
+	if err != nil {
+		log.Printf("[AutoHealScheduler] Failed to list heal candidates: %v", err)
+		return
+	}
+	if len(candidates) == 0 {
+		s.setBreaker(false, "")
+		return
+	}
+
+	budget, reason := s.replacementBudget(ctx)
+	if budget <= 0 {
+		s.setBreaker(true, reason)
+		return
+	}
+	s.setBreaker(false, "")
+
+	for _, hp := range candidates[:min(budget, len(candidates))] {
+		err := s.provisionService.ReplaceNode(ctx, hp, "node unhealthy since "+hp.HealthChangedAt.Format(time.RFC3339))
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[AutoHealScheduler] Failed to start replacement of %s: %v", hp.ID, err)
+		}
+	}
+}
+
+// replacementBudget 熔断检查，返回本轮还可发起的替换数
+func (s *AutoHealScheduler) replacementBudget(ctx context.Context) (int, string) {
+	nodes, err := s.hostingRepo.ListProbeTargets(ctx)
+	if err != nil {
+		return 0, "failed to count active nodes: " + err.Error()
+	}
+	if len(nodes) >= s.cfg.MinNodesForPercent && len(nodes) > 0 {
+		degraded := 0
+		for _, hp := range nodes {
+			if hp.HealthStatus == models.NodeHealthDegraded {
+				degraded++
+			}
+		}
+		if degraded*100/len(nodes) >= s.cfg.MaxUnhealthyPercent {
+			return 0, "too many degraded nodes, possible provider-wide outage"
+		}
+	}
+
+	recent, err := s.replacementRepo.CountStartedSince(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		return 0, "failed to count recent replacements: " + err.Error()
+	}
+	if recent >= s.cfg.MaxPerHour {
+		return 0, "hourly replacement limit reached"
+	}
+	return s.cfg.MaxPerHour - recent, ""
+}
+
+func (s *AutoHealScheduler) setBreaker(open bool, reason string) {
+	if open == s.breakerOpen {
+		return
+	}
+	s.breakerOpen = open
+	if open {
+		log.Printf("[AutoHealScheduler] WARN: circuit breaker open, pausing replacements: %s", reason)
+	} else {
+		log.Println("[AutoHealScheduler] Circuit breaker closed, replacements resumed")
+	}
+}
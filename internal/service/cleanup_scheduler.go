@@ -6,30 +6,37 @@ import (
 	"time"
 
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/client"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
 )
 
 // CleanupScheduler 后台兜底清理任务
 // 定时扫描需要清理的失败 provision 和孤立云实例，防止资源泄漏
 type CleanupScheduler struct {
-	hostingRepo   *repository.HostingProvisionRepository
-	hostingClient *client.HostingClient
-	interval      time.Duration
-	failedNodeAge time.Duration // 失败节点清理阈值（创建超过多久才清理）
+	hostingRepo      *repository.HostingProvisionRepository
+	hostingClient    *client.HostingClient
+	provisionService *ProvisionService
+	warmPool         *WarmPoolService
+	interval         time.Duration
+	failedNodeAge    time.Duration // 失败节点清理阈值（创建超过多久才清理）
 }
 
 // NewCleanupScheduler 创建清理调度器
 func NewCleanupScheduler(
 	hostingRepo *repository.HostingProvisionRepository,
 	hostingClient *client.HostingClient,
+	provisionService *ProvisionService,
+	warmPool *WarmPoolService,
 	interval time.Duration,
 	failedNodeAge time.Duration,
 ) *CleanupScheduler {
 	return &CleanupScheduler{
-		hostingRepo:   hostingRepo,
-		hostingClient: hostingClient,
-		interval:      interval,
-		failedNodeAge: failedNodeAge,
+		hostingRepo:      hostingRepo,
+		hostingClient:    hostingClient,
+		provisionService: provisionService,
+		warmPool:         warmPool,
+		interval:         interval,
+		failedNodeAge:    failedNodeAge,
 	}
 }
 
@@ -53,13 +60,38 @@ func (s *CleanupScheduler) Start(ctx context.Context) {
 
 // runCleanupCycle 执行一轮清理
 func (s *CleanupScheduler) runCleanupCycle(ctx context.Context) {
+	s.cleanupQueuedNodes(ctx)
 	s.cleanupFailedProvisions(ctx)
 	s.cleanupOrphanedNodes(ctx)
 	s.cleanupOrphanedActiveNodes(ctx)
+	s.provisionService.DeleteExpiredSnapshots(ctx)
+	s.provisionService.PurgeWebhookEvents(ctx)
 }
 
-// cleanupFailedProvisions 清理标记了 needs_cleanup 的失败 provision
-// 这些是 provisionAsync 中 DeleteNode 失败后留下的记录
+// cleanupQueuedNodes 重试删除 node_cleanups 中记录的云实例
+// 这些是 createNodeIn 中节点未就绪且 DeleteNode 失败后留下的记录
+func (s *CleanupScheduler) cleanupQueuedNodes(ctx context.Context) {
+	cleanups, err := s.hostingRepo.ListNodeCleanups(ctx, 20)
+	if err != nil {
+		log.Printf("[CleanupScheduler] Failed to list queued node cleanups: %v", err)
+		return
+	}
+
+	for _, nc := range cleanups {
+		if _, err := s.hostingClient.DeleteNode(ctx, nc.HostingNodeID); err != nil {
+			log.Printf("[CleanupScheduler] Failed to delete queued node %s: %v", nc.HostingNodeID, err)
+			continue
+		}
+		if err := s.hostingRepo.DeleteNodeCleanup(ctx, nc.HostingNodeID); err != nil {
+			log.Printf("[CleanupScheduler] Failed to remove cleanup record of %s: %v", nc.HostingNodeID, err)
+		}
+		log.Printf("[CleanupScheduler] Cleaned up failed node %s", nc.HostingNodeID)
+	}
+}
+
+// cleanupFailedProvisions 清理升级前标记了 needs_cleanup 的失败 provision
+// 标记只记录了 provision，其 hosting_node_id 可能已被故障切换后的新节点覆盖，
+// 因此只删除已失败/已删除 provision 的节点，仍在使用的 provision 只清除标记
 func (s *CleanupScheduler) cleanupFailedProvisions(ctx context.Context) {
 	provisions, err := s.hostingRepo.ListNeedsCleanup(ctx, 20)
 	if err != nil {
@@ -74,8 +106,8 @@ func (s *CleanupScheduler) cleanupFailedProvisions(ctx context.Context) {
 	log.Printf("[CleanupScheduler] Found %d provisions needing cleanup", len(provisions))
 
 	for _, p := range provisions {
-		if p.HostingNodeID == "" {
-			// 没有 hosting_node_id，无需清理云资源，直接清除标记
+		if p.HostingNodeID == "" || (p.Status != models.StatusFailed && p.Status != models.StatusDeleted) {
+			// 没有 hosting_node_id 或节点仍属于使用中的 provision，无需清理云资源，直接清除标记
 			if err := s.hostingRepo.ClearCleanupFlag(ctx, p.ID); err != nil {
 				log.Printf("[CleanupScheduler] Failed to clear flag for %s: %v", p.ID, err)
 			}
@@ -103,6 +135,8 @@ func (s *CleanupScheduler) cleanupFailedProvisions(ctx context.Context) {
 // - 订阅过期/取消但 deprovision 事件丢失
 // - deprovision 执行失败且重试也失败
 // - 任何导致 VPS 和订阅不一致的 bug
+//
+// 预热池中未领取的节点没有 provision，按池记录跳过。
 func (s *CleanupScheduler) cleanupOrphanedActiveNodes(ctx context.Context) {
 	nodes, err := s.hostingClient.ListActiveOBoxNodes(ctx)
 	if err != nil {
@@ -120,6 +154,15 @@ func (s *CleanupScheduler) cleanupOrphanedActiveNodes(ctx context.Context) {
 		if provision != nil && (provision.Status == "active" || provision.Status == "creating" || provision.Status == "pending" || provision.Status == "running" || provision.Status == "installing") {
 			continue // 有活跃的 provision 对应，正常
 		}
+		if provision != nil && provision.Status == models.StatusStopped {
+			continue // 用户关机或宽限期内暂停保留的节点，后者到期由 SuspensionScheduler 删除
+		}
+		if provision != nil && (provision.Status == models.StatusRebooting || provision.Status == models.StatusStarting || provision.Status == models.StatusStopping || provision.Status == models.StatusReplacing) {
+			continue // 电源操作或替换进行中
+		}
+		if provision == nil && s.warmPool.IsPoolNode(ctx, node.NodeID) {
+			continue // 预热池中尚未领取的节点，由 WarmPoolService 管理
+		}
 
 		// 防止竞态：新节点刚创建但 provision 记录尚未关联 HostingNodeID，
 		// 跳过创建时间不足 failedNodeAge 的节点，给 provisionAsync 留出窗口
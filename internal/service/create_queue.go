@@ -0,0 +1,245 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+)
+
+// CreatePriority orders queued node creations; lower values run first
+type CreatePriority int
+
+const (
+	PriorityPaid     CreatePriority = iota // 付费订阅触发的创建
+	PriorityRecreate                       // 用户重新创建、自动替换
+	PriorityTrial                          // 试用
+	PriorityWarmPool                       // 预热池补充
+)
+
+func (p CreatePriority) String() string {
+	switch p {
+	case PriorityPaid:
+		return "paid"
+	case PriorityRecreate:
+		return "recreate"
+	case PriorityTrial:
+		return "trial"
+	case PriorityWarmPool:
+		return "warm_pool"
+	}
+	return "unknown"
+}
+
+// createTicket is one queued or running node creation
+type createTicket struct {
+	id       string
+	priority CreatePriority
+	provider string
+	region   string
+	seq      uint64
+	ready    chan struct{}
+	started  time.Time
+}
+
+// NodeCreateQueue bounds concurrent node creations against hosting-service
+// 全局、按云厂商、按区域三级并发上限。排队按优先级、同优先级先到先得；
+// 高优先级任务所在区域已满时，其他区域的低优先级任务可以先执行。
+// 队列只在当前进程内生效：配置的上限是所有副本合计，按 HOSTING_CREATE_REPLICAS 平分到每个进程。
+type NodeCreateQueue struct {
+	cfg config.CreateQueueConfig
+
+	mu          sync.Mutex
+	waiting     []*createTicket // 按 (priority, seq) 排序
+	running     int
+	byProvider  map[string]int
+	byRegion    map[string]int
+	seq         uint64
+	avgDuration time.Duration // 最近创建耗时的滑动平均，用于估算排队时间
+}
+
+// NewNodeCreateQueue creates a node creation queue with this process's share of the limits
+func NewNodeCreateQueue(cfg config.CreateQueueConfig) *NodeCreateQueue {
+	cfg = perProcessLimits(cfg)
+	log.Printf("[CreateQueue] Per-process limits: max_concurrent=%d, providers=%v, regions=%v, default_region=%d (replicas=%d)",
+		cfg.MaxConcurrent, cfg.ProviderLimits, cfg.RegionLimits, cfg.DefaultRegionLimit, max(cfg.Replicas, 1))
+	return &NodeCreateQueue{
+		cfg:         cfg,
+		byProvider:  make(map[string]int),
+		byRegion:    make(map[string]int),
+		avgDuration: time.Duration(cfg.EstimateSeconds) * time.Second,
+	}
+}
+
+// perProcessLimits divides the fleet-wide limits by the number of replicas
+// 每个进程至少保留 1 个名额，因此副本数多于上限时合计会略超配置值
+func perProcessLimits(cfg config.CreateQueueConfig) config.CreateQueueConfig {
+	replicas := max(cfg.Replicas, 1)
+	share := func(l int) int {
+		if l <= 0 {
+			return l
+		}
+		return max(l/replicas, 1)
+	}
+	scaled := cfg
+	scaled.MaxConcurrent = share(max(cfg.MaxConcurrent, 1))
+	scaled.DefaultRegionLimit = share(cfg.DefaultRegionLimit)
+	scaled.ProviderLimits = make(map[string]int, len(cfg.ProviderLimits))
+	for k, l := range cfg.ProviderLimits {
+		scaled.ProviderLimits[k] = share(l)
+	}
+	scaled.RegionLimits = make(map[string]int, len(cfg.RegionLimits))
+	for k, l := range cfg.RegionLimits {
+		scaled.RegionLimits[k] = share(l)
+	}
+	return scaled
+}
+
+// Acquire blocks until a creation slot for the provider and region is free
+// 返回的 release 必须在创建结束（无论成功或失败）后调用；
+// 超过 HOSTING_CREATE_SLOT_HOLD_SECONDS 仍未调用时名额自动归还，
+// 已发起创建、只在等待节点就绪的任务不再阻塞后面的创建
+func (q *NodeCreateQueue) Acquire(ctx context.Context, id string, priority CreatePriority, provider, region string) (func(), error) {
+	q.mu.Lock()
+	q.seq++
+	t := &createTicket{
+		id:       id,
+		priority: priority,
+		provider: provider,
+		region:   region,
+		seq:      q.seq,
+		ready:    make(chan struct{}),
+	}
+	q.waiting = append(q.waiting, t)
+	slices.SortFunc(q.waiting, func(a, b *createTicket) int {
+		return cmp.Or(cmp.Compare(a.priority, b.priority), cmp.Compare(a.seq, b.seq))
+	})
+	q.dispatchLocked()
+	position := slices.Index(q.waiting, t) + 1
+	q.mu.Unlock()
+
+	if position > 0 {
+		log.Printf("[CreateQueue] %s queued (priority=%s, placement=%s/%s, position=%d)", id, priority, provider, region, position)
+	}
+
+	select {
+	case <-t.ready:
+	case <-ctx.Done():
+		q.mu.Lock()
+		select {
+		case <-t.ready:
+			// 取消的同时已分配到名额，归还
+			q.mu.Unlock()
+			q.release(t)
+		default:
+			q.waiting = slices.DeleteFunc(q.waiting, func(w *createTicket) bool { return w == t })
+			q.mu.Unlock()
+		}
+		return nil, ctx.Err()
+	}
+
+	var once sync.Once
+	var timer *time.Timer
+	if hold := time.Duration(q.cfg.SlotHoldSeconds) * time.Second; hold > 0 {
+		timer = time.AfterFunc(hold, func() {
+			once.Do(func() {
+				log.Printf("[CreateQueue] %s still running after %v, releasing its slot", id, hold)
+				q.release(t)
+			})
+		})
+	}
+	return func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		once.Do(func() { q.release(t) })
+	}, nil
+}
+
+// Position returns the queue position (1-based) and estimated wait of a queued creation
+// 预计等待按全局、云厂商、区域三级上限中最慢的一级估算：只有同一云厂商 / 区域中
+// 排在前面的任务会占用该级名额。不在队列中（已开始或不存在）时 ok 为 false
+func (q *NodeCreateQueue) Position(id string) (position int, wait time.Duration, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	idx := slices.IndexFunc(q.waiting, func(t *createTicket) bool { return t.id == id })
+	if idx < 0 {
+		return 0, 0, false
+	}
+	t := q.waiting[idx]
+	position = idx + 1
+
+	ahead := q.waiting[:position]
+	sameProvider, sameRegion := 0, 0
+	for _, w := range ahead {
+		if w.provider == t.provider {
+			sameProvider++
+		}
+		if w.region == t.region {
+			sameRegion++
+		}
+	}
+	rounds := ceilDiv(position, max(q.cfg.MaxConcurrent, 1))
+	if l := q.cfg.ProviderLimits[t.provider]; l > 0 {
+		rounds = max(rounds, ceilDiv(sameProvider, l))
+	}
+	if l := q.cfg.RegionLimit(t.region); l > 0 {
+		rounds = max(rounds, ceilDiv(sameRegion, l))
+	}
+	return position, time.Duration(rounds) * q.avgDuration, true
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+func (q *NodeCreateQueue) release(t *createTicket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	q.byProvider[t.provider]--
+	q.byRegion[t.region]--
+
+	// 指数滑动平均，新样本权重 0.2
+	elapsed := time.Since(t.started)
+	q.avgDuration = (q.avgDuration*4 + elapsed) / 5
+
+	q.dispatchLocked()
+}
+
+// dispatchLocked starts every waiting ticket that fits within the limits, in priority order
+func (q *NodeCreateQueue) dispatchLocked() {
+	remaining := q.waiting[:0]
+	for _, t := range q.waiting {
+		if !q.fitsLocked(t) {
+			remaining = append(remaining, t)
+			continue
+		}
+		q.running++
+		q.byProvider[t.provider]++
+		q.byRegion[t.region]++
+		t.started = time.Now()
+		close(t.ready)
+	}
+	clear(q.waiting[len(remaining):])
+	q.waiting = remaining
+}
+
+func (q *NodeCreateQueue) fitsLocked(t *createTicket) bool {
+	if q.running >= max(q.cfg.MaxConcurrent, 1) {
+		return false
+	}
+	if l := q.cfg.ProviderLimits[t.provider]; l > 0 && q.byProvider[t.provider] >= l {
+		return false
+	}
+	if l := q.cfg.RegionLimit(t.region); l > 0 && q.byRegion[t.region] >= l {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/client"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// ResolvedEntitlement is the effective VPN entitlement computed from all active grants
+type ResolvedEntitlement struct {
+	Active       bool
+	TrafficLimit int64 // BaseTrafficLimit + TopUpTraffic, what otun-manager enforces
+	ExpireAt     time.Time
+	ServiceTier  string
+
+	BaseTrafficLimit int64
+	TopUpTraffic     int64
+
+	// Highest-priority grant covering now
+	PrimaryGrantID     string
+	PrimaryProvisionID string
+}
+
+// ResolveGrants computes the effective entitlement at a point in time.
+//
+//   - ExpireAt is the end of the contiguous coverage starting at now, so windows
+//     that overlap or touch extend each other instead of overwriting.
+//   - The base allowance is the largest among grants in that coverage.
+//   - Additive grants (top-ups) covering now are added on top of the base;
+//     they neither extend the expiry nor activate an entitlement on their own.
+//   - ServiceTier comes from the highest-priority grant covering now.
+func ResolveGrants(grants []*models.EntitlementGrant, now time.Time) *ResolvedEntitlement {
+	res := &ResolvedEntitlement{ServiceTier: models.ServiceTierStandard}
+
+	sorted := make([]*models.EntitlementGrant, 0, len(grants))
+	for _, g := range grants {
+		if g.Status == models.GrantStatusActive && g.EndsAt.After(now) {
+			sorted = append(sorted, g)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartsAt.Before(sorted[j].StartsAt) })
+
+	var primary *models.EntitlementGrant
+	for _, g := range sorted {
+		if g.Additive || g.StartsAt.After(now) {
+			continue
+		}
+		if primary == nil || g.Priority > primary.Priority ||
+			(g.Priority == primary.Priority && g.EndsAt.After(primary.EndsAt)) {
+			primary = g
+		}
+	}
+	if primary == nil {
+		return res
+	}
+
+	coverageEnd := now
+	for _, g := range sorted {
+		if g.Additive {
+			if !g.StartsAt.After(now) {
+				res.TopUpTraffic += g.TrafficBytes
+			}
+			continue
+		}
+		if g.StartsAt.After(coverageEnd) {
+			break
+		}
+		if g.EndsAt.After(coverageEnd) {
+			coverageEnd = g.EndsAt
+		}
+		if g.TrafficBytes > res.BaseTrafficLimit {
+			res.BaseTrafficLimit = g.TrafficBytes
+		}
+	}
+
+	res.Active = true
+	res.TrafficLimit = res.BaseTrafficLimit + res.TopUpTraffic
+	res.ExpireAt = coverageEnd
+	res.ServiceTier = primary.ServiceTier
+	res.PrimaryGrantID = primary.ID
+	res.PrimaryProvisionID = primary.VPNProvisionID
+	return res
+}
+
+// EntitlementLedger records grants and pushes the resolved result to otun-manager.
+// All VPN limit changes go through here instead of calling OTunClient.UpdateUser directly.
+type EntitlementLedger struct {
+	grantRepo  *repository.EntitlementGrantRepository
+	vpnRepo    *repository.VPNProvisionRepository
+	otunClient *client.OTunClient
+}
+
+// NewEntitlementLedger creates a new entitlement ledger
+func NewEntitlementLedger(
+	grantRepo *repository.EntitlementGrantRepository,
+	vpnRepo *repository.VPNProvisionRepository,
+	otunClient *client.OTunClient,
+) *EntitlementLedger {
+	return &EntitlementLedger{
+		grantRepo:  grantRepo,
+		vpnRepo:    vpnRepo,
+		otunClient: otunClient,
+	}
+}
+
+// Record appends a grant to the ledger. Priority defaults by source.
+func (l *EntitlementLedger) Record(ctx context.Context, g *models.EntitlementGrant) error {
+	l.prepare(g)
+	return l.grantRepo.Create(ctx, g)
+}
+
+// Replace records g and supersedes the grants of the provision it replaces, atomically
+// (renewal / trial conversion)
+func (l *EntitlementLedger) Replace(ctx context.Context, supersededProvisionID string, g *models.EntitlementGrant) error {
+	l.prepare(g)
+	return l.grantRepo.ReplaceByProvision(ctx, supersededProvisionID, g)
+}
+
+// prepare fills the defaults of a grant about to be recorded
+func (l *EntitlementLedger) prepare(g *models.EntitlementGrant) {
+	if g.ID == "" {
+		g.ID = uuid.New().String()
+	}
+	if g.Priority == 0 {
+		g.Priority = models.GrantPriorityForSource(g.Source)
+	}
+	if g.ServiceTier == "" {
+		g.ServiceTier = models.ServiceTierStandard
+	}
+	if g.StartsAt.IsZero() {
+		g.StartsAt = time.Now()
+	}
+	g.Status = models.GrantStatusActive
+}
+
+// PurchaseGrant returns the active base grant recorded for a provision's purchase
+func (l *EntitlementLedger) PurchaseGrant(ctx context.Context, provisionID string) (*models.EntitlementGrant, error) {
+	return l.grantRepo.GetActiveBaseByProvision(ctx, provisionID)
+}
+
+// Supersede closes the grants of a provision that has been replaced (renewal / trial conversion)
+func (l *EntitlementLedger) Supersede(ctx context.Context, provisionID string) error {
+	return l.grantRepo.CloseByProvision(ctx, provisionID, models.GrantStatusSuperseded)
+}
+
+// Revoke closes the grants of a provision that has been taken back.
+// Top-ups bought on top of it end with it: their additive grants are superseded.
+func (l *EntitlementLedger) Revoke(ctx context.Context, provisionID string) error {
+	if err := l.grantRepo.CloseByProvision(ctx, provisionID, models.GrantStatusRevoked); err != nil {
+		return err
+	}
+	return l.grantRepo.CloseTopUpsByProvision(ctx, provisionID)
+}
+
+// MoveTopUps hands a provision's top-ups to the provision that replaced it
+func (l *EntitlementLedger) MoveTopUps(ctx context.Context, fromProvisionID, toProvisionID string) error {
+	return l.grantRepo.MoveTopUps(ctx, fromProvisionID, toProvisionID)
+}
+
+// RevokeGrant closes a single grant (e.g. a top-up whose push failed)
+func (l *EntitlementLedger) RevokeGrant(ctx context.Context, grantID string) error {
+	return l.grantRepo.CloseByID(ctx, grantID, models.GrantStatusRevoked)
+}
+
+// SupersedeGrant closes a single grant that has been replaced or used up
+func (l *EntitlementLedger) SupersedeGrant(ctx context.Context, grantID string) error {
+	return l.grantRepo.CloseByID(ctx, grantID, models.GrantStatusSuperseded)
+}
+
+// Shift pushes the user's running grants forward by d, starting from `from` (VPN pause)
+func (l *EntitlementLedger) Shift(ctx context.Context, userID string, from time.Time, d time.Duration) error {
+	return l.grantRepo.ShiftActiveByUser(ctx, userID, from, d)
+}
+
+// Resolve computes the user's effective entitlement from the ledger
+func (l *EntitlementLedger) Resolve(ctx context.Context, userID string) (*ResolvedEntitlement, error) {
+	grants, err := l.grantRepo.ListActiveByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveGrants(grants, time.Now()), nil
+}
+
+// ListGrants returns the user's full ledger (admin view)
+func (l *EntitlementLedger) ListGrants(ctx context.Context, userID string) ([]*models.EntitlementGrant, error) {
+	return l.grantRepo.ListByUser(ctx, userID)
+}
+
+// Push resolves the ledger and applies the result to the otun user:
+// update limits when anything is still covered, disable otherwise.
+// A paused plan keeps the otun user disabled; only the limits are updated.
+// The resolved values are then projected onto the current vpn_provisions rows.
+func (l *EntitlementLedger) Push(ctx context.Context, userID, otunUUID string) (*ResolvedEntitlement, error) {
+	resolved, err := l.Resolve(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resolved.Active {
+		if err := l.otunClient.DisableUser(ctx, otunUUID); err != nil {
+			return nil, fmt.Errorf("failed to disable VPN user: %w", err)
+		}
+		log.Printf("[EntitlementLedger] No active grants for user=%s, otun user disabled", userID)
+		return resolved, nil
+	}
+
+	enabled := true
+	if current, err := l.vpnRepo.GetCurrentByUserAnyStatus(ctx, userID); err == nil &&
+		current.Status == models.VPNProvisionStatusPaused {
+		enabled = false
+	}
+	updateReq := &client.UpdateVPNUserRequest{
+		TrafficLimit: resolved.TrafficLimit,
+		ExpireAt:     resolved.ExpireAt.Format(time.RFC3339),
+		Enabled:      &enabled,
+	}
+	if err := l.otunClient.UpdateUser(ctx, otunUUID, updateReq); err != nil {
+		return nil, fmt.Errorf("failed to update VPN user: %w", err)
+	}
+
+	l.Project(ctx, userID, resolved)
+
+	log.Printf("[EntitlementLedger] Resolved user=%s: traffic=%d, expire=%s, tier=%s",
+		userID, resolved.TrafficLimit, resolved.ExpireAt.Format(time.RFC3339), resolved.ServiceTier)
+	return resolved, nil
+}
+
+// Project writes the resolved values onto the current vpn_provisions rows (best effort)
+func (l *EntitlementLedger) Project(ctx context.Context, userID string, resolved *ResolvedEntitlement) {
+	if !resolved.Active {
+		return
+	}
+	if err := l.vpnRepo.UpdateProjectionByUser(ctx, userID, resolved.TrafficLimit, resolved.ExpireAt); err != nil {
+		log.Printf("[EntitlementLedger] Failed to project resolved entitlement for user=%s: %v", userID, err)
+	}
+}
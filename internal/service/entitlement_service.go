@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,24 +18,51 @@ import (
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
 )
 
-// EntitlementService handles gift and other entitlement operations
+// Trial activation errors
+var (
+	ErrTrialDisabled    = errors.New("trial is not available")
+	ErrTrialNotEligible = errors.New("trial is only available to users without an active VPN plan")
+)
+
+// ErrEntitlementAlreadyRevoked is returned when revoking a record twice
+var ErrEntitlementAlreadyRevoked = errors.New("entitlement already revoked")
+
+// ErrInvalidVoucherBatch is returned when a voucher batch request fails validation
+var ErrInvalidVoucherBatch = errors.New("invalid voucher batch")
+
+// EntitlementService handles trial, gift and other entitlement operations
 // Uses VPNProvisionRepository (vpn_provisions table) for all storage
 type EntitlementService struct {
-	cfg        *config.Config
-	vpnRepo    *repository.VPNProvisionRepository
-	otunClient *client.OTunClient
+	cfg         *config.Config
+	vpnRepo     *repository.VPNProvisionRepository
+	logRepo     *repository.LogRepository
+	voucherRepo *repository.VoucherRepository
+	ledger      *EntitlementLedger
+	otunClient  *client.OTunClient
+	subClient   *client.SubscriptionClient
+	eligibility *TrialEligibilityEngine
 }
 
 // NewEntitlementService creates a new entitlement service
 func NewEntitlementService(
 	cfg *config.Config,
 	vpnRepo *repository.VPNProvisionRepository,
+	logRepo *repository.LogRepository,
+	voucherRepo *repository.VoucherRepository,
+	ledger *EntitlementLedger,
 	otunClient *client.OTunClient,
+	subClient *client.SubscriptionClient,
+	eligibility *TrialEligibilityEngine,
 ) *EntitlementService {
 	return &EntitlementService{
-		cfg:        cfg,
-		vpnRepo:    vpnRepo,
-		otunClient: otunClient,
+		cfg:         cfg,
+		vpnRepo:     vpnRepo,
+		logRepo:     logRepo,
+		voucherRepo: voucherRepo,
+		ledger:      ledger,
+		otunClient:  otunClient,
+		subClient:   subClient,
+		eligibility: eligibility,
 	}
 }
 
@@ -43,61 +75,222 @@ func (s *EntitlementService) GetTrialConfig() *models.TrialConfigResponse {
 	}
 }
 
-// GiftEntitlement creates a gift entitlement for a user (admin/internal)
-func (s *EntitlementService) GiftEntitlement(ctx context.Context, req *models.GiftEntitlementRequest) (*models.GiftEntitlementResponse, error) {
+// ActivateTrial starts a VPN trial for a user on the given device.
+// The vpn_provisions row is inserted first so the partial unique indexes
+// (user_id / device_id / email) reserve the trial before otun-manager is touched.
+func (s *EntitlementService) ActivateTrial(ctx context.Context, userID, email, ipAddress string, req *models.TrialActivationRequest) (*models.TrialActivationResponse, error) {
+	if !s.cfg.Trial.Enabled {
+		return nil, ErrTrialDisabled
+	}
+
+	// 1. Existing VPN plan: trial is only for new users
+	current, _ := s.vpnRepo.GetCurrentByUserAnyStatus(ctx, userID)
+	if current != nil {
+		if current.Status == models.VPNProvisionStatusActive && !repository.IsVPNExpired(current) {
+			return nil, ErrTrialNotEligible
+		}
+	}
+
+	// 2. Eligibility scoring (normalized email, disposable domains, velocity)
+	attempt, err := s.eligibility.Evaluate(ctx, &TrialEligibilityInput{
+		UserID:    userID,
+		Email:     email,
+		DeviceID:  req.DeviceID,
+		IPAddress: ipAddress,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("evaluate trial eligibility: %w", err)
+	}
+	if attempt.Decision != models.TrialDecisionAllow {
+		return nil, &TrialEligibilityError{
+			AttemptID: attempt.ID,
+			Decision:  attempt.Decision,
+			Reasons:   attempt.Reasons,
+		}
+	}
+
 	const GB = int64(1024 * 1024 * 1024)
-	trafficLimit := int64(req.TrafficGB) * GB
-	expireAt := time.Now().AddDate(0, 0, req.DurationDays)
-	serviceTier := req.ServiceTier
-	if serviceTier == "" {
-		serviceTier = models.ServiceTierStandard
+	trafficLimit := int64(s.cfg.Trial.TrafficGB) * GB
+	expireAt := time.Now().Add(time.Duration(s.cfg.Trial.DurationHours) * time.Hour)
+
+	// 3. Reserve the trial (unique index violations → trial already used)
+	provisionID := uuid.New().String()
+	vp := &models.VPNProvision{
+		ID:           provisionID,
+		UserID:       userID,
+		Channel:      "trial",
+		BusinessType: models.BusinessTypeTrial,
+		ServiceTier:  models.ServiceTierStandard,
+		PlanTier:     "trial",
+		Status:       models.VPNProvisionStatusActive,
+		TrafficLimit: trafficLimit,
+		TrafficUsed:  0,
+		ExpireAt:     &expireAt,
+		Email:        email,
+		DeviceID:     req.DeviceID,
+		GrantedBy:    "system",
+		IsCurrent:    true,
+	}
+	if err := s.vpnRepo.Create(ctx, vp); err != nil {
+		s.eligibility.RecordNotGranted(ctx, attempt, "reservation_failed")
+		return nil, err
+	}
+
+	// 4. Record the trial grant, create or reuse the otun-manager user
+	otunUUID, resolved, err := s.applyGrant(ctx, userID, email, &models.EntitlementGrant{
+		UserID:         userID,
+		VPNProvisionID: provisionID,
+		Source:         models.GrantSourceTrial,
+		SourceRef:      req.DeviceID,
+		TrafficBytes:   trafficLimit,
+		EndsAt:         expireAt,
+		ServiceTier:    models.ServiceTierStandard,
+	})
+	if err != nil {
+		// Release the reservation so the user can retry
+		if delErr := s.vpnRepo.Delete(ctx, provisionID); delErr != nil {
+			log.Printf("[EntitlementService] Failed to release trial reservation %s: %v", provisionID, delErr)
+		}
+		s.eligibility.RecordNotGranted(ctx, attempt, "provision_failed")
+		return nil, err
+	}
+	// 试用已发放，记录 allow（此后同一归一化邮箱的其他账号会被拒绝）
+	s.eligibility.Record(ctx, attempt)
+
+	vp.OtunUUID = &otunUUID
+	vp.TrafficLimit = resolved.TrafficLimit
+	vp.ExpireAt = &resolved.ExpireAt
+	if err := s.vpnRepo.Update(ctx, vp); err != nil {
+		return nil, fmt.Errorf("failed to save vpn provision: %w", err)
+	}
+
+	// Previous (expired/disabled) record is kept as history
+	if current != nil {
+		s.vpnRepo.UnsetCurrent(ctx, current.ID)
 	}
 
-	// 1. Check if user already has an otun_uuid
-	existingOtunUUID, _ := s.vpnRepo.GetOtunUUIDByUser(ctx, req.UserID)
+	s.logRepo.LogActionWithMetadata(ctx, provisionID, "vpn", "trial_activated", models.VPNProvisionStatusActive,
+		"VPN trial activated",
+		map[string]interface{}{
+			"vpn_user_id":   otunUUID,
+			"device_id":     req.DeviceID,
+			"attempt_id":    attempt.ID,
+			"traffic_limit": trafficLimit,
+			"expire_at":     expireAt.Format(time.RFC3339),
+		})
+
+	log.Printf("[EntitlementService] Trial activated: user=%s, otun_uuid=%s, hours=%d, traffic_gb=%d",
+		userID, otunUUID, s.cfg.Trial.DurationHours, s.cfg.Trial.TrafficGB)
+
+	return &models.TrialActivationResponse{
+		EntitlementID: provisionID,
+		OtunUUID:      otunUUID,
+		TrafficLimit:  resolved.TrafficLimit,
+		ExpireAt:      resolved.ExpireAt.Format(time.RFC3339),
+		Protocols:     s.syncProtocols(ctx, otunUUID),
+	}, nil
+}
+
+// applyGrant records a grant in the ledger and pushes the resolved entitlement
+// to the user's otun-manager account, creating the account if there is none yet.
+// On failure the grant is revoked again. Returns the otun UUID.
+func (s *EntitlementService) applyGrant(ctx context.Context, userID, email string, g *models.EntitlementGrant) (string, *ResolvedEntitlement, error) {
+	if err := s.ledger.Record(ctx, g); err != nil {
+		return "", nil, fmt.Errorf("record entitlement grant: %w", err)
+	}
+
+	otunUUID, resolved, err := s.pushToOtunUser(ctx, userID, email, g.ServiceTier)
+	if err != nil {
+		if revErr := s.ledger.Revoke(ctx, g.VPNProvisionID); revErr != nil {
+			log.Printf("[EntitlementService] Failed to revoke grant %s after otun error: %v", g.ID, revErr)
+		}
+		return "", nil, err
+	}
+	return otunUUID, resolved, nil
+}
 
-	var otunUUID string
-	var syncResp *client.SubscribeResponse
+// pushToOtunUser applies the resolved ledger to the existing otun user, or creates one
+func (s *EntitlementService) pushToOtunUser(ctx context.Context, userID, email, serviceTier string) (string, *ResolvedEntitlement, error) {
+	existingOtunUUID, _ := s.vpnRepo.GetOtunUUIDByUser(ctx, userID)
 
 	if existingOtunUUID != nil && *existingOtunUUID != "" {
-		otunUUID = *existingOtunUUID
-		enabled := true
-		updateReq := &client.UpdateVPNUserRequest{
-			TrafficLimit: trafficLimit,
-			ExpireAt:     expireAt.Format(time.RFC3339),
-			Enabled:      &enabled,
-		}
-		if err := s.otunClient.UpdateUser(ctx, otunUUID, updateReq); err != nil {
-			return nil, fmt.Errorf("failed to update VPN user: %w", err)
-		}
-
-		syncResp, _ = s.otunClient.SyncUser(ctx, otunUUID)
-	} else {
-		vpnUserID := uuid.New().String()
-		ssPassword := generateRandomPassword(16)
-
-		createReq := &client.CreateVPNUserRequest{
-			UUID:         vpnUserID,
-			Email:        req.Email,
-			AuthUserID:   req.UserID,
-			Protocols:    []string{"vless", "shadowsocks"},
-			SSPassword:   ssPassword,
-			TrafficLimit: trafficLimit,
-			ExpireAt:     expireAt.Format(time.RFC3339),
-			ServiceTier:  serviceTier,
-		}
-
-		createResp, err := s.otunClient.CreateUser(ctx, createReq)
+		resolved, err := s.ledger.Push(ctx, userID, *existingOtunUUID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create VPN user: %w", err)
+			return "", nil, err
 		}
-		otunUUID = createResp.UUID
+		return *existingOtunUUID, resolved, nil
+	}
+
+	resolved, err := s.ledger.Resolve(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	createReq := &client.CreateVPNUserRequest{
+		UUID:         uuid.New().String(),
+		Email:        email,
+		AuthUserID:   userID,
+		Protocols:    []string{"vless", "shadowsocks"},
+		SSPassword:   generateRandomPassword(16),
+		TrafficLimit: resolved.TrafficLimit,
+		ExpireAt:     resolved.ExpireAt.Format(time.RFC3339),
+		ServiceTier:  serviceTier,
+	}
 
-		syncResp, _ = s.otunClient.SyncUser(ctx, otunUUID)
+	createResp, err := s.otunClient.CreateUser(ctx, createReq)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create VPN user: %w", err)
+	}
+	if createResp.UUID == "" {
+		return createReq.UUID, resolved, nil
 	}
+	return createResp.UUID, resolved, nil
+}
 
-	// 2. Insert VPN provision record (business_type=gift)
+// syncProtocols fetches protocol URLs for an otun user (best effort)
+func (s *EntitlementService) syncProtocols(ctx context.Context, otunUUID string) []models.VPNProtocol {
+	syncResp, err := s.otunClient.SyncUser(ctx, otunUUID)
+	if err != nil || syncResp == nil {
+		return nil
+	}
+
+	var protocols []models.VPNProtocol
+	for _, p := range syncResp.Protocols {
+		protocols = append(protocols, models.VPNProtocol{
+			Protocol: p.Protocol,
+			URL:      p.URL,
+			Node:     p.Node,
+		})
+	}
+	return protocols
+}
+
+// GiftEntitlement creates a gift entitlement for a user (admin/internal)
+func (s *EntitlementService) GiftEntitlement(ctx context.Context, req *models.GiftEntitlementRequest) (*models.GiftEntitlementResponse, error) {
+	const GB = int64(1024 * 1024 * 1024)
+	trafficLimit := int64(req.TrafficGB) * GB
+	expireAt := time.Now().AddDate(0, 0, req.DurationDays)
+	serviceTier := req.ServiceTier
+	if serviceTier == "" {
+		serviceTier = models.ServiceTierStandard
+	}
+
+	// 1. Record the gift grant, create or update the otun-manager user
 	provisionID := uuid.New().String()
+	otunUUID, resolved, err := s.applyGrant(ctx, req.UserID, req.Email, &models.EntitlementGrant{
+		UserID:         req.UserID,
+		VPNProvisionID: provisionID,
+		Source:         models.GrantSourceGift,
+		SourceRef:      "admin",
+		TrafficBytes:   trafficLimit,
+		EndsAt:         expireAt,
+		ServiceTier:    serviceTier,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Insert VPN provision record (business_type=gift), projected from the ledger
 	vp := &models.VPNProvision{
 		ID:           provisionID,
 		UserID:       req.UserID,
@@ -105,9 +298,9 @@ func (s *EntitlementService) GiftEntitlement(ctx context.Context, req *models.Gi
 		ServiceTier:  serviceTier,
 		OtunUUID:     &otunUUID,
 		Status:       models.VPNProvisionStatusActive,
-		TrafficLimit: trafficLimit,
+		TrafficLimit: resolved.TrafficLimit,
 		TrafficUsed:  0,
-		ExpireAt:     &expireAt,
+		ExpireAt:     &resolved.ExpireAt,
 		Email:        req.Email,
 		GrantedBy:    "admin",
 		Note:         req.Note,
@@ -115,19 +308,13 @@ func (s *EntitlementService) GiftEntitlement(ctx context.Context, req *models.Gi
 	}
 
 	if err := s.vpnRepo.Create(ctx, vp); err != nil {
-		return nil, fmt.Errorf("failed to save vpn provision: %w", err)
-	}
-
-	// 3. Build response
-	var protocols []models.VPNProtocol
-	if syncResp != nil {
-		for _, p := range syncResp.Protocols {
-			protocols = append(protocols, models.VPNProtocol{
-				Protocol: p.Protocol,
-				URL:      p.URL,
-				Node:     p.Node,
-			})
+		// 撤销本次赠送并重新下发，避免 otun 上留下没有记录的权益
+		if revErr := s.ledger.Revoke(ctx, provisionID); revErr != nil {
+			log.Printf("[EntitlementService] Failed to revoke gift grant of %s: %v", provisionID, revErr)
+		} else if _, pushErr := s.ledger.Push(ctx, req.UserID, otunUUID); pushErr != nil {
+			log.Printf("[EntitlementService] Failed to push ledger after gift rollback for user=%s: %v", req.UserID, pushErr)
 		}
+		return nil, fmt.Errorf("failed to save vpn provision: %w", err)
 	}
 
 	log.Printf("[EntitlementService] Gift entitlement created: user=%s, otun_uuid=%s, traffic_gb=%d, days=%d",
@@ -136,12 +323,315 @@ func (s *EntitlementService) GiftEntitlement(ctx context.Context, req *models.Gi
 	return &models.GiftEntitlementResponse{
 		EntitlementID: provisionID,
 		OtunUUID:      otunUUID,
-		TrafficLimit:  trafficLimit,
-		ExpireAt:      expireAt.Format(time.RFC3339),
-		Protocols:     protocols,
+		TrafficLimit:  resolved.TrafficLimit,
+		ExpireAt:      resolved.ExpireAt.Format(time.RFC3339),
+		Protocols:     s.syncProtocols(ctx, otunUUID),
 	}, nil
 }
 
+// RevokeEntitlement revokes a VPN provision (admin/internal).
+// The record's ledger grants are revoked and the remaining grants are re-resolved,
+// so otun-manager shrinks back to whatever still applies, or is disabled.
+func (s *EntitlementService) RevokeEntitlement(ctx context.Context, id string, req *models.RevokeEntitlementRequest) (*models.RevokeEntitlementResponse, error) {
+	vp, err := s.vpnRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if vp.Status == models.VPNProvisionStatusRevoked {
+		return nil, ErrEntitlementAlreadyRevoked
+	}
+
+	refundType := req.RefundType
+	if refundType == "" {
+		refundType = "none"
+	}
+	revokedBy := req.RevokedBy
+	if revokedBy == "" {
+		revokedBy = "admin"
+	}
+
+	resp := &models.RevokeEntitlementResponse{
+		EntitlementID: vp.ID,
+		Status:        models.VPNProvisionStatusRevoked,
+		OtunAction:    "unchanged",
+	}
+
+	// 1. Close the record's grants and push what is left to otun-manager.
+	// The record is only marked revoked afterwards, so a failed push can be retried.
+	if err := s.ledger.Revoke(ctx, vp.ID); err != nil {
+		return nil, err
+	}
+	var resolved *ResolvedEntitlement
+	if vp.OtunUUID != nil && *vp.OtunUUID != "" {
+		resolved, err = s.ledger.Push(ctx, vp.UserID, *vp.OtunUUID)
+		if err != nil {
+			return nil, err
+		}
+		if resolved.Active {
+			resp.OtunAction = "restored"
+			resp.FallbackEntitlementID = resolved.PrimaryProvisionID
+			resp.TrafficLimit = resolved.TrafficLimit
+			resp.ExpireAt = resolved.ExpireAt.Format(time.RFC3339)
+		} else {
+			resp.OtunAction = "disabled"
+		}
+	}
+
+	// 2. Mark revoked and hand the current marker to the record now backing the user
+	if err := s.vpnRepo.MarkRevoked(ctx, vp.ID); err != nil {
+		return nil, err
+	}
+	if vp.IsCurrent && resp.FallbackEntitlementID != "" && resp.FallbackEntitlementID != vp.ID {
+		if err := s.vpnRepo.SetCurrent(ctx, resp.FallbackEntitlementID); err != nil {
+			log.Printf("[EntitlementService] Failed to set fallback %s as current: %v", resp.FallbackEntitlementID, err)
+		}
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, vp.ID, "vpn", "entitlement_revoked", models.VPNProvisionStatusRevoked,
+		req.Reason,
+		map[string]interface{}{
+			"revoked_by":      revokedBy,
+			"refund_type":     refundType,
+			"business_type":   vp.BusinessType,
+			"granted_by":      vp.GrantedBy,
+			"otun_action":     resp.OtunAction,
+			"fallback_id":     resp.FallbackEntitlementID,
+			"previous_status": vp.Status,
+		})
+
+	// 3. Subscription-backed entitlements: let subscription-service know, reporting
+	//    whether the user is still covered by another entitlement
+	if vp.SubscriptionID != "" {
+		userActive := resolved != nil && resolved.Active
+		if err := s.subClient.NotifyVPNRevoked(ctx, vp.SubscriptionID, vp.ID, req.Reason, refundType,
+			resp.FallbackEntitlementID, userActive); err != nil {
+			log.Printf("[EntitlementService] Failed to notify subscription-service (revoked): %v", err)
+		}
+	}
+
+	log.Printf("[EntitlementService] Entitlement revoked: id=%s, user=%s, type=%s, otun=%s, by=%s",
+		vp.ID, vp.UserID, vp.BusinessType, resp.OtunAction, revokedBy)
+
+	return resp, nil
+}
+
+// CreateVoucherBatch generates a batch of redeemable codes (admin/internal)
+func (s *EntitlementService) CreateVoucherBatch(ctx context.Context, req *models.CreateVoucherBatchRequest) (*models.VoucherBatchResponse, error) {
+	serviceTier := req.ServiceTier
+	if serviceTier == "" {
+		serviceTier = models.ServiceTierStandard
+	}
+	maxRedemptions := req.MaxRedemptions
+	if maxRedemptions <= 0 {
+		maxRedemptions = 1
+	}
+	validFrom := time.Now()
+	if req.ValidFrom != nil {
+		validFrom = *req.ValidFrom
+	}
+	validUntil := validFrom.AddDate(0, 0, 90)
+	if req.ValidUntil != nil {
+		validUntil = *req.ValidUntil
+	}
+	if !validUntil.After(validFrom) {
+		return nil, fmt.Errorf("%w: valid_until must be after valid_from", ErrInvalidVoucherBatch)
+	}
+	if !slices.Contains(voucherServiceTiers, serviceTier) {
+		return nil, fmt.Errorf("%w: unknown service_tier %q", ErrInvalidVoucherBatch, serviceTier)
+	}
+	createdBy := req.CreatedBy
+	if createdBy == "" {
+		createdBy = "admin"
+	}
+
+	batchID := uuid.New().String()
+	vouchers := make([]*models.Voucher, 0, req.Count)
+	seen := make(map[string]bool, req.Count)
+	for len(vouchers) < req.Count {
+		code, err := generateVoucherCode()
+		if err != nil {
+			return nil, fmt.Errorf("generate voucher code: %w", err)
+		}
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		vouchers = append(vouchers, &models.Voucher{
+			ID:             uuid.New().String(),
+			Code:           code,
+			BatchID:        batchID,
+			Campaign:       req.Campaign,
+			TrafficGB:      req.TrafficGB,
+			DurationDays:   req.DurationDays,
+			ServiceTier:    serviceTier,
+			MaxRedemptions: maxRedemptions,
+			ValidFrom:      validFrom,
+			ValidUntil:     validUntil,
+			CreatedBy:      createdBy,
+		})
+	}
+
+	if err := s.voucherRepo.CreateBatch(ctx, vouchers); err != nil {
+		return nil, fmt.Errorf("create voucher batch: %w", err)
+	}
+
+	log.Printf("[EntitlementService] Voucher batch created: batch=%s, campaign=%s, count=%d, by=%s",
+		batchID, req.Campaign, len(vouchers), createdBy)
+
+	resp := &models.VoucherBatchResponse{
+		BatchID:  batchID,
+		Campaign: req.Campaign,
+		Count:    len(vouchers),
+	}
+	for _, v := range vouchers {
+		resp.Vouchers = append(resp.Vouchers, toVoucherInfo(v))
+	}
+	return resp, nil
+}
+
+// ListVoucherBatch returns all codes in a batch (admin/internal, used for CSV export)
+func (s *EntitlementService) ListVoucherBatch(ctx context.Context, batchID string) ([]*models.VoucherInfo, error) {
+	vouchers, err := s.voucherRepo.ListByBatch(ctx, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("list voucher batch: %w", err)
+	}
+
+	var results []*models.VoucherInfo
+	for _, v := range vouchers {
+		results = append(results, toVoucherInfo(v))
+	}
+	return results, nil
+}
+
+// RedeemVoucher validates and consumes a code, then grants its traffic/duration
+// through the same otun create-or-update path as GiftEntitlement.
+func (s *EntitlementService) RedeemVoucher(ctx context.Context, userID, email string, req *models.RedeemVoucherRequest) (*models.RedeemVoucherResponse, error) {
+	code := strings.ToUpper(strings.TrimSpace(req.Code))
+	if code == "" {
+		return nil, repository.ErrVoucherInvalid
+	}
+
+	// 1. Atomically take a redemption slot
+	voucher, redemptionID, err := s.voucherRepo.Consume(ctx, code, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	const GB = int64(1024 * 1024 * 1024)
+	trafficLimit := int64(voucher.TrafficGB) * GB
+	expireAt := time.Now().AddDate(0, 0, voucher.DurationDays)
+
+	// 2. Record the voucher grant, create or update the otun-manager user
+	provisionID := uuid.New().String()
+	otunUUID, resolved, err := s.applyGrant(ctx, userID, email, &models.EntitlementGrant{
+		UserID:         userID,
+		VPNProvisionID: provisionID,
+		Source:         models.GrantSourceVoucher,
+		SourceRef:      voucher.ID,
+		TrafficBytes:   trafficLimit,
+		EndsAt:         expireAt,
+		ServiceTier:    voucher.ServiceTier,
+	})
+	if err != nil {
+		if relErr := s.voucherRepo.Release(ctx, voucher.ID, redemptionID); relErr != nil {
+			log.Printf("[EntitlementService] Failed to release voucher %s after otun error: %v", voucher.ID, relErr)
+		}
+		return nil, err
+	}
+
+	// 3. Insert VPN provision record (business_type=gift, granted_by=voucher:<id>) and link the redemption;
+	//    it only becomes the current record when the user has none (e.g. no purchased plan)
+	vp := &models.VPNProvision{
+		ID:           provisionID,
+		UserID:       userID,
+		Channel:      "voucher",
+		BusinessType: models.BusinessTypeGift,
+		ServiceTier:  voucher.ServiceTier,
+		OtunUUID:     &otunUUID,
+		Status:       models.VPNProvisionStatusActive,
+		TrafficLimit: resolved.TrafficLimit,
+		TrafficUsed:  0,
+		ExpireAt:     &resolved.ExpireAt,
+		Email:        email,
+		GrantedBy:    "voucher:" + voucher.ID,
+		Note:         voucher.Campaign,
+	}
+	if err := s.vpnRepo.CreateRedeemed(ctx, vp, redemptionID); err != nil {
+		// 撤销本次授权并重新下发，释放兑换名额，用户可重试
+		if revErr := s.ledger.Revoke(ctx, provisionID); revErr != nil {
+			log.Printf("[EntitlementService] Failed to revoke voucher grant of %s: %v", provisionID, revErr)
+		} else if _, pushErr := s.ledger.Push(ctx, userID, otunUUID); pushErr != nil {
+			log.Printf("[EntitlementService] Failed to push ledger after voucher rollback for user=%s: %v", userID, pushErr)
+		}
+		if relErr := s.voucherRepo.Release(ctx, voucher.ID, redemptionID); relErr != nil {
+			log.Printf("[EntitlementService] Failed to release voucher %s after save error: %v", voucher.ID, relErr)
+		}
+		return nil, fmt.Errorf("failed to save vpn provision: %w", err)
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, provisionID, "vpn", "voucher_redeemed", models.VPNProvisionStatusActive,
+		"Voucher redeemed",
+		map[string]interface{}{
+			"voucher_id":    voucher.ID,
+			"campaign":      voucher.Campaign,
+			"vpn_user_id":   otunUUID,
+			"traffic_limit": trafficLimit,
+			"expire_at":     expireAt.Format(time.RFC3339),
+		})
+
+	log.Printf("[EntitlementService] Voucher redeemed: user=%s, voucher=%s, campaign=%s",
+		userID, voucher.ID, voucher.Campaign)
+
+	return &models.RedeemVoucherResponse{
+		EntitlementID: provisionID,
+		OtunUUID:      otunUUID,
+		TrafficLimit:  resolved.TrafficLimit,
+		ExpireAt:      resolved.ExpireAt.Format(time.RFC3339),
+		Protocols:     s.syncProtocols(ctx, otunUUID),
+	}, nil
+}
+
+func toVoucherInfo(v *models.Voucher) *models.VoucherInfo {
+	return &models.VoucherInfo{
+		ID:             v.ID,
+		Code:           v.Code,
+		BatchID:        v.BatchID,
+		Campaign:       v.Campaign,
+		TrafficGB:      v.TrafficGB,
+		DurationDays:   v.DurationDays,
+		ServiceTier:    v.ServiceTier,
+		MaxRedemptions: v.MaxRedemptions,
+		RedeemedCount:  v.RedeemedCount,
+		ValidFrom:      v.ValidFrom.Format(time.RFC3339),
+		ValidUntil:     v.ValidUntil.Format(time.RFC3339),
+	}
+}
+
+// voucherAlphabet excludes easily confused characters (0/O, 1/I/L)
+const voucherAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// voucherServiceTiers are the service tiers a voucher batch may grant
+var voucherServiceTiers = []string{models.ServiceTierStandard, models.ServiceTierPremium, models.ServiceTierResidential}
+
+// generateVoucherCode returns a random code formatted as XXXX-XXXX-XXXX
+func generateVoucherCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(voucherAlphabet)))
+
+	var sb strings.Builder
+	for i := 0; i < 12; i++ {
+		if i > 0 && i%4 == 0 {
+			sb.WriteByte('-')
+		}
+		// rand.Int 均匀取值，避免 byte 取模偏向字母表前部
+		n, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(voucherAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
 // ListEntitlements lists vpn provisions with optional filters (admin/internal)
 func (s *EntitlementService) ListEntitlements(ctx context.Context, userID, businessType, status string) ([]*models.EntitlementInfo, error) {
 	provisions, err := s.vpnRepo.ListByFilters(ctx, userID, businessType, status)
@@ -177,3 +667,99 @@ func (s *EntitlementService) ListEntitlements(ctx context.Context, userID, busin
 	return results, nil
 }
 
+// GetLedger returns a user's grants and the resolved entitlement (admin/internal)
+func (s *EntitlementService) GetLedger(ctx context.Context, userID string) (*models.EntitlementLedgerResponse, error) {
+	grants, err := s.ledger.ListGrants(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	resolved := ResolveGrants(grants, time.Now())
+
+	resp := &models.EntitlementLedgerResponse{
+		UserID: userID,
+		Resolved: models.ResolvedEntitlementInfo{
+			Active:             resolved.Active,
+			TrafficLimit:       resolved.TrafficLimit,
+			BaseTrafficLimit:   resolved.BaseTrafficLimit,
+			TopUpTraffic:       resolved.TopUpTraffic,
+			ServiceTier:        resolved.ServiceTier,
+			PrimaryGrantID:     resolved.PrimaryGrantID,
+			PrimaryProvisionID: resolved.PrimaryProvisionID,
+		},
+		Grants: []*models.EntitlementGrantInfo{},
+	}
+	if resolved.Active {
+		resp.Resolved.ExpireAt = resolved.ExpireAt.Format(time.RFC3339)
+	}
+
+	for _, g := range grants {
+		info := &models.EntitlementGrantInfo{
+			ID:             g.ID,
+			VPNProvisionID: g.VPNProvisionID,
+			Source:         g.Source,
+			SourceRef:      g.SourceRef,
+			TrafficBytes:   g.TrafficBytes,
+			StartsAt:       g.StartsAt.Format(time.RFC3339),
+			EndsAt:         g.EndsAt.Format(time.RFC3339),
+			Priority:       g.Priority,
+			ServiceTier:    g.ServiceTier,
+			Additive:       g.Additive,
+			Status:         g.Status,
+			CreatedAt:      g.CreatedAt.Format(time.RFC3339),
+		}
+		if g.ClosedAt != nil {
+			closedAt := g.ClosedAt.Format(time.RFC3339)
+			info.ClosedAt = &closedAt
+		}
+		resp.Grants = append(resp.Grants, info)
+	}
+	return resp, nil
+}
+
+// ListTrialAttempts lists trial eligibility evaluations (admin/internal)
+func (s *EntitlementService) ListTrialAttempts(ctx context.Context, userID, decision string, limit int) ([]*models.TrialAttemptInfo, error) {
+	attempts, err := s.eligibility.ListAttempts(ctx, userID, decision, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list trial attempts: %w", err)
+	}
+
+	var results []*models.TrialAttemptInfo
+	for _, a := range attempts {
+		results = append(results, toTrialAttemptInfo(a))
+	}
+	return results, nil
+}
+
+// OverrideTrialAttempt records an admin allow/deny decision for a trial attempt
+func (s *EntitlementService) OverrideTrialAttempt(ctx context.Context, attemptID string, req *models.TrialOverrideRequest) (*models.TrialAttemptInfo, error) {
+	attempt, err := s.eligibility.Override(ctx, attemptID, req.Decision, req.OverriddenBy, req.Note, req.ValidDays)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[EntitlementService] Trial attempt %s overridden to %s by %s", attemptID, req.Decision, req.OverriddenBy)
+	return toTrialAttemptInfo(attempt), nil
+}
+
+func toTrialAttemptInfo(a *models.TrialAttempt) *models.TrialAttemptInfo {
+	info := &models.TrialAttemptInfo{
+		ID:               a.ID,
+		UserID:           a.UserID,
+		Email:            a.Email,
+		NormalizedEmail:  a.NormalizedEmail,
+		DeviceID:         a.DeviceID,
+		IPAddress:        a.IPAddress,
+		Decision:         a.Decision,
+		Score:            a.Score,
+		Reasons:          a.Reasons,
+		OverrideDecision: a.OverrideDecision,
+		OverriddenBy:     a.OverriddenBy,
+		OverrideNote:     a.OverrideNote,
+		EffectiveResult:  a.EffectiveDecision(),
+		CreatedAt:        a.CreatedAt.Format(time.RFC3339),
+	}
+	if a.OverrideExpires != nil {
+		info.OverrideExpires = a.OverrideExpires.Format(time.RFC3339)
+	}
+	return info
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/client"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// nodeEventRelisten LISTEN 连接断开后重新监听的间隔
+const nodeEventRelisten = 5 * time.Second
+
+// NodeEventHub delivers node status changes pushed by hosting-service to waiting goroutines
+// 推送事件即时唤醒等待方；GetNode 轮询只作为兜底对账（推送丢失或未配置 webhook 时）
+// webhook 可能落在任一副本上，事件经 Postgres NOTIFY 转发给其他副本的等待方
+type NodeEventHub struct {
+	hostingClient *client.HostingClient
+	eventRepo     *repository.NodeEventRepository
+	pollInterval  time.Duration
+	instanceID    string
+
+	mu      sync.Mutex
+	waiters map[string][]chan *client.NodeInfo
+}
+
+// NewNodeEventHub creates a hub that falls back to polling every pollInterval
+func NewNodeEventHub(hostingClient *client.HostingClient, eventRepo *repository.NodeEventRepository, pollInterval time.Duration) *NodeEventHub {
+	return &NodeEventHub{
+		hostingClient: hostingClient,
+		eventRepo:     eventRepo,
+		pollInterval:  pollInterval,
+		instanceID:    uuid.New().String(),
+		waiters:       make(map[string][]chan *client.NodeInfo),
+	}
+}
+
+// Start listens for node events broadcast by other replicas until ctx is cancelled
+func (h *NodeEventHub) Start(ctx context.Context) {
+	log.Printf("[NodeEventHub] Started (instance=%s)", h.instanceID)
+	for {
+		err := h.eventRepo.Listen(ctx, h.relay)
+		if ctx.Err() != nil {
+			log.Println("[NodeEventHub] Stopped")
+			return
+		}
+		// 断开期间漏掉的事件由兜底轮询补上
+		log.Printf("[NodeEventHub] Listen failed, retrying in %v: %v", nodeEventRelisten, err)
+		select {
+		case <-ctx.Done():
+			log.Println("[NodeEventHub] Stopped")
+			return
+		case <-time.After(nodeEventRelisten):
+		}
+	}
+}
+
+// Broadcast publishes a node status locally and notifies the other replicas
+func (h *NodeEventHub) Broadcast(ctx context.Context, node *client.NodeInfo) {
+	h.Publish(node)
+	if err := h.eventRepo.Notify(ctx, h.instanceID+":"+node.NodeID); err != nil {
+		log.Printf("[NodeEventHub] Failed to broadcast event of node %s: %v", node.NodeID, err)
+	}
+}
+
+// relay handles a notification from another replica: the payload only carries the
+// node id, so the current status is fetched when someone here is waiting on the node
+func (h *NodeEventHub) relay(payload string) {
+	instanceID, nodeID, ok := strings.Cut(payload, ":")
+	if !ok || instanceID == h.instanceID {
+		return
+	}
+	h.mu.Lock()
+	waiting := len(h.waiters[nodeID]) > 0
+	h.mu.Unlock()
+	if !waiting {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if node := h.poll(ctx, nodeID); node != nil {
+			h.Publish(node)
+		}
+	}()
+}
+
+// Publish hands a node status to everyone waiting on the node
+// 返回是否有等待方
+func (h *NodeEventHub) Publish(node *client.NodeInfo) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	chans := h.waiters[node.NodeID]
+	for _, ch := range chans {
+		// 只保留最新状态：丢弃尚未消费的旧事件
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- node
+	}
+	return len(chans) > 0
+}
+
+// WaitForNodeReady waits until the node is active or failed
+// 与 HostingClient.WaitForNodeReady 语义相同，但由推送事件驱动
+func (h *NodeEventHub) WaitForNodeReady(ctx context.Context, nodeID string, maxWait time.Duration) (*client.NodeInfo, error) {
+	ch := make(chan *client.NodeInfo, 1)
+	h.subscribe(nodeID, ch)
+	defer h.unsubscribe(nodeID, ch)
+
+	timeout := time.NewTimer(maxWait)
+	defer timeout.Stop()
+	ticker := time.NewTicker(h.pollInterval)
+	defer ticker.Stop()
+
+	// 订阅后先查询一次，覆盖订阅之前已经推送过的状态
+	node := h.poll(ctx, nodeID)
+	for {
+		if node != nil {
+			switch node.Status {
+			case "active":
+				return node, nil
+			case "failed":
+				return node, fmt.Errorf("node creation failed: %s", node.ErrorMessage)
+			case "deleted":
+				return nil, fmt.Errorf("node was deleted")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout.C:
+			return nil, fmt.Errorf("timeout waiting for node to be ready")
+		case node = <-ch:
+		case <-ticker.C:
+			node = h.poll(ctx, nodeID)
+		}
+	}
+}
+
+func (h *NodeEventHub) poll(ctx context.Context, nodeID string) *client.NodeInfo {
+	node, err := h.hostingClient.GetNode(ctx, nodeID)
+	if err != nil {
+		log.Printf("[NodeEventHub] Error getting node %s status: %v", nodeID, err)
+		return nil
+	}
+	return node
+}
+
+func (h *NodeEventHub) subscribe(nodeID string, ch chan *client.NodeInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.waiters[nodeID] = append(h.waiters[nodeID], ch)
+}
+
+func (h *NodeEventHub) unsubscribe(nodeID string, ch chan *client.NodeInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	chans := h.waiters[nodeID]
+	for i, c := range chans {
+		if c == ch {
+			chans = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+	if len(chans) == 0 {
+		delete(h.waiters, nodeID)
+	} else {
+		h.waiters[nodeID] = chans
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// NodeHealthService records node reachability and derives health_status
+// 内部探测连续失败 → degraded；内部正常但外部探测点连续失败 → blocked
+type NodeHealthService struct {
+	cfg         *config.Config
+	hostingRepo *repository.HostingProvisionRepository
+	probeRepo   *repository.NodeProbeRepository
+	logRepo     *repository.LogRepository
+	probers     []NodeProber
+}
+
+// NewNodeHealthService creates a node health service with the given probers
+func NewNodeHealthService(
+	cfg *config.Config,
+	hostingRepo *repository.HostingProvisionRepository,
+	probeRepo *repository.NodeProbeRepository,
+	logRepo *repository.LogRepository,
+	probers ...NodeProber,
+) *NodeHealthService {
+	return &NodeHealthService{
+		cfg:         cfg,
+		hostingRepo: hostingRepo,
+		probeRepo:   probeRepo,
+		logRepo:     logRepo,
+		probers:     probers,
+	}
+}
+
+// ProbeAll runs every registered prober against all active nodes
+func (s *NodeHealthService) ProbeAll(ctx context.Context) {
+	nodes, err := s.hostingRepo.ListProbeTargets(ctx)
+	if err != nil {
+		log.Printf("[NodeHealth] Failed to list probe targets: %v", err)
+		return
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	sem := make(chan struct{}, max(s.cfg.Probe.Concurrency, 1))
+	var wg sync.WaitGroup
+	for _, hp := range nodes {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(hp *models.HostingProvision) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			checks := make([]ProbeCheck, 0, len(s.probers))
+			for _, p := range s.probers {
+				checks = append(checks, p.Probe(ctx, hp))
+			}
+			if err := s.RecordChecks(ctx, hp, models.ProbeSourceInternal, checks); err != nil {
+				log.Printf("[NodeHealth] Failed to record probes for %s: %v", hp.ID, err)
+			}
+		}(hp)
+	}
+	wg.Wait()
+}
+
+// ErrInvalidProbeReport 外部探测上报的内容不合法（如使用保留的 source）
+var ErrInvalidProbeReport = errors.New("invalid probe report")
+
+// ReportExternal records checks reported by an external vantage point
+func (s *NodeHealthService) ReportExternal(ctx context.Context, resourceID string, req *models.NodeProbeReportRequest) error {
+	if req.Source == models.ProbeSourceInternal {
+		return fmt.Errorf("%w: source %q is reserved", ErrInvalidProbeReport, req.Source)
+	}
+
+	hp, err := s.hostingRepo.GetByID(ctx, resourceID)
+	if err != nil {
+		return err
+	}
+
+	checks := make([]ProbeCheck, 0, len(req.Checks))
+	for _, c := range req.Checks {
+		checks = append(checks, ProbeCheck{
+			Check:     c.Check,
+			Success:   c.Success,
+			LatencyMS: c.LatencyMS,
+			Error:     c.Error,
+		})
+	}
+	return s.RecordChecks(ctx, hp, req.Source, checks)
+}
+
+// RecordChecks stores one probe round and updates the node's health status
+// 一轮中任一检查失败即视为该轮失败
+func (s *NodeHealthService) RecordChecks(ctx context.Context, hp *models.HostingProvision, source string, checks []ProbeCheck) error {
+	if len(checks) == 0 {
+		return nil
+	}
+
+	ok := true
+	results := make([]*models.NodeProbeResult, 0, len(checks))
+	for _, c := range checks {
+		pr := &models.NodeProbeResult{
+			HostingProvisionID: hp.ID,
+			Source:             source,
+			Check:              c.Check,
+			Success:            c.Success,
+			LatencyMS:          c.LatencyMS,
+		}
+		if c.Error != "" {
+			errMsg := c.Error
+			pr.Error = &errMsg
+		}
+		if !c.Success {
+			ok = false
+		}
+		results = append(results, pr)
+	}
+	if err := s.probeRepo.CreateBatch(ctx, results); err != nil {
+		return err
+	}
+
+	// 节点在探测期间被停机/删除时不再更新健康状态
+	if hp.Status != models.StatusActive {
+		return nil
+	}
+
+	external := source != models.ProbeSourceInternal
+	var failures, externalFailures int
+	var current string
+	var err error
+	if external {
+		failures, externalFailures, current, err = s.hostingRepo.RecordExternalProbeRound(ctx, hp.ID, source, ok, s.externalActiveSince())
+	} else {
+		failures, externalFailures, current, err = s.hostingRepo.RecordProbeRound(ctx, hp.ID, ok)
+	}
+	if err != nil {
+		return err
+	}
+
+	next := s.deriveHealth(failures, externalFailures, current, external, ok, hp.HostingFailedAt != nil)
+	if next == current {
+		return nil
+	}
+
+	if err := s.hostingRepo.UpdateHealthStatus(ctx, hp.ID, next); err != nil {
+		return err
+	}
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "node_health_changed", hp.Status,
+		fmt.Sprintf("Node health changed from %s to %s", current, next),
+		map[string]interface{}{
+			"from":                    current,
+			"to":                      next,
+			"source":                  source,
+			"probe_failures":          failures,
+			"external_probe_failures": externalFailures,
+		})
+	log.Printf("[NodeHealth] Resource %s health %s -> %s (source=%s)", hp.ID, current, next, source)
+	return nil
+}
+
+// externalActiveSince 外部探测点超过两个判定窗口（阈值 × 探测间隔）没有上报时，不再计入 external_probe_failures
+func (s *NodeHealthService) externalActiveSince() time.Time {
+	window := time.Duration(max(s.cfg.Probe.FailureThreshold, 1)*max(s.cfg.Probe.Interval, 1)) * time.Minute
+	return time.Now().Add(-2 * window)
+}
+
+// deriveHealth computes the next health status from the consecutive failure counters
+// hosting-service 报告节点 failed 时（hostingFailed）始终为 degraded，不被端口探测成功覆盖
+func (s *NodeHealthService) deriveHealth(failures, externalFailures int, current string, external, ok, hostingFailed bool) string {
+	threshold := max(s.cfg.Probe.FailureThreshold, 1)
+	switch {
+	case hostingFailed, failures >= threshold:
+		return models.NodeHealthDegraded
+	case externalFailures >= threshold:
+		return models.NodeHealthBlocked
+	case !ok:
+		// 未达到阈值，维持当前状态
+		return current
+	case external && current == models.NodeHealthUnknown:
+		// 仅有外部探测结果时不足以判定为 healthy
+		return current
+	default:
+		return models.NodeHealthHealthy
+	}
+}
+
+// PruneResults deletes probe results older than the retention period
+// NODE_PROBE_RETENTION_DAYS<=0 表示永久保留
+func (s *NodeHealthService) PruneResults(ctx context.Context) {
+	if s.cfg.Probe.RetentionDays <= 0 {
+		return
+	}
+	before := time.Now().AddDate(0, 0, -s.cfg.Probe.RetentionDays)
+	deleted, err := s.probeRepo.DeleteOlderThan(ctx, before)
+	if err != nil {
+		log.Printf("[NodeHealth] Failed to prune probe results: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("[NodeHealth] Pruned %d probe results older than %s", deleted, before.Format(time.RFC3339))
+	}
+}
+
+// GetProbeResults returns recent probe results of a node (admin)
+func (s *NodeHealthService) GetProbeResults(ctx context.Context, resourceID string, limit int) (*models.NodeProbeResultsResponse, error) {
+	hp, err := s.hostingRepo.GetByID(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := s.probeRepo.ListRecentByProvision(ctx, hp.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.NodeProbeResultsResponse{
+		ResourceID:   hp.ID,
+		HealthStatus: hp.HealthStatus,
+		Results:      make([]models.NodeProbeResultInfo, 0, len(results)),
+	}
+	for _, pr := range results {
+		info := models.NodeProbeResultInfo{
+			Source:    pr.Source,
+			Check:     pr.Check,
+			Success:   pr.Success,
+			LatencyMS: pr.LatencyMS,
+			ProbedAt:  pr.ProbedAt.Format(time.RFC3339),
+		}
+		if pr.Error != nil {
+			info.Error = *pr.Error
+		}
+		resp.Results = append(resp.Results, info)
+	}
+	return resp, nil
+}
+
+// HealthReport summarizes the health of all active nodes and lists the unhealthy ones (admin)
+func (s *NodeHealthService) HealthReport(ctx context.Context) (*models.NodeHealthReport, error) {
+	nodes, err := s.hostingRepo.ListProbeTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.NodeHealthReport{
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		Total:       len(nodes),
+		Counts:      make(map[string]int),
+		Nodes:       []models.NodeHealthReportItem{},
+	}
+	for _, hp := range nodes {
+		report.Counts[hp.HealthStatus]++
+		if hp.HealthStatus == models.NodeHealthHealthy {
+			continue
+		}
+
+		item := models.NodeHealthReportItem{
+			ResourceID:            hp.ID,
+			UserID:                hp.UserID,
+			Region:                hp.Region,
+			HealthStatus:          hp.HealthStatus,
+			ProbeFailures:         hp.ProbeFailures,
+			ExternalProbeFailures: hp.ExternalProbeFailures,
+		}
+		if hp.PublicIP != nil {
+			item.PublicIP = *hp.PublicIP
+		}
+		if hp.LastProbedAt != nil {
+			item.LastProbedAt = hp.LastProbedAt.Format(time.RFC3339)
+		}
+		if hp.HealthChangedAt != nil {
+			item.HealthChangedAt = hp.HealthChangedAt.Format(time.RFC3339)
+		}
+		report.Nodes = append(report.Nodes, item)
+	}
+	return report, nil
+}
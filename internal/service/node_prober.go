@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+)
+
+// ProbeCheck is the outcome of a single reachability check
+// 内部探测器和外部探测点（通过 /api/internal/resources/:id/probes 上报）共用此结构
+type ProbeCheck struct {
+	Check     string
+	Success   bool
+	LatencyMS int
+	Error     string
+}
+
+// NodeProber checks one aspect of a node's reachability
+// 新的探测方式实现此接口并在 main.go 中注册到 NodeHealthService
+type NodeProber interface {
+	Name() string
+	Probe(ctx context.Context, hp *models.HostingProvision) ProbeCheck
+}
+
+// TCPProber checks that a node port completes a TCP handshake
+type TCPProber struct {
+	check   string
+	port    func(hp *models.HostingProvision) int
+	timeout time.Duration
+}
+
+// NewVlessTCPProber probes the VLESS port
+func NewVlessTCPProber(timeout time.Duration) *TCPProber {
+	return &TCPProber{
+		check:   models.ProbeCheckVlessTCP,
+		port:    func(hp *models.HostingProvision) int { return hp.VlessPort },
+		timeout: timeout,
+	}
+}
+
+// NewSSTCPProber probes the Shadowsocks port
+func NewSSTCPProber(timeout time.Duration) *TCPProber {
+	return &TCPProber{
+		check:   models.ProbeCheckSSTCP,
+		port:    func(hp *models.HostingProvision) int { return hp.SSPort },
+		timeout: timeout,
+	}
+}
+
+func (p *TCPProber) Name() string { return p.check }
+
+func (p *TCPProber) Probe(ctx context.Context, hp *models.HostingProvision) ProbeCheck {
+	addr := net.JoinHostPort(*hp.PublicIP, strconv.Itoa(p.port(hp)))
+	dialer := &net.Dialer{Timeout: p.timeout}
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	latency := int(time.Since(start).Milliseconds())
+	if err != nil {
+		return ProbeCheck{Check: p.check, Success: false, LatencyMS: latency, Error: err.Error()}
+	}
+	conn.Close()
+	return ProbeCheck{Check: p.check, Success: true, LatencyMS: latency}
+}
+
+// AgentHealthProber calls the node agent /health endpoint
+// 探测走明文 HTTP，因此不携带节点 API key（/health 无需认证）；
+// agent 返回 401/403 也说明进程在正常响应，同样视为成功
+type AgentHealthProber struct {
+	httpClient *http.Client
+}
+
+// NewAgentHealthProber creates a node agent health prober
+func NewAgentHealthProber(timeout time.Duration) *AgentHealthProber {
+	return &AgentHealthProber{
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *AgentHealthProber) Name() string { return models.ProbeCheckAgentHealth }
+
+func (p *AgentHealthProber) Probe(ctx context.Context, hp *models.HostingProvision) ProbeCheck {
+	url := fmt.Sprintf("http://%s/health", net.JoinHostPort(*hp.PublicIP, strconv.Itoa(hp.APIPort)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return ProbeCheck{Check: models.ProbeCheckAgentHealth, Success: false, Error: err.Error()}
+	}
+
+	start := time.Now()
+	resp, err := p.httpClient.Do(req)
+	latency := int(time.Since(start).Milliseconds())
+	if err != nil {
+		return ProbeCheck{Check: models.ProbeCheckAgentHealth, Success: false, LatencyMS: latency, Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnauthorized, http.StatusForbidden:
+		return ProbeCheck{Check: models.ProbeCheckAgentHealth, Success: true, LatencyMS: latency}
+	default:
+		return ProbeCheck{
+			Check:     models.ProbeCheckAgentHealth,
+			Success:   false,
+			LatencyMS: latency,
+			Error:     fmt.Sprintf("node agent returned %d", resp.StatusCode),
+		}
+	}
+}
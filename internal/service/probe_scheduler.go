@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ProbeScheduler 节点可达性探测任务
+// 定期对所有 active 节点执行 NodeHealthService 中注册的探测器，并清理过期的探测结果
+type ProbeScheduler struct {
+	healthService *NodeHealthService
+	interval      time.Duration
+}
+
+// NewProbeScheduler 创建可达性探测调度器
+func NewProbeScheduler(healthService *NodeHealthService, interval time.Duration) *ProbeScheduler {
+	return &ProbeScheduler{
+		healthService: healthService,
+		interval:      interval,
+	}
+}
+
+// Start 启动调度器（阻塞运行，应在 goroutine 中调用）
+func (s *ProbeScheduler) Start(ctx context.Context) {
+	log.Printf("[ProbeScheduler] Started (interval=%v)", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[ProbeScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.healthService.ProbeAll(ctx)
+
+			// 探测结果每天清理一次
+			if time.Since(lastPrune) >= 24*time.Hour {
+				s.healthService.PruneResults(ctx)
+				lastPrune = time.Now()
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+)
+
+// ProvisionFailure classifies why a node could not be created
+type ProvisionFailure string
+
+const (
+	FailureCapacity      ProvisionFailure = "capacity"       // 区域内无可用容量
+	FailureQuota         ProvisionFailure = "quota"          // 账号配额/实例数上限
+	FailureTimeout       ProvisionFailure = "timeout"        // 创建或就绪超时
+	FailureInvalidBundle ProvisionFailure = "invalid_bundle" // 套餐规格/镜像在该区域不可用
+	FailureInternal      ProvisionFailure = "internal"       // 其他错误
+)
+
+// Retryable reports whether the failure may succeed in another region or provider
+// invalid_bundle 换区域也可能成功（规格按区域提供），internal 通常是配置或代码问题，不切换
+func (f ProvisionFailure) Retryable() bool {
+	switch f {
+	case FailureCapacity, FailureQuota, FailureTimeout, FailureInvalidBundle:
+		return true
+	}
+	return false
+}
+
+// 按错误信息中的关键字分类（hosting-service 透传云厂商错误）
+var provisionFailurePatterns = []struct {
+	failure  ProvisionFailure
+	keywords []string
+}{
+	{FailureCapacity, []string{"capacity", "out of stock", "not available in", "unavailable in", "insufficient"}},
+	{FailureQuota, []string{"quota", "limitexceeded", "limit exceeded", "too many instances", "maximum number"}},
+	{FailureInvalidBundle, []string{"bundle", "blueprint", "invalid size", "invalid image", "unsupported instance"}},
+	{FailureTimeout, []string{"timeout", "timed out", "deadline exceeded"}},
+}
+
+// classifyProvisionFailure maps a create/wait error to a failure class
+func classifyProvisionFailure(err error) ProvisionFailure {
+	if err == nil {
+		return FailureInternal
+	}
+	msg := strings.ToLower(err.Error())
+	for _, p := range provisionFailurePatterns {
+		for _, kw := range p.keywords {
+			if strings.Contains(msg, kw) {
+				return p.failure
+			}
+		}
+	}
+	return FailureInternal
+}
@@ -2,8 +2,12 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,14 +17,27 @@ import (
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
 )
 
+// ErrNodeNotSuspended is returned when resuming a node that is not suspended (or is already being resumed)
+var ErrNodeNotSuspended = errors.New("node is not suspended")
+
+// suspendStopTimeout 暂停节点停留在 stopping 超过该时长视为停机中断，由 SuspensionScheduler 重试
+const suspendStopTimeout = 15 * time.Minute
+
 // ProvisionService handles hosting node provisioning operations
 type ProvisionService struct {
 	cfg                *config.Config
 	hostingRepo        *repository.HostingProvisionRepository
 	regionRepo         *repository.RegionRepository
+	snapshotRepo       *repository.NodeSnapshotRepository
+	ipChangeRepo       *repository.NodeIPChangeRepository
+	replacementRepo    *repository.NodeReplacementRepository
+	webhookEventRepo   *repository.WebhookEventRepository
 	logRepo            *repository.LogRepository
 	hostingClient      *client.HostingClient
 	subscriptionClient *client.SubscriptionClient
+	warmPool           *WarmPoolService
+	createQueue        *NodeCreateQueue
+	nodeEvents         *NodeEventHub
 }
 
 // NewProvisionService creates a new provision service
@@ -28,22 +45,47 @@ func NewProvisionService(
 	cfg *config.Config,
 	hostingRepo *repository.HostingProvisionRepository,
 	regionRepo *repository.RegionRepository,
+	snapshotRepo *repository.NodeSnapshotRepository,
+	ipChangeRepo *repository.NodeIPChangeRepository,
+	replacementRepo *repository.NodeReplacementRepository,
+	webhookEventRepo *repository.WebhookEventRepository,
 	logRepo *repository.LogRepository,
 	hostingClient *client.HostingClient,
 	subscriptionClient *client.SubscriptionClient,
+	warmPool *WarmPoolService,
+	createQueue *NodeCreateQueue,
+	nodeEvents *NodeEventHub,
 ) *ProvisionService {
 	return &ProvisionService{
 		cfg:                cfg,
 		hostingRepo:        hostingRepo,
 		regionRepo:         regionRepo,
+		snapshotRepo:       snapshotRepo,
+		ipChangeRepo:       ipChangeRepo,
+		replacementRepo:    replacementRepo,
+		webhookEventRepo:   webhookEventRepo,
 		logRepo:            logRepo,
 		hostingClient:      hostingClient,
 		subscriptionClient: subscriptionClient,
+		warmPool:           warmPool,
+		createQueue:        createQueue,
+		nodeEvents:         nodeEvents,
 	}
 }
 
 // Provision starts the provisioning process for a new hosting node
 func (s *ProvisionService) Provision(ctx context.Context, req *models.ProvisionRequest) (*models.ProvisionResponse, error) {
+	priority := PriorityPaid
+	if req.BusinessType == models.BusinessTypeTrial {
+		priority = PriorityTrial
+	}
+	return s.provision(ctx, req, nil, priority)
+}
+
+// provision creates the provision record and starts provisioning.
+// With a snapshot the node is booted from it instead of a fresh blueprint.
+// priority orders the creation in the NodeCreateQueue.
+func (s *ProvisionService) provision(ctx context.Context, req *models.ProvisionRequest, snapshot *models.NodeSnapshot, priority CreatePriority) (*models.ProvisionResponse, error) {
 	log.Printf("[Provision] Starting provisioning for subscription=%s, user=%s",
 		req.SubscriptionID, req.UserID)
 
@@ -55,6 +97,18 @@ func (s *ProvisionService) Provision(ctx context.Context, req *models.ProvisionR
 
 	// Check if user already has an active hosting node
 	existing, err := s.hostingRepo.GetActiveByUser(ctx, req.UserID)
+	if err == nil && existing != nil && existing.SuspendedAt != nil {
+		// 宽限期内订阅恢复：重新启动原节点（保留 IP 和配置），不新建；停机尚未完成时同样恢复
+		resp, err := s.resumeSuspended(ctx, existing, req.SubscriptionID)
+		if errors.Is(err, ErrNodeNotSuspended) {
+			return &models.ProvisionResponse{
+				ResourceID: existing.ID,
+				Status:     models.StatusStarting,
+				Message:    "Suspended node is already being resumed",
+			}, nil
+		}
+		return resp, err
+	}
 	if err == nil && existing != nil {
 		return nil, fmt.Errorf("user already has an active hosting_node resource")
 	}
@@ -79,6 +133,10 @@ func (s *ProvisionService) Provision(ctx context.Context, req *models.ProvisionR
 
 	// Create hosting provision record
 	provisionID := uuid.New().String()
+	callbackToken, err := newCallbackToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate callback token: %w", err)
+	}
 	hp := &models.HostingProvision{
 		ID:             provisionID,
 		SubscriptionID: req.SubscriptionID,
@@ -89,31 +147,62 @@ func (s *ProvisionService) Provision(ctx context.Context, req *models.ProvisionR
 		Status:         models.StatusPending,
 		PlanTier:       req.PlanTier,
 		TrafficLimit:   req.TrafficLimit,
+		CallbackToken:  &callbackToken,
 	}
 
 	if err := s.hostingRepo.Create(ctx, hp); err != nil {
 		return nil, fmt.Errorf("create hosting provision: %w", err)
 	}
 
+	// 创建节点前领取快照：并发的创建请求只有一个能从同一快照恢复，其余创建新节点
+	if snapshot != nil {
+		if err := s.snapshotRepo.MarkRestored(ctx, snapshot.ID, provisionID); err != nil {
+			log.Printf("[Provision] Snapshot %s is no longer available for %s, creating a fresh node: %v", snapshot.ID, provisionID, err)
+			snapshot = nil
+		}
+	}
+
 	// Log action
-	s.logRepo.LogAction(ctx, provisionID, "hosting", "provision_started", "pending",
-		fmt.Sprintf("Provisioning started for hosting_node in region %s", region))
+	if snapshot != nil {
+		s.logRepo.LogActionWithMetadata(ctx, provisionID, "hosting", "provision_started", "pending",
+			fmt.Sprintf("Restoring hosting_node from snapshot in region %s", region),
+			map[string]interface{}{
+				"snapshot_id":         snapshot.ID,
+				"source_provision_id": snapshot.HostingProvisionID,
+			})
+	} else {
+		s.logRepo.LogAction(ctx, provisionID, "hosting", "provision_started", "pending",
+			fmt.Sprintf("Provisioning started for hosting_node in region %s", region))
+	}
 
 	// Start async provisioning
-	go s.provisionAsync(provisionID, req, region)
+	go s.provisionAsync(context.WithoutCancel(ctx), provisionID, req, region, snapshot, priority)
 
+	message := "Provisioning started"
+	if snapshot != nil {
+		message = msgRestoringSnapshot
+	}
 	return &models.ProvisionResponse{
 		ResourceID:            provisionID,
 		Status:                models.StatusPending,
 		EstimatedReadySeconds: 300,
-		Message:               "Provisioning started",
+		Message:               message,
 	}, nil
 }
 
-// provisionAsync handles the actual provisioning in the background
-func (s *ProvisionService) provisionAsync(provisionID string, req *models.ProvisionRequest, region string) {
-	ctx := context.Background()
+// msgRestoringSnapshot is the provision message when the node is restored from a claimed snapshot
+const msgRestoringSnapshot = "Provisioning started from snapshot"
 
+// releaseSnapshot gives back a snapshot claimed by a provision that did not restore from it
+func (s *ProvisionService) releaseSnapshot(ctx context.Context, snapshot *models.NodeSnapshot, provisionID string) {
+	if err := s.snapshotRepo.ReleaseRestore(ctx, snapshot.ID, provisionID); err != nil {
+		log.Printf("[Provision] Failed to release snapshot %s claimed by %s: %v", snapshot.ID, provisionID, err)
+	}
+}
+
+// provisionAsync handles the actual provisioning in the background
+// ctx 不随请求取消，但保留请求携带的内部调用方用于操作记录
+func (s *ProvisionService) provisionAsync(ctx context.Context, provisionID string, req *models.ProvisionRequest, region string, snapshot *models.NodeSnapshot, priority CreatePriority) {
 	// Notify subscription-service that provisioning started
 	if err := s.subscriptionClient.NotifyProvisioningStarted(ctx, req.SubscriptionID, provisionID); err != nil {
 		log.Printf("[Provision] Failed to notify subscription-service (start): %v", err)
@@ -125,50 +214,71 @@ func (s *ProvisionService) provisionAsync(provisionID string, req *models.Provis
 	// Get bundle ID based on plan tier
 	bundleID := s.getBundleID(req.PlanTier)
 
-	// Call obox-hosting-service to create node
-	createReq := &client.CreateNodeRequest{
-		CloudProvider:  s.cfg.Hosting.CloudProvider,
-		Region:         region,
-		BundleID:       bundleID,
-		SubscriptionID: req.SubscriptionID,
-		UserID:         req.UserID,
+	// 预热池中有同区域同规格的就绪节点时直接领取，跳过创建和等待
+	var node *client.NodeInfo
+	var placement config.RegionFallback
+	if snapshot == nil {
+		node, placement = s.claimWarmNode(ctx, provisionID, req, region, bundleID)
 	}
 
-	createResp, err := s.hostingClient.CreateNode(ctx, createReq)
-	if err != nil {
-		s.handleProvisionError(ctx, req.SubscriptionID, provisionID, fmt.Sprintf("create node via hosting-service: %v", err))
-		return
-	}
+	// 依次尝试首选区域和备选区域：容量/配额/超时等可重试的失败自动切换到下一个
+	if node == nil {
+		placements := s.placementCandidates(region)
+		for i, p := range placements {
+			if i > 0 && snapshot != nil {
+				// 快照只能在原区域恢复，归还给之后的创建
+				s.releaseSnapshot(ctx, snapshot, provisionID)
+				snapshot = nil
+			}
 
-	// Store the external node ID
-	nodeID := createResp.NodeID
-	hp, _ := s.hostingRepo.GetByID(ctx, provisionID)
-	if hp != nil {
-		hp.HostingNodeID = nodeID
-		hp.Status = models.StatusCreating
-		s.hostingRepo.Update(ctx, hp)
-	}
+			var err error
+			node, err = s.createNodeIn(ctx, provisionID, req, bundleID, p, snapshot, priority)
+			if err == nil {
+				placement = p
+				break
+			}
 
-	s.logRepo.LogAction(ctx, provisionID, "hosting", "node_creating", "creating",
-		fmt.Sprintf("Node %s created in hosting-service, waiting for active state", nodeID))
+			failure := classifyProvisionFailure(err)
+			if !failure.Retryable() || i == len(placements)-1 {
+				if snapshot != nil {
+					s.releaseSnapshot(ctx, snapshot, provisionID)
+				}
+				s.handleProvisionError(ctx, req.SubscriptionID, provisionID, fmt.Sprintf("[%s] %v", failure, err))
+				return
+			}
 
-	// Wait for node to be active
-	node, err := s.hostingClient.WaitForNodeReady(ctx, nodeID, 10*time.Minute)
-	if err != nil {
-		// 云实例已创建但未就绪，主动清理避免僵尸实例持续计费
-		log.Printf("[Provision] Node %s failed to become ready, attempting cleanup...", nodeID)
-		if _, cleanupErr := s.hostingClient.DeleteNode(ctx, nodeID); cleanupErr != nil {
-			log.Printf("[Provision] WARN: failed to cleanup node %s after provision failure: %v (will be retried by CleanupScheduler)", nodeID, cleanupErr)
-			s.hostingRepo.MarkNeedsCleanup(ctx, provisionID)
-		} else {
-			log.Printf("[Provision] Successfully cleaned up failed node %s", nodeID)
+			next := placements[i+1]
+			log.Printf("[Provision] %s failed in %s (%s), failing over to %s", provisionID, placementName(p), failure, placementName(next))
+			s.logRepo.LogActionWithMetadata(ctx, provisionID, "hosting", "provision_failover", models.StatusCreating,
+				fmt.Sprintf("Could not create node in %s (%s), retrying in %s", placementName(p), failure, placementName(next)),
+				map[string]interface{}{
+					"from_provider": p.Provider,
+					"from_region":   p.Region,
+					"to_provider":   next.Provider,
+					"to_region":     next.Region,
+					"failure":       string(failure),
+					"error":         err.Error(),
+				})
 		}
-		s.handleProvisionError(ctx, req.SubscriptionID, provisionID, fmt.Sprintf("wait for node ready: %v", err))
-		return
+	}
+
+	if placement.Region != region || placement.Provider != s.cfg.Hosting.CloudProvider {
+		s.logRepo.LogActionWithMetadata(ctx, provisionID, "hosting", "provision_region_selected", models.StatusCreating,
+			fmt.Sprintf("Node created in %s instead of %s because the preferred region was unavailable", placementName(placement), region),
+			map[string]interface{}{
+				"requested_region": region,
+				"provider":         placement.Provider,
+				"region":           placement.Region,
+			})
+	}
+
+	// 从快照恢复：hosting-service 未回报的凭据用快照时记录的值兜底
+	if snapshot != nil {
+		restoreSnapshotCredentials(node, snapshot)
 	}
 
 	// Update hosting provision with node information
-	hp, _ = s.hostingRepo.GetByID(ctx, provisionID)
+	hp, _ := s.hostingRepo.GetByID(ctx, provisionID)
 	if hp != nil {
 		publicIP := node.PublicIP
 		apiKey := node.NodeAPIKey
@@ -209,6 +319,191 @@ func (s *ProvisionService) provisionAsync(provisionID string, req *models.Provis
 	log.Printf("[Provision] Resource %s provisioning complete! Node active at %s", provisionID, node.PublicIP)
 }
 
+// claimWarmNode hands a ready warm pool node over to the provision
+// 领取后转移归属并轮换凭据，池节点的密钥在交付前不会被任何用户看到；
+// 任一步骤失败则删除该节点并返回 nil，由调用方按正常流程创建
+func (s *ProvisionService) claimWarmNode(ctx context.Context, provisionID string, req *models.ProvisionRequest, region, bundleID string) (*client.NodeInfo, config.RegionFallback) {
+	wn, err := s.warmPool.Claim(ctx, region, bundleID, provisionID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[Provision] Failed to claim warm node for %s: %v", provisionID, err)
+		}
+		return nil, config.RegionFallback{}
+	}
+	if wn.HostingNodeID == nil {
+		s.warmPool.Discard(ctx, wn, "claimed node has no hosting node id")
+		return nil, config.RegionFallback{}
+	}
+	nodeID := *wn.HostingNodeID
+
+	// 立即记录节点，之后对账时节点已有 provision 引用
+	hp, _ := s.hostingRepo.GetByID(ctx, provisionID)
+	if hp != nil {
+		hp.HostingNodeID = nodeID
+		s.hostingRepo.Update(ctx, hp)
+	}
+
+	if err := s.hostingClient.AssignNode(ctx, nodeID, &client.AssignNodeRequest{
+		SubscriptionID: req.SubscriptionID,
+		UserID:         req.UserID,
+		CallbackToken:  s.callbackTokenOf(ctx, provisionID),
+	}); err != nil {
+		s.warmPool.Discard(ctx, wn, "assign failed: "+err.Error())
+		return nil, config.RegionFallback{}
+	}
+
+	node, err := s.hostingClient.RotateNodeCredentials(ctx, nodeID, &client.RotateCredentialsRequest{
+		OldKeyTTLSeconds: 0, // 池节点的旧凭据从未交付，立即失效
+	})
+	if err != nil {
+		s.warmPool.Discard(ctx, wn, "credential rotation failed: "+err.Error())
+		return nil, config.RegionFallback{}
+	}
+
+	p := config.RegionFallback{Provider: wn.Provider, Region: wn.Region}
+	if err := s.hostingRepo.UpdatePlacement(ctx, provisionID, p.Provider, p.Region); err != nil {
+		log.Printf("[Provision] Failed to update placement of %s: %v", provisionID, err)
+	}
+	metadata := map[string]interface{}{
+		"warm_node_id":    wn.ID,
+		"hosting_node_id": nodeID,
+	}
+	if wn.ReadyAt != nil {
+		metadata["idle_seconds"] = int(time.Since(*wn.ReadyAt).Seconds())
+	}
+	s.logRepo.LogActionWithMetadata(ctx, provisionID, "hosting", "warm_node_claimed", models.StatusCreating,
+		fmt.Sprintf("Node %s claimed from warm pool (%s)", nodeID, placementName(p)), metadata)
+	log.Printf("[Provision] Resource %s claimed warm node %s", provisionID, nodeID)
+	return node, p
+}
+
+// placementCandidates returns the preferred region followed by its configured fallbacks
+func (s *ProvisionService) placementCandidates(region string) []config.RegionFallback {
+	placements := []config.RegionFallback{{Provider: s.cfg.Hosting.CloudProvider, Region: region}}
+	for _, fb := range s.cfg.Hosting.RegionFallbacks[region] {
+		if len(placements) >= s.cfg.Hosting.FailoverMaxAttempts {
+			break
+		}
+		if fb.Provider == "" {
+			fb.Provider = s.cfg.Hosting.CloudProvider
+		}
+		if !slices.Contains(placements, fb) {
+			placements = append(placements, fb)
+		}
+	}
+	return placements
+}
+
+// createNodeIn creates a node in one placement and waits for it to become active
+// 未就绪的实例会被删除，返回的错误交给 classifyProvisionFailure 判断是否切换区域
+func (s *ProvisionService) createNodeIn(ctx context.Context, provisionID string, req *models.ProvisionRequest, bundleID string, p config.RegionFallback, snapshot *models.NodeSnapshot, priority CreatePriority) (*client.NodeInfo, error) {
+	if err := s.hostingRepo.UpdatePlacement(ctx, provisionID, p.Provider, p.Region); err != nil {
+		log.Printf("[Provision] Failed to update placement of %s: %v", provisionID, err)
+	}
+
+	// 占用创建名额直到节点就绪或失败，避免突发请求压垮 hosting-service 和云厂商 API
+	release, err := s.createQueue.Acquire(ctx, provisionID, priority, p.Provider, p.Region)
+	if err != nil {
+		return nil, fmt.Errorf("wait for create slot: %w", err)
+	}
+	defer release()
+
+	// Call obox-hosting-service to create node
+	createReq := &client.CreateNodeRequest{
+		CloudProvider:  p.Provider,
+		Region:         p.Region,
+		BundleID:       bundleID,
+		SubscriptionID: req.SubscriptionID,
+		UserID:         req.UserID,
+		CallbackToken:  s.callbackTokenOf(ctx, provisionID),
+	}
+	if snapshot != nil {
+		createReq.SnapshotID = snapshot.SnapshotRef
+	}
+
+	createResp, err := s.hostingClient.CreateNode(ctx, createReq)
+	if err != nil {
+		return nil, fmt.Errorf("create node via hosting-service: %w", err)
+	}
+
+	// Store the external node ID
+	nodeID := createResp.NodeID
+	hp, _ := s.hostingRepo.GetByID(ctx, provisionID)
+	if hp != nil {
+		hp.HostingNodeID = nodeID
+		hp.Status = models.StatusCreating
+		s.hostingRepo.Update(ctx, hp)
+	}
+
+	s.logRepo.LogAction(ctx, provisionID, "hosting", "node_creating", "creating",
+		fmt.Sprintf("Node %s created in hosting-service (%s), waiting for active state", nodeID, placementName(p)))
+
+	// Wait for node to be active
+	node, err := s.nodeEvents.WaitForNodeReady(ctx, nodeID, 10*time.Minute)
+	if err != nil {
+		// 云实例已创建但未就绪，主动清理避免僵尸实例持续计费
+		log.Printf("[Provision] Node %s failed to become ready, attempting cleanup...", nodeID)
+		if _, cleanupErr := s.hostingClient.DeleteNode(ctx, nodeID); cleanupErr != nil {
+			log.Printf("[Provision] WARN: failed to cleanup node %s after provision failure: %v (will be retried by CleanupScheduler)", nodeID, cleanupErr)
+			// 按节点 id 记录：故障切换后 provision 会关联新节点，不能按 provision 清理
+			if err := s.hostingRepo.QueueNodeCleanup(ctx, provisionID, nodeID); err != nil {
+				log.Printf("[Provision] Failed to queue cleanup of node %s: %v", nodeID, err)
+			}
+		} else {
+			log.Printf("[Provision] Successfully cleaned up failed node %s", nodeID)
+		}
+		return nil, fmt.Errorf("wait for node ready: %w", err)
+	}
+	return node, nil
+}
+
+// CallbackToken returns the node callback signing key of a provision
+// 早于回调签名创建的 provision 没有密钥，返回 ErrNotFound（只能走旧的共享密钥回调）
+func (s *ProvisionService) CallbackToken(ctx context.Context, resourceID string) (string, error) {
+	hp, err := s.hostingRepo.GetByID(ctx, resourceID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.hostingRepo.OpenCredentials(hp); err != nil {
+		return "", fmt.Errorf("decrypt callback token: %w", err)
+	}
+	if hp.CallbackToken == nil || *hp.CallbackToken == "" {
+		return "", repository.ErrNotFound
+	}
+	return *hp.CallbackToken, nil
+}
+
+// openCredentials decrypts the node credentials before handing them out
+// 无法解密（密钥版本缺失）时记录日志，凭据保持为空，不影响其余字段
+func (s *ProvisionService) openCredentials(hp *models.HostingProvision) {
+	if err := s.hostingRepo.OpenCredentials(hp); err != nil {
+		log.Printf("[Provision] Failed to decrypt credentials of %s: %v", hp.ID, err)
+	}
+}
+
+// callbackTokenOf returns the callback token to hand to hosting-service, "" if unavailable
+func (s *ProvisionService) callbackTokenOf(ctx context.Context, provisionID string) string {
+	token, err := s.CallbackToken(ctx, provisionID)
+	if err != nil {
+		return ""
+	}
+	return token
+}
+
+// newCallbackToken generates a random per-provision callback signing key
+func newCallbackToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// placementName formats a placement as "provider/region"
+func placementName(p config.RegionFallback) string {
+	return p.Provider + "/" + p.Region
+}
+
 // HandleNodeReady handles callback when node software is ready
 func (s *ProvisionService) HandleNodeReady(ctx context.Context, callback *models.NodeReadyCallback) error {
 	log.Printf("[Provision] Node ready callback for resource %s", callback.ResourceID)
@@ -249,6 +544,79 @@ func (s *ProvisionService) HandleNodeReady(ctx context.Context, callback *models
 	return nil
 }
 
+// webhookEventRetention 已处理 webhook 事件 id 的保留时长，覆盖 hosting-service 的重试窗口
+const webhookEventRetention = 7 * 24 * time.Hour
+
+// HandleHostingNodeEvent applies a node status change pushed by hosting-service
+// 按 event_id 去重：重复推送直接确认；处理失败时删除记录，让重试重新处理
+func (s *ProvisionService) HandleHostingNodeEvent(ctx context.Context, event *client.NodeEvent) error {
+	if event.EventID == "" {
+		return s.applyHostingNodeEvent(ctx, event)
+	}
+
+	first, err := s.webhookEventRepo.Record(ctx, event.EventID)
+	if err != nil {
+		return err
+	}
+	if !first {
+		log.Printf("[Webhook] Duplicate event %s ignored", event.EventID)
+		return nil
+	}
+	if err := s.applyHostingNodeEvent(ctx, event); err != nil {
+		if forgetErr := s.webhookEventRepo.Forget(context.WithoutCancel(ctx), event.EventID); forgetErr != nil {
+			log.Printf("[Webhook] Failed to release event %s after error: %v", event.EventID, forgetErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// PurgeWebhookEvents deletes webhook event ids past the retention window
+func (s *ProvisionService) PurgeWebhookEvents(ctx context.Context) {
+	n, err := s.webhookEventRepo.DeleteBefore(ctx, time.Now().Add(-webhookEventRetention))
+	if err != nil {
+		log.Printf("[Webhook] Failed to purge processed events: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("[Webhook] Purged %d processed events", n)
+	}
+}
+
+// applyHostingNodeEvent 唤醒等待该节点的创建/替换流程，并推进创建进度（creating → running → installing）
+func (s *ProvisionService) applyHostingNodeEvent(ctx context.Context, event *client.NodeEvent) error {
+	node := &event.Node
+	if node.NodeID == "" {
+		return fmt.Errorf("event has no node_id")
+	}
+	s.nodeEvents.Broadcast(ctx, node)
+
+	hp, err := s.hostingRepo.GetByHostingNodeID(ctx, node.NodeID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil // 预热池节点或替换中的新节点，由等待方处理
+		}
+		return fmt.Errorf("get hosting provision: %w", err)
+	}
+
+	switch {
+	case node.Status == models.StatusRunning && hp.Status == models.StatusCreating,
+		node.Status == models.StatusInstalling && (hp.Status == models.StatusCreating || hp.Status == models.StatusRunning):
+		if err := s.hostingRepo.TransitionStatus(ctx, hp.ID, hp.Status, node.Status); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil // 状态已被其他流程推进
+			}
+			return err
+		}
+		s.logRepo.LogAction(ctx, hp.ID, "hosting", "node_"+node.Status, node.Status,
+			fmt.Sprintf("Node %s is %s", node.NodeID, node.Status))
+	case node.Status == models.StatusFailed && hp.Status == models.StatusActive:
+		// 已交付的节点故障：交给 auto-heal 替换
+		s.MarkHostingFailed(ctx, hp, "hosting-service reported node failed: "+node.ErrorMessage)
+	}
+	return nil
+}
+
 // HandleNodeFailed handles callback when node installation fails
 func (s *ProvisionService) HandleNodeFailed(ctx context.Context, callback *models.NodeFailedCallback) error {
 	log.Printf("[Provision] Node failed callback for resource %s: %s", callback.ResourceID, callback.ErrorMessage)
@@ -258,6 +626,12 @@ func (s *ProvisionService) HandleNodeFailed(ctx context.Context, callback *model
 		return fmt.Errorf("get hosting provision: %w", err)
 	}
 
+	if hp.Status == models.StatusActive {
+		// 已交付的节点故障：不标记 failed，交给 auto-heal 替换
+		s.MarkNodeDegraded(ctx, hp, "node agent reported failure: "+callback.ErrorMessage)
+		return nil
+	}
+
 	s.handleProvisionError(context.Background(), hp.SubscriptionID, hp.ID, callback.ErrorMessage)
 	return nil
 }
@@ -294,7 +668,42 @@ func (s *ProvisionService) Deprovision(ctx context.Context, req *models.Deprovis
 		return nil, fmt.Errorf("resource not found")
 	}
 
-	go s.deprovisionAsync(hp, req.Reason)
+	// 订阅失效先停机保留，宽限期过后再删除；用户主动删除（Immediate）直接删
+	if !req.Immediate && s.cfg.Hosting.SuspendGraceHours > 0 && hp.HostingNodeID != "" {
+		switch {
+		case hp.Status == models.StatusActive, hp.Status == models.StatusStopped && hp.SuspendedAt == nil,
+			hp.Status == models.StatusRebooting, hp.Status == models.StatusStarting:
+			// 用户主动关机或正在重启/开机的节点同样进入宽限期（进行中的电源操作完成时发现状态已变，不再覆盖）
+			// 先同步记录暂停，停机期间到达的续费即可识别为恢复
+			until := time.Now().Add(time.Duration(s.cfg.Hosting.SuspendGraceHours) * time.Hour)
+			if err := s.hostingRepo.MarkSuspended(ctx, hp.ID, until, req.Reason); err != nil {
+				if !errors.Is(err, repository.ErrNotFound) {
+					return nil, err
+				}
+				return &models.DeprovisionResponse{
+					ResourceID: hp.ID,
+					Status:     hp.Status,
+					Message:    "Node already suspended",
+				}, nil
+			}
+			hp.SuspendUntil = &until
+			hp.SuspendReason = &req.Reason
+			go s.suspendAsync(context.WithoutCancel(ctx), hp)
+			return &models.DeprovisionResponse{
+				ResourceID: hp.ID,
+				Status:     models.StatusStopping,
+				Message:    fmt.Sprintf("Node suspended, will be deleted after %s unless the subscription is reactivated", until.Format(time.RFC3339)),
+			}, nil
+		case hp.SuspendedAt != nil:
+			return &models.DeprovisionResponse{
+				ResourceID: hp.ID,
+				Status:     hp.Status,
+				Message:    "Node already suspended",
+			}, nil
+		}
+	}
+
+	go s.deprovisionAsync(context.WithoutCancel(ctx), hp, req.Reason, !req.Immediate)
 
 	return &models.DeprovisionResponse{
 		ResourceID: hp.ID,
@@ -304,11 +713,14 @@ func (s *ProvisionService) Deprovision(ctx context.Context, req *models.Deprovis
 }
 
 // deprovisionAsync handles the actual deprovisioning in the background
-func (s *ProvisionService) deprovisionAsync(hp *models.HostingProvision, reason string) {
-	ctx := context.Background()
-
+// snapshot: take a snapshot first when HOSTING_SNAPSHOT_ON_DELETE is on (not for user-initiated deletes)
+func (s *ProvisionService) deprovisionAsync(ctx context.Context, hp *models.HostingProvision, reason string, snapshot bool) {
 	s.updateStatus(ctx, hp.ID, models.StatusStopping, nil)
 
+	if snapshot && s.cfg.Hosting.SnapshotOnDelete && hp.HostingNodeID != "" {
+		s.snapshotBeforeDelete(ctx, hp)
+	}
+
 	// Delete node via hosting-service
 	if hp.HostingNodeID != "" {
 		_, err := s.hostingClient.DeleteNode(ctx, hp.HostingNodeID)
@@ -322,15 +734,247 @@ func (s *ProvisionService) deprovisionAsync(hp *models.HostingProvision, reason
 	hp.DeletedAt = &now
 	s.hostingRepo.Update(ctx, hp)
 
-	s.logRepo.LogAction(ctx, hp.ID, "hosting", "deprovisioned", "deleted",
-		fmt.Sprintf("Resource deprovisioned. Reason: %s", reason))
+	s.logRepo.LogAction(ctx, hp.ID, "hosting", "deprovisioned", "deleted",
+		fmt.Sprintf("Resource deprovisioned. Reason: %s", reason))
+
+	// Notify subscription-service（携带 reason，让 subscription-service 区分用户主动删除和订阅取消）
+	if err := s.subscriptionClient.NotifyDeleted(ctx, hp.SubscriptionID, hp.ID, reason); err != nil {
+		log.Printf("[Deprovision] Failed to notify subscription-service (deleted): %v", err)
+	}
+
+	log.Printf("[Deprovision] Resource %s successfully deprovisioned (reason: %s)", hp.ID, reason)
+}
+
+// suspendAsync stops a node already marked suspended (status stopping) and
+// records the state it actually ends up in; the node is held for the grace period
+func (s *ProvisionService) suspendAsync(ctx context.Context, hp *models.HostingProvision) {
+	until, reason := time.Now(), ""
+	if hp.SuspendUntil != nil {
+		until = *hp.SuspendUntil
+	}
+	if hp.SuspendReason != nil {
+		reason = *hp.SuspendReason
+	}
+
+	// 停机失败时按节点实际状态记录，节点继续运行到宽限期结束，届时照常删除
+	status := models.StatusStopped
+	_, stopErr := s.hostingClient.StopNode(ctx, hp.HostingNodeID)
+	if stopErr != nil {
+		log.Printf("[Suspend] Warning: failed to stop node %s: %v", hp.HostingNodeID, stopErr)
+		status = s.observedPowerStatus(ctx, hp.HostingNodeID)
+	}
+
+	if err := s.hostingRepo.TransitionStatus(ctx, hp.ID, models.StatusStopping, status); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[Suspend] Failed to update status of %s: %v", hp.ID, err)
+			return
+		}
+		// 停机期间订阅已恢复：恢复流程的开机可能先于本次停机完成，再开一次机
+		if cur, gErr := s.hostingRepo.GetByID(ctx, hp.ID); gErr == nil && cur.SuspendedAt == nil && cur.DeletedAt == nil && stopErr == nil {
+			log.Printf("[Suspend] Resource %s was resumed while stopping, starting node %s again", hp.ID, hp.HostingNodeID)
+			if _, err := s.hostingClient.StartNode(ctx, hp.HostingNodeID); err != nil {
+				log.Printf("[Suspend] Failed to restart resumed node %s: %v", hp.HostingNodeID, err)
+			}
+		}
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"suspend_until": until.Format(time.RFC3339),
+	}
+	if stopErr != nil {
+		metadata["stop_error"] = stopErr.Error()
+	}
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "node_suspended", status,
+		fmt.Sprintf("Node suspended. Reason: %s", reason), metadata)
+
+	if err := s.subscriptionClient.NotifySuspended(ctx, hp.SubscriptionID, hp.ID, until); err != nil {
+		log.Printf("[Suspend] Failed to notify subscription-service (suspended): %v", err)
+	}
+
+	log.Printf("[Suspend] Resource %s suspended until %s as %s (reason: %s)", hp.ID, until.Format(time.RFC3339), status, reason)
+}
+
+// observedPowerStatus asks hosting-service whether the node is stopped after a failed stop;
+// anything else (including an unreachable hosting-service) is recorded as still running
+func (s *ProvisionService) observedPowerStatus(ctx context.Context, nodeID string) string {
+	node, err := s.hostingClient.GetNode(ctx, nodeID)
+	if err == nil && node.Status == models.StatusStopped {
+		return models.StatusStopped
+	}
+	return models.StatusActive
+}
+
+// RetryStuckSuspensions re-runs the stop for suspended nodes left in stopping
+// (e.g. the process restarted before suspendAsync finished)
+func (s *ProvisionService) RetryStuckSuspensions(ctx context.Context) {
+	provisions, err := s.hostingRepo.ListStuckSuspending(ctx, time.Now().Add(-suspendStopTimeout), 20)
+	if err != nil {
+		log.Printf("[Suspend] Failed to list stuck suspensions: %v", err)
+		return
+	}
+
+	for _, hp := range provisions {
+		log.Printf("[Suspend] Resource %s stuck in stopping since %s, retrying stop", hp.ID, hp.UpdatedAt.Format(time.RFC3339))
+		s.suspendAsync(context.WithoutCancel(ctx), hp)
+	}
+}
+
+// resumeSuspended starts a suspended node again after its subscription is reactivated
+func (s *ProvisionService) resumeSuspended(ctx context.Context, hp *models.HostingProvision, subscriptionID string) (*models.ProvisionResponse, error) {
+	log.Printf("[Resume] Resuming suspended resource %s (node=%s, status=%s)", hp.ID, hp.HostingNodeID, hp.Status)
+
+	if err := s.hostingRepo.ClaimResume(ctx, hp.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrNodeNotSuspended
+		}
+		return nil, err
+	}
+
+	// 停机失败的暂停节点仍在运行，无需开机
+	node := &client.NodeInfo{}
+	if hp.Status != models.StatusActive {
+		var err error
+		node, err = s.hostingClient.StartNode(ctx, hp.HostingNodeID)
+		if err != nil {
+			// 暂停信息保留，回到原状态，宽限期内可再次恢复
+			if tErr := s.hostingRepo.TransitionStatus(ctx, hp.ID, models.StatusStarting, hp.Status); tErr != nil {
+				log.Printf("[Resume] Failed to restore status of %s: %v", hp.ID, tErr)
+			}
+			return nil, fmt.Errorf("start suspended node: %w", err)
+		}
+	}
+
+	if err := s.hostingRepo.ClearSuspension(ctx, hp.ID, subscriptionID); err != nil {
+		return nil, err
+	}
+	if node.PublicIP != "" && (hp.PublicIP == nil || *hp.PublicIP != node.PublicIP) {
+		// 正常情况下静态 IP 保持不变，这里兜底
+		publicIP := node.PublicIP
+		hp.PublicIP = &publicIP
+	}
+	hp.Status = models.StatusActive
+	if err := s.hostingRepo.Update(ctx, hp); err != nil {
+		return nil, err
+	}
+	if subscriptionID != "" {
+		hp.SubscriptionID = subscriptionID
+	}
+
+	s.logRepo.LogAction(ctx, hp.ID, "hosting", "node_resumed", "active", "Suspended node resumed")
+
+	if err := s.subscriptionClient.NotifyResumed(ctx, hp.SubscriptionID, hp.ID); err != nil {
+		log.Printf("[Resume] Failed to notify subscription-service (resumed): %v", err)
+	}
+
+	return &models.ProvisionResponse{
+		ResourceID: hp.ID,
+		Status:     models.StatusActive,
+		Message:    "Suspended node resumed",
+	}, nil
+}
+
+// ResumeResource resumes a suspended hosting provision (admin/internal)
+func (s *ProvisionService) ResumeResource(ctx context.Context, resourceID string) (*models.ProvisionResponse, error) {
+	hp, err := s.hostingRepo.GetByID(ctx, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	if hp.SuspendedAt == nil {
+		return nil, ErrNodeNotSuspended
+	}
+	return s.resumeSuspended(ctx, hp, "")
+}
+
+// DeleteExpiredSuspensions deletes suspended nodes whose grace period has passed
+func (s *ProvisionService) DeleteExpiredSuspensions(ctx context.Context) {
+	provisions, err := s.hostingRepo.ListSuspensionDue(ctx, 20)
+	if err != nil {
+		log.Printf("[Suspend] Failed to list expired suspensions: %v", err)
+		return
+	}
+
+	for _, hp := range provisions {
+		log.Printf("[Suspend] Grace period for %s ended at %s, deleting node", hp.ID, hp.SuspendUntil.Format(time.RFC3339))
+		s.deprovisionAsync(context.WithoutCancel(ctx), hp, "Suspension grace period expired", true)
+	}
+}
+
+// snapshotBeforeDelete snapshots the node and records it for later restore.
+// A failed snapshot doesn't block the deletion.
+func (s *ProvisionService) snapshotBeforeDelete(ctx context.Context, hp *models.HostingProvision) {
+	info, err := s.hostingClient.CreateSnapshot(ctx, hp.HostingNodeID)
+	if err != nil {
+		log.Printf("[Deprovision] Warning: failed to snapshot node %s, deleting without snapshot: %v", hp.HostingNodeID, err)
+		return
+	}
+
+	s.openCredentials(hp)
+	ns := &models.NodeSnapshot{
+		ID:                 uuid.New().String(),
+		UserID:             hp.UserID,
+		HostingProvisionID: hp.ID,
+		HostingNodeID:      hp.HostingNodeID,
+		SnapshotRef:        info.SnapshotID,
+		Provider:           hp.Provider,
+		Region:             hp.Region,
+		PlanTier:           hp.PlanTier,
+		APIKey:             hp.APIKey,
+		PublicKey:          hp.PublicKey,
+		ShortID:            hp.ShortID,
+		Status:             models.SnapshotStatusAvailable,
+		ExpiresAt:          time.Now().AddDate(0, 0, s.cfg.Hosting.SnapshotRetentionDays),
+	}
+	if err := s.snapshotRepo.Create(ctx, ns); err != nil {
+		// 没有记录就无法恢复也无法到期清理，直接删掉快照避免泄漏
+		log.Printf("[Deprovision] Failed to record snapshot %s: %v", info.SnapshotID, err)
+		if delErr := s.hostingClient.DeleteSnapshot(ctx, info.SnapshotID); delErr != nil {
+			log.Printf("[Deprovision] Failed to delete unrecorded snapshot %s: %v", info.SnapshotID, delErr)
+		}
+		return
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "node_snapshotted", models.StatusStopping,
+		"Node snapshot taken before deletion",
+		map[string]interface{}{
+			"snapshot_id":  ns.ID,
+			"snapshot_ref": info.SnapshotID,
+			"expires_at":   ns.ExpiresAt.Format(time.RFC3339),
+		})
+}
+
+// restoreSnapshotCredentials fills in node credentials missing from a restored node
+func restoreSnapshotCredentials(node *client.NodeInfo, snapshot *models.NodeSnapshot) {
+	if node.NodeAPIKey == "" && snapshot.APIKey != nil {
+		node.NodeAPIKey = *snapshot.APIKey
+	}
+	if node.PublicKey == "" && snapshot.PublicKey != nil {
+		node.PublicKey = *snapshot.PublicKey
+	}
+	if node.ShortID == "" && snapshot.ShortID != nil {
+		node.ShortID = *snapshot.ShortID
+	}
+}
 
-	// Notify subscription-service（携带 reason，让 subscription-service 区分用户主动删除和订阅取消）
-	if err := s.subscriptionClient.NotifyDeleted(ctx, hp.SubscriptionID, hp.ID, reason); err != nil {
-		log.Printf("[Deprovision] Failed to notify subscription-service (deleted): %v", err)
+// DeleteExpiredSnapshots deletes snapshots past their retention window
+func (s *ProvisionService) DeleteExpiredSnapshots(ctx context.Context) {
+	snapshots, err := s.snapshotRepo.ListExpired(ctx, 20)
+	if err != nil {
+		log.Printf("[Snapshot] Failed to list expired snapshots: %v", err)
+		return
 	}
 
-	log.Printf("[Deprovision] Resource %s successfully deprovisioned (reason: %s)", hp.ID, reason)
+	for _, ns := range snapshots {
+		if err := s.hostingClient.DeleteSnapshot(ctx, ns.SnapshotRef); err != nil {
+			log.Printf("[Snapshot] Failed to delete snapshot %s: %v", ns.SnapshotRef, err)
+			continue
+		}
+		if err := s.snapshotRepo.MarkDeleted(ctx, ns.ID); err != nil {
+			log.Printf("[Snapshot] Failed to mark snapshot %s deleted: %v", ns.ID, err)
+			continue
+		}
+		log.Printf("[Snapshot] Deleted expired snapshot %s (provision=%s)", ns.SnapshotRef, ns.HostingProvisionID)
+	}
 }
 
 // GetResourceStatus gets the status of a hosting provision
@@ -371,6 +1015,25 @@ func (s *ProvisionService) GetUserNodeStatus(ctx context.Context, userID string)
 	// 3. Build response
 	resp := &models.UserNodeStatusResponse{}
 
+	if (subStatus == nil || !subStatus.HasActive) && nodeErr == nil && hp.SuspendedAt != nil &&
+		(hp.Status == models.StatusStopped || hp.Status == models.StatusStopping || hp.Status == models.StatusActive) {
+		// 订阅失效但节点仍在宽限期内：提示续费以保留节点
+		resp.HostingStatus = models.HostingStatusNodeSuspended
+		resp.HasNode = true
+		resp.Node = &models.UserNodeInfo{
+			ResourceID:     hp.ID,
+			Region:         hp.Region,
+			RegionName:     hp.Region,
+			Status:         hp.Status,
+			PublicIP:       hp.PublicIP,
+			PlanTier:       hp.PlanTier,
+			CreatedAt:      hp.CreatedAt.Format(time.RFC3339),
+			SuspendedUntil: hp.SuspendUntil.Format(time.RFC3339),
+		}
+		resp.Message = "Your subscription has lapsed. Renew before the node is deleted to keep it."
+		return resp, nil
+	}
+
 	if subStatus == nil || !subStatus.HasActive {
 		resp.HostingStatus = models.HostingStatusNoSubscription
 		resp.HasSubscription = false
@@ -410,6 +1073,7 @@ func (s *ProvisionService) GetUserNodeStatus(ctx context.Context, userID string)
 		trafficPercent = (float64(hp.TrafficUsed) / float64(hp.TrafficLimit)) * 100
 	}
 
+	s.openCredentials(hp)
 	resp.Node = &models.UserNodeInfo{
 		ResourceID:     hp.ID,
 		Region:         hp.Region,
@@ -432,14 +1096,44 @@ func (s *ProvisionService) GetUserNodeStatus(ctx context.Context, userID string)
 	switch hp.Status {
 	case models.StatusPending, models.StatusCreating, models.StatusRunning, models.StatusInstalling:
 		resp.HostingStatus = models.HostingStatusNodeCreating
-		resp.CreationProgress = s.buildCreationProgress(hp.Status)
+		resp.CreationProgress = s.buildCreationProgress(hp.ID, hp.Status)
 		resp.Message = "Node is being created. Please wait..."
 	case models.StatusActive:
 		resp.HostingStatus = models.HostingStatusNodeActive
 		resp.Message = "Node is active and ready to use."
+		resp.Node.Health = &models.NodeHealthInfo{
+			Status:              hp.HealthStatus,
+			ConsecutiveFailures: max(hp.ProbeFailures, hp.ExternalProbeFailures),
+		}
+		if hp.LastProbedAt != nil {
+			resp.Node.Health.LastProbedAt = hp.LastProbedAt.Format(time.RFC3339)
+		}
+		switch hp.HealthStatus {
+		case models.NodeHealthDegraded:
+			resp.Message = "Node is not responding. Try restarting it."
+		case models.NodeHealthBlocked:
+			resp.Message = "Node appears to be blocked in your region. Try changing its IP."
+		}
 	case models.StatusFailed:
 		resp.HostingStatus = models.HostingStatusNodeFailed
 		resp.Message = "Node creation failed. You can delete and recreate the node."
+	case models.StatusStopped:
+		if hp.SuspendedAt == nil {
+			resp.HostingStatus = models.HostingStatusNodeStopped
+			resp.Message = "Node is stopped. Start it to use it again."
+			break
+		}
+		resp.HostingStatus = models.HostingStatusNodeSuspended
+		if hp.SuspendUntil != nil {
+			resp.Node.SuspendedUntil = hp.SuspendUntil.Format(time.RFC3339)
+		}
+		resp.Message = "Node is suspended and will resume once the subscription is reactivated."
+	case models.StatusRebooting, models.StatusStarting, models.StatusStopping:
+		resp.HostingStatus = models.HostingStatusNodeRestarting
+		resp.Message = fmt.Sprintf("Node is %s. Please wait...", hp.Status)
+	case models.StatusReplacing:
+		resp.HostingStatus = models.HostingStatusNodeRestarting
+		resp.Message = "Node was unreachable and is being replaced automatically. Please wait..."
 	default:
 		resp.HostingStatus = models.HostingStatusSubscribedNoNode
 		resp.HasNode = false
@@ -450,7 +1144,7 @@ func (s *ProvisionService) GetUserNodeStatus(ctx context.Context, userID string)
 	return resp, nil
 }
 
-func (s *ProvisionService) buildCreationProgress(status string) *models.NodeCreationProgress {
+func (s *ProvisionService) buildCreationProgress(resourceID, status string) *models.NodeCreationProgress {
 	steps := []models.NodeCreationStep{
 		{Step: 1, Name: "Payment confirmed", Status: "completed"},
 		{Step: 2, Name: "VPS creating", Status: "pending"},
@@ -490,12 +1184,20 @@ func (s *ProvisionService) buildCreationProgress(status string) *models.NodeCrea
 		}
 	}
 
-	return &models.NodeCreationProgress{
+	progress := &models.NodeCreationProgress{
 		CurrentStep: currentStep,
 		TotalSteps:  4,
 		StepName:    stepName,
 		Steps:       steps,
 	}
+
+	// 等待创建名额：显示队列位置和预计等待时间
+	if position, wait, ok := s.createQueue.Position(resourceID); ok {
+		progress.StepName = "Waiting in queue"
+		progress.QueuePosition = position
+		progress.EstimatedWaitSeconds = int(wait.Seconds())
+	}
+	return progress
 }
 
 // GetAvailableRegions gets available regions
@@ -520,6 +1222,10 @@ func (s *ProvisionService) GetAvailableRegions(ctx context.Context) (*models.Reg
 
 // CreateUserNode creates a node for a user after verifying subscription
 func (s *ProvisionService) CreateUserNode(ctx context.Context, userID, region string) (*models.CreateNodeResponse, error) {
+	// 未指定区域时使用默认区域，与 provision() 一致（快照区域比对依赖这里）
+	if region == "" {
+		region = s.cfg.Hosting.DefaultRegion
+	}
 	log.Printf("[CreateUserNode] Creating node for user=%s, region=%s", userID, region)
 
 	subStatus, err := s.subscriptionClient.GetUserHostingSubscription(ctx, userID)
@@ -554,7 +1260,7 @@ func (s *ProvisionService) CreateUserNode(ctx context.Context, userID, region st
 				Success:          true,
 				ResourceID:       existing.ID,
 				Status:           "creating",
-				CreationProgress: s.buildCreationProgress(existing.Status),
+				CreationProgress: s.buildCreationProgress(existing.ID, existing.Status),
 				Message:          "Node is already being created. Please wait.",
 			}, nil
 		case models.StatusFailed:
@@ -574,7 +1280,21 @@ func (s *ProvisionService) CreateUserNode(ctx context.Context, userID, region st
 		TrafficLimit:   s.getTrafficLimit(subStatus.PlanTier),
 	}
 
-	resp, err := s.Provision(ctx, provisionReq)
+	// 保留期内有同区域快照时从快照恢复（保留 Reality 密钥和节点配置）
+	snapshot, _ := s.snapshotRepo.GetLatestAvailableByUser(ctx, userID)
+	if snapshot != nil && snapshot.Region != region {
+		log.Printf("[CreateUserNode] Snapshot %s is in %s, requested %s: creating a fresh node",
+			snapshot.ID, snapshot.Region, region)
+		snapshot = nil
+	}
+	if snapshot != nil {
+		if err := s.snapshotRepo.OpenCredentials(snapshot); err != nil {
+			// 快照凭据无法解密时仍可恢复，节点凭据以 hosting-service 回报的为准
+			log.Printf("[CreateUserNode] Failed to decrypt credentials of snapshot %s: %v", snapshot.ID, err)
+		}
+	}
+
+	resp, err := s.provision(ctx, provisionReq, snapshot, PriorityRecreate)
 	if err != nil {
 		return &models.CreateNodeResponse{
 			Success: false,
@@ -583,12 +1303,17 @@ func (s *ProvisionService) CreateUserNode(ctx context.Context, userID, region st
 		}, nil
 	}
 
+	message := "Node creation started. This may take a few minutes."
+	if resp.Message == msgRestoringSnapshot {
+		message = "Restoring your previous node from snapshot. This may take a few minutes."
+	}
+
 	return &models.CreateNodeResponse{
 		Success:          true,
 		ResourceID:       resp.ResourceID,
 		Status:           "creating",
-		CreationProgress: s.buildCreationProgress(models.StatusPending),
-		Message:          "Node creation started. This may take a few minutes.",
+		CreationProgress: s.buildCreationProgress(resp.ResourceID, models.StatusPending),
+		Message:          message,
 	}, nil
 }
 
@@ -625,6 +1350,7 @@ func (s *ProvisionService) DeleteUserNode(ctx context.Context, userID string) (*
 		SubscriptionID: subscriptionID,
 		ResourceID:     hp.ID,
 		Reason:         "User initiated deletion",
+		Immediate:      true,
 	})
 	if err != nil {
 		return &models.DeleteNodeResponse{
@@ -639,6 +1365,557 @@ func (s *ProvisionService) DeleteUserNode(ctx context.Context, userID string) (*
 	}, nil
 }
 
+// RotateUserNodeCredentials regenerates credentials for the user's active node
+// 用户分享过节点配置后可以借此切断他人访问，无需重建 VPS
+func (s *ProvisionService) RotateUserNodeCredentials(ctx context.Context, userID string) (*models.RotateCredentialsResponse, error) {
+	log.Printf("[RotateCredentials] Rotating node credentials for user=%s", userID)
+
+	hp, err := s.hostingRepo.GetActiveByUser(ctx, userID)
+	if err != nil || hp == nil {
+		return &models.RotateCredentialsResponse{
+			Success: false,
+			Message: "No node found.",
+		}, nil
+	}
+
+	return s.rotateCredentials(ctx, hp, "user")
+}
+
+// RotateResourceCredentials regenerates credentials for a hosting provision (admin/internal)
+func (s *ProvisionService) RotateResourceCredentials(ctx context.Context, resourceID string) (*models.RotateCredentialsResponse, error) {
+	log.Printf("[RotateCredentials] Rotating node credentials for resource=%s", resourceID)
+
+	hp, err := s.hostingRepo.GetByID(ctx, resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("get hosting provision: %w", err)
+	}
+
+	return s.rotateCredentials(ctx, hp, "admin")
+}
+
+func (s *ProvisionService) rotateCredentials(ctx context.Context, hp *models.HostingProvision, initiatedBy string) (*models.RotateCredentialsResponse, error) {
+	if hp.Status != models.StatusActive || hp.HostingNodeID == "" {
+		return &models.RotateCredentialsResponse{
+			Success:    false,
+			ResourceID: hp.ID,
+			Message:    "Credentials can only be rotated while the node is active.",
+		}, nil
+	}
+
+	overlap := time.Duration(s.cfg.Node.CredentialOverlapMinutes) * time.Minute
+	node, err := s.hostingClient.RotateNodeCredentials(ctx, hp.HostingNodeID, &client.RotateCredentialsRequest{
+		OldKeyTTLSeconds: int(overlap.Seconds()),
+	})
+	if err != nil {
+		s.logRepo.LogAction(ctx, hp.ID, "hosting", "credentials_rotate_failed", hp.Status, err.Error())
+		return nil, fmt.Errorf("rotate node credentials via hosting-service: %w", err)
+	}
+
+	s.openCredentials(hp)
+	oldKeyValidUntil := time.Now().Add(overlap)
+	if err := s.hostingRepo.UpdateCredentials(ctx, hp.ID, node.NodeAPIKey, node.PublicKey, node.ShortID, hp.APIKey, oldKeyValidUntil); err != nil {
+		return nil, fmt.Errorf("save rotated credentials: %w", err)
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "credentials_rotated", hp.Status,
+		"Node credentials rotated",
+		map[string]interface{}{
+			"initiated_by":        initiatedBy,
+			"old_key_valid_until": oldKeyValidUntil.Format(time.RFC3339),
+		})
+
+	if err := s.subscriptionClient.NotifyCredentialsRotated(ctx, hp.SubscriptionID, hp.ID); err != nil {
+		log.Printf("[RotateCredentials] Failed to notify subscription-service (credentials_rotated): %v", err)
+	}
+
+	log.Printf("[RotateCredentials] Credentials rotated for resource %s (old key valid until %s)",
+		hp.ID, oldKeyValidUntil.Format(time.RFC3339))
+
+	return &models.RotateCredentialsResponse{
+		Success:          true,
+		ResourceID:       hp.ID,
+		APIKey:           &node.NodeAPIKey,
+		PublicKey:        &node.PublicKey,
+		ShortID:          &node.ShortID,
+		OldKeyValidUntil: oldKeyValidUntil.Format(time.RFC3339),
+		Message:          "Node credentials rotated. Please update your client configuration.",
+	}, nil
+}
+
+// ChangeUserNodeIP swaps the public IP of the user's node, subject to the monthly quota
+// IP 被封锁时使用，节点和密钥保持不变，无需删除重建
+func (s *ProvisionService) ChangeUserNodeIP(ctx context.Context, userID, reason string) (*models.ChangeIPResponse, error) {
+	log.Printf("[ChangeIP] Changing node IP for user=%s", userID)
+
+	hp, err := s.hostingRepo.GetActiveByUser(ctx, userID)
+	if err != nil || hp == nil {
+		return &models.ChangeIPResponse{
+			Success: false,
+			Message: "No node found.",
+		}, nil
+	}
+
+	return s.changeIP(ctx, hp, reason, "user", s.cfg.Hosting.IPChangeLimitFor(hp.PlanTier))
+}
+
+// ChangeResourceIP swaps the public IP of a hosting provision (admin/internal, not counted against the quota)
+func (s *ProvisionService) ChangeResourceIP(ctx context.Context, resourceID, reason string) (*models.ChangeIPResponse, error) {
+	log.Printf("[ChangeIP] Changing node IP for resource=%s", resourceID)
+
+	hp, err := s.hostingRepo.GetByID(ctx, resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("get hosting provision: %w", err)
+	}
+
+	return s.changeIP(ctx, hp, reason, "admin", -1)
+}
+
+// changeIP swaps the node IP; limit < 0 means not counted against the monthly quota
+// 调用 hosting-service 前先预留配额记录（统计与预留在同一事务），更换失败时释放
+func (s *ProvisionService) changeIP(ctx context.Context, hp *models.HostingProvision, reason, initiatedBy string, limit int) (*models.ChangeIPResponse, error) {
+	if hp.Status != models.StatusActive || hp.HostingNodeID == "" {
+		return &models.ChangeIPResponse{
+			Success:    false,
+			ResourceID: hp.ID,
+			Message:    "The IP can only be changed while the node is active.",
+		}, nil
+	}
+
+	// 配额按自然月（UTC）计算
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	oldIP := hp.PublicIP
+	change := &models.NodeIPChange{
+		ID:                 uuid.New().String(),
+		HostingProvisionID: hp.ID,
+		UserID:             hp.UserID,
+		HostingNodeID:      hp.HostingNodeID,
+		OldIP:              oldIP,
+		Reason:             reason,
+		InitiatedBy:        initiatedBy,
+	}
+	used, err := s.ipChangeRepo.Reserve(ctx, change, monthStart, limit)
+	if errors.Is(err, repository.ErrIPChangeQuotaExceeded) {
+		return &models.ChangeIPResponse{
+			Success:      false,
+			ResourceID:   hp.ID,
+			ChangesUsed:  used,
+			ChangesLimit: limit,
+			Message: fmt.Sprintf("Monthly IP change limit reached (%d/%d). The quota resets on %s.",
+				used, limit, monthStart.AddDate(0, 1, 0).Format("2006-01-02")),
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reserve IP change: %w", err)
+	}
+	release := func() {
+		if err := s.ipChangeRepo.Release(context.WithoutCancel(ctx), change.ID); err != nil {
+			log.Printf("[ChangeIP] Failed to release reserved IP change %s: %v", change.ID, err)
+		}
+	}
+
+	node, err := s.hostingClient.ChangeNodeIP(ctx, hp.HostingNodeID)
+	if err != nil {
+		release()
+		s.logRepo.LogAction(ctx, hp.ID, "hosting", "ip_change_failed", hp.Status, err.Error())
+		return nil, fmt.Errorf("change node IP via hosting-service: %w", err)
+	}
+	if node.PublicIP == "" || (hp.PublicIP != nil && *hp.PublicIP == node.PublicIP) {
+		release()
+		s.logRepo.LogAction(ctx, hp.ID, "hosting", "ip_change_failed", hp.Status, "hosting-service returned no new IP")
+		return nil, fmt.Errorf("hosting-service returned no new IP for node %s", hp.HostingNodeID)
+	}
+
+	// IP 已经更换，之后的失败不再释放配额
+	if err := s.ipChangeRepo.Complete(ctx, change.ID, node.PublicIP); err != nil {
+		log.Printf("[ChangeIP] Failed to record new IP of change %s: %v", change.ID, err)
+	}
+	if err := s.hostingRepo.UpdatePublicIP(ctx, hp.ID, node.PublicIP); err != nil {
+		return nil, fmt.Errorf("save new public IP: %w", err)
+	}
+
+	previousIP := ""
+	if oldIP != nil {
+		previousIP = *oldIP
+	}
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "ip_changed", hp.Status,
+		fmt.Sprintf("Public IP changed to %s", node.PublicIP),
+		map[string]interface{}{
+			"old_ip":       previousIP,
+			"new_ip":       node.PublicIP,
+			"initiated_by": initiatedBy,
+			"reason":       reason,
+		})
+
+	// 连接信息变化，按 active 回调重新下发给 subscription-service
+	callback := &models.NodeReadyCallback{
+		ResourceID: hp.ID,
+		PublicIP:   node.PublicIP,
+		APIPort:    hp.APIPort,
+		VlessPort:  hp.VlessPort,
+		SSPort:     hp.SSPort,
+	}
+	s.openCredentials(hp)
+	if hp.APIKey != nil {
+		callback.APIKey = *hp.APIKey
+	}
+	if hp.PublicKey != nil {
+		callback.PublicKey = *hp.PublicKey
+	}
+	if hp.ShortID != nil {
+		callback.ShortID = *hp.ShortID
+	}
+	if err := s.subscriptionClient.NotifyActive(ctx, hp.SubscriptionID, hp.ID, callback); err != nil {
+		log.Printf("[ChangeIP] Failed to notify subscription-service (active): %v", err)
+	}
+
+	log.Printf("[ChangeIP] Resource %s IP changed %s -> %s", hp.ID, previousIP, node.PublicIP)
+
+	resp := &models.ChangeIPResponse{
+		Success:    true,
+		ResourceID: hp.ID,
+		PublicIP:   node.PublicIP,
+		PreviousIP: previousIP,
+		Message:    "Node IP changed. Please update your client configuration.",
+	}
+	if limit >= 0 {
+		resp.ChangesUsed = used + 1
+		resp.ChangesLimit = limit
+	}
+	return resp, nil
+}
+
+// MarkNodeDegraded marks an active node unhealthy after the node agent reports a failure
+func (s *ProvisionService) MarkNodeDegraded(ctx context.Context, hp *models.HostingProvision, reason string) {
+	s.markDegraded(ctx, hp, "node-agent", reason, false)
+}
+
+// MarkHostingFailed marks an active node unhealthy after hosting-service reports it failed.
+// The node stays degraded while hosting-service reports it, whatever the TCP probes say.
+func (s *ProvisionService) MarkHostingFailed(ctx context.Context, hp *models.HostingProvision, reason string) {
+	s.markDegraded(ctx, hp, "hosting-service", reason, true)
+}
+
+func (s *ProvisionService) markDegraded(ctx context.Context, hp *models.HostingProvision, source, reason string, hostingFailed bool) {
+	previous, err := s.hostingRepo.MarkDegraded(ctx, hp.ID, hostingFailed)
+	if err != nil {
+		log.Printf("[AutoHeal] Failed to mark %s degraded: %v", hp.ID, err)
+		return
+	}
+	if previous == models.NodeHealthDegraded {
+		return
+	}
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "node_health_changed", hp.Status,
+		fmt.Sprintf("Node health changed from %s to %s", previous, models.NodeHealthDegraded),
+		map[string]interface{}{
+			"from":   previous,
+			"to":     models.NodeHealthDegraded,
+			"source": source,
+			"reason": reason,
+		})
+	log.Printf("[AutoHeal] Resource %s marked degraded: %s", hp.ID, reason)
+}
+
+// ReplaceNode replaces an unhealthy node with a new one in the same region
+// provision 记录（resource_id）保持不变，只切换 hosting_node_id；替换失败时原节点保留
+func (s *ProvisionService) ReplaceNode(ctx context.Context, hp *models.HostingProvision, reason string) error {
+	if err := s.hostingRepo.TransitionStatus(ctx, hp.ID, models.StatusActive, models.StatusReplacing); err != nil {
+		return err
+	}
+
+	nr := &models.NodeReplacement{
+		ID:                 uuid.New().String(),
+		HostingProvisionID: hp.ID,
+		UserID:             hp.UserID,
+		Region:             hp.Region,
+		OldNodeID:          hp.HostingNodeID,
+		Reason:             reason,
+		Status:             models.ReplacementStatusInProgress,
+	}
+	if err := s.replacementRepo.Create(ctx, nr); err != nil {
+		s.hostingRepo.TransitionStatus(ctx, hp.ID, models.StatusReplacing, models.StatusActive)
+		return err
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "node_replacing", models.StatusReplacing,
+		fmt.Sprintf("Replacing unhealthy node. Reason: %s", reason),
+		map[string]interface{}{
+			"old_node_id":    hp.HostingNodeID,
+			"replacement_id": nr.ID,
+		})
+
+	go s.replaceAsync(hp, nr)
+	return nil
+}
+
+// replaceAsync creates the replacement node, swaps the linkage and deletes the broken instance
+func (s *ProvisionService) replaceAsync(hp *models.HostingProvision, nr *models.NodeReplacement) {
+	ctx := context.Background()
+
+	fail := func(errMsg string) {
+		log.Printf("[AutoHeal] Replacement of %s failed: %s", hp.ID, errMsg)
+		s.replacementRepo.MarkFailed(ctx, nr.ID, errMsg)
+		if err := s.hostingRepo.TransitionStatus(ctx, hp.ID, models.StatusReplacing, models.StatusActive); err != nil {
+			log.Printf("[AutoHeal] Failed to restore status of %s: %v", hp.ID, err)
+		}
+		s.logRepo.LogAction(ctx, hp.ID, "hosting", "node_replace_failed", models.StatusActive, errMsg)
+	}
+
+	release, err := s.createQueue.Acquire(ctx, hp.ID, PriorityRecreate, s.cfg.Hosting.CloudProvider, hp.Region)
+	if err != nil {
+		fail(fmt.Sprintf("wait for create slot: %v", err))
+		return
+	}
+	defer release()
+
+	createResp, err := s.hostingClient.CreateNode(ctx, &client.CreateNodeRequest{
+		CloudProvider:  s.cfg.Hosting.CloudProvider,
+		Region:         hp.Region,
+		BundleID:       s.getBundleID(hp.PlanTier),
+		SubscriptionID: hp.SubscriptionID,
+		UserID:         hp.UserID,
+		ReuseKeysFrom:  hp.HostingNodeID,
+		CallbackToken:  s.callbackTokenOf(ctx, hp.ID),
+	})
+	if err != nil {
+		fail(fmt.Sprintf("create replacement node: %v", err))
+		return
+	}
+	newNodeID := createResp.NodeID
+	s.replacementRepo.SetNewNode(ctx, nr.ID, newNodeID)
+
+	node, err := s.nodeEvents.WaitForNodeReady(ctx, newNodeID, 10*time.Minute)
+	if err != nil {
+		s.deleteReplacementNode(ctx, hp.ID, newNodeID)
+		fail(fmt.Sprintf("wait for replacement node ready: %v", err))
+		return
+	}
+
+	oldNodeID := hp.HostingNodeID
+	oldIP := hp.PublicIP
+	keysCarriedOver := hp.PublicKey != nil && *hp.PublicKey == node.PublicKey
+
+	// 切换到新节点：仅当状态仍为 replacing，期间被删除或暂停时新节点不再需要
+	publicIP := node.PublicIP
+	apiKey := node.NodeAPIKey
+	publicKey := node.PublicKey
+	shortID := node.ShortID
+	swapped := *hp
+	swapped.HostingNodeID = newNodeID
+	swapped.PublicIP = &publicIP
+	swapped.APIKey = &apiKey
+	swapped.VlessPort = node.VLESSPort
+	swapped.SSPort = node.SSPort
+	swapped.PublicKey = &publicKey
+	swapped.ShortID = &shortID
+	if err := s.hostingRepo.SwapNode(ctx, &swapped); err != nil {
+		s.deleteReplacementNode(ctx, hp.ID, newNodeID)
+		if errors.Is(err, repository.ErrNotFound) {
+			s.replacementRepo.MarkFailed(ctx, nr.ID, "provision changed during replacement")
+			return
+		}
+		fail(fmt.Sprintf("swap provision to replacement node: %v", err))
+		return
+	}
+
+	// 删除故障实例；失败时原节点已无 provision 引用，由 CleanupScheduler 作为孤立节点清理
+	if _, err := s.hostingClient.DeleteNode(ctx, oldNodeID); err != nil {
+		log.Printf("[AutoHeal] WARN: failed to delete broken node %s: %v", oldNodeID, err)
+	}
+
+	s.replacementRepo.MarkCompleted(ctx, nr.ID)
+
+	previousIP := ""
+	if oldIP != nil {
+		previousIP = *oldIP
+	}
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "node_replaced", models.StatusActive,
+		fmt.Sprintf("Node replaced, now active at %s", node.PublicIP),
+		map[string]interface{}{
+			"old_node_id":       oldNodeID,
+			"new_node_id":       newNodeID,
+			"old_ip":            previousIP,
+			"new_ip":            node.PublicIP,
+			"keys_carried_over": keysCarriedOver,
+		})
+
+	// 连接信息变化，按 active 回调重新下发
+	callback := &models.NodeReadyCallback{
+		ResourceID: hp.ID,
+		PublicIP:   node.PublicIP,
+		APIPort:    hp.APIPort,
+		APIKey:     node.NodeAPIKey,
+		VlessPort:  node.VLESSPort,
+		SSPort:     node.SSPort,
+		PublicKey:  node.PublicKey,
+		ShortID:    node.ShortID,
+	}
+	if err := s.subscriptionClient.NotifyActive(ctx, hp.SubscriptionID, hp.ID, callback); err != nil {
+		log.Printf("[AutoHeal] Failed to notify subscription-service (active): %v", err)
+	}
+
+	log.Printf("[AutoHeal] Resource %s replaced node %s -> %s (keys carried over: %v)", hp.ID, oldNodeID, newNodeID, keysCarriedOver)
+}
+
+// deleteReplacementNode removes a replacement node that will not be used
+// 删除失败时按节点 id 排队，由 CleanupScheduler 重试删除（与 createNodeIn 一致）
+func (s *ProvisionService) deleteReplacementNode(ctx context.Context, provisionID, nodeID string) {
+	if _, err := s.hostingClient.DeleteNode(ctx, nodeID); err != nil {
+		log.Printf("[AutoHeal] WARN: failed to cleanup replacement node %s: %v (queued for CleanupScheduler)", nodeID, err)
+		if err := s.hostingRepo.QueueNodeCleanup(ctx, provisionID, nodeID); err != nil {
+			log.Printf("[AutoHeal] Failed to queue cleanup of node %s: %v", nodeID, err)
+		}
+	}
+}
+
+// nodeTransition describes the status flow of a node power action
+type nodeTransition struct {
+	from    string // 允许发起操作的状态
+	pending string // 操作进行中的状态
+	done    string // 操作完成后的状态
+	event   string // 完成后写入 provision timeline 的 action
+}
+
+var nodeActionTransitions = map[string]nodeTransition{
+	models.NodeActionReboot: {from: models.StatusActive, pending: models.StatusRebooting, done: models.StatusActive, event: "node_rebooted"},
+	models.NodeActionStop:   {from: models.StatusActive, pending: models.StatusStopping, done: models.StatusStopped, event: "node_stopped"},
+	models.NodeActionStart:  {from: models.StatusStopped, pending: models.StatusStarting, done: models.StatusActive, event: "node_started"},
+}
+
+// NodeAction reboots, stops or starts the user's node via hosting-service
+// 状态先切到中间态（rebooting/stopping/starting），后台完成后再切到目标状态；失败时回退
+func (s *ProvisionService) NodeAction(ctx context.Context, userID, action string) (*models.NodeActionResponse, error) {
+	t, ok := nodeActionTransitions[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown node action: %s", action)
+	}
+
+	log.Printf("[NodeAction] %s node for user=%s", action, userID)
+
+	hp, err := s.hostingRepo.GetActiveByUser(ctx, userID)
+	if err != nil || hp == nil || hp.HostingNodeID == "" {
+		return &models.NodeActionResponse{
+			Success: false,
+			Action:  action,
+			Message: "No node found.",
+		}, nil
+	}
+
+	if hp.SuspendedAt != nil {
+		return &models.NodeActionResponse{
+			Success:    false,
+			ResourceID: hp.ID,
+			Action:     action,
+			Status:     hp.Status,
+			Message:    "Node is suspended. Renew your subscription to resume it.",
+		}, nil
+	}
+
+	busy := &models.NodeActionResponse{
+		Success:    false,
+		ResourceID: hp.ID,
+		Action:     action,
+		Status:     hp.Status,
+		Message:    fmt.Sprintf("Cannot %s node while it is %s.", action, hp.Status),
+	}
+	if hp.Status != t.from {
+		return busy, nil
+	}
+	if err := s.hostingRepo.TransitionStatus(ctx, hp.ID, t.from, t.pending); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return busy, nil // 并发操作已改变状态
+		}
+		return nil, err
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, hp.ID, "hosting", "node_"+action+"_requested", t.pending,
+		fmt.Sprintf("Node %s requested", action),
+		map[string]interface{}{
+			"initiated_by": "user",
+		})
+
+	go s.nodeActionAsync(hp, action, t)
+
+	return &models.NodeActionResponse{
+		Success:    true,
+		ResourceID: hp.ID,
+		Action:     action,
+		Status:     t.pending,
+		Message:    fmt.Sprintf("Node %s started. This usually takes a minute or two.", action),
+	}, nil
+}
+
+// nodeActionAsync performs the power action and waits for the node to settle
+func (s *ProvisionService) nodeActionAsync(hp *models.HostingProvision, action string, t nodeTransition) {
+	ctx := context.Background()
+
+	var node *client.NodeInfo
+	var err error
+	switch action {
+	case models.NodeActionReboot:
+		node, err = s.hostingClient.RebootNode(ctx, hp.HostingNodeID)
+	case models.NodeActionStop:
+		node, err = s.hostingClient.StopNode(ctx, hp.HostingNodeID)
+	case models.NodeActionStart:
+		node, err = s.hostingClient.StartNode(ctx, hp.HostingNodeID)
+	}
+	if err == nil && t.done == models.StatusActive {
+		node, err = s.nodeEvents.WaitForNodeReady(ctx, hp.HostingNodeID, 5*time.Minute)
+	}
+
+	if err != nil {
+		log.Printf("[NodeAction] %s failed for resource %s: %v", action, hp.ID, err)
+		if tErr := s.hostingRepo.TransitionStatus(ctx, hp.ID, t.pending, t.from); tErr != nil {
+			log.Printf("[NodeAction] Failed to restore status of %s: %v", hp.ID, tErr)
+		}
+		s.logRepo.LogAction(ctx, hp.ID, "hosting", "node_"+action+"_failed", t.from, err.Error())
+		return
+	}
+
+	// 只在状态仍为中间态时完成操作；期间被删除或暂停时状态已由对应流程接管
+	if err := s.hostingRepo.TransitionStatus(ctx, hp.ID, t.pending, t.done); err != nil {
+		log.Printf("[NodeAction] Failed to update status of %s after %s: %v", hp.ID, action, err)
+		return
+	}
+	if node != nil && node.PublicIP != "" && (hp.PublicIP == nil || *hp.PublicIP != node.PublicIP) {
+		// 非静态 IP 开机后可能变化
+		if err := s.hostingRepo.UpdatePublicIP(ctx, hp.ID, node.PublicIP); err != nil {
+			log.Printf("[NodeAction] Failed to save new public IP of %s: %v", hp.ID, err)
+		}
+	}
+
+	s.logRepo.LogAction(ctx, hp.ID, "hosting", t.event, t.done, fmt.Sprintf("Node %s completed", action))
+	log.Printf("[NodeAction] %s completed for resource %s", action, hp.ID)
+}
+
+// GetUserNodeTimeline returns recent provision log events of the user's node
+func (s *ProvisionService) GetUserNodeTimeline(ctx context.Context, userID string, limit int) (*models.NodeTimelineResponse, error) {
+	hp, err := s.hostingRepo.GetLatestByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := s.logRepo.GetByProvisionID(ctx, hp.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.NodeTimelineResponse{
+		ResourceID: hp.ID,
+		Events:     make([]models.NodeTimelineEntry, 0, len(logs)),
+	}
+	for _, l := range logs {
+		resp.Events = append(resp.Events, models.NodeTimelineEntry{
+			Action:    l.Action,
+			Status:    l.Status,
+			Message:   l.Message,
+			Metadata:  l.Metadata,
+			CreatedAt: l.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
+
 // Helper functions
 
 func (s *ProvisionService) updateStatus(ctx context.Context, provisionID, status string, errorMsg *string) {
@@ -686,6 +1963,7 @@ func (s *ProvisionService) getTrafficLimit(planTier string) int64 {
 }
 
 func (s *ProvisionService) hostingToStatusResponse(hp *models.HostingProvision) *models.ResourceStatusResponse {
+	s.openCredentials(hp)
 	trafficLimitGB := float64(hp.TrafficLimit) / (1024 * 1024 * 1024)
 	trafficUsedGB := float64(hp.TrafficUsed) / (1024 * 1024 * 1024)
 	trafficPercent := 0.0
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// SecretReencryptScheduler 节点凭据重新加密任务
+// 将升级前的明文凭据和旧版本主密钥加密的凭据用当前主密钥重新加密，完成后即可从 ENCRYPTION_OLD_KEYS 移除旧密钥
+type SecretReencryptScheduler struct {
+	hostingRepo  *repository.HostingProvisionRepository
+	snapshotRepo *repository.NodeSnapshotRepository
+	interval     time.Duration
+}
+
+// NewSecretReencryptScheduler 创建重新加密调度器
+func NewSecretReencryptScheduler(hostingRepo *repository.HostingProvisionRepository, snapshotRepo *repository.NodeSnapshotRepository, interval time.Duration) *SecretReencryptScheduler {
+	return &SecretReencryptScheduler{
+		hostingRepo:  hostingRepo,
+		snapshotRepo: snapshotRepo,
+		interval:     interval,
+	}
+}
+
+// Start 启动调度器（阻塞运行，应在 goroutine 中调用）
+func (s *SecretReencryptScheduler) Start(ctx context.Context) {
+	log.Printf("[SecretReencryptScheduler] Started (interval=%v)", s.interval)
+
+	// 启动时立即执行一次，密钥轮换后尽快完成重新加密
+	s.run(ctx)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[SecretReencryptScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.run(ctx)
+		}
+	}
+}
+
+func (s *SecretReencryptScheduler) run(ctx context.Context) {
+	for name, reseal := range map[string]func(context.Context) (int, int, error){
+		"hosting_provisions": s.hostingRepo.ResealSecrets,
+		"node_snapshots":     s.snapshotRepo.ResealSecrets,
+	} {
+		resealed, failed, err := reseal(ctx)
+		if err != nil {
+			log.Printf("[SecretReencryptScheduler] Failed to re-encrypt %s: %v", name, err)
+		}
+		if resealed > 0 || failed > 0 {
+			log.Printf("[SecretReencryptScheduler] %s: re-encrypted %d rows, %d could not be decrypted", name, resealed, failed)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// SuspensionScheduler 暂停节点到期删除任务
+// 订阅失效后停机保留的节点，宽限期过后仍未恢复则删除；停机中断的节点重新停机
+type SuspensionScheduler struct {
+	provisionService *ProvisionService
+	interval         time.Duration
+}
+
+// NewSuspensionScheduler 创建暂停节点清理调度器
+func NewSuspensionScheduler(provisionService *ProvisionService, interval time.Duration) *SuspensionScheduler {
+	return &SuspensionScheduler{
+		provisionService: provisionService,
+		interval:         interval,
+	}
+}
+
+// Start 启动调度器（阻塞运行，应在 goroutine 中调用）
+func (s *SuspensionScheduler) Start(ctx context.Context) {
+	log.Printf("[SuspensionScheduler] Started (interval=%v)", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[SuspensionScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.provisionService.RetryStuckSuspensions(ctx)
+			s.provisionService.DeleteExpiredSuspensions(ctx)
+		}
+	}
+}
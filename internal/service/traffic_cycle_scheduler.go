@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// TrafficCycleScheduler 长周期套餐的流量周期重置任务
+// 定时扫描周期已结束的 VPN provision，归档用量并清零 otun-manager 中的 traffic_used
+type TrafficCycleScheduler struct {
+	vpnRepo    *repository.VPNProvisionRepository
+	vpnService *VPNService
+	interval   time.Duration
+}
+
+// NewTrafficCycleScheduler 创建流量周期调度器
+func NewTrafficCycleScheduler(
+	vpnRepo *repository.VPNProvisionRepository,
+	vpnService *VPNService,
+	interval time.Duration,
+) *TrafficCycleScheduler {
+	return &TrafficCycleScheduler{
+		vpnRepo:    vpnRepo,
+		vpnService: vpnService,
+		interval:   interval,
+	}
+}
+
+// Start 启动流量周期调度器（阻塞运行，应在 goroutine 中调用）
+func (s *TrafficCycleScheduler) Start(ctx context.Context) {
+	log.Printf("[TrafficCycleScheduler] Started (interval=%v)", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[TrafficCycleScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.runResetCycle(ctx)
+		}
+	}
+}
+
+// runResetCycle 执行一轮周期重置
+// 单个失败不影响其他记录，下一轮会重新扫描到
+func (s *TrafficCycleScheduler) runResetCycle(ctx context.Context) {
+	provisions, err := s.vpnRepo.ListCycleDue(ctx, 50)
+	if err != nil {
+		log.Printf("[TrafficCycleScheduler] Failed to list cycle-due provisions: %v", err)
+		return
+	}
+
+	if len(provisions) == 0 {
+		return
+	}
+
+	log.Printf("[TrafficCycleScheduler] Found %d provisions with ended traffic cycles", len(provisions))
+
+	for _, vp := range provisions {
+		if err := s.vpnService.ResetTrafficCycle(ctx, vp); err != nil {
+			log.Printf("[TrafficCycleScheduler] Failed to reset cycle for %s: %v", vp.ID, err)
+		}
+	}
+}
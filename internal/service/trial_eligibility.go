@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// Velocity thresholds and score weights for trial eligibility
+const (
+	trialIPWindow      = 24 * time.Hour
+	trialIPReviewCount = 3  // 同一 IP 24 小时内申请次数达到此值开始加分
+	trialIPDenyCount   = 10 // 同一 IP 24 小时内申请次数达到此值直接拒绝
+
+	trialDeviceWindow      = 30 * 24 * time.Hour
+	trialDeviceReviewUsers = 1 // 同一设备已被其他账号申请过
+	trialDeviceDenyUsers   = 3
+
+	trialAccountWindow    = 24 * time.Hour
+	trialAccountMaxTries  = 5
+	trialScoreIPReview    = 30
+	trialScoreDeviceShare = 40
+	trialScoreAccountRate = 50
+)
+
+// TrialEligibilityError is returned when a trial request is denied or held for review
+type TrialEligibilityError struct {
+	AttemptID string
+	Decision  string
+	Reasons   []string
+}
+
+func (e *TrialEligibilityError) Error() string {
+	if e.Decision == models.TrialDecisionReview {
+		return "trial request is pending review"
+	}
+	return "trial request denied"
+}
+
+// TrialEligibilityInput is the request context evaluated by the engine
+type TrialEligibilityInput struct {
+	UserID    string
+	Email     string
+	DeviceID  string
+	IPAddress string
+}
+
+// TrialEligibilityEngine scores trial requests beyond the exact-match unique indexes:
+// normalized emails, disposable domains and IP / device / account velocity.
+type TrialEligibilityEngine struct {
+	cfg               *config.Config
+	attemptRepo       *repository.TrialAttemptRepository
+	disposableDomains map[string]bool
+}
+
+// NewTrialEligibilityEngine creates the engine and loads the disposable-domain list
+func NewTrialEligibilityEngine(cfg *config.Config, attemptRepo *repository.TrialAttemptRepository) *TrialEligibilityEngine {
+	domains, err := loadDomainList(cfg.Trial.DisposableDomainsFile)
+	if err != nil {
+		log.Printf("[TrialEligibility] WARN: failed to load disposable domains from %s: %v", cfg.Trial.DisposableDomainsFile, err)
+	} else {
+		log.Printf("[TrialEligibility] Loaded %d disposable domains", len(domains))
+	}
+
+	return &TrialEligibilityEngine{
+		cfg:               cfg,
+		attemptRepo:       attemptRepo,
+		disposableDomains: domains,
+	}
+}
+
+// Evaluate scores a trial request. Denied and review attempts are recorded in
+// trial_attempts right away; an allowed attempt is only returned, and the caller
+// records it with Record once the trial is actually granted (or with
+// RecordNotGranted when the reservation fails), so an allow never stands for
+// a trial that was not given.
+func (e *TrialEligibilityEngine) Evaluate(ctx context.Context, in *TrialEligibilityInput) (*models.TrialAttempt, error) {
+	attempt := &models.TrialAttempt{
+		ID:              uuid.New().String(),
+		UserID:          in.UserID,
+		Email:           in.Email,
+		NormalizedEmail: NormalizeEmail(in.Email),
+		DeviceID:        in.DeviceID,
+		IPAddress:       in.IPAddress,
+	}
+
+	// 管理员已复核过该账号：沿用复核结果
+	reviewed, err := e.attemptRepo.GetLatestOverrideByUser(ctx, in.UserID)
+	switch {
+	case err == nil:
+		attempt.Decision = *reviewed.OverrideDecision
+		attempt.Reasons = []string{"admin_override"}
+		if attempt.Decision == models.TrialDecisionAllow {
+			return attempt, nil
+		}
+		return attempt, e.attemptRepo.Create(ctx, attempt)
+	case !errors.Is(err, repository.ErrNotFound):
+		// 查询失败时不能跳过复核结果直接打分
+		return nil, err
+	}
+
+	score, reasons, err := e.score(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.Score = score
+	attempt.Reasons = reasons
+	switch {
+	case score >= e.cfg.Trial.DenyScore:
+		attempt.Decision = models.TrialDecisionDeny
+	case score >= e.cfg.Trial.ReviewScore:
+		attempt.Decision = models.TrialDecisionReview
+	default:
+		attempt.Decision = models.TrialDecisionAllow
+	}
+
+	if attempt.Decision != models.TrialDecisionAllow {
+		if err := e.attemptRepo.Create(ctx, attempt); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[TrialEligibility] user=%s decision=%s score=%d reasons=%v",
+		in.UserID, attempt.Decision, score, reasons)
+	return attempt, nil
+}
+
+// Record saves an allowed attempt once its trial has been granted
+func (e *TrialEligibilityEngine) Record(ctx context.Context, attempt *models.TrialAttempt) {
+	if err := e.attemptRepo.Create(ctx, attempt); err != nil {
+		log.Printf("[TrialEligibility] Failed to record attempt %s: %v", attempt.ID, err)
+	}
+}
+
+// RecordNotGranted saves an allowed attempt whose trial could not be granted
+// (e.g. the unique indexes show the trial was already used) as denied,
+// so it still counts toward velocity but not as a used email.
+func (e *TrialEligibilityEngine) RecordNotGranted(ctx context.Context, attempt *models.TrialAttempt, reason string) {
+	attempt.Decision = models.TrialDecisionDeny
+	attempt.Reasons = append(attempt.Reasons, reason)
+	e.Record(ctx, attempt)
+}
+
+func (e *TrialEligibilityEngine) score(ctx context.Context, a *models.TrialAttempt) (int, []string, error) {
+	score := 0
+	var reasons []string
+
+	// 1. Email checks
+	if a.NormalizedEmail != "" {
+		domain := a.NormalizedEmail[strings.LastIndex(a.NormalizedEmail, "@")+1:]
+		if e.disposableDomains[domain] {
+			score += e.cfg.Trial.DenyScore
+			reasons = append(reasons, "disposable_email_domain")
+		}
+
+		used, err := e.attemptRepo.ExistsAllowedByNormalizedEmail(ctx, a.NormalizedEmail, a.UserID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if used {
+			score += e.cfg.Trial.DenyScore
+			reasons = append(reasons, "email_already_used")
+		}
+	}
+
+	// 2. IP velocity
+	if a.IPAddress != "" {
+		count, err := e.attemptRepo.CountByIPSince(ctx, a.IPAddress, time.Now().Add(-trialIPWindow))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case count >= trialIPDenyCount:
+			score += e.cfg.Trial.DenyScore
+			reasons = append(reasons, fmt.Sprintf("ip_velocity:%d", count))
+		case count >= trialIPReviewCount:
+			score += trialScoreIPReview
+			reasons = append(reasons, fmt.Sprintf("ip_velocity:%d", count))
+		}
+	}
+
+	// 3. Device shared across accounts
+	if a.DeviceID != "" {
+		users, err := e.attemptRepo.CountDistinctUsersByDeviceSince(ctx, a.DeviceID, a.UserID, time.Now().Add(-trialDeviceWindow))
+		if err != nil {
+			return 0, nil, err
+		}
+		switch {
+		case users >= trialDeviceDenyUsers:
+			score += e.cfg.Trial.DenyScore
+			reasons = append(reasons, fmt.Sprintf("device_shared:%d", users))
+		case users >= trialDeviceReviewUsers:
+			score += trialScoreDeviceShare
+			reasons = append(reasons, fmt.Sprintf("device_shared:%d", users))
+		}
+	}
+
+	// 4. Account velocity
+	tries, err := e.attemptRepo.CountByUserSince(ctx, a.UserID, time.Now().Add(-trialAccountWindow))
+	if err != nil {
+		return 0, nil, err
+	}
+	if tries >= trialAccountMaxTries {
+		score += trialScoreAccountRate
+		reasons = append(reasons, fmt.Sprintf("account_velocity:%d", tries))
+	}
+
+	return score, reasons, nil
+}
+
+// ListAttempts lists recorded trial attempts (admin)
+func (e *TrialEligibilityEngine) ListAttempts(ctx context.Context, userID, decision string, limit int) ([]*models.TrialAttempt, error) {
+	return e.attemptRepo.ListByFilters(ctx, userID, decision, limit)
+}
+
+// Override records an admin decision for an attempt; later requests from the same
+// account follow the override instead of being re-scored until it expires after
+// validDays (TRIAL_OVERRIDE_DAYS when 0).
+func (e *TrialEligibilityEngine) Override(ctx context.Context, attemptID, decision, overriddenBy, note string, validDays int) (*models.TrialAttempt, error) {
+	if decision != models.TrialDecisionAllow && decision != models.TrialDecisionDeny {
+		return nil, fmt.Errorf("invalid override decision: %s", decision)
+	}
+	if validDays <= 0 {
+		validDays = max(e.cfg.Trial.OverrideDays, 1)
+	}
+	expiresAt := time.Now().AddDate(0, 0, validDays)
+	if err := e.attemptRepo.SetOverride(ctx, attemptID, decision, overriddenBy, note, expiresAt); err != nil {
+		return nil, err
+	}
+	return e.attemptRepo.GetByID(ctx, attemptID)
+}
+
+// NormalizeEmail canonicalizes an email so aliases map to the same mailbox:
+// lowercase, strip "+tag", and drop dots for Gmail addresses.
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// loadDomainList reads one domain per line, ignoring blank lines and # comments
+func loadDomainList(path string) (map[string]bool, error) {
+	domains := make(map[string]bool)
+	if path == "" {
+		return domains, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return domains, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = true
+	}
+	return domains, scanner.Err()
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// VPNPauseScheduler 暂停到期自动恢复任务
+// 定时扫描已用完最长暂停天数的 VPN provision 并自动恢复
+type VPNPauseScheduler struct {
+	vpnRepo    *repository.VPNProvisionRepository
+	vpnService *VPNService
+	interval   time.Duration
+}
+
+// NewVPNPauseScheduler 创建暂停自动恢复调度器
+func NewVPNPauseScheduler(
+	vpnRepo *repository.VPNProvisionRepository,
+	vpnService *VPNService,
+	interval time.Duration,
+) *VPNPauseScheduler {
+	return &VPNPauseScheduler{
+		vpnRepo:    vpnRepo,
+		vpnService: vpnService,
+		interval:   interval,
+	}
+}
+
+// Start 启动调度器（阻塞运行，应在 goroutine 中调用）
+func (s *VPNPauseScheduler) Start(ctx context.Context) {
+	log.Printf("[VPNPauseScheduler] Started (interval=%v)", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[VPNPauseScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.runResumeCycle(ctx)
+		}
+	}
+}
+
+// runResumeCycle 执行一轮自动恢复
+func (s *VPNPauseScheduler) runResumeCycle(ctx context.Context) {
+	provisions, err := s.vpnRepo.ListPauseDue(ctx, 50)
+	if err != nil {
+		log.Printf("[VPNPauseScheduler] Failed to list pause-due provisions: %v", err)
+		return
+	}
+
+	if len(provisions) == 0 {
+		return
+	}
+
+	log.Printf("[VPNPauseScheduler] Found %d paused provisions to auto-resume", len(provisions))
+
+	for _, vp := range provisions {
+		if _, err := s.vpnService.resumeProvision(ctx, vp, "max paused days reached"); err != nil {
+			log.Printf("[VPNPauseScheduler] Failed to auto-resume %s: %v", vp.ID, err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -15,11 +16,24 @@ import (
 	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
 )
 
+// ErrNoActivePlanForTopUp is returned when a top-up arrives for a user without an active plan
+var ErrNoActivePlanForTopUp = errors.New("no active VPN plan to add traffic to")
+
+// Pause / resume errors
+var (
+	ErrVPNNotPausable       = errors.New("VPN plan cannot be paused")
+	ErrVPNPauseLimitReached = errors.New("pause limit reached for this plan")
+	ErrVPNNotPaused         = errors.New("VPN plan is not paused")
+)
+
 // VPNService handles VPN user provisioning operations
 type VPNService struct {
 	cfg                *config.Config
 	vpnRepo            *repository.VPNProvisionRepository
+	topupRepo          *repository.TrafficTopUpRepository
+	cycleRepo          *repository.TrafficCycleRepository
 	logRepo            *repository.LogRepository
+	ledger             *EntitlementLedger
 	otunClient         *client.OTunClient
 	subscriptionClient *client.SubscriptionClient
 }
@@ -28,14 +42,20 @@ type VPNService struct {
 func NewVPNService(
 	cfg *config.Config,
 	vpnRepo *repository.VPNProvisionRepository,
+	topupRepo *repository.TrafficTopUpRepository,
+	cycleRepo *repository.TrafficCycleRepository,
 	logRepo *repository.LogRepository,
+	ledger *EntitlementLedger,
 	otunClient *client.OTunClient,
 	subscriptionClient *client.SubscriptionClient,
 ) *VPNService {
 	return &VPNService{
 		cfg:                cfg,
 		vpnRepo:            vpnRepo,
+		topupRepo:          topupRepo,
+		cycleRepo:          cycleRepo,
 		logRepo:            logRepo,
+		ledger:             ledger,
 		otunClient:         otunClient,
 		subscriptionClient: subscriptionClient,
 	}
@@ -49,7 +69,8 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 	// Idempotency check: if this subscription has already been provisioned, return existing result
 	if req.SubscriptionID != "" {
 		existingBySubID, _ := s.vpnRepo.GetBySubscriptionID(ctx, req.SubscriptionID)
-		if existingBySubID != nil && existingBySubID.Status == models.VPNProvisionStatusActive && existingBySubID.OtunUUID != nil {
+		if existingBySubID != nil && existingBySubID.Status == models.VPNProvisionStatusActive && existingBySubID.OtunUUID != nil &&
+			!s.extendsStoreExpiry(ctx, req, existingBySubID) {
 			log.Printf("[VPNService] Already provisioned for subscription=%s (provision=%s), skipping",
 				req.SubscriptionID, existingBySubID.ID)
 			return &models.ProvisionResponse{
@@ -72,11 +93,19 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 
 	// 1. Check if user already has a current VPN provision
 	existing, err := s.vpnRepo.GetCurrentByUserAnyStatus(ctx, req.UserID)
+	if err == nil && existing.Status == models.VPNProvisionStatusPaused {
+		// A new payment ends the pause; the renewal then applies to the resumed window
+		if _, rErr := s.resumeProvision(ctx, existing, "renewal"); rErr != nil {
+			log.Printf("[VPNService] Warning: failed to resume paused provision %s on renewal: %v", existing.ID, rErr)
+		}
+		existing, err = s.vpnRepo.GetCurrentByUserAnyStatus(ctx, req.UserID)
+	}
 	if err == nil && existing != nil && existing.OtunUUID != nil && *existing.OtunUUID != "" {
 		// Renewal scenario: update expire_at and traffic_limit
 		vpnUserID := *existing.OtunUUID
 		expireDays := s.calculateExpireDays(req.Channel, req.ExpireDays)
 		trafficLimit := s.calculateTrafficLimit(req.PlanTier, req.TrafficLimit)
+		allowance := trafficLimit
 
 		// Determine expiration strategy by channel:
 		// - apple/google: platform manages renewal cycle, always fresh period
@@ -84,8 +113,14 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 		// - trial/gift → stripe: channel upgrade, fresh period (don't stack free trial time)
 		// - stripe → stripe: user paid money, stack on remaining time if not expired
 		var expireAt time.Time
-		switch req.Channel {
-		case "apple", "google", "trial", "gift":
+		freshPeriod := true
+		storeExpireAt, hasStoreExpiry := s.calculateStoreExpireAt(req)
+		switch {
+		case hasStoreExpiry:
+			// Store/billing-reported expiry is authoritative, no stacking
+			expireAt = storeExpireAt
+			log.Printf("[VPNService] %s: store expiry, expire=%s", req.Channel, expireAt.Format(time.RFC3339))
+		case req.Channel == "apple" || req.Channel == "google" || req.Channel == "trial" || req.Channel == "gift":
 			expireAt = s.calculateExpireAt(expireDays)
 			log.Printf("[VPNService] %s: fresh period, expire=%s", req.Channel, expireAt.Format(time.RFC3339))
 		default:
@@ -97,29 +132,78 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 			} else {
 				// Same paid channel renewal (e.g., stripe → stripe): stack on remaining time
 				expireAt = s.calculateExpireAtWithStacking(ctx, vpnUserID, expireDays)
+				freshPeriod = false
 			}
 		}
 
-		enabled := true
-		updateReq := &client.UpdateVPNUserRequest{
-			TrafficLimit: trafficLimit,
-			ExpireAt:     expireAt.Format(time.RFC3339),
-			Enabled:      &enabled,
+		// A plan without traffic cycles only resets usage at a fresh period, so top-ups
+		// are settled here; cycle plans are settled by ResetTrafficCycle.
+		if freshPeriod && existing.CycleMonths == 0 {
+			if userInfo, uErr := s.otunClient.GetUser(ctx, vpnUserID); uErr != nil {
+				log.Printf("[VPNService] Failed to get VPN user usage for top-up settlement: %v", uErr)
+			} else {
+				s.settleTopUps(ctx, req.UserID, userInfo.TrafficUsed)
+			}
 		}
 
-		if err := s.otunClient.UpdateUser(ctx, vpnUserID, updateReq); err != nil {
-			log.Printf("[VPNService] Warning: failed to update existing VPN user: %v", err)
+		// If channel changed (e.g., trial → apple), preserve old record as history.
+		// A trial record is always converted, whatever channel the purchase came from.
+		channelChanged := existing.Channel != req.Channel || existing.BusinessType == models.BusinessTypeTrial
+
+		// Record the purchase in the ledger. A same-channel renewal replaces the record's
+		// previous window (stacking is already in expireAt); a converted trial is closed.
+		// Other grants (e.g. an active gift) stay and are layered by the resolver.
+		// The new grant and the supersede are written in one transaction, so a failure
+		// never leaves the user without a purchase grant.
+		grantProvisionID := existing.ID
+		if channelChanged {
+			grantProvisionID = uuid.New().String()
+		}
+		grant := &models.EntitlementGrant{
+			UserID:         req.UserID,
+			VPNProvisionID: grantProvisionID,
+			Source:         businessType,
+			SourceRef:      req.SubscriptionID,
+			TrafficBytes:   trafficLimit,
+			EndsAt:         expireAt,
+			ServiceTier:    serviceTier,
+		}
+		var err error
+		if !channelChanged || existing.BusinessType == models.BusinessTypeTrial {
+			err = s.ledger.Replace(ctx, existing.ID, grant)
 		} else {
-			log.Printf("[VPNService] Updated existing VPN user %s: expire=%s, traffic=%d",
-				vpnUserID, expireAt.Format(time.RFC3339), trafficLimit)
+			err = s.ledger.Record(ctx, grant)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to record entitlement grant: %w", err)
+		}
+
+		resolved, err := s.ledger.Push(ctx, req.UserID, vpnUserID)
+		if err != nil {
+			// A same-channel grant is replaced again when the callback is retried;
+			// a new record's grant has no provision row yet and is taken back.
+			if channelChanged {
+				s.ledger.Revoke(ctx, grantProvisionID)
+			}
+			return nil, fmt.Errorf("failed to update existing VPN user: %w", err)
 		}
+		trafficLimit = resolved.TrafficLimit
+		expireAt = resolved.ExpireAt
+		log.Printf("[VPNService] Updated existing VPN user %s: expire=%s, traffic=%d",
+			vpnUserID, expireAt.Format(time.RFC3339), trafficLimit)
 
-		// If channel changed (e.g., trial → apple), preserve old record as history
-		if existing.Channel != req.Channel {
+		if channelChanged {
 			s.vpnRepo.MarkNotCurrent(ctx, existing.ID)
+			if err := s.ledger.MoveTopUps(ctx, existing.ID, grantProvisionID); err != nil {
+				log.Printf("[VPNService] Warning: failed to move top-ups of %s: %v", existing.ID, err)
+			}
 			log.Printf("[VPNService] Channel changed %s → %s, creating new provision record", existing.Channel, req.Channel)
+			if existing.BusinessType == models.BusinessTypeTrial {
+				s.logRepo.LogAction(ctx, existing.ID, "vpn", "trial_converted", models.VPNProvisionStatusConverted,
+					fmt.Sprintf("Trial converted to %s (%s)", businessType, req.Channel))
+			}
 
-			newProvisionID := uuid.New().String()
+			newProvisionID := grantProvisionID
 			newExpireAt := expireAt
 			newVP := &models.VPNProvision{
 				ID:             newProvisionID,
@@ -137,6 +221,7 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 				Email:          req.UserEmail,
 				IsCurrent:      true,
 			}
+			s.applyTrafficCycle(newVP, allowance, newExpireAt)
 			if err := s.vpnRepo.Create(ctx, newVP); err != nil {
 				log.Printf("[VPNService] Warning: failed to create new provision: %v", err)
 			}
@@ -151,11 +236,13 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 
 		// Same channel renewal: update existing record in-place
 		existing.TrafficLimit = trafficLimit
+		existing.ExpireAt = &expireAt
 		existing.SubscriptionID = req.SubscriptionID
 		existing.BusinessType = businessType
 		existing.ServiceTier = serviceTier
 		existing.PlanTier = req.PlanTier
 		existing.Status = models.VPNProvisionStatusActive
+		s.applyTrafficCycle(existing, allowance, expireAt)
 		s.vpnRepo.Update(ctx, existing)
 
 		return &models.ProvisionResponse{
@@ -168,12 +255,37 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 
 	// 2. Calculate traffic limit and expire time
 	trafficLimit := s.calculateTrafficLimit(req.PlanTier, req.TrafficLimit)
+	allowance := trafficLimit
 	expireDays := s.calculateExpireDays(req.Channel, req.ExpireDays)
 	expireAt := s.calculateExpireAt(expireDays)
+	if storeExpireAt, ok := s.calculateStoreExpireAt(req); ok {
+		expireAt = storeExpireAt
+	}
 	log.Printf("[VPNService] ProvisionVPNUser: expireDays=%d, trafficLimit=%d, expireAt=%s",
 		expireDays, trafficLimit, expireAt.Format(time.RFC3339))
 
-	// 3. Check if user has an existing otun_uuid from any previous provision (e.g., trial)
+	// 3. Record the grant in the ledger; limits pushed to otun-manager are resolved from it
+	provisionID := uuid.New().String()
+	grant := &models.EntitlementGrant{
+		UserID:         req.UserID,
+		VPNProvisionID: provisionID,
+		Source:         businessType,
+		SourceRef:      req.SubscriptionID,
+		TrafficBytes:   trafficLimit,
+		EndsAt:         expireAt,
+		ServiceTier:    serviceTier,
+	}
+	var grantErr error
+	if existing != nil && existing.BusinessType == models.BusinessTypeTrial {
+		grantErr = s.ledger.Replace(ctx, existing.ID, grant)
+	} else {
+		grantErr = s.ledger.Record(ctx, grant)
+	}
+	if grantErr != nil {
+		return nil, fmt.Errorf("failed to record entitlement grant: %w", grantErr)
+	}
+
+	// 4. Check if user has an existing otun_uuid from any previous provision (e.g., trial)
 	existingOtunUUID, _ := s.vpnRepo.GetOtunUUIDByUser(ctx, req.UserID)
 
 	var actualVPNUserID string
@@ -181,21 +293,27 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 	if existingOtunUUID != nil && *existingOtunUUID != "" {
 		// Reuse existing otun_uuid (e.g., trial → purchase conversion)
 		actualVPNUserID = *existingOtunUUID
-		enabled := true
-		updateReq := &client.UpdateVPNUserRequest{
-			TrafficLimit: trafficLimit,
-			ExpireAt:     expireAt.Format(time.RFC3339),
-			Enabled:      &enabled,
-		}
-		if err := s.otunClient.UpdateUser(ctx, actualVPNUserID, updateReq); err != nil {
+		resolved, err := s.ledger.Push(ctx, req.UserID, actualVPNUserID)
+		if err != nil {
+			s.ledger.Revoke(ctx, provisionID)
 			return nil, fmt.Errorf("failed to update existing VPN user: %w", err)
 		}
+		trafficLimit = resolved.TrafficLimit
+		expireAt = resolved.ExpireAt
 
 		// Mark old provision as not current (trial → converted)
 		if existing != nil {
 			s.vpnRepo.MarkNotCurrent(ctx, existing.ID)
+			if err := s.ledger.MoveTopUps(ctx, existing.ID, provisionID); err != nil {
+				log.Printf("[VPNService] Warning: failed to move top-ups of %s: %v", existing.ID, err)
+			}
 		}
 	} else {
+		if resolved, err := s.ledger.Resolve(ctx, req.UserID); err == nil && resolved.Active {
+			trafficLimit = resolved.TrafficLimit
+			expireAt = resolved.ExpireAt
+		}
+
 		// Create new VPN user in otun-manager
 		vpnUserID := uuid.New().String()
 		ssPassword := generateRandomPassword(16)
@@ -213,6 +331,7 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 
 		otunResp, err := s.otunClient.CreateUser(ctx, otunReq)
 		if err != nil {
+			s.ledger.Revoke(ctx, provisionID)
 			s.logRepo.LogAction(ctx, "", "vpn", "vpn_user_create_failed", "failed", err.Error())
 			return nil, fmt.Errorf("failed to create VPN user in otun-manager: %w", err)
 		}
@@ -223,8 +342,7 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 		}
 	}
 
-	// 4. Create local VPN provision record
-	provisionID := uuid.New().String()
+	// 5. Create local VPN provision record
 	vp := &models.VPNProvision{
 		ID:             provisionID,
 		UserID:         req.UserID,
@@ -241,13 +359,15 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 		Email:          req.UserEmail,
 		IsCurrent:      true,
 	}
+	s.applyTrafficCycle(vp, allowance, expireAt)
 
 	if err := s.vpnRepo.Create(ctx, vp); err != nil {
+		s.ledger.Revoke(ctx, provisionID)
 		_ = s.otunClient.DeleteUser(ctx, actualVPNUserID)
 		return nil, fmt.Errorf("failed to save vpn provision: %w", err)
 	}
 
-	// 5. Log action
+	// 6. Log action
 	s.logRepo.LogActionWithMetadata(ctx, provisionID, "vpn", "vpn_user_created", "active",
 		"VPN user created successfully",
 		map[string]interface{}{
@@ -259,7 +379,7 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 			"channel":       req.Channel,
 		})
 
-	// 6. Notify subscription-service
+	// 7. Notify subscription-service
 	s.notifyVPNActive(ctx, req.SubscriptionID, provisionID, actualVPNUserID)
 
 	log.Printf("[VPNService] VPN user created successfully: provision=%s, vpn_user=%s", provisionID, actualVPNUserID)
@@ -272,6 +392,426 @@ func (s *VPNService) ProvisionVPNUser(ctx context.Context, req *models.Provision
 	}, nil
 }
 
+// ApplyTrafficTopUp adds a one-time traffic pack (business_type=topup) to the user's
+// current period. expire_at is not changed; the pack is a separate line item
+// backed by an additive ledger grant. req.TrafficLimit carries the bytes to add.
+func (s *VPNService) ApplyTrafficTopUp(ctx context.Context, req *models.ProvisionRequest) (*models.ProvisionResponse, error) {
+	log.Printf("[VPNService] Applying traffic top-up: user=%s, bytes=%d, ref=%s",
+		req.UserID, req.TrafficLimit, req.SubscriptionID)
+
+	if req.TrafficLimit <= 0 {
+		return nil, fmt.Errorf("traffic_limit (bytes to add) is required for top-up")
+	}
+
+	// Idempotency: the same order is applied only once. A retry of a top-up whose
+	// grant is already recorded only pushes the limits again (the last push may have failed).
+	if req.SubscriptionID != "" {
+		if existing, err := s.topupRepo.GetBySourceRef(ctx, req.SubscriptionID); err == nil && existing.GrantID != "" {
+			if vp, err := s.vpnRepo.GetCurrentByUser(ctx, req.UserID); err == nil && vp.OtunUUID != nil && *vp.OtunUUID != "" {
+				if _, err := s.ledger.Push(ctx, req.UserID, *vp.OtunUUID); err != nil {
+					return nil, err
+				}
+			}
+			return &models.ProvisionResponse{
+				ResourceID: existing.ID,
+				Status:     models.StatusActive,
+				Message:    "Top-up already applied (idempotent)",
+			}, nil
+		}
+	}
+
+	vp, err := s.vpnRepo.GetCurrentByUser(ctx, req.UserID)
+	if err != nil || vp == nil || vp.OtunUUID == nil || *vp.OtunUUID == "" {
+		return nil, ErrNoActivePlanForTopUp
+	}
+	resolved, err := s.ledger.Resolve(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !resolved.Active {
+		return nil, ErrNoActivePlanForTopUp
+	}
+
+	// Carry-over packs outlive the period; otherwise they end with it
+	carryOver := s.cfg.TopUp.CarryOver
+	expiresAt := resolved.ExpireAt
+	if carryOver {
+		expiresAt = time.Now().AddDate(0, 0, s.cfg.TopUp.ValidityDays)
+	}
+
+	// 1. Record the line item first; its source_ref claims the order
+	topup := &models.TrafficTopUp{
+		ID:             uuid.New().String(),
+		UserID:         req.UserID,
+		VPNProvisionID: vp.ID,
+		SourceRef:      req.SubscriptionID,
+		ProductID:      req.ProductID,
+		Bytes:          req.TrafficLimit,
+		CarryOver:      carryOver,
+		ExpiresAt:      expiresAt,
+		Status:         models.TopUpStatusActive,
+	}
+	created, err := s.topupRepo.Create(ctx, topup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save top-up: %w", err)
+	}
+	if !created {
+		// A concurrent request, or an earlier attempt stopped before recording the grant
+		if topup, err = s.topupRepo.GetBySourceRef(ctx, req.SubscriptionID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Back it with an additive grant, attached only once per top-up
+	if topup.GrantID == "" {
+		grant := &models.EntitlementGrant{
+			UserID:         req.UserID,
+			VPNProvisionID: topup.VPNProvisionID,
+			Source:         models.GrantSourceTopUp,
+			SourceRef:      topup.ID,
+			TrafficBytes:   topup.Bytes,
+			EndsAt:         topup.ExpiresAt,
+			ServiceTier:    resolved.ServiceTier,
+			Additive:       true,
+		}
+		if err := s.ledger.Record(ctx, grant); err != nil {
+			return nil, fmt.Errorf("failed to record top-up grant: %w", err)
+		}
+		attached, err := s.topupRepo.AttachGrant(ctx, topup.ID, grant.ID)
+		if err != nil || !attached {
+			s.ledger.RevokeGrant(ctx, grant.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 3. Push; on failure the grant stays recorded and a retry pushes again
+	resolved, err = s.ledger.Push(ctx, req.UserID, *vp.OtunUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, vp.ID, "vpn", "traffic_topup_applied", models.VPNProvisionStatusActive,
+		"Traffic top-up applied",
+		map[string]interface{}{
+			"topup_id":      topup.ID,
+			"bytes":         topup.Bytes,
+			"carry_over":    topup.CarryOver,
+			"expires_at":    topup.ExpiresAt.Format(time.RFC3339),
+			"traffic_limit": resolved.TrafficLimit,
+			"product_id":    req.ProductID,
+		})
+
+	return &models.ProvisionResponse{
+		ResourceID: topup.ID,
+		Status:     models.StatusActive,
+		VPNUserID:  *vp.OtunUUID,
+		Message:    "Traffic top-up applied",
+	}, nil
+}
+
+// settleTopUps closes out top-ups at a period boundary: a traffic cycle reset, or a
+// renewal starting a fresh period for plans without cycles.
+// Usage above the base allowance is charged to top-ups, earliest expiry first.
+// What is left carries over as a new additive grant; packs without carry-over
+// end with the period. Until a boundary the counter is cumulative, so nothing is
+// charged in between and the resolver simply keeps the packs in the limit.
+func (s *VPNService) settleTopUps(ctx context.Context, userID string, used int64) {
+	topups, err := s.topupRepo.ListActiveByUser(ctx, userID)
+	if err != nil || len(topups) == 0 {
+		return
+	}
+	resolved, err := s.ledger.Resolve(ctx, userID)
+	if err != nil {
+		log.Printf("[VPNService] Failed to resolve ledger for top-up settlement: %v", err)
+		return
+	}
+
+	overflow := used - resolved.BaseTrafficLimit
+	for _, t := range topups {
+		consumed := int64(0)
+		if overflow > 0 {
+			consumed = min(overflow, t.RemainingBytes())
+			t.ConsumedBytes += consumed
+			overflow -= consumed
+		}
+
+		switch {
+		case t.RemainingBytes() == 0:
+			t.Status = models.TopUpStatusConsumed
+			s.ledger.SupersedeGrant(ctx, t.GrantID)
+		case !t.CarryOver:
+			t.Status = models.TopUpStatusExpired
+			s.ledger.SupersedeGrant(ctx, t.GrantID)
+		case consumed > 0:
+			// Re-grant only the unconsumed bytes for the next period
+			s.ledger.SupersedeGrant(ctx, t.GrantID)
+			grant := &models.EntitlementGrant{
+				UserID:         userID,
+				VPNProvisionID: t.VPNProvisionID,
+				Source:         models.GrantSourceTopUp,
+				SourceRef:      t.ID,
+				TrafficBytes:   t.RemainingBytes(),
+				EndsAt:         t.ExpiresAt,
+				ServiceTier:    resolved.ServiceTier,
+				Additive:       true,
+			}
+			if err := s.ledger.Record(ctx, grant); err != nil {
+				log.Printf("[VPNService] Failed to carry over top-up %s: %v", t.ID, err)
+				continue
+			}
+			t.GrantID = grant.ID
+		default:
+			continue
+		}
+
+		if err := s.topupRepo.UpdateSettlement(ctx, t); err != nil {
+			log.Printf("[VPNService] Failed to settle top-up %s: %v", t.ID, err)
+		}
+	}
+}
+
+// ResetTrafficCycle closes the finished traffic cycle of a provision: archives it,
+// opens the next cycle, settles top-ups against the cycle's usage and then resets
+// traffic_used in otun-manager. Advancing the cycle is conditional on its previous
+// end, so only one run closes a cycle; if the otun reset fails the provision stays
+// cycle_reset_pending and the next run only retries the reset.
+func (s *VPNService) ResetTrafficCycle(ctx context.Context, vp *models.VPNProvision) error {
+	if vp.OtunUUID == nil || *vp.OtunUUID == "" || vp.CycleAnchor == nil || vp.CycleMonths <= 0 {
+		return fmt.Errorf("provision %s has no traffic cycle", vp.ID)
+	}
+	otunUUID := *vp.OtunUUID
+
+	if !vp.CycleResetPending {
+		if err := s.closeTrafficCycle(ctx, vp); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil // 周期已被其他实例推进
+			}
+			return err
+		}
+	}
+
+	if err := s.otunClient.ResetTrafficUsed(ctx, otunUUID); err != nil {
+		return fmt.Errorf("failed to reset VPN user traffic: %w", err)
+	}
+	if err := s.vpnRepo.ClearCycleResetPending(ctx, vp.ID); err != nil {
+		return err
+	}
+
+	// Settlement may have changed the add-on grants
+	if _, err := s.ledger.Push(ctx, vp.UserID, otunUUID); err != nil {
+		log.Printf("[VPNService] Failed to push limits after cycle reset for %s: %v", vp.ID, err)
+	}
+	return nil
+}
+
+// closeTrafficCycle archives the finished cycle with otun-manager's usage, advances
+// the provision to the next cycle (marking the reset pending) and settles top-ups.
+// Returns ErrNotFound if the cycle was already advanced.
+func (s *VPNService) closeTrafficCycle(ctx context.Context, vp *models.VPNProvision) error {
+	if vp.CycleEndsAt == nil {
+		return fmt.Errorf("provision %s has no cycle end", vp.ID)
+	}
+	userInfo, err := s.otunClient.GetUser(ctx, *vp.OtunUUID)
+	if err != nil {
+		return fmt.Errorf("failed to get VPN user usage: %w", err)
+	}
+
+	var prevStart time.Time
+	if vp.CycleStartedAt != nil {
+		prevStart = *vp.CycleStartedAt
+	}
+	prevEnd := *vp.CycleEndsAt
+	if err := s.cycleRepo.Archive(ctx, vp.ID, vp.UserID, prevStart, prevEnd, vp.CycleAllowance, userInfo.TrafficUsed); err != nil {
+		return err
+	}
+
+	start, end := models.CycleWindow(*vp.CycleAnchor, vp.CycleMonths, time.Now())
+	if err := s.vpnRepo.AdvanceCycle(ctx, vp.ID, prevEnd, start, end); err != nil {
+		return err
+	}
+
+	// Usage beyond the base allowance is charged to top-ups before they roll over
+	s.settleTopUps(ctx, vp.UserID, userInfo.TrafficUsed)
+
+	s.logRepo.LogActionWithMetadata(ctx, vp.ID, "vpn", "traffic_cycle_reset", models.VPNProvisionStatusActive,
+		"Traffic cycle reset",
+		map[string]interface{}{
+			"previous_cycle_start": prevStart.Format(time.RFC3339),
+			"previous_cycle_end":   prevEnd.Format(time.RFC3339),
+			"previous_used":        userInfo.TrafficUsed,
+			"allowance":            vp.CycleAllowance,
+			"cycle_start":          start.Format(time.RFC3339),
+			"cycle_end":            end.Format(time.RFC3339),
+		})
+
+	log.Printf("[VPNService] Traffic cycle reset: provision=%s, used=%d, next_end=%s",
+		vp.ID, userInfo.TrafficUsed, end.Format(time.RFC3339))
+	return nil
+}
+
+// PauseVPN freezes the user's current paid plan: the otun user is disabled and
+// the remaining time/traffic recorded. Limits per plan come from VPN_PAUSE_LIMITS.
+func (s *VPNService) PauseVPN(ctx context.Context, userID, reason string) (*models.VPNPauseResponse, error) {
+	if !s.cfg.Pause.Enabled {
+		return nil, ErrVPNNotPausable
+	}
+	vp, err := s.vpnRepo.GetCurrentByUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrVPNNotPausable
+		}
+		return nil, err
+	}
+
+	// Only paid plans we control the expiry of; store subscriptions keep billing
+	// on the store side, so freezing them here would drift from the store
+	if vp.OtunUUID == nil || *vp.OtunUUID == "" ||
+		(vp.BusinessType != models.BusinessTypeSubscription && vp.BusinessType != models.BusinessTypePurchase) ||
+		vp.Channel == "apple" || vp.Channel == "google" ||
+		vp.ExpireAt == nil || !vp.ExpireAt.After(time.Now()) {
+		return nil, ErrVPNNotPausable
+	}
+
+	limit := s.cfg.Pause.LimitFor(vp.PlanTier)
+	allowed := time.Duration(limit.MaxDays)*24*time.Hour - time.Duration(vp.PausedSeconds)*time.Second
+	if vp.PauseCount >= limit.MaxCount || allowed <= 0 {
+		return nil, ErrVPNPauseLimitReached
+	}
+
+	otunUUID := *vp.OtunUUID
+	used := vp.TrafficUsed
+	if userInfo, err := s.otunClient.GetUser(ctx, otunUUID); err == nil {
+		used = userInfo.TrafficUsed
+	} else {
+		log.Printf("[VPNService] Failed to get VPN user usage before pause, using stored value: %v", err)
+	}
+	remainingTraffic := max(vp.TrafficLimit-used, 0)
+	remainingSeconds := int64(time.Until(*vp.ExpireAt).Seconds())
+
+	if err := s.otunClient.DisableUser(ctx, otunUUID); err != nil {
+		return nil, fmt.Errorf("failed to disable VPN user: %w", err)
+	}
+
+	pausedAt := time.Now()
+	pauseEndsAt := pausedAt.Add(allowed)
+	if err := s.vpnRepo.MarkPaused(ctx, vp.ID, pausedAt, pauseEndsAt, remainingSeconds, remainingTraffic); err != nil {
+		if enErr := s.otunClient.EnableUser(ctx, otunUUID); enErr != nil {
+			log.Printf("[VPNService] Failed to re-enable VPN user after pause failure: %v", enErr)
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrVPNNotPausable
+		}
+		return nil, err
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, vp.ID, "vpn", "vpn_paused", models.VPNProvisionStatusPaused, reason,
+		map[string]interface{}{
+			"remaining_seconds": remainingSeconds,
+			"remaining_traffic": remainingTraffic,
+			"auto_resume_at":    pauseEndsAt.Format(time.RFC3339),
+			"pause_count":       vp.PauseCount + 1,
+		})
+
+	log.Printf("[VPNService] VPN paused: provision=%s, auto_resume_at=%s", vp.ID, pauseEndsAt.Format(time.RFC3339))
+
+	vp.Status = models.VPNProvisionStatusPaused
+	vp.PausedAt = &pausedAt
+	vp.PauseEndsAt = &pauseEndsAt
+	vp.PauseCount++
+	vp.PausedRemainingSeconds = remainingSeconds
+	vp.PausedRemainingTraffic = remainingTraffic
+	return &models.VPNPauseResponse{
+		ResourceID: vp.ID,
+		Status:     vp.Status,
+		ExpireAt:   vp.ExpireAt.Format(time.RFC3339),
+		Pause:      s.pauseInfo(vp),
+	}, nil
+}
+
+// ResumeVPN reactivates the user's paused plan
+func (s *VPNService) ResumeVPN(ctx context.Context, userID, reason string) (*models.VPNPauseResponse, error) {
+	vp, err := s.vpnRepo.GetCurrentByUserAnyStatus(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrVPNNotPaused
+		}
+		return nil, err
+	}
+	if vp.Status != models.VPNProvisionStatusPaused {
+		return nil, ErrVPNNotPaused
+	}
+	return s.resumeProvision(ctx, vp, reason)
+}
+
+// resumeProvision pushes expire_at (and the ledger) forward by the paused
+// duration and re-enables the otun user. The pause is capped at pause_ends_at,
+// so a late auto-resume doesn't extend the plan past the allowed days.
+func (s *VPNService) resumeProvision(ctx context.Context, vp *models.VPNProvision, reason string) (*models.VPNPauseResponse, error) {
+	now := time.Now()
+	pausedAt := now
+	if vp.PausedAt != nil {
+		pausedAt = *vp.PausedAt
+	}
+	resumeAt := now
+	if vp.PauseEndsAt != nil && vp.PauseEndsAt.Before(now) {
+		resumeAt = *vp.PauseEndsAt
+	}
+	paused := resumeAt.Sub(pausedAt)
+
+	// The conditional update claims the resume, so a concurrent resume (user and
+	// scheduler) shifts the ledger and re-enables the user only once
+	if err := s.vpnRepo.MarkResumed(ctx, vp.ID, paused); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrVPNNotPaused
+		}
+		return nil, err
+	}
+	if err := s.ledger.Shift(ctx, vp.UserID, pausedAt, paused); err != nil {
+		s.restorePaused(ctx, vp, paused)
+		return nil, fmt.Errorf("failed to shift entitlement grants: %w", err)
+	}
+
+	if vp.OtunUUID != nil && *vp.OtunUUID != "" {
+		if err := s.otunClient.EnableUser(ctx, *vp.OtunUUID); err != nil {
+			// 撤回账本顺延并恢复暂停状态，用户或调度器可重试恢复
+			if shiftErr := s.ledger.Shift(ctx, vp.UserID, pausedAt.Add(paused), -paused); shiftErr != nil {
+				log.Printf("[VPNService] Failed to undo grant shift for %s: %v", vp.ID, shiftErr)
+			}
+			s.restorePaused(ctx, vp, paused)
+			return nil, fmt.Errorf("failed to enable VPN user: %w", err)
+		}
+		if _, err := s.ledger.Push(ctx, vp.UserID, *vp.OtunUUID); err != nil {
+			log.Printf("[VPNService] Warning: failed to push limits after resume for %s: %v", vp.ID, err)
+		}
+	}
+
+	s.logRepo.LogActionWithMetadata(ctx, vp.ID, "vpn", "vpn_resumed", models.VPNProvisionStatusActive, reason,
+		map[string]interface{}{
+			"paused_at":      pausedAt.Format(time.RFC3339),
+			"paused_seconds": int64(paused.Seconds()),
+		})
+
+	log.Printf("[VPNService] VPN resumed: provision=%s, paused=%v", vp.ID, paused.Round(time.Second))
+
+	resp := &models.VPNPauseResponse{
+		ResourceID: vp.ID,
+		Status:     models.VPNProvisionStatusActive,
+	}
+	if updated, err := s.vpnRepo.GetByID(ctx, vp.ID); err == nil && updated.ExpireAt != nil {
+		resp.ExpireAt = updated.ExpireAt.Format(time.RFC3339)
+	}
+	return resp, nil
+}
+
+// restorePaused puts a provision whose resume failed back into the paused state
+func (s *VPNService) restorePaused(ctx context.Context, vp *models.VPNProvision, paused time.Duration) {
+	if err := s.vpnRepo.RestorePaused(ctx, vp, paused); err != nil {
+		log.Printf("[VPNService] Failed to restore paused state of %s: %v", vp.ID, err)
+	}
+}
+
 // DeprovisionVPNUser disables a VPN user
 func (s *VPNService) DeprovisionVPNUser(ctx context.Context, provisionID, reason string) error {
 	log.Printf("[VPNService] Deprovisioning VPN user: provision=%s, reason=%s", provisionID, reason)
@@ -281,10 +821,16 @@ func (s *VPNService) DeprovisionVPNUser(ctx context.Context, provisionID, reason
 		return fmt.Errorf("vpn provision not found: %w", err)
 	}
 
-	// Disable user in otun-manager
+	// Close this record's grants; otun-manager is disabled only if nothing else applies
+	if err := s.ledger.Revoke(ctx, vp.ID); err != nil {
+		log.Printf("[VPNService] Warning: failed to revoke entitlement grants: %v", err)
+	}
 	if vp.OtunUUID != nil && *vp.OtunUUID != "" {
-		if err := s.otunClient.DisableUser(ctx, *vp.OtunUUID); err != nil {
-			log.Printf("[VPNService] Warning: failed to disable VPN user in otun-manager: %v", err)
+		if resolved, err := s.ledger.Push(ctx, vp.UserID, *vp.OtunUUID); err != nil {
+			log.Printf("[VPNService] Warning: failed to update VPN user in otun-manager: %v", err)
+		} else if resolved.Active {
+			log.Printf("[VPNService] Other grants still apply for user=%s, VPN user kept until %s",
+				vp.UserID, resolved.ExpireAt.Format(time.RFC3339))
 		}
 	}
 
@@ -321,28 +867,31 @@ func (s *VPNService) UpdateVPNUser(ctx context.Context, provisionID string, req
 		return fmt.Errorf("VPN user ID not found in provision")
 	}
 
-	// Get current user info from otun-manager
-	userInfo, err := s.otunClient.GetUser(ctx, *vp.OtunUUID)
-	if err != nil {
-		return fmt.Errorf("failed to get VPN user from otun-manager: %w", err)
-	}
-
-	updateReq := &client.UpdateVPNUserRequest{}
+	// The adjusted grant replaces this record's purchase grant, so it starts from that
+	// grant's window and allowance. otun's expiry and limit are the resolved totals,
+	// which already include other grants (gifts, top-ups) and must not be folded in.
 	needUpdate := false
+	trafficLimit := s.calculateTrafficLimit(vp.PlanTier, 0)
+	var endsAt time.Time
+	grant, err := s.ledger.PurchaseGrant(ctx, vp.ID)
+	switch {
+	case err == nil:
+		trafficLimit = grant.TrafficBytes
+		endsAt = grant.EndsAt
+	case !errors.Is(err, repository.ErrNotFound):
+		return fmt.Errorf("failed to load entitlement grant: %w", err)
+	}
 
 	if req.TrafficLimit > 0 {
-		updateReq.TrafficLimit = req.TrafficLimit
-		vp.TrafficLimit = req.TrafficLimit
+		trafficLimit = req.TrafficLimit
 		needUpdate = true
 	}
 
 	if req.ExtendDays > 0 {
-		currentExpire, _ := time.Parse(time.RFC3339, userInfo.ExpireAt)
-		if currentExpire.Before(time.Now()) {
-			currentExpire = time.Now()
+		if endsAt.Before(time.Now()) {
+			endsAt = time.Now()
 		}
-		newExpire := currentExpire.AddDate(0, 0, req.ExtendDays)
-		updateReq.ExpireAt = newExpire.Format(time.RFC3339)
+		endsAt = endsAt.AddDate(0, 0, req.ExtendDays)
 		needUpdate = true
 	}
 
@@ -350,9 +899,7 @@ func (s *VPNService) UpdateVPNUser(ctx context.Context, provisionID string, req
 		vp.PlanTier = req.PlanTier
 		vp.ServiceTier = models.MapPlanToServiceTier(req.PlanTier)
 		if req.TrafficLimit == 0 {
-			newLimit := s.calculateTrafficLimit(req.PlanTier, 0)
-			updateReq.TrafficLimit = newLimit
-			vp.TrafficLimit = newLimit
+			trafficLimit = s.calculateTrafficLimit(req.PlanTier, 0)
 		}
 		needUpdate = true
 	}
@@ -360,10 +907,32 @@ func (s *VPNService) UpdateVPNUser(ctx context.Context, provisionID string, req
 	if !needUpdate {
 		return nil
 	}
+	if !endsAt.After(time.Now()) {
+		return fmt.Errorf("VPN user already expired, extend_days is required")
+	}
+
+	// Replace this record's grant with the adjusted one, then push the resolved result
+	if err := s.ledger.Supersede(ctx, vp.ID); err != nil {
+		return fmt.Errorf("failed to supersede entitlement grants: %w", err)
+	}
+	if err := s.ledger.Record(ctx, &models.EntitlementGrant{
+		UserID:         vp.UserID,
+		VPNProvisionID: vp.ID,
+		Source:         vp.BusinessType,
+		SourceRef:      "admin_update",
+		TrafficBytes:   trafficLimit,
+		EndsAt:         endsAt,
+		ServiceTier:    vp.ServiceTier,
+	}); err != nil {
+		return fmt.Errorf("failed to record entitlement grant: %w", err)
+	}
 
-	if err := s.otunClient.UpdateUser(ctx, *vp.OtunUUID, updateReq); err != nil {
+	resolved, err := s.ledger.Push(ctx, vp.UserID, *vp.OtunUUID)
+	if err != nil {
 		return fmt.Errorf("failed to update VPN user in otun-manager: %w", err)
 	}
+	vp.TrafficLimit = resolved.TrafficLimit
+	vp.ExpireAt = &resolved.ExpireAt
 
 	if err := s.vpnRepo.Update(ctx, vp); err != nil {
 		return fmt.Errorf("failed to update vpn provision: %w", err)
@@ -390,8 +959,14 @@ func (s *VPNService) GetUserVPNStatus(ctx context.Context, userID string) (*mode
 		subStatus = nil
 	}
 
-	// 2. Check VPN provision
+	// 2. Check VPN provision (a paused plan is not "active" but still the user's plan)
 	vp, _ := s.vpnRepo.GetCurrentByUser(ctx, userID)
+	if vp == nil {
+		if current, err := s.vpnRepo.GetCurrentByUserAnyStatus(ctx, userID); err == nil &&
+			current.Status == models.VPNProvisionStatusPaused {
+			vp = current
+		}
+	}
 
 	// 3. Build response
 	resp := &models.VPNStatusResponse{}
@@ -450,6 +1025,14 @@ func (s *VPNService) GetUserVPNStatus(ctx context.Context, userID string) (*mode
 		ExpireAt:       expireAtStr,
 		CreatedAt:      vp.CreatedAt.Format(time.RFC3339),
 	}
+	resp.VPNUser.TopUpRemainingGB = float64(s.topUpRemaining(ctx, vp)) / (1024 * 1024 * 1024)
+	if vp.CycleMonths > 0 && vp.CycleStartedAt != nil && vp.CycleEndsAt != nil {
+		resp.VPNUser.TrafficCycle = &models.TrafficCycleInfo{
+			AllowanceGB: float64(vp.CycleAllowance) / (1024 * 1024 * 1024),
+			StartedAt:   vp.CycleStartedAt.Format(time.RFC3339),
+			ResetsAt:    vp.CycleEndsAt.Format(time.RFC3339),
+		}
+	}
 
 	switch vp.Status {
 	case models.VPNProvisionStatusActive:
@@ -458,6 +1041,10 @@ func (s *VPNService) GetUserVPNStatus(ctx context.Context, userID string) (*mode
 	case models.VPNProvisionStatusExpired:
 		resp.VPNStatus = models.VPNStatusExpired
 		resp.Message = "VPN subscription expired."
+	case models.VPNProvisionStatusPaused:
+		resp.VPNStatus = models.VPNStatusPaused
+		resp.VPNUser.Pause = s.pauseInfo(vp)
+		resp.Message = "VPN is paused. Resume to continue using it."
 	default:
 		resp.VPNStatus = models.VPNStatusDisabled
 		resp.Message = "VPN is currently disabled."
@@ -578,6 +1165,50 @@ func (s *VPNService) UpdateUserEmail(ctx context.Context, userID, email string)
 
 // Helper functions
 
+// topUpRemaining returns the unconsumed top-up bytes, charging current usage
+// to the base allowance first
+func (s *VPNService) topUpRemaining(ctx context.Context, vp *models.VPNProvision) int64 {
+	topups, err := s.topupRepo.ListActiveByUser(ctx, vp.UserID)
+	if err != nil || len(topups) == 0 {
+		return 0
+	}
+	resolved, err := s.ledger.Resolve(ctx, vp.UserID)
+	if err != nil {
+		return 0
+	}
+
+	var remaining int64
+	for _, t := range topups {
+		remaining += t.RemainingBytes()
+	}
+	if overflow := vp.TrafficUsed - resolved.BaseTrafficLimit; overflow > 0 {
+		remaining -= overflow
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// pauseInfo builds the user-facing pause state of a paused provision
+func (s *VPNService) pauseInfo(vp *models.VPNProvision) *models.VPNPauseInfo {
+	if vp.PausedAt == nil {
+		return nil
+	}
+	limit := s.cfg.Pause.LimitFor(vp.PlanTier)
+	info := &models.VPNPauseInfo{
+		PausedAt:           vp.PausedAt.Format(time.RFC3339),
+		RemainingDays:      float64(vp.PausedRemainingSeconds) / 86400,
+		RemainingTrafficGB: float64(vp.PausedRemainingTraffic) / (1024 * 1024 * 1024),
+		PausesUsed:         vp.PauseCount,
+		PausesAllowed:      limit.MaxCount,
+	}
+	if vp.PauseEndsAt != nil {
+		info.AutoResumeAt = vp.PauseEndsAt.Format(time.RFC3339)
+	}
+	return info
+}
+
 // calculateTrafficLimit calculates traffic limit based on plan tier
 func (s *VPNService) calculateTrafficLimit(planTier string, override int64) int64 {
 	if override > 0 {
@@ -604,7 +1235,7 @@ func (s *VPNService) calculateTrafficLimit(planTier string, override int64) int6
 func (s *VPNService) calculateExpireDays(channel string, requestedDays int) int {
 	switch channel {
 	case "apple", "google":
-		// Subscription-based: platform manages renewal cycle, fixed 30 days
+		// Legacy callers without expires_at/period: fixed 30 days
 		return 30
 	default:
 		// Purchase-based (Stripe etc): use requested days
@@ -615,6 +1246,92 @@ func (s *VPNService) calculateExpireDays(channel string, requestedDays int) int
 	}
 }
 
+// calculateStoreExpireAt derives expiry from what subscription-service reports:
+//   - expires_at: the store's own expiry plus STORE_EXPIRY_GRACE_HOURS
+//   - period only: one calendar period from now plus grace (yearly = +1 year, not 365 × days)
+//
+// Returns false when neither is usable, so callers fall back to expire_days / 30 days.
+// Only apple/google purchases carry a store expiry; other channels (e.g. stripe) keep
+// stacking onto the current expiry.
+func (s *VPNService) calculateStoreExpireAt(req *models.ProvisionRequest) (time.Time, bool) {
+	if req.Channel != "apple" && req.Channel != "google" {
+		return time.Time{}, false
+	}
+	grace := time.Duration(s.cfg.Store.ExpiryGraceHours) * time.Hour
+	now := time.Now()
+
+	if req.ExpiresAt != nil {
+		expireAt := req.ExpiresAt.Add(grace)
+		if expireAt.After(now) {
+			return expireAt, true
+		}
+		log.Printf("[VPNService] Ignoring stale store expires_at=%s for subscription=%s",
+			req.ExpiresAt.Format(time.RFC3339), req.SubscriptionID)
+	}
+
+	switch req.Period {
+	case "weekly":
+		return now.AddDate(0, 0, 7).Add(grace), true
+	case "monthly":
+		return now.AddDate(0, 1, 0).Add(grace), true
+	case "yearly":
+		return now.AddDate(1, 0, 0).Add(grace), true
+	}
+	return time.Time{}, false
+}
+
+// extendsStoreExpiry reports whether a store renewal for an already provisioned
+// subscription moves the expiry forward (same subscription_id, new period).
+// The expiry is compared with the provision's purchase grant, not the resolved
+// expire_at, which may already be extended by other grants (e.g. a gift).
+func (s *VPNService) extendsStoreExpiry(ctx context.Context, req *models.ProvisionRequest, existing *models.VPNProvision) bool {
+	if req.ExpiresAt == nil {
+		return false
+	}
+	expireAt, ok := s.calculateStoreExpireAt(req)
+	if !ok {
+		return false
+	}
+	grant, err := s.ledger.PurchaseGrant(ctx, existing.ID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("[VPNService] Failed to load purchase grant of %s: %v", existing.ID, err)
+			return false
+		}
+		// 没有有效的购买记录（已结束或升级前的数据）：只要新到期时间在未来就续期
+		return expireAt.After(time.Now())
+	}
+	return expireAt.After(grant.EndsAt)
+}
+
+// applyTrafficCycle turns on per-cycle traffic allowances when the plan window is
+// longer than TRAFFIC_CYCLE_MIN_PLAN_DAYS (e.g. annual plans). On renewal the
+// existing anchor is kept so cycle boundaries don't move.
+func (s *VPNService) applyTrafficCycle(vp *models.VPNProvision, allowance int64, expireAt time.Time) {
+	cfg := s.cfg.TrafficCycle
+	minWindow := time.Duration(cfg.MinPlanDays) * 24 * time.Hour
+	if !cfg.Enabled || cfg.Months <= 0 || time.Until(expireAt) <= minWindow {
+		vp.CycleAnchor = nil
+		vp.CycleMonths = 0
+		vp.CycleAllowance = 0
+		vp.CycleStartedAt = nil
+		vp.CycleEndsAt = nil
+		return
+	}
+
+	vp.CycleAllowance = allowance
+	if vp.CycleMonths > 0 && vp.CycleAnchor != nil {
+		return
+	}
+
+	now := time.Now()
+	start, end := models.CycleWindow(now, cfg.Months, now)
+	vp.CycleAnchor = &now
+	vp.CycleMonths = cfg.Months
+	vp.CycleStartedAt = &start
+	vp.CycleEndsAt = &end
+}
+
 // calculateExpireAt calculates expiration time from now (for new users)
 func (s *VPNService) calculateExpireAt(days int) time.Time {
 	if days <= 0 {
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// WarmPoolScheduler 预热节点池补充任务
+// 定期将每个池补充到当前时段的目标数量，超出目标时回收空闲最久的节点
+type WarmPoolScheduler struct {
+	warmPool *WarmPoolService
+	interval time.Duration
+}
+
+// NewWarmPoolScheduler 创建预热节点池调度器
+func NewWarmPoolScheduler(warmPool *WarmPoolService, interval time.Duration) *WarmPoolScheduler {
+	return &WarmPoolScheduler{
+		warmPool: warmPool,
+		interval: interval,
+	}
+}
+
+// Start 启动调度器（阻塞运行，应在 goroutine 中调用）
+func (s *WarmPoolScheduler) Start(ctx context.Context) {
+	log.Printf("[WarmPoolScheduler] Started (interval=%v)", s.interval)
+
+	// 启动时立即补充一次，避免等待一个周期
+	s.warmPool.Replenish(ctx)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("[WarmPoolScheduler] Stopped")
+			return
+		case <-ticker.C:
+			s.warmPool.Replenish(ctx)
+		}
+	}
+}
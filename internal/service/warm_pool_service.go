@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/client"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/config"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/models"
+	"github.com/wenwu/saas-platform/fulfillment-service/internal/repository"
+)
+
+// warmPoolOwner 池节点在 hosting-service 中的占位归属，领取后通过 AssignNode 转移
+const warmPoolOwner = "warm-pool"
+
+const (
+	// warmClaimAttempts 领取时最多检查的就绪节点数，不健康的节点删除后换下一个
+	warmClaimAttempts = 3
+	// warmClaimGrace 领取后到 provision 记录节点之前，CleanupScheduler 仍按池节点跳过
+	warmClaimGrace = time.Hour
+	// warmHealthTimeout 领取前 VLESS 端口握手的超时
+	warmHealthTimeout = 5 * time.Second
+)
+
+// WarmPoolService keeps pre-provisioned, unassigned nodes ready for instant delivery
+type WarmPoolService struct {
+	cfg           *config.Config
+	warmRepo      *repository.WarmNodeRepository
+	hostingClient *client.HostingClient
+	createQueue   *NodeCreateQueue
+	nodeEvents    *NodeEventHub
+}
+
+// NewWarmPoolService creates a warm pool service
+func NewWarmPoolService(cfg *config.Config, warmRepo *repository.WarmNodeRepository, hostingClient *client.HostingClient, createQueue *NodeCreateQueue, nodeEvents *NodeEventHub) *WarmPoolService {
+	return &WarmPoolService{
+		cfg:           cfg,
+		warmRepo:      warmRepo,
+		hostingClient: hostingClient,
+		createQueue:   createQueue,
+		nodeEvents:    nodeEvents,
+	}
+}
+
+// Claim atomically takes a ready node of the given region and bundle and checks
+// it is still healthy; unhealthy nodes are discarded and the next one is tried.
+// Returns repository.ErrNotFound when the pool is disabled or empty.
+func (s *WarmPoolService) Claim(ctx context.Context, region, bundleID, provisionID string) (*models.WarmNode, error) {
+	if !s.cfg.WarmPool.Enabled {
+		return nil, repository.ErrNotFound
+	}
+	for range warmClaimAttempts {
+		wn, err := s.warmRepo.Claim(ctx, region, bundleID, provisionID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkHealth(ctx, wn); err != nil {
+			s.Discard(ctx, wn, "unhealthy at claim: "+err.Error())
+			continue
+		}
+		return wn, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+// checkHealth 领取前确认节点在 hosting-service 中仍为 active 且 VLESS 端口可连接
+// 池节点可能空闲数小时，期间被云厂商回收或 agent 异常
+func (s *WarmPoolService) checkHealth(ctx context.Context, wn *models.WarmNode) error {
+	if wn.HostingNodeID == nil {
+		return errors.New("no hosting node id")
+	}
+	node, err := s.hostingClient.GetNode(ctx, *wn.HostingNodeID)
+	if err != nil {
+		return err
+	}
+	if node.Status != models.StatusActive {
+		return fmt.Errorf("node is %s", node.Status)
+	}
+	if node.PublicIP == "" || node.VLESSPort == 0 {
+		return errors.New("node has no public endpoint")
+	}
+	dialer := &net.Dialer{Timeout: warmHealthTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(node.PublicIP, strconv.Itoa(node.VLESSPort)))
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// Discard deletes a claimed node that could not be handed over
+func (s *WarmPoolService) Discard(ctx context.Context, wn *models.WarmNode, reason string) {
+	log.Printf("[WarmPool] Discarding warm node %s: %s", wn.ID, reason)
+	if wn.HostingNodeID != nil {
+		if _, err := s.hostingClient.DeleteNode(ctx, *wn.HostingNodeID); err != nil {
+			log.Printf("[WarmPool] WARN: failed to delete warm node %s: %v (will be removed by CleanupScheduler)", *wn.HostingNodeID, err)
+		}
+	}
+	if err := s.warmRepo.MarkDeleted(ctx, wn.ID); err != nil {
+		log.Printf("[WarmPool] Failed to mark warm node %s deleted: %v", wn.ID, err)
+	}
+}
+
+// IsPoolNode reports whether a hosting node is an unclaimed pool node
+func (s *WarmPoolService) IsPoolNode(ctx context.Context, hostingNodeID string) bool {
+	ok, err := s.warmRepo.IsPoolNode(ctx, hostingNodeID, warmClaimGrace)
+	if err != nil {
+		// 查询失败时按池节点处理，宁可漏删也不误删
+		log.Printf("[WarmPool] Failed to check pool node %s: %v", hostingNodeID, err)
+		return true
+	}
+	return ok
+}
+
+// Replenish brings every pool to its current target, within the node and budget caps
+// 低于目标时补充创建；高于目标（如高峰结束）时删除空闲最久的就绪节点
+func (s *WarmPoolService) Replenish(ctx context.Context) {
+	// 多副本时只有一个副本执行本轮补充，避免同时按同一计数超额创建
+	unlock, ok, err := s.warmRepo.TryLockReplenish(ctx)
+	if err != nil {
+		log.Printf("[WarmPool] Failed to take replenish lock: %v", err)
+		return
+	}
+	if !ok {
+		log.Printf("[WarmPool] Replenish already running on another replica, skipping")
+		return
+	}
+	defer unlock()
+
+	s.expireStuckNodes(ctx)
+
+	counts, err := s.warmRepo.CountPending(ctx)
+	if err != nil {
+		log.Printf("[WarmPool] Failed to count pool nodes: %v", err)
+		return
+	}
+
+	byPool := make(map[string]repository.WarmPoolCount)
+	total := 0
+	for _, c := range counts {
+		byPool[c.Region+"/"+c.BundleID] = c
+		total += c.Creating + c.Ready
+	}
+
+	withinBudget := s.withinBudget(ctx)
+	now := time.Now()
+	for _, t := range s.cfg.WarmPool.Pools {
+		want := s.cfg.WarmPool.TargetAt(t, now)
+		c := byPool[t.Region+"/"+t.BundleID]
+		have := c.Creating + c.Ready
+
+		if have > want {
+			s.shrink(ctx, t, min(have-want, c.Ready))
+			continue
+		}
+
+		for i := have; i < want; i++ {
+			if total >= s.cfg.WarmPool.MaxNodes {
+				log.Printf("[WarmPool] Node cap reached (%d), not replenishing %s/%s", s.cfg.WarmPool.MaxNodes, t.Region, t.BundleID)
+				break
+			}
+			if !withinBudget {
+				log.Printf("[WarmPool] Monthly budget reached, not replenishing %s/%s", t.Region, t.BundleID)
+				break
+			}
+			if err := s.addNode(ctx, t); err != nil {
+				log.Printf("[WarmPool] Failed to add node to %s/%s: %v", t.Region, t.BundleID, err)
+				break
+			}
+			total++
+		}
+	}
+}
+
+// expireStuckNodes 回收停留在 creating 超过 WARM_POOL_CREATE_TIMEOUT_MINUTES 的节点
+// 创建协程随进程退出而中断时记录会一直停在 creating，占用目标数和 MaxNodes，
+// 其云实例也一直被当作池节点跳过孤立清理
+func (s *WarmPoolService) expireStuckNodes(ctx context.Context) {
+	timeout := time.Duration(max(s.cfg.WarmPool.CreateTimeout, 1)) * time.Minute
+	stuck, err := s.warmRepo.ListStuckCreating(ctx, time.Now().Add(-timeout))
+	if err != nil {
+		log.Printf("[WarmPool] Failed to list stuck warm nodes: %v", err)
+		return
+	}
+	for _, wn := range stuck {
+		// 先改状态：仍在运行的创建协程随后 MarkReady 失败，自行删除节点
+		if err := s.warmRepo.MarkFailed(ctx, wn.ID, fmt.Sprintf("still creating after %v", timeout)); err != nil {
+			continue
+		}
+		log.Printf("[WarmPool] Warm node %s stuck in creating for over %v, giving up", wn.ID, timeout)
+		if wn.HostingNodeID != nil {
+			if _, err := s.hostingClient.DeleteNode(ctx, *wn.HostingNodeID); err != nil {
+				log.Printf("[WarmPool] WARN: failed to delete stuck warm node %s: %v (will be removed by CleanupScheduler)", *wn.HostingNodeID, err)
+			}
+		}
+	}
+}
+
+// withinBudget 当月池节点空闲成本是否低于 WARM_POOL_MONTHLY_BUDGET_USD
+func (s *WarmPoolService) withinBudget(ctx context.Context) bool {
+	if s.cfg.WarmPool.MonthlyBudgetUSD <= 0 {
+		return true
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	hours, err := s.warmRepo.IdleHoursSince(ctx, monthStart)
+	if err != nil {
+		log.Printf("[WarmPool] Failed to compute idle cost: %v", err)
+		return false
+	}
+
+	cost := 0.0
+	for bundleID, h := range hours {
+		cost += h * s.cfg.WarmPool.BundleHourlyCost[bundleID]
+	}
+	return cost < float64(s.cfg.WarmPool.MonthlyBudgetUSD)
+}
+
+// shrink deletes the n longest-idle ready nodes of a pool
+func (s *WarmPoolService) shrink(ctx context.Context, t config.WarmPoolTarget, n int) {
+	if n <= 0 {
+		return
+	}
+	ready, err := s.warmRepo.ListReady(ctx, t.Region, t.BundleID)
+	if err != nil {
+		log.Printf("[WarmPool] Failed to list ready nodes of %s/%s: %v", t.Region, t.BundleID, err)
+		return
+	}
+	for _, wn := range ready[:min(n, len(ready))] {
+		s.Discard(ctx, wn, "pool above target")
+	}
+}
+
+// addNode records a new pool node and creates it in the background
+func (s *WarmPoolService) addNode(ctx context.Context, t config.WarmPoolTarget) error {
+	wn := &models.WarmNode{
+		ID:       uuid.New().String(),
+		Provider: s.cfg.Hosting.CloudProvider,
+		Region:   t.Region,
+		BundleID: t.BundleID,
+		Status:   models.WarmNodeStatusCreating,
+	}
+	if err := s.warmRepo.Create(ctx, wn); err != nil {
+		return err
+	}
+
+	go s.createAsync(wn)
+	return nil
+}
+
+func (s *WarmPoolService) createAsync(wn *models.WarmNode) {
+	ctx := context.Background()
+
+	// 预热池优先级最低，用户的创建请求排在前面
+	release, err := s.createQueue.Acquire(ctx, wn.ID, PriorityWarmPool, wn.Provider, wn.Region)
+	if err != nil {
+		s.warmRepo.MarkFailed(ctx, wn.ID, err.Error())
+		return
+	}
+	defer release()
+
+	createResp, err := s.hostingClient.CreateNode(ctx, &client.CreateNodeRequest{
+		CloudProvider:  wn.Provider,
+		Region:         wn.Region,
+		BundleID:       wn.BundleID,
+		SubscriptionID: warmPoolOwner,
+		UserID:         warmPoolOwner,
+	})
+	if err != nil {
+		log.Printf("[WarmPool] Failed to create warm node %s: %v", wn.ID, err)
+		s.warmRepo.MarkFailed(ctx, wn.ID, err.Error())
+		return
+	}
+	nodeID := createResp.NodeID
+	wn.HostingNodeID = &nodeID
+	s.warmRepo.SetNode(ctx, wn.ID, nodeID)
+
+	if _, err := s.nodeEvents.WaitForNodeReady(ctx, nodeID, 10*time.Minute); err != nil {
+		log.Printf("[WarmPool] Warm node %s failed to become ready: %v", nodeID, err)
+		if _, cleanupErr := s.hostingClient.DeleteNode(ctx, nodeID); cleanupErr != nil {
+			log.Printf("[WarmPool] WARN: failed to cleanup warm node %s: %v", nodeID, cleanupErr)
+		}
+		s.warmRepo.MarkFailed(ctx, wn.ID, err.Error())
+		return
+	}
+
+	if err := s.warmRepo.MarkReady(ctx, wn.ID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// 创建超时已被回收，节点不再属于池
+			log.Printf("[WarmPool] Warm node %s was expired while creating, deleting %s", wn.ID, nodeID)
+			if _, err := s.hostingClient.DeleteNode(ctx, nodeID); err != nil {
+				log.Printf("[WarmPool] WARN: failed to delete expired warm node %s: %v", nodeID, err)
+			}
+			return
+		}
+		log.Printf("[WarmPool] Failed to mark warm node %s ready: %v", wn.ID, err)
+		return
+	}
+	log.Printf("[WarmPool] Warm node %s ready in %s/%s", nodeID, wn.Region, wn.BundleID)
+}
@@ -0,0 +1,8 @@
+-- 008: 节点凭据轮换
+-- 用户分享过节点配置后，可以重新生成 APIKey / Reality PublicKey / ShortID 来切断他人访问，
+-- 无需重建 VPS。旧 APIKey 在重叠窗口内仍然有效，避免客户端瞬间断连。
+
+ALTER TABLE fulfillment.hosting_provisions
+    ADD COLUMN IF NOT EXISTS previous_api_key            VARCHAR(256),
+    ADD COLUMN IF NOT EXISTS previous_api_key_expires_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS credentials_rotated_at      TIMESTAMPTZ;
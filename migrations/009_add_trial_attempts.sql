@@ -0,0 +1,34 @@
+-- 009: 试用资格评估记录
+-- vpn_provisions 上的唯一索引只能拦截完全相同的 device_id / email，
+-- 加号邮箱、一次性邮箱域名、重置设备 ID 都能绕过。
+-- trial_attempts 记录每次试用申请及评估结果，用于按 IP / 设备 / 账号统计频率，
+-- 并支持管理员人工复核（override）。
+
+CREATE TABLE IF NOT EXISTS fulfillment.trial_attempts (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id           VARCHAR(256) NOT NULL,
+    email             VARCHAR(255) DEFAULT '',
+    normalized_email  VARCHAR(255) DEFAULT '',
+    device_id         VARCHAR(255) DEFAULT '',
+    ip_address        VARCHAR(64) DEFAULT '',
+
+    -- 评估结果: allow / deny / review
+    decision          VARCHAR(16) NOT NULL,
+    score             INT NOT NULL DEFAULT 0,
+    reasons           JSONB NOT NULL DEFAULT '[]',
+
+    -- 管理员复核
+    override_decision VARCHAR(16),
+    overridden_by     VARCHAR(100),
+    override_note     TEXT,
+    overridden_at     TIMESTAMPTZ,
+
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_trial_attempts_user ON fulfillment.trial_attempts(user_id, created_at DESC);
+CREATE INDEX idx_trial_attempts_email ON fulfillment.trial_attempts(normalized_email) WHERE normalized_email != '';
+CREATE INDEX idx_trial_attempts_device ON fulfillment.trial_attempts(device_id, created_at DESC) WHERE device_id != '';
+CREATE INDEX idx_trial_attempts_ip ON fulfillment.trial_attempts(ip_address, created_at DESC) WHERE ip_address != '';
+CREATE INDEX idx_trial_attempts_review ON fulfillment.trial_attempts(created_at DESC)
+    WHERE decision = 'review' AND override_decision IS NULL;
@@ -0,0 +1,42 @@
+-- 010: 兑换码 / 代金券
+-- GiftEntitlement 需要管理员知道目标 user_id，市场活动需要可分发的兑换码。
+-- vouchers 每行一个兑换码（按 batch_id 成批生成），voucher_redemptions 记录兑换明细，
+-- 同一用户不能重复兑换同一个码。
+
+CREATE TABLE IF NOT EXISTS fulfillment.vouchers (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code              VARCHAR(32) NOT NULL UNIQUE,
+    batch_id          UUID NOT NULL,
+    campaign          VARCHAR(100) NOT NULL DEFAULT '',
+
+    -- 兑换内容
+    traffic_gb        INT NOT NULL,
+    duration_days     INT NOT NULL,
+    service_tier      VARCHAR(32) NOT NULL DEFAULT 'standard',
+
+    -- 兑换限制
+    max_redemptions   INT NOT NULL DEFAULT 1,
+    redeemed_count    INT NOT NULL DEFAULT 0,
+    valid_from        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    valid_until       TIMESTAMPTZ NOT NULL,
+    disabled          BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_by        VARCHAR(100) DEFAULT 'admin',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT chk_vouchers_redemptions CHECK (redeemed_count <= max_redemptions)
+);
+
+CREATE INDEX idx_vouchers_batch ON fulfillment.vouchers(batch_id);
+CREATE INDEX idx_vouchers_campaign ON fulfillment.vouchers(campaign);
+
+CREATE TABLE IF NOT EXISTS fulfillment.voucher_redemptions (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    voucher_id        UUID NOT NULL REFERENCES fulfillment.vouchers(id),
+    user_id           VARCHAR(256) NOT NULL,
+    vpn_provision_id  UUID,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_voucher_redemptions_user ON fulfillment.voucher_redemptions(voucher_id, user_id);
@@ -0,0 +1,54 @@
+-- 011: 权益账本（entitlement_grants）
+-- 之前赠送、试用转化、续费都直接用新的 traffic_limit / expire_at 覆盖 otun 用户，
+-- 例如给付费用户赠送 30 天会把付费到期时间覆盖掉。
+-- 改为只追加的授予记录：每条记录一个来源、流量额度、时间窗口和优先级，
+-- 由 resolver 汇总所有有效授予后再推送到 otun-manager，
+-- vpn_provisions 上的 traffic_limit / expire_at 只是汇总结果的投影。
+
+CREATE TABLE IF NOT EXISTS fulfillment.entitlement_grants (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id           VARCHAR(256) NOT NULL,
+    vpn_provision_id  UUID,
+
+    -- 来源: subscription / purchase / trial / gift / voucher / adjustment
+    source            VARCHAR(32) NOT NULL,
+    source_ref        VARCHAR(256) DEFAULT '',
+
+    traffic_bytes     BIGINT NOT NULL DEFAULT 0,
+    starts_at         TIMESTAMPTZ NOT NULL,
+    ends_at           TIMESTAMPTZ NOT NULL,
+    priority          INT NOT NULL DEFAULT 0,
+    service_tier      VARCHAR(32) NOT NULL DEFAULT 'standard',
+
+    -- active / superseded / revoked（记录本身不删除）
+    status            VARCHAR(16) NOT NULL DEFAULT 'active',
+
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    closed_at         TIMESTAMPTZ,
+
+    CONSTRAINT chk_grant_window CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX idx_grants_user_active ON fulfillment.entitlement_grants(user_id, ends_at)
+    WHERE status = 'active';
+CREATE INDEX idx_grants_provision ON fulfillment.entitlement_grants(vpn_provision_id);
+
+-- 回填：现有有效记录各生成一条授予，保证 resolver 对老用户结果一致
+INSERT INTO fulfillment.entitlement_grants (
+    user_id, vpn_provision_id, source, source_ref,
+    traffic_bytes, starts_at, ends_at, priority, service_tier
+)
+SELECT
+    user_id, id,
+    CASE WHEN granted_by LIKE 'voucher:%' THEN 'voucher' ELSE business_type END,
+    COALESCE(subscription_id, ''),
+    COALESCE(traffic_limit, 0), created_at, expire_at,
+    CASE business_type
+        WHEN 'subscription' THEN 100
+        WHEN 'purchase' THEN 100
+        WHEN 'gift' THEN 50
+        ELSE 10
+    END,
+    service_tier
+FROM fulfillment.vpn_provisions
+WHERE status = 'active' AND expire_at IS NOT NULL AND expire_at > created_at;
@@ -0,0 +1,37 @@
+-- 012: 一次性流量加油包
+-- 加油包只增加当前周期的流量，不改变 expire_at。
+-- entitlement_grants.additive 标记叠加型授予：resolver 把它加在基础额度之上，
+-- 不参与到期时间计算。traffic_topups 为每次购买的独立明细，
+-- 记录已消耗字节（先扣基础额度，超出部分再扣加油包）。
+
+ALTER TABLE fulfillment.entitlement_grants
+    ADD COLUMN IF NOT EXISTS additive BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS fulfillment.traffic_topups (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id           VARCHAR(256) NOT NULL,
+    vpn_provision_id  UUID NOT NULL,
+    grant_id          UUID,
+
+    -- 订单引用（subscription-service 传入的 subscription_id / 订单号），用于幂等
+    source_ref        VARCHAR(256) DEFAULT '',
+    product_id        VARCHAR(128) DEFAULT '',
+
+    bytes             BIGINT NOT NULL,
+    consumed_bytes    BIGINT NOT NULL DEFAULT 0,
+    carry_over        BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at        TIMESTAMPTZ NOT NULL,
+
+    -- active / consumed / expired / revoked
+    status            VARCHAR(16) NOT NULL DEFAULT 'active',
+
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CONSTRAINT chk_topup_bytes CHECK (bytes > 0 AND consumed_bytes >= 0)
+);
+
+CREATE INDEX idx_topups_user_active ON fulfillment.traffic_topups(user_id, expires_at)
+    WHERE status = 'active';
+CREATE UNIQUE INDEX idx_topups_source_ref ON fulfillment.traffic_topups(source_ref)
+    WHERE source_ref != '';
@@ -0,0 +1,28 @@
+-- 013: 长周期套餐的按月流量重置
+-- 年付套餐之前在整个 expire_at 窗口内只有一个 traffic_limit。
+-- 改为按周期计费：cycle_anchor 为起算日，cycle_months 为周期长度（0 表示不分周期），
+-- cycle_allowance 为每个周期的流量额度。调度器在周期边界重置 otun-manager 的 traffic_used，
+-- 并把上一周期的用量归档到 vpn_traffic_cycles。
+
+ALTER TABLE fulfillment.vpn_provisions
+    ADD COLUMN IF NOT EXISTS cycle_anchor      TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS cycle_months      INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cycle_allowance   BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cycle_started_at  TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS cycle_ends_at     TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_vpn_prov_cycle_due ON fulfillment.vpn_provisions(cycle_ends_at)
+    WHERE cycle_months > 0 AND status = 'active' AND is_current = TRUE;
+
+CREATE TABLE IF NOT EXISTS fulfillment.vpn_traffic_cycles (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    vpn_provision_id  UUID NOT NULL,
+    user_id           VARCHAR(256) NOT NULL,
+    cycle_start       TIMESTAMPTZ NOT NULL,
+    cycle_end         TIMESTAMPTZ NOT NULL,
+    allowance         BIGINT NOT NULL DEFAULT 0,
+    traffic_used      BIGINT NOT NULL DEFAULT 0,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_traffic_cycles_provision ON fulfillment.vpn_traffic_cycles(vpn_provision_id, cycle_start DESC);
@@ -0,0 +1,16 @@
+-- 014: VPN 套餐暂停/恢复
+-- 暂停时禁用 otun 用户并记录剩余时长和剩余流量，status 设为 paused。
+-- 恢复时 expire_at（以及账本中仍有效的授予、流量周期）顺延暂停时长。
+-- pause_count / paused_seconds 按 provision 累计，用于套餐级别的次数和天数上限；
+-- pause_ends_at 为达到最长暂停天数的时间点，调度器到点自动恢复。
+
+ALTER TABLE fulfillment.vpn_provisions
+    ADD COLUMN IF NOT EXISTS paused_at                 TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS pause_ends_at             TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS pause_count               INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS paused_seconds            BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS paused_remaining_seconds  BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS paused_remaining_traffic  BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_vpn_prov_pause_due ON fulfillment.vpn_provisions(pause_ends_at)
+    WHERE status = 'paused';
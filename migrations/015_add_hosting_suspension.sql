@@ -0,0 +1,11 @@
+-- 015: Hosting 节点宽限期暂停
+-- 订阅失效时不再立即删除 VPS，而是先停机（status = stopped）并保留 HOSTING_SUSPEND_GRACE_HOURS。
+-- 宽限期内订阅恢复则重新启动节点（保留原节点和 IP），到期仍未恢复由调度器删除。
+
+ALTER TABLE fulfillment.hosting_provisions
+    ADD COLUMN IF NOT EXISTS suspended_at    TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS suspend_until   TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS suspend_reason  VARCHAR(256);
+
+CREATE INDEX IF NOT EXISTS idx_hosting_prov_suspend_due ON fulfillment.hosting_provisions(suspend_until)
+    WHERE status = 'stopped' AND deleted_at IS NULL;
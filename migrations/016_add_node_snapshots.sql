@@ -0,0 +1,36 @@
+-- 016: 删除前快照与恢复
+-- 订阅失效删除节点前（可选，HOSTING_SNAPSHOT_ON_DELETE）通过 hosting-service 打快照，
+-- 保留 HOSTING_SNAPSHOT_RETENTION_DAYS 天。用户在保留期内重新创建同区域节点时从快照启动，
+-- 恢复 Reality 密钥和节点配置。过期快照由 CleanupScheduler 删除。
+
+CREATE TABLE IF NOT EXISTS fulfillment.node_snapshots (
+    id                    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id               VARCHAR(256) NOT NULL,
+    hosting_provision_id  UUID NOT NULL,
+    hosting_node_id       VARCHAR(128) NOT NULL,
+
+    -- hosting-service 中的快照 ID
+    snapshot_ref          VARCHAR(256) NOT NULL,
+    provider              VARCHAR(32) NOT NULL,
+    region                VARCHAR(64) NOT NULL,
+    plan_tier             VARCHAR(32) DEFAULT '',
+
+    -- 快照时的节点凭据（恢复后回填，hosting-service 未返回时兜底）
+    api_key               VARCHAR(256),
+    public_key            VARCHAR(256),
+    short_id              VARCHAR(64),
+
+    -- available: 可恢复, restored: 已用于恢复, deleted: 已删除
+    status                VARCHAR(32) NOT NULL DEFAULT 'available',
+    expires_at            TIMESTAMPTZ NOT NULL,
+    restored_provision_id UUID,
+
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    restored_at           TIMESTAMPTZ,
+    deleted_at            TIMESTAMPTZ
+);
+
+CREATE INDEX idx_node_snapshots_user ON fulfillment.node_snapshots(user_id, created_at DESC)
+    WHERE status = 'available';
+CREATE INDEX idx_node_snapshots_expires ON fulfillment.node_snapshots(expires_at)
+    WHERE status IN ('available', 'restored');
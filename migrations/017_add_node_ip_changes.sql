@@ -0,0 +1,21 @@
+-- 017: 节点更换公网 IP
+-- 部分地区节点 IP 被封锁时，用户可通过 hosting-service 更换静态 IP（保留节点和密钥）。
+-- 每次更换记录旧/新 IP，同时用于按套餐的每月次数限制（HOSTING_IP_CHANGE_LIMITS）。
+
+CREATE TABLE IF NOT EXISTS fulfillment.node_ip_changes (
+    id                    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    hosting_provision_id  UUID NOT NULL,
+    user_id               VARCHAR(256) NOT NULL,
+    hosting_node_id       VARCHAR(128) NOT NULL,
+
+    old_ip                VARCHAR(64),
+    new_ip                VARCHAR(64) NOT NULL,
+    reason                VARCHAR(256) DEFAULT '',
+    -- user / admin（admin 不计入配额）
+    initiated_by          VARCHAR(32) NOT NULL DEFAULT 'user',
+
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_node_ip_changes_provision ON fulfillment.node_ip_changes(hosting_provision_id, created_at DESC);
+CREATE INDEX idx_node_ip_changes_user ON fulfillment.node_ip_changes(user_id, created_at DESC);
@@ -0,0 +1,27 @@
+-- 018: 节点可达性探测
+-- ProbeScheduler 定期检查 VLESS/SS 端口 TCP 握手和节点 agent /health，结果写入 node_probe_results。
+-- 外部探测点（目标市场内的 vantage point）通过内部接口上报，source 为探测点标识。
+-- 内部探测连续失败 N 次标记 degraded；内部正常但外部连续失败 N 次标记 blocked（IP 疑似被封锁）。
+
+ALTER TABLE fulfillment.hosting_provisions
+    ADD COLUMN IF NOT EXISTS health_status            VARCHAR(32) NOT NULL DEFAULT 'unknown',
+    ADD COLUMN IF NOT EXISTS probe_failures           INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS external_probe_failures  INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_probed_at           TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS health_changed_at        TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS fulfillment.node_probe_results (
+    id                    BIGSERIAL PRIMARY KEY,
+    hosting_provision_id  UUID NOT NULL,
+    -- internal: 本服务探测；其他为外部探测点标识（如 cn-shanghai-1）
+    source                VARCHAR(64) NOT NULL,
+    -- vless_tcp / ss_tcp / agent_health
+    check_name            VARCHAR(32) NOT NULL,
+    success               BOOLEAN NOT NULL,
+    latency_ms            INT NOT NULL DEFAULT 0,
+    error                 TEXT,
+    probed_at             TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_node_probe_results_provision ON fulfillment.node_probe_results(hosting_provision_id, probed_at DESC);
+CREATE INDEX idx_node_probe_results_probed_at ON fulfillment.node_probe_results(probed_at);
@@ -0,0 +1,25 @@
+-- 019: 不健康节点自动替换（auto-heal）
+-- 节点持续不可达（health_status = degraded 超过 AUTO_HEAL_UNHEALTHY_MINUTES）或 hosting-service 报告
+-- 已 active 的节点 failed 时，在同一区域创建替换节点（尽量沿用原密钥），切换 hosting_provisions 的
+-- hosting_node_id 后删除原实例。node_replacements 记录每次替换，同时用于熔断（每小时替换上限）。
+
+CREATE TABLE IF NOT EXISTS fulfillment.node_replacements (
+    id                    UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    hosting_provision_id  UUID NOT NULL,
+    user_id               VARCHAR(256) NOT NULL,
+    region                VARCHAR(64) NOT NULL,
+
+    old_node_id           VARCHAR(128) NOT NULL,
+    new_node_id           VARCHAR(128),
+    reason                VARCHAR(256) DEFAULT '',
+
+    -- in_progress / completed / failed
+    status                VARCHAR(32) NOT NULL DEFAULT 'in_progress',
+    error                 TEXT,
+
+    started_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at          TIMESTAMPTZ
+);
+
+CREATE INDEX idx_node_replacements_provision ON fulfillment.node_replacements(hosting_provision_id, started_at DESC);
+CREATE INDEX idx_node_replacements_started ON fulfillment.node_replacements(started_at);
@@ -0,0 +1,27 @@
+-- 020: 预创建节点池（warm pool）
+-- 按热门区域和套餐规格预先创建就绪、未分配的节点。用户创建节点时原子领取一个，
+-- 轮换凭据并转移归属后直接交付，省去数分钟的创建等待。WarmPoolScheduler 在后台按时段目标补充，
+-- 受节点总数和月度成本上限约束。池中节点不视为孤立节点。
+
+CREATE TABLE IF NOT EXISTS fulfillment.warm_nodes (
+    id                       UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    hosting_node_id          VARCHAR(128),
+    provider                 VARCHAR(32) NOT NULL,
+    region                   VARCHAR(64) NOT NULL,
+    bundle_id                VARCHAR(64) NOT NULL,
+
+    -- creating / ready / claimed / failed / deleted
+    status                   VARCHAR(32) NOT NULL DEFAULT 'creating',
+    error_message            TEXT,
+
+    claimed_by_provision_id  UUID,
+
+    created_at               TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ready_at                 TIMESTAMPTZ,
+    claimed_at               TIMESTAMPTZ,
+    deleted_at               TIMESTAMPTZ
+);
+
+CREATE INDEX idx_warm_nodes_pool ON fulfillment.warm_nodes(region, bundle_id, ready_at)
+    WHERE status = 'ready';
+CREATE INDEX idx_warm_nodes_node ON fulfillment.warm_nodes(hosting_node_id);
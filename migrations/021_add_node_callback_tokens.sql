@@ -0,0 +1,7 @@
+-- 021: 节点回调签名密钥
+-- 每个 hosting provision 创建时生成独立的 callback_token，随创建/领取/替换请求下发给节点 agent。
+-- /api/callback/node/* 使用该密钥对 "timestamp.body" 做 HMAC-SHA256 签名，只能为自己的 resource_id 回调。
+-- 旧版 agent 的共享 INTERNAL_SECRET 回调由 NODE_CALLBACK_LEGACY_AUTH 控制，升级完成后关闭。
+
+ALTER TABLE fulfillment.hosting_provisions
+    ADD COLUMN IF NOT EXISTS callback_token VARCHAR(128);
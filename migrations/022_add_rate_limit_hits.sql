@@ -0,0 +1,13 @@
+-- 022: 分布式速率限制（滑动窗口日志）
+-- 每次放行的请求记录一行，窗口内的行数即已用次数，多副本共享同一计数。
+-- key 形如 "<policy>:<user|ip|caller>:<id>"；同一 key 的检查通过 advisory lock 串行化。
+-- 过期记录在访问该 key 时删除，其余由限流器定期清理。
+
+CREATE TABLE IF NOT EXISTS fulfillment.rate_limit_hits (
+    id      BIGSERIAL PRIMARY KEY,
+    key     VARCHAR(255) NOT NULL,
+    hit_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_rate_limit_hits_key ON fulfillment.rate_limit_hits(key, hit_at);
+CREATE INDEX idx_rate_limit_hits_hit_at ON fulfillment.rate_limit_hits(hit_at);
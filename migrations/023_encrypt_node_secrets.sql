@@ -0,0 +1,12 @@
+-- 023: 节点凭据加密存储
+-- api_key / previous_api_key / callback_token 由应用层使用 AES-256-GCM 信封加密后保存，
+-- 格式为 "enc:v<主密钥版本>:<base64>"，长度超过原 VARCHAR 上限，改为 TEXT。
+-- 已有明文数据无需迁移：读取时兼容明文，SecretReencryptScheduler 在后台用当前主密钥重新加密。
+
+ALTER TABLE fulfillment.hosting_provisions
+    ALTER COLUMN api_key TYPE TEXT,
+    ALTER COLUMN previous_api_key TYPE TEXT,
+    ALTER COLUMN callback_token TYPE TEXT;
+
+ALTER TABLE fulfillment.node_snapshots
+    ALTER COLUMN api_key TYPE TEXT;
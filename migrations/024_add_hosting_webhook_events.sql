@@ -0,0 +1,10 @@
+-- 024: hosting-service webhook 事件去重
+-- hosting-service 按 event_id 重试推送，处理前先记录 event_id，重复的事件直接确认不再处理。
+-- 处理失败时删除记录，让下一次重试重新处理；超过保留期的记录由 CleanupScheduler 删除。
+
+CREATE TABLE IF NOT EXISTS fulfillment.hosting_webhook_events (
+    event_id     VARCHAR(128) PRIMARY KEY,
+    received_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_hosting_webhook_events_received_at ON fulfillment.hosting_webhook_events(received_at);
@@ -0,0 +1,10 @@
+-- 025: 待删除的云实例
+-- 创建未就绪且删除失败的节点按节点 id 记录在此，由 CleanupScheduler 重试删除。
+-- 之前的 hosting_provisions.needs_cleanup 只标记 provision，区域故障切换后 hosting_node_id 会被新节点覆盖，
+-- 清理时误删用户的新节点而泄漏失败的节点；该标记仅保留给升级前的记录。
+
+CREATE TABLE IF NOT EXISTS fulfillment.node_cleanups (
+    hosting_node_id       VARCHAR(128) PRIMARY KEY,
+    hosting_provision_id  UUID,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
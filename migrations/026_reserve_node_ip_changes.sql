@@ -0,0 +1,8 @@
+-- 026: IP 更换配额预留
+-- 用户更换 IP 前在同一事务中统计本月次数并插入 pending 记录（按用户加 advisory lock），
+-- 并发请求不能同时通过配额检查；hosting-service 更换成功后记录新 IP 并标记 completed，失败则删除预留。
+-- pending 记录计入配额，进程在更换途中退出时宁可多占一次也不超额。
+
+ALTER TABLE fulfillment.node_ip_changes
+    ALTER COLUMN new_ip DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'completed';
@@ -0,0 +1,17 @@
+-- 027: 流量周期重置幂等
+-- 周期边界先归档用量并推进周期（只有一次能成功），再清零 otun-manager 的 traffic_used。
+-- cycle_reset_pending 标记已推进但尚未清零的记录，清零失败时调度器下一轮只重试清零，
+-- 不会重复归档、重复结算加油包或清掉新周期的用量。
+
+ALTER TABLE fulfillment.vpn_provisions
+    ADD COLUMN IF NOT EXISTS cycle_reset_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 同一周期只归档一次
+DELETE FROM fulfillment.vpn_traffic_cycles a
+    USING fulfillment.vpn_traffic_cycles b
+    WHERE a.vpn_provision_id = b.vpn_provision_id
+      AND a.cycle_start = b.cycle_start
+      AND a.created_at > b.created_at;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_traffic_cycles_provision_start
+    ON fulfillment.vpn_traffic_cycles(vpn_provision_id, cycle_start);
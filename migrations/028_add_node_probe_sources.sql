@@ -0,0 +1,11 @@
+-- 028: 外部探测点按来源分别计数
+-- 之前所有外部探测点共用 external_probe_failures，一个探测点成功会清零其他探测点的连续失败。
+-- 现在每个探测点单独记录连续失败次数，external_probe_failures 为近期有上报的探测点中的最大值。
+
+CREATE TABLE IF NOT EXISTS fulfillment.node_probe_sources (
+    hosting_provision_id  UUID NOT NULL,
+    source                VARCHAR(64) NOT NULL,
+    failures              INT NOT NULL DEFAULT 0,
+    reported_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hosting_provision_id, source)
+);
@@ -0,0 +1,6 @@
+-- 029: hosting-service 报告的节点故障
+-- hosting-service 报告已交付节点 failed 时记录 hosting_failed_at，健康状态保持 degraded，
+-- 不会被随后的 TCP 探测成功覆盖为 healthy；节点恢复（不再出现在 failed 列表中）或被替换后清除。
+
+ALTER TABLE fulfillment.hosting_provisions
+    ADD COLUMN IF NOT EXISTS hosting_failed_at TIMESTAMPTZ;
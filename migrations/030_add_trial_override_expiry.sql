@@ -0,0 +1,10 @@
+-- 030: 试用复核结果的有效期
+-- 管理员复核（override）此前对该账号永久生效；override_expires_at 之后重新按评分评估。
+-- 已有的复核记录按复核时间起 30 天过期。
+
+ALTER TABLE fulfillment.trial_attempts
+    ADD COLUMN IF NOT EXISTS override_expires_at TIMESTAMPTZ;
+
+UPDATE fulfillment.trial_attempts
+SET override_expires_at = overridden_at + INTERVAL '30 days'
+WHERE override_decision IS NOT NULL AND override_expires_at IS NULL;